@@ -2,14 +2,22 @@ package command
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
 	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
 	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/metrics"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/state"
 	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
 )
 
@@ -18,8 +26,28 @@ var (
 	applyForce   bool
 	applyTarget  []string
 	applyExclude []string
+	applyOutput  string
+	applyState   string
+	applyResume  bool
+	applyReport  string
+	applyAudit   string
+	onlyErrors   bool
+	metricsFile  string
+	maskMode     string
+
+	checkCapabilities bool
+	checkAndSet       bool
+	concurrency       int
+	parallelFetch     int
+	noFetchCache      bool
+	failOnUnmanaged   bool
+	reportSources     bool
+	devDeterministic  string
 )
 
+// defaultConcurrency is the default number of secret blocks processed at once.
+const defaultConcurrency = 4
+
 var applyCmd = &cobra.Command{
 	Use:   "apply",
 	Short: "Apply secrets to Vault",
@@ -33,8 +61,13 @@ For each secret defined in the configuration:
 - Static values are used as-is
 
 Use --dry-run to see what changes would be made without applying them.
-Use --target to apply specific secrets by label.
-Use --exclude to skip specific secrets by label.`,
+Use --target to apply specific secrets by label or glob (e.g. prod-*).
+Use --exclude to skip specific secrets by label or glob. An exclude wins
+over a target matching the same secret.
+
+With --state-file, apply records which blocks it wrote successfully. After
+a partly failed run, --resume skips the blocks the previous run applied, as
+long as their configuration hasn't changed since.`,
 	Example: `  # Apply all secrets
   vsg apply --config config.hcl
 
@@ -51,9 +84,35 @@ Use --exclude to skip specific secrets by label.`,
   vsg apply --config config.hcl --target prod-app
   vsg apply --config config.hcl -t prod-app -t prod-db
 
+  # Every prod secret except the databases
+  vsg apply --config config.hcl --target 'prod-*' --exclude '*-db'
+
   # Apply all except specific secrets
   vsg apply --config config.hcl --exclude broken-secret
-  vsg apply --config config.hcl -e broken -e legacy`,
+  vsg apply --config config.hcl -e broken -e legacy
+
+  # Machine-readable result for CI
+  vsg apply --config config.hcl --output json
+
+  # Show only the length of values in CI logs
+  vsg apply --config config.hcl --mask length-only
+
+  # Print only what went wrong
+  vsg apply --config config.hcl --only-errors
+
+  # Resume a partly failed apply, skipping blocks already applied
+  vsg apply --config config.hcl --state-file .vsg-state.json
+  vsg apply --config config.hcl --state-file .vsg-state.json --resume
+
+  # Write Prometheus metrics for the node_exporter textfile collector
+  vsg apply --config config.hcl --metrics-file /var/lib/node_exporter/vsg.prom
+
+  # Keep an audit record of the run
+  vsg apply --config config.hcl --report report.json
+
+  # Record who applied each block, to a file or a webhook
+  vsg apply --config config.hcl --audit-log /var/log/vsg-audit.jsonl
+  vsg apply --config config.hcl --audit-log https://audit.example.com/vsg`,
 	RunE: runApply,
 }
 
@@ -62,45 +121,121 @@ func init() {
 
 	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "show what would be done without making changes")
 	applyCmd.Flags().BoolVar(&applyForce, "force", false, "force regeneration of generated secrets")
-	applyCmd.Flags().StringSliceVarP(&applyTarget, "target", "t", nil, "target specific secrets by label (comma-separated or repeated)")
-	applyCmd.Flags().StringSliceVarP(&applyExclude, "exclude", "e", nil, "exclude secrets by label (comma-separated or repeated)")
+	applyCmd.Flags().StringSliceVarP(&applyTarget, "target", "t", nil, "target specific secrets by label or glob (comma-separated or repeated)")
+	applyCmd.Flags().StringSliceVarP(&applyExclude, "exclude", "e", nil, "exclude secrets by label or glob (comma-separated or repeated)")
+	applyCmd.Flags().StringVarP(&applyOutput, "output", "o", "text", "output format: text, json")
+	applyCmd.Flags().StringVar(&maskMode, "mask", string(engine.MaskPartial), "how values are masked in the output: partial, full, length-only")
+	applyCmd.Flags().BoolVar(&onlyErrors, "only-errors", false, "print nothing but the errors of the run (not with --output json)")
+	applyCmd.Flags().StringVar(&applyReport, "report", "", "write a JSON record of the run (change counts and errors, no values) to this file")
+	applyCmd.Flags().StringVar(&applyAudit, "audit-log", "", "append a JSON line per block written, with the token's identity and no values, to this file or POST them to an http(s) URL")
+	applyCmd.Flags().StringVar(&metricsFile, "metrics-file", "", "write Prometheus textfile metrics to this path after the run")
+	applyCmd.Flags().StringVar(&applyState, "state-file", "", "record the blocks applied successfully in this local file")
+	applyCmd.Flags().BoolVar(&applyResume, "resume", false, "skip blocks the state file records as applied with an unchanged configuration")
+	applyCmd.Flags().IntVar(&concurrency, "concurrency", defaultConcurrency, "maximum number of secret blocks processed at once")
+	applyCmd.Flags().IntVar(&parallelFetch, "parallel-fetch", 0, "fetch up to this many json/yaml/raw sources at once before processing blocks (0 = fetch as needed)")
+	applyCmd.Flags().BoolVar(&noFetchCache, "no-fetch-cache", false, "fetch a source again for every value using it instead of once per run")
+	applyCmd.Flags().BoolVar(&failOnUnmanaged, "fail-on-unmanaged", false, "exit 4 if a secret holds keys the config doesn't manage")
+	applyCmd.Flags().StringVar(&devDeterministic, "dev-deterministic", "", "INSECURE, dev only: derive generate() values from this seed and each mount, path and key")
+	applyCmd.Flags().BoolVar(&reportSources, "report-sources", false, "list the source URLs fetched, with cache hits and sizes, after the run")
+	applyCmd.Flags().BoolVar(&checkCapabilities, "check-capabilities", false, "verify the token can read and write every targeted path before processing")
+	applyCmd.Flags().BoolVar(&checkAndSet, "cas", false, "write KV v2 secrets with check-and-set, failing a block changed since it was read")
+
+	registerBlockCompletion(applyCmd)
 }
 
 func runApply(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 	log := getLogger()
 
+	if applyOutput != "text" && applyOutput != "json" {
+		return fmt.Errorf("unknown output format: %s (use 'text' or 'json')", applyOutput)
+	}
+	if applyResume && applyState == "" {
+		return fmt.Errorf("--resume requires --state-file")
+	}
+	if onlyErrors && applyOutput == "json" {
+		return fmt.Errorf("--only-errors can't be used with --output json")
+	}
+	mask, err := engine.ParseMaskMode(maskMode)
+	if err != nil {
+		return err
+	}
+	seed, err := deterministicSeed(cmd)
+	if err != nil {
+		return err
+	}
+
 	// Load config
-	cfgPath, err := getConfigFile()
+	cfgPaths, err := getConfigFiles()
 	if err != nil {
 		return err
 	}
 
-	log.Debug("loading config", "path", cfgPath)
+	log.Debug("loading config", "paths", cfgPaths)
 
-	vars := parseVars()
-	cfg, err := config.Load(cfgPath, vars)
+	cfg, err := loadConfig(ctx, cfgPaths)
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
 	}
 
+	// Load the state of previous runs, and the hashes this run records
+	var st *state.State
+	var hashes map[string]string
+	exclude := applyExclude
+	if applyState != "" {
+		st, err = state.Load(applyState)
+		if err != nil {
+			return err
+		}
+		hashes, err = blockHashes(cfg)
+		if err != nil {
+			return err
+		}
+		if applyResume {
+			skipped := resumeSkips(st, hashes)
+			if len(skipped) > 0 {
+				fmt.Fprintf(stderr, "Resuming: skipping %d blocks applied by a previous run: %s\n", len(skipped), strings.Join(skipped, ", "))
+			}
+			exclude = slices.Clone(exclude)
+			for _, name := range skipped {
+				// Excludes are glob patterns; a skipped label must only match itself
+				exclude = append(exclude, globEscape(name))
+			}
+		}
+	}
+
 	// Create Vault client
 	log.Debug("connecting to vault", "address", cfg.Vault.Address)
 
-	vaultClient, err := vault.NewClient(cfg.Vault)
+	vaultClient, err := vault.NewClient(cfg.Vault, vaultOptions()...)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error: failed to connect to Vault:", err)
-		os.Exit(ExitVaultError)
+		fmt.Fprintln(stderr, "Error: failed to connect to Vault:", err)
+		return &exitError{Code: ExitVaultError}
 	}
+	defer vaultClient.Close()
 
 	// Check Vault health
 	if err := vaultClient.CheckHealth(ctx); err != nil {
-		fmt.Fprintln(os.Stderr, "Error: Vault health check failed:", err)
-		os.Exit(ExitVaultError)
+		fmt.Fprintln(stderr, "Error: Vault health check failed:", err)
+		return &exitError{Code: ExitVaultError}
+	}
+
+	// Look up who is applying before anything is written, so an apply
+	// that can't be audited changes nothing
+	var audit *auditLog
+	if applyAudit != "" && !applyDryRun {
+		audit, err = openAuditLog(ctx, applyAudit, vaultClient, vaultClient.Address())
+		if err != nil {
+			fmt.Fprintln(stderr, "Error:", err)
+			return &exitError{Code: ExitVaultError}
+		}
+		defer audit.Close()
 	}
 
 	// Set up fetchers
 	registry := setupFetchers(ctx)
+	//nolint:errcheck // Best effort close on defer
+	defer registry.Close()
 
 	// Create engine
 	eng := engine.NewEngine(vaultClient, registry, cfg.Defaults, log)
@@ -110,51 +245,310 @@ func runApply(cmd *cobra.Command, args []string) error {
 		DryRun:  applyDryRun,
 		Force:   applyForce,
 		Target:  applyTarget,
-		Exclude: applyExclude,
+		Exclude: exclude,
+
+		CheckCapabilities: checkCapabilities,
+		CheckAndSet:       checkAndSet,
+		Concurrency:       concurrency,
+		ParallelFetch:     parallelFetch,
+		CommandTimeout:    commandTimeout,
+
+		DevDeterministicSeed: seed,
 	}
 
+	start := time.Now()
 	result, err := eng.Reconcile(ctx, cfg, opts)
+	if errors.Is(err, engine.ErrMissingCapabilities) {
+		fmt.Fprintln(stderr, "Error:", err)
+		return &exitError{Code: ExitVaultError}
+	}
 	if err != nil {
 		return err
 	}
+	result.Diff.Mask = mask
+
+	// The audit records go out first, so nothing that fails later in the
+	// run can leave the writes unrecorded. A failure is reported, but the
+	// state, output and report still follow, since Vault already changed.
+	var auditErr error
+	if audit != nil {
+		if auditErr = audit.Write(ctx, result, cfgPaths, time.Now()); auditErr != nil {
+			fmt.Fprintln(stderr, "Error:", auditErr)
+		}
+	}
+
+	if st != nil && !applyDryRun {
+		st.Record(result, hashes, time.Now())
+		if err := st.Save(applyState); err != nil {
+			return err
+		}
+	}
+
+	end := time.Now()
+	writeMetrics(metrics.Run{
+		Command: "apply",
+		Result:  result,
+		DryRun:  applyDryRun,
+		Start:   start,
+		End:     end,
+	})
+
+	if onlyErrors {
+		writeApplyErrors(stderr, result.Errors)
+	} else if err := printApplyResult(stdout, stderr, result, applyOutput, applyDryRun); err != nil {
+		return err
+	}
+	if reportSources {
+		writeSourceReport(stderr, registry.Stats())
+	}
+
+	// The report records partial failures too, so it's written before
+	// the exit code is decided
+	if applyReport != "" {
+		if err := writeRunReport(applyReport, newRunReport(result, cfgPaths, applyDryRun, end)); err != nil {
+			return err
+		}
+	}
+	if len(result.Errors) > 0 {
+		return &exitError{Code: classifyErrors(result.Errors)}
+	}
+	if auditErr != nil {
+		// Already reported; the secrets were written, the record wasn't
+		return &exitError{Code: ExitPartialFailure}
+	}
+	if reportUnmanaged(result.Diff) {
+		return &exitError{Code: ExitPartialFailure}
+	}
+
+	return nil
+}
+
+// reportUnmanaged lists the unmanaged keys of the diff on stderr if
+// --fail-on-unmanaged is set, and reports whether there were any, which
+// fails the run.
+func reportUnmanaged(diff *engine.Diff) bool {
+	if !failOnUnmanaged {
+		return false
+	}
+	keys := unmanagedKeys(diff)
+	if len(keys) == 0 {
+		return false
+	}
+	fmt.Fprintf(stderr, "\nUnmanaged keys: in Vault but not in the config: %s\n", strings.Join(keys, ", "))
+	return true
+}
+
+// unmanagedKeys returns the keys in Vault that the config doesn't manage,
+// as block/key in diff order. Keys matched by ignore_keys are left out,
+// since they are unmanaged on purpose.
+func unmanagedKeys(diff *engine.Diff) []string {
+	var keys []string
+	for _, block := range diff.Blocks {
+		for _, change := range block.Changes {
+			if change.Change == engine.ChangeUnmanaged && !change.Ignored {
+				keys = append(keys, block.Name+"/"+change.Key)
+			}
+		}
+	}
+	return keys
+}
+
+// classifyErrors returns the exit code of a run that failed with errs:
+// ExitFetchError when every error is a source that couldn't be fetched, so
+// CI can tell a missing file from a rejected write, ExitVaultError when
+// every error is a failed Vault read or write, and ExitPartialFailure
+// otherwise.
+func classifyErrors(errs []engine.BlockError) int {
+	if len(errs) == 0 {
+		return ExitSuccess
+	}
+
+	code := exitCode(errs[0].Err)
+	for _, e := range errs[1:] {
+		if exitCode(e.Err) != code {
+			return ExitPartialFailure
+		}
+	}
+	if code == ExitConfigError {
+		return ExitPartialFailure
+	}
+	return code
+}
+
+// blockHashes returns the state hash of every block in the config.
+func blockHashes(cfg *config.Config) (map[string]string, error) {
+	hashes := make(map[string]string, len(cfg.Secrets))
+	for name, block := range cfg.Secrets {
+		hash, err := state.BlockHash(block, cfg.Defaults)
+		if err != nil {
+			return nil, err
+		}
+		hashes[name] = hash
+	}
+	return hashes, nil
+}
+
+// resumeSkips returns the blocks a resumed apply skips, in sorted order:
+// those the state records as applied with the same configuration.
+func resumeSkips(st *state.State, hashes map[string]string) []string {
+	var skipped []string
+	for name, hash := range hashes {
+		if st.Applied(name, hash) {
+			skipped = append(skipped, name)
+		}
+	}
+	sort.Strings(skipped)
+	return skipped
+}
+
+// globEscape escapes the path.Match metacharacters in s, so the pattern
+// matches s only.
+func globEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`).Replace(s)
+}
+
+// applyJSONResult is the --output json form of an apply run.
+type applyJSONResult struct {
+	Diff    json.RawMessage  `json:"diff"`
+	Applied bool             `json:"applied"`
+	DryRun  bool             `json:"dry_run"`
+	Errors  []applyJSONError `json:"errors"`
+}
+
+type applyJSONError struct {
+	Block string   `json:"block"`
+	Key   string   `json:"key,omitempty"`
+	Keys  []string `json:"keys,omitempty"`
+	Error string   `json:"error"`
+}
+
+// printApplyResult writes the result of an apply run in the given format.
+// In text mode errors go to errOut; in json mode they are part of the
+// document written to out.
+func printApplyResult(out, errOut io.Writer, result *engine.Result, format string, dryRun bool) error {
+	if format == "json" {
+		diff, err := result.Diff.ToJSON()
+		if err != nil {
+			return fmt.Errorf("formatting JSON: %w", err)
+		}
+
+		doc := applyJSONResult{
+			Diff:    json.RawMessage(diff),
+			Applied: result.Applied,
+			DryRun:  dryRun,
+			Errors:  make([]applyJSONError, 0, len(result.Errors)),
+		}
+		for _, e := range result.Errors {
+			var keys []string
+			for _, k := range e.Keys {
+				keys = append(keys, k.String())
+			}
+			doc.Errors = append(doc.Errors, applyJSONError{Block: e.Block, Key: e.Key, Keys: keys, Error: e.Err.Error()})
+		}
+
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return fmt.Errorf("formatting JSON: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
 
 	// Print diff
 	if result.Diff.HasChanges() || verbose {
-		fmt.Println(engine.FormatDiff(result.Diff))
+		fmt.Fprintln(out, engine.FormatDiff(result.Diff, engine.FormatOptions{}))
 	} else {
-		fmt.Println("No changes required.")
+		fmt.Fprintln(out, "No changes required.")
 	}
 
 	// Handle errors
 	if len(result.Errors) > 0 {
-		fmt.Fprintln(os.Stderr, "\nErrors:")
-		for _, e := range result.Errors {
-			fmt.Fprintln(os.Stderr, " -", e.Error())
-		}
-		os.Exit(ExitPartialFailure)
+		writeApplyErrors(errOut, result.Errors)
+		return nil
 	}
 
 	// Report result
-	if applyDryRun {
+	if dryRun {
 		adds, updates, deletes, _, _ := result.Diff.Summary()
 		changes := adds + updates + deletes
 		if changes > 0 {
-			fmt.Printf("\nDry-run complete. %d changes would be made.\n", changes)
+			fmt.Fprintf(out, "\nDry-run complete. %d changes would be made.\n", changes)
 		}
 	} else if result.Applied {
-		fmt.Println("\nSecrets applied successfully.")
+		fmt.Fprintln(out, "\nSecrets applied successfully.")
 	}
 
 	return nil
 }
 
+// writeApplyErrors writes the errors of a run, if any, as a list. It is the
+// only output of --only-errors.
+func writeApplyErrors(w io.Writer, errs []engine.BlockError) {
+	if len(errs) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nErrors:")
+	for _, e := range errs {
+		fmt.Fprintln(w, " -", e.Error())
+	}
+}
+
+// writeMetrics writes run metrics if --metrics-file is set.
+// Failures are logged but never fail the run.
+func writeMetrics(run metrics.Run) {
+	if metricsFile == "" {
+		return
+	}
+
+	if err := metrics.WriteFile(metricsFile, run); err != nil {
+		getLogger().Warn("failed to write metrics file", "path", metricsFile, "error", err)
+	}
+}
+
+// deterministicSeed returns the --dev-deterministic seed, warning on stderr
+// that the generated values it gives are predictable.
+func deterministicSeed(cmd *cobra.Command) (string, error) {
+	if !cmd.Flags().Changed("dev-deterministic") {
+		return "", nil
+	}
+	if devDeterministic == "" {
+		return "", fmt.Errorf("--dev-deterministic requires a non-empty seed")
+	}
+	fmt.Fprintln(stderr, "WARNING: --dev-deterministic derives generated values from the seed. They are not secret from anyone who knows it. Use it only for throwaway dev environments.")
+	return devDeterministic, nil
+}
+
+// writeSourceReport lists every source URL requested during the run with
+// how it was accessed, for --report-sources. Contents are never shown.
+func writeSourceReport(w io.Writer, stats []fetcher.SourceStats) {
+	fmt.Fprintln(w, "\nSources:")
+	if len(stats) == 0 {
+		fmt.Fprintln(w, "  (none fetched)")
+		return
+	}
+	for _, s := range stats {
+		fmt.Fprintf(w, "  %s: %d fetched, %d from cache, %d failed, %d bytes\n", s.URL, s.Fetches, s.CacheHits, s.Failures, s.Size)
+	}
+}
+
 // setupFetchers creates and configures the fetcher registry
 func setupFetchers(ctx context.Context) *fetcher.Registry {
 	registry := fetcher.NewRegistry()
+	registry.SetMaxSize(maxFetchSize)
+	if noFetchCache {
+		registry.DisableCache()
+	}
 
 	// Local file fetcher
 	registry.Register(fetcher.NewLocalFetcher())
 
+	// Azure Blob Storage fetcher, ahead of the HTTP(S) fetcher so that
+	// https://<account>.blob.core.windows.net URLs are authenticated
+	registry.Register(fetcher.NewAzureBlobFetcher())
+
+	// HTTP(S) fetcher
+	registry.Register(fetcher.NewHTTPFetcher())
+
 	// S3 fetcher (optional - only if we might need it)
 	s3Fetcher, err := fetcher.NewS3Fetcher(ctx)
 	if err != nil {
@@ -164,5 +558,13 @@ func setupFetchers(ctx context.Context) *fetcher.Registry {
 		registry.Register(s3Fetcher)
 	}
 
+	// GCS fetcher (optional - only if we might need it)
+	gcsFetcher, err := fetcher.NewGCSFetcher(ctx)
+	if err != nil {
+		getLogger().Debug("GCS fetcher not available", "error", err)
+	} else {
+		registry.Register(gcsFetcher)
+	}
+
 	return registry
 }
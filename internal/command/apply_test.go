@@ -0,0 +1,321 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/state"
+)
+
+func testApplyResult() *engine.Result {
+	return &engine.Result{
+		Diff: &engine.Diff{
+			Blocks: []engine.BlockDiff{
+				{
+					Name:  "app",
+					Mount: "secret",
+					Path:  "app",
+					Changes: []engine.SecretChange{
+						{Key: "password", Change: engine.ChangeAdd, NewValue: "super-secret"},
+						{Key: "host", Change: engine.ChangeUpdate, OldValue: "old-host", NewValue: "new-host"},
+					},
+				},
+			},
+		},
+		Errors:  []engine.BlockError{{Block: "db", Key: "password", Err: errors.New("fetch failed")}},
+		Applied: true,
+	}
+}
+
+func TestPrintApplyResult_JSON(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if err := printApplyResult(&out, &errOut, testApplyResult(), "json", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if errOut.Len() != 0 {
+		t.Errorf("expected nothing on stderr in json mode, got %q", errOut.String())
+	}
+
+	var doc struct {
+		Diff struct {
+			Blocks []struct {
+				Name    string `json:"name"`
+				Changes []struct {
+					Key      string `json:"key"`
+					Change   string `json:"change"`
+					NewValue string `json:"new_value"`
+				} `json:"changes"`
+			} `json:"blocks"`
+		} `json:"diff"`
+		Applied bool `json:"applied"`
+		DryRun  bool `json:"dry_run"`
+		Errors  []struct {
+			Block string `json:"block"`
+			Key   string `json:"key"`
+			Error string `json:"error"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out.String())
+	}
+
+	if !doc.Applied || doc.DryRun {
+		t.Errorf("applied = %v, dry_run = %v", doc.Applied, doc.DryRun)
+	}
+	if len(doc.Diff.Blocks) != 1 || len(doc.Diff.Blocks[0].Changes) != 2 {
+		t.Fatalf("unexpected diff: %+v", doc.Diff)
+	}
+	if c := doc.Diff.Blocks[0].Changes[0]; c.Key != "password" || c.Change != "add" || c.NewValue != "su********et" {
+		t.Errorf("unexpected change: %+v", c)
+	}
+	if len(doc.Errors) != 1 || doc.Errors[0].Block != "db" || doc.Errors[0].Key != "password" || doc.Errors[0].Error != "fetch failed" {
+		t.Errorf("unexpected errors: %+v", doc.Errors)
+	}
+
+	// Raw values must never appear
+	for _, secret := range []string{"super-secret", "old-host", "new-host"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("json output contains %q", secret)
+		}
+	}
+}
+
+func TestPrintApplyResult_JSONNoErrors(t *testing.T) {
+	result := testApplyResult()
+	result.Errors = nil
+
+	var out, errOut bytes.Buffer
+	if err := printApplyResult(&out, &errOut, result, "json", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// An empty array, not null, so consumers can iterate unconditionally
+	if !strings.Contains(out.String(), `"errors": []`) {
+		t.Errorf("expected an empty errors array, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `"dry_run": true`) {
+		t.Errorf("expected dry_run to be set, got:\n%s", out.String())
+	}
+}
+
+func TestResumeSkips(t *testing.T) {
+	st := &state.State{Blocks: map[string]state.Block{
+		"app":   {Hash: "h-app"},
+		"db":    {Hash: "h-db-old"},
+		"cache": {Hash: "h-cache"},
+	}}
+	hashes := map[string]string{"app": "h-app", "db": "h-db", "cache": "h-cache", "new": "h-new"}
+
+	// db changed since it was applied and new never was
+	skipped := resumeSkips(st, hashes)
+	if !slices.Equal(skipped, []string{"app", "cache"}) {
+		t.Errorf("resumeSkips() = %v, want [app cache]", skipped)
+	}
+}
+
+func TestWriteSourceReport(t *testing.T) {
+	var buf bytes.Buffer
+	writeSourceReport(&buf, []fetcher.SourceStats{
+		{URL: "s3://bucket/db.json", Fetches: 1, CacheHits: 3, Size: 512},
+		{URL: "s3://bucket/missing.json", Failures: 2},
+	})
+
+	expected := "\nSources:\n" +
+		"  s3://bucket/db.json: 1 fetched, 3 from cache, 0 failed, 512 bytes\n" +
+		"  s3://bucket/missing.json: 0 fetched, 0 from cache, 2 failed, 0 bytes\n"
+	if buf.String() != expected {
+		t.Errorf("report = %q, want %q", buf.String(), expected)
+	}
+
+	buf.Reset()
+	writeSourceReport(&buf, nil)
+	if !strings.Contains(buf.String(), "(none fetched)") {
+		t.Errorf("expected an empty report to say so, got %q", buf.String())
+	}
+}
+
+func TestGlobEscape(t *testing.T) {
+	for _, name := range []string{"prod-app", "app[billing]", "a*b?c", `back\\slash`} {
+		pattern := globEscape(name)
+		if !engine.MatchLabel([]string{pattern}, name) {
+			t.Errorf("%q: escaped pattern %q doesn't match it", name, pattern)
+		}
+	}
+	if engine.MatchLabel([]string{globEscape("app[billing]")}, "appl") {
+		t.Error("escaped app[billing] must not match appl")
+	}
+}
+
+func TestWriteApplyErrors(t *testing.T) {
+	// A clean run prints nothing at all
+	var out bytes.Buffer
+	writeApplyErrors(&out, nil)
+	if out.Len() != 0 {
+		t.Errorf("expected no output for a clean run, got %q", out.String())
+	}
+
+	writeApplyErrors(&out, testApplyResult().Errors)
+	if out.String() != "\nErrors:\n - db/password: fetch failed\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestApply_OnlyErrors(t *testing.T) {
+	store := &fakeKV{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/sys/health" {
+			_, _ = w.Write([]byte(`{"initialized": true, "sealed": false}`))
+			return
+		}
+		store.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "vsg.hcl")
+	hcl := fmt.Sprintf(`
+vault {
+  address = %q
+  auth {
+    method = "token"
+  }
+}
+
+secret "app" {
+  path    = "app"
+  version = 2
+
+  content {
+    host = "db.internal"
+    cert = raw("file://%s/missing.pem")
+  }
+}
+`, server.URL, dir)
+	if err := os.WriteFile(cfgPath, []byte(hcl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	origOut, origErr := stdout, stderr
+	stdout, stderr = &out, &errOut
+	t.Cleanup(func() {
+		stdout, stderr = origOut, origErr
+		onlyErrors = false
+		configFiles = nil
+		logger = nil
+	})
+
+	rootCmd.SetArgs([]string{"apply", "--config", cfgPath, "--only-errors"})
+	err := rootCmd.ExecuteContext(context.Background())
+
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.Code != ExitFetchError {
+		t.Fatalf("expected exit %d, got %v", ExitFetchError, err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected nothing on stdout, got %q", out.String())
+	}
+	if !strings.Contains(errOut.String(), "\nErrors:\n - app/cert: fetching file://"+dir+"/missing.pem") {
+		t.Errorf("expected the errors on stderr, got %q", errOut.String())
+	}
+	if strings.Contains(errOut.String(), "db.internal") {
+		t.Errorf("expected no diff on stderr, got %q", errOut.String())
+	}
+}
+
+func TestClassifyErrors(t *testing.T) {
+	fetchErr := engine.BlockError{Block: "app", Key: "db_host", Err: &engine.FetchError{URL: "s3://bucket/state.json", Err: errors.New("NoSuchKey")}}
+	wrappedFetchErr := engine.BlockError{Block: "app", Key: "config", Err: fmt.Errorf("map_from(%q): %w", "s3://bucket/app.json", &engine.FetchError{URL: "s3://bucket/app.json", Err: errors.New("access denied")})}
+	vaultErr := engine.BlockError{Block: "db", Err: &engine.VaultError{Op: "writing to vault", Err: errors.New("permission denied")}}
+	resolveErr := engine.BlockError{Block: "db", Key: "token", Err: &engine.ResolveError{Type: config.ValueTypeCommand, Err: errors.New("exit status 1")}}
+
+	tests := []struct {
+		name     string
+		errs     []engine.BlockError
+		expected int
+	}{
+		{"none", nil, ExitSuccess},
+		{"fetch only", []engine.BlockError{fetchErr, wrappedFetchErr}, ExitFetchError},
+		{"vault only", []engine.BlockError{vaultErr}, ExitVaultError},
+		{"resolve only", []engine.BlockError{resolveErr}, ExitPartialFailure},
+		{"mixed", []engine.BlockError{fetchErr, vaultErr}, ExitPartialFailure},
+		{"fetch and resolve", []engine.BlockError{fetchErr, resolveErr}, ExitPartialFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyErrors(tt.errs); got != tt.expected {
+				t.Errorf("classifyErrors() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"config", fmt.Errorf("loading config: %w", &config.ConfigError{Err: errors.New("parsing HCL")}), ExitConfigError},
+		{"vault", &engine.VaultError{Op: "reading current secrets", Err: errors.New("permission denied")}, ExitVaultError},
+		{"fetch", &engine.ResolveError{Type: config.ValueTypeJSON, Err: &engine.FetchError{URL: "s3://bucket/app.json", Err: errors.New("NoSuchKey")}}, ExitFetchError},
+		{"untyped", errors.New("invalid --mask"), ExitConfigError},
+		{"reported", fmt.Errorf("apply: %w", &exitError{Code: ExitDrift}), ExitDrift},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.expected {
+				t.Errorf("exitCode() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUnmanagedKeys(t *testing.T) {
+	diff := &engine.Diff{
+		Blocks: []engine.BlockDiff{
+			{
+				Name: "app",
+				Changes: []engine.SecretChange{
+					{Key: "password", Change: engine.ChangeNone},
+					{Key: "legacy_token", Change: engine.ChangeUnmanaged},
+					{Key: "rotated_by", Change: engine.ChangeUnmanaged, Ignored: true},
+				},
+			},
+			{
+				Name: "db",
+				Changes: []engine.SecretChange{
+					{Key: "host", Change: engine.ChangeUpdate},
+					{Key: "old_host", Change: engine.ChangeDelete},
+					{Key: "debug", Change: engine.ChangeUnmanaged},
+				},
+			},
+		},
+	}
+
+	expected := []string{"app/legacy_token", "db/debug"}
+	if got := unmanagedKeys(diff); !slices.Equal(got, expected) {
+		t.Errorf("unmanagedKeys() = %v, want %v", got, expected)
+	}
+
+	if got := unmanagedKeys(testApplyResult().Diff); got != nil {
+		t.Errorf("expected no unmanaged keys, got %v", got)
+	}
+}
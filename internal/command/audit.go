@@ -0,0 +1,236 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
+)
+
+// auditWebhookTimeout bounds each attempt to post the records to an
+// --audit-log URL, and auditWebhookAttempts is how many attempts are made
+// on connection errors, 429 and 5xx responses.
+const (
+	auditWebhookTimeout  = 30 * time.Second
+	auditWebhookAttempts = 3
+)
+
+// auditWebhookRetryDelay is the delay before the first retry of a post,
+// doubled after each attempt. A var so tests can shorten it.
+var auditWebhookRetryDelay = time.Second
+
+// AuditRecord is the line --audit-log writes for each block an apply
+// wrote to, or tried to: who wrote it, when, from which config, and the
+// keys changed. It never holds values, masked or not.
+type AuditRecord struct {
+	Timestamp time.Time        `json:"timestamp"`
+	Config    []string         `json:"config"`
+	Vault     string           `json:"vault"`
+	Identity  *vault.TokenInfo `json:"identity"`
+	Block     string           `json:"block"`
+	Path      string           `json:"path"`
+
+	// Status is "applied" once the block's keys, or its metadata when no
+	// key changed, are written to Vault, or "failed" if they weren't
+	Status  string        `json:"status"`
+	Version int           `json:"version,omitempty"`
+	Changes []AuditChange `json:"changes"`
+
+	// Metadata is set when the custom metadata was written
+	Metadata bool     `json:"metadata,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// AuditChange is one key of an AuditRecord.
+type AuditChange struct {
+	Key    string            `json:"key"`
+	Change engine.ChangeType `json:"change"`
+}
+
+// tokenLookup returns the identity of the Vault token, see
+// vault.Client.LookupSelf.
+type tokenLookup interface {
+	LookupSelf(ctx context.Context) (*vault.TokenInfo, error)
+}
+
+// auditLog writes audit records to a file, appending JSON lines, or posts
+// them to a webhook URL.
+type auditLog struct {
+	dest     string
+	file     *os.File
+	address  string
+	identity *vault.TokenInfo
+}
+
+// openAuditLog looks up the token identity and opens dest for the records
+// of the run. It runs before anything is written to Vault, so an apply
+// that can't be audited fails without changing anything.
+func openAuditLog(ctx context.Context, dest string, lookup tokenLookup, address string) (*auditLog, error) {
+	identity, err := lookup.LookupSelf(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+
+	audit := &auditLog{dest: dest, address: address, identity: identity}
+	if isWebhook(dest) {
+		return audit, nil
+	}
+
+	audit.file, err = os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	return audit, nil
+}
+
+func isWebhook(dest string) bool {
+	return strings.HasPrefix(dest, "http://") || strings.HasPrefix(dest, "https://")
+}
+
+// Close closes the audit log file, if any.
+func (l *auditLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Write records the blocks of result that the apply wrote to. Nothing is
+// written when no block changed.
+func (l *auditLog) Write(ctx context.Context, result *engine.Result, cfgPaths []string, at time.Time) error {
+	records := newAuditRecords(result, cfgPaths, l.address, l.identity, at)
+	if len(records) == 0 {
+		return nil
+	}
+
+	// Errors are redacted like any other output, since they may quote
+	// source content
+	var buf bytes.Buffer
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("formatting audit record: %w", err)
+		}
+		buf.WriteString(redactor.String(string(data)))
+		buf.WriteByte('\n')
+	}
+
+	if l.file != nil {
+		if _, err := l.file.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("writing audit log: %w", err)
+		}
+		return nil
+	}
+	return postAuditRecords(ctx, l.dest, buf.Bytes())
+}
+
+// postAuditRecords posts the JSON lines of the records to url in one
+// request, retrying connection errors, 429 and 5xx responses.
+func postAuditRecords(ctx context.Context, url string, body []byte) error {
+	client := &http.Client{Timeout: auditWebhookTimeout}
+	delay := auditWebhookRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		retry, err := postAuditAttempt(ctx, client, url, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= auditWebhookAttempts {
+			return fmt.Errorf("posting audit log: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("posting audit log: %w", err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// postAuditAttempt makes one post of the records, reporting whether a
+// failure is worth retrying.
+func postAuditAttempt(ctx context.Context, client *http.Client, url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	//nolint:errcheck // Best effort drain and close
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return false, nil
+}
+
+// newAuditRecords builds a record for each block of result with keys or
+// metadata to write, in the diff's order. The status comes from what the
+// apply reports it wrote, so a block that failed before its write is
+// failed and one that failed after it, such as deleting the replaced
+// version, is applied. Every error of the block is listed either way.
+func newAuditRecords(result *engine.Result, cfgPaths []string, address string, identity *vault.TokenInfo, at time.Time) []AuditRecord {
+	blockErrors := make(map[string][]string)
+	for _, e := range result.Errors {
+		for _, name := range e.Blocks() {
+			blockErrors[name] = append(blockErrors[name], e.Error())
+		}
+	}
+
+	var records []AuditRecord
+	for _, block := range result.Diff.Blocks {
+		var changes []AuditChange
+		for _, change := range block.Changes {
+			switch change.Change {
+			case engine.ChangeAdd, engine.ChangeUpdate, engine.ChangeDelete:
+				changes = append(changes, AuditChange{Key: change.Key, Change: change.Change})
+			}
+		}
+		if len(changes) == 0 && block.Metadata == nil {
+			continue
+		}
+
+		write := result.Writes[block.Name]
+		record := AuditRecord{
+			Timestamp: at.UTC(),
+			Config:    cfgPaths,
+			Vault:     address,
+			Identity:  identity,
+			Block:     block.Name,
+			Path:      block.FullPath(),
+			Status:    "applied",
+			Changes:   changes,
+			Metadata:  write.Metadata,
+			Errors:    blockErrors[block.Name],
+		}
+		if write.Data {
+			record.Version = block.NextVersion
+		}
+		if (len(changes) > 0 && !write.Data) || (len(changes) == 0 && !write.Metadata) {
+			record.Status = "failed"
+		}
+		if record.Changes == nil {
+			record.Changes = []AuditChange{}
+		}
+		records = append(records, record)
+	}
+	return records
+}
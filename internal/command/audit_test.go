@@ -0,0 +1,327 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
+)
+
+// fakeTokenLookup returns fixed token metadata, as lookup-self would.
+type fakeTokenLookup struct {
+	info *vault.TokenInfo
+	err  error
+}
+
+func (f *fakeTokenLookup) LookupSelf(ctx context.Context) (*vault.TokenInfo, error) {
+	return f.info, f.err
+}
+
+func testTokenLookup() *fakeTokenLookup {
+	return &fakeTokenLookup{info: &vault.TokenInfo{
+		DisplayName: "oidc-jane@example.com",
+		EntityID:    "7d2e3179-f69b-450c-7179-ac8ee8bd8ca9",
+		Accessor:    "acc-123",
+		Policies:    []string{"default", "vsg-writer"},
+	}}
+}
+
+// testAuditResult is an apply result with a block written, a block whose
+// write failed, and a block without changes.
+func testAuditResult() *engine.Result {
+	result := testApplyResult()
+	result.Diff.Blocks[0].NextVersion = 4
+	result.Diff.Blocks = append(result.Diff.Blocks,
+		engine.BlockDiff{Name: "db", Mount: "secret", Path: "db", NextVersion: 2, Changes: []engine.SecretChange{
+			{Key: "user", Change: engine.ChangeUpdate, OldValue: "old-user", NewValue: "new-user"},
+		}},
+		engine.BlockDiff{Name: "web", Mount: "secret", Path: "web", Changes: []engine.SecretChange{
+			{Key: "key", Change: engine.ChangeNone, OldValue: "tok", NewValue: "tok"},
+		}},
+	)
+	result.Errors = append(result.Errors, engine.BlockError{
+		Block: "db",
+		Err:   &engine.VaultError{Op: "writing secret", Err: errors.New("permission denied")},
+	})
+	result.Applied = false
+	result.Writes = map[string]engine.BlockWrite{"app": {Data: true}}
+	return result
+}
+
+func readAuditRecords(t *testing.T, data []byte) []AuditRecord {
+	t.Helper()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditLog_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	at := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	// Two runs append to the same file
+	for range 2 {
+		audit, err := openAuditLog(context.Background(), path, testTokenLookup(), "https://vault.example.com:8200")
+		if err != nil {
+			t.Fatalf("opening audit log: %v", err)
+		}
+		if err := audit.Write(context.Background(), testAuditResult(), []string{"config.hcl"}, at); err != nil {
+			t.Fatalf("writing audit log: %v", err)
+		}
+		audit.Close()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"super-secret", "old-host", "new-host", "old-user", "new-user", "tok\""} {
+		if strings.Contains(string(data), value) {
+			t.Errorf("audit log contains the value %q:\n%s", value, data)
+		}
+	}
+
+	records := readAuditRecords(t, data)
+	if len(records) != 4 {
+		t.Fatalf("expected 2 records per run, got %d:\n%s", len(records), data)
+	}
+
+	app := records[0]
+	if app.Block != "app" || app.Path != "secret/app" || app.Status != "applied" || app.Version != 4 {
+		t.Errorf("unexpected app record: %+v", app)
+	}
+	if app.Identity == nil || app.Identity.DisplayName != "oidc-jane@example.com" || app.Identity.EntityID != "7d2e3179-f69b-450c-7179-ac8ee8bd8ca9" {
+		t.Errorf("unexpected identity: %+v", app.Identity)
+	}
+	if !app.Timestamp.Equal(at) || app.Vault != "https://vault.example.com:8200" || len(app.Config) != 1 || app.Config[0] != "config.hcl" {
+		t.Errorf("unexpected run fields: %+v", app)
+	}
+	want := []AuditChange{{Key: "password", Change: engine.ChangeAdd}, {Key: "host", Change: engine.ChangeUpdate}}
+	if len(app.Changes) != 2 || app.Changes[0] != want[0] || app.Changes[1] != want[1] {
+		t.Errorf("changes = %+v, want %+v", app.Changes, want)
+	}
+
+	db := records[1]
+	if db.Block != "db" || db.Status != "failed" || db.Version != 0 {
+		t.Errorf("unexpected db record: %+v", db)
+	}
+	if len(db.Errors) != 2 {
+		t.Errorf("expected both db errors, got %q", db.Errors)
+	}
+}
+
+func TestNewAuditRecords_Status(t *testing.T) {
+	block := engine.BlockDiff{Name: "app", Mount: "secret", Path: "app", NextVersion: 4, Changes: []engine.SecretChange{
+		{Key: "password", Change: engine.ChangeUpdate},
+	}}
+
+	tests := []struct {
+		name        string
+		metadata    map[string]string
+		write       engine.BlockWrite
+		err         error
+		wantStatus  string
+		wantVersion int
+	}{
+		{
+			// Nothing reaches Vault, though the error is no VaultError
+			name:       "failed before the write",
+			err:        errors.New(`nesting keys: key "a/b" conflicts with key "a"`),
+			wantStatus: "failed",
+		},
+		{
+			name:        "failed after the write",
+			write:       engine.BlockWrite{Data: true},
+			err:         &engine.VaultError{Op: "deleting replaced version", Err: errors.New("permission denied")},
+			wantStatus:  "applied",
+			wantVersion: 4,
+		},
+		{
+			name:        "metadata failed after the write",
+			metadata:    map[string]string{"owner": "platform"},
+			write:       engine.BlockWrite{Data: true},
+			err:         &engine.VaultError{Op: "writing metadata", Err: errors.New("permission denied")},
+			wantStatus:  "applied",
+			wantVersion: 4,
+		},
+		{
+			name:        "written",
+			metadata:    map[string]string{"owner": "platform"},
+			write:       engine.BlockWrite{Data: true, Metadata: true},
+			wantStatus:  "applied",
+			wantVersion: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := block
+			block.Metadata = tt.metadata
+			result := &engine.Result{
+				Diff:   &engine.Diff{Blocks: []engine.BlockDiff{block}},
+				Writes: map[string]engine.BlockWrite{},
+			}
+			if tt.write != (engine.BlockWrite{}) {
+				result.Writes["app"] = tt.write
+			}
+			if tt.err != nil {
+				result.Errors = []engine.BlockError{{Block: "app", Err: tt.err}}
+			}
+
+			records := newAuditRecords(result, nil, "", nil, time.Now())
+			if len(records) != 1 {
+				t.Fatalf("expected 1 record, got %+v", records)
+			}
+			record := records[0]
+			if record.Status != tt.wantStatus || record.Version != tt.wantVersion {
+				t.Errorf("status = %q, version = %d, want %q, %d", record.Status, record.Version, tt.wantStatus, tt.wantVersion)
+			}
+			if record.Metadata != tt.write.Metadata {
+				t.Errorf("metadata = %v, want %v", record.Metadata, tt.write.Metadata)
+			}
+			if (tt.err != nil) != (len(record.Errors) == 1) {
+				t.Errorf("unexpected errors: %q", record.Errors)
+			}
+		})
+	}
+}
+
+func TestAuditLog_Webhook(t *testing.T) {
+	defer func(delay time.Duration) { auditWebhookRetryDelay = delay }(auditWebhookRetryDelay)
+	auditWebhookRetryDelay = time.Millisecond
+
+	var body []byte
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	audit, err := openAuditLog(context.Background(), server.URL, testTokenLookup(), "https://vault.example.com:8200")
+	if err != nil {
+		t.Fatalf("opening audit log: %v", err)
+	}
+	defer audit.Close()
+	if err := audit.Write(context.Background(), testAuditResult(), []string{"config.hcl"}, time.Now()); err != nil {
+		t.Fatalf("posting audit log: %v", err)
+	}
+
+	if contentType != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	if records := readAuditRecords(t, body); len(records) != 2 || records[0].Identity.Accessor != "acc-123" {
+		t.Errorf("unexpected records posted:\n%s", body)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	audit, err = openAuditLog(context.Background(), failing.URL, testTokenLookup(), "")
+	if err != nil {
+		t.Fatalf("opening audit log: %v", err)
+	}
+	err = audit.Write(context.Background(), testAuditResult(), nil, time.Now())
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected the status in the error, got %v", err)
+	}
+}
+
+func TestOpenAuditLog_LookupFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	lookup := &fakeTokenLookup{err: errors.New("looking up token: permission denied")}
+
+	if _, err := openAuditLog(context.Background(), path, lookup, ""); err == nil {
+		t.Fatal("expected an error when the token can't be looked up")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected no audit log to be created")
+	}
+}
+
+func TestAuditLog_NothingWritten(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := openAuditLog(context.Background(), path, testTokenLookup(), "")
+	if err != nil {
+		t.Fatalf("opening audit log: %v", err)
+	}
+	defer audit.Close()
+
+	result := &engine.Result{Diff: &engine.Diff{Blocks: []engine.BlockDiff{
+		{Name: "web", Changes: []engine.SecretChange{{Key: "key", Change: engine.ChangeNone}}},
+	}}}
+	if err := audit.Write(context.Background(), result, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("expected an empty audit log, got %v, %v", info, err)
+	}
+}
+
+func TestAuditLog_WebhookRetries(t *testing.T) {
+	defer func(delay time.Duration) { auditWebhookRetryDelay = delay }(auditWebhookRetryDelay)
+	auditWebhookRetryDelay = time.Millisecond
+
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantPosts int
+		wantErr   bool
+	}{
+		{"recovers", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, 3, false},
+		{"gives up", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, 3, true},
+		{"client error", []int{http.StatusBadRequest, http.StatusOK}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posts int
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+				w.WriteHeader(tt.statuses[posts])
+				posts++
+			}))
+			defer server.Close()
+
+			audit, err := openAuditLog(context.Background(), server.URL, testTokenLookup(), "")
+			if err != nil {
+				t.Fatalf("opening audit log: %v", err)
+			}
+			err = audit.Write(context.Background(), testAuditResult(), nil, time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if posts != tt.wantPosts {
+				t.Errorf("posts = %d, want %d", posts, tt.wantPosts)
+			}
+			for _, body := range bodies {
+				if body != bodies[0] || body == "" {
+					t.Errorf("expected every attempt to post the same records, got %q", bodies)
+				}
+			}
+		})
+	}
+}
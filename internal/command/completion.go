@@ -0,0 +1,93 @@
+package command
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Generate a shell completion script",
+	Long: `Completion prints a completion script for the given shell. Besides
+commands and flags, it completes --target and --exclude with the secret
+block names of the config given by --config, --config-dir, or VSG_CONFIG.`,
+	Example: `  # Bash, for the current shell
+  source <(vsg completion bash)
+
+  # Zsh, installed for every new shell
+  vsg completion zsh > "${fpath[1]}/_vsg"
+
+  # Fish
+  vsg completion fish > ~/.config/fish/completions/vsg.fish
+
+  # PowerShell
+  vsg completion powershell | Out-String | Invoke-Expression`,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	DisableFlagsInUseLine: true,
+	RunE:                  runCompletion,
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
+
+func runCompletion(cmd *cobra.Command, args []string) error {
+	switch args[0] {
+	case "bash":
+		return rootCmd.GenBashCompletionV2(stdout, true)
+	case "zsh":
+		return rootCmd.GenZshCompletion(stdout)
+	case "fish":
+		return rootCmd.GenFishCompletion(stdout, true)
+	case "powershell":
+		return rootCmd.GenPowerShellCompletionWithDesc(stdout)
+	default:
+		return fmt.Errorf("unknown shell: %s (use 'bash', 'zsh', 'fish' or 'powershell')", args[0])
+	}
+}
+
+// registerBlockCompletion completes the --target and --exclude flags of cmd
+// with secret block names. Call it after the flags are defined.
+func registerBlockCompletion(cmd *cobra.Command) {
+	for _, flag := range []string{"target", "exclude"} {
+		if err := cmd.RegisterFlagCompletionFunc(flag, completeBlockNames); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// completeBlockNames returns the secret block names of the config starting
+// with toComplete. Both flags take comma-separated lists, so only the text
+// after the last comma is completed. Without a loadable config there is
+// nothing to offer.
+func completeBlockNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfgPaths, err := getConfigFiles()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	// Vault isn't contacted while completing, so --var-from-vault is ignored
+	cfg, err := config.LoadFilesWithBase(getBaseDefaults(), cfgPaths, parseVars())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix, toComplete = toComplete[:i+1], toComplete[i+1:]
+	}
+
+	var names []string
+	for name := range cfg.Secrets {
+		if strings.HasPrefix(name, toComplete) {
+			names = append(names, prefix+name)
+		}
+	}
+	slices.Sort(names)
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
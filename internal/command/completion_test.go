@@ -0,0 +1,69 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCompleteBlockNames(t *testing.T) {
+	hcl := `
+secret "app-db" {
+  path = "app/db"
+  content {
+    user = "app"
+  }
+}
+
+secret "app-web" {
+  path = "app/web"
+  content {
+    user = "web"
+  }
+}
+
+secret "billing" {
+  path = "billing"
+  content {
+    user = "billing"
+  }
+}
+`
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	if err := os.WriteFile(path, []byte(hcl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	origFiles := configFiles
+	configFiles = []string{path}
+	t.Cleanup(func() { configFiles = origFiles })
+
+	tests := []struct {
+		toComplete string
+		expected   []string
+	}{
+		{"", []string{"app-db", "app-web", "billing"}},
+		{"app-", []string{"app-db", "app-web"}},
+		{"billing,app-w", []string{"billing,app-web"}},
+		{"missing", nil},
+	}
+
+	for _, tt := range tests {
+		got, directive := completeBlockNames(applyCmd, nil, tt.toComplete)
+		if !slices.Equal(got, tt.expected) {
+			t.Errorf("completeBlockNames(%q) = %v, want %v", tt.toComplete, got, tt.expected)
+		}
+		if directive != cobra.ShellCompDirectiveNoFileComp {
+			t.Errorf("completeBlockNames(%q) directive = %v", tt.toComplete, directive)
+		}
+	}
+
+	// An unreadable config completes nothing rather than failing
+	configFiles = []string{filepath.Join(t.TempDir(), "missing.hcl")}
+	if got, _ := completeBlockNames(applyCmd, nil, ""); got != nil {
+		t.Errorf("expected no completions without a config, got %v", got)
+	}
+}
@@ -0,0 +1,109 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+)
+
+var (
+	configDumpOutput     string
+	configDumpShowValues bool
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+}
+
+var configDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Print the effective configuration",
+	Long: `Dump prints the configuration exactly as the engine sees it: defaults
+applied, variables substituted, and every secret block with its final mount,
+path, and values.
+
+Values are shown as the HCL function call that produces them. Nothing is
+resolved and Vault is never contacted. Vault credentials are redacted.
+
+Static values are masked by default, like values in diff output, since
+they may be secrets written into the config. Use --show-values to reveal
+them. Keys matching redact.always_mask stay fully masked even then. A
+masked dump no longer parses back to the same config.`,
+	Example: `  # Show the effective config as HCL
+  vsg config dump --config config.hcl
+
+  # JSON output, e.g. for jq
+  vsg config dump --config config.hcl --output json
+
+  # YAML output
+  vsg config dump --config config.hcl --output yaml
+
+  # Reveal static values
+  vsg config dump --config config.hcl --show-values`,
+	Args: cobra.NoArgs,
+	RunE: runConfigDump,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configDumpCmd)
+
+	configDumpCmd.Flags().StringVarP(&configDumpOutput, "output", "o", "hcl", "output format: hcl, json, yaml")
+	configDumpCmd.Flags().BoolVar(&configDumpShowValues, "show-values", false, "show static values instead of masking them")
+}
+
+func runConfigDump(cmd *cobra.Command, args []string) error {
+	switch configDumpOutput {
+	case "hcl", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format: %s (use 'hcl', 'json' or 'yaml')", configDumpOutput)
+	}
+
+	cfgPaths, err := getConfigFiles()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(cmd.Context(), cfgPaths)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	opts := dumpOptions(cfg.Redact.AlwaysMask, configDumpShowValues)
+
+	var data []byte
+	switch configDumpOutput {
+	case "json":
+		data, err = config.DumpJSON(cfg, opts)
+	case "yaml":
+		data, err = config.DumpYAML(cfg, opts)
+	default:
+		data = config.DumpHCL(cfg, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Revealed values are what the user asked to see, so they bypass the
+	// redaction writer, which would mask tokens and DSNs among them
+	out := stdout
+	if configDumpShowValues {
+		out = cmd.OutOrStdout()
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// dumpOptions masks static values in a dump the way diff output masks
+// values: partially unless showValues, fully for keys matching alwaysMask.
+func dumpOptions(alwaysMask []string, showValues bool) config.DumpOptions {
+	return config.DumpOptions{
+		MaskStatic: func(key, value string) string {
+			return engine.DisplayValue(key, value, showValues, alwaysMask)
+		},
+	}
+}
@@ -0,0 +1,110 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+)
+
+func TestDumpOptions_MaskStatic(t *testing.T) {
+	hcl := `
+redact {
+  always_mask = ["*_key"]
+}
+
+secret "app" {
+  path = "app"
+
+  content {
+    password = "hunter2-secret"
+    api_key  = "sk-live-123456"
+    hashed   = command("cat", {stdin = "pipe-secret"})
+    id       = uuid()
+  }
+}
+`
+
+	cfg, err := config.ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Masked by default
+	dump := string(config.DumpHCL(cfg, dumpOptions(cfg.Redact.AlwaysMask, false)))
+	for _, secret := range []string{"hunter2-secret", "sk-live-123456", "pipe-secret"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("default dump contains %q:\n%s", secret, dump)
+		}
+	}
+	for _, want := range []string{`password = "hu**********et"`, `api_key  = "********"`, `stdin = "pi*******et"`, "id       = uuid()"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("default dump missing %s:\n%s", want, dump)
+		}
+	}
+
+	data, err := config.DumpJSON(cfg, dumpOptions(cfg.Redact.AlwaysMask, false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(data), "hunter2-secret") {
+		t.Errorf("default JSON dump contains the static value:\n%s", data)
+	}
+
+	// --show-values reveals all but always_mask keys
+	dump = string(config.DumpHCL(cfg, dumpOptions(cfg.Redact.AlwaysMask, true)))
+	for _, want := range []string{`password = "hunter2-secret"`, `api_key  = "********"`, `stdin = "pipe-secret"`} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("dump with values missing %s:\n%s", want, dump)
+		}
+	}
+}
+
+func TestConfigDump_ShowValuesUnredacted(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "vsg.hcl")
+	hcl := `
+redact {
+  patterns = ["hunter2-[a-z]+"]
+}
+
+secret "app" {
+  path = "app"
+
+  content {
+    password = "hunter2-secret"
+  }
+}
+`
+	if err := os.WriteFile(cfgPath, []byte(hcl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var redacted, shown bytes.Buffer
+	origOut := stdout
+	stdout = &redacted
+	rootCmd.SetOut(&shown)
+	t.Cleanup(func() {
+		stdout = origOut
+		rootCmd.SetOut(nil)
+		configDumpShowValues = false
+		configFiles = nil
+		logger = nil
+		_ = redactor.SetPatterns()
+	})
+
+	rootCmd.SetArgs([]string{"config", "dump", "--config", cfgPath, "--show-values"})
+	if err := rootCmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if redacted.Len() != 0 {
+		t.Errorf("expected nothing on the redacted stdout, got %q", redacted.String())
+	}
+	if !strings.Contains(shown.String(), `password = "hunter2-secret"`) {
+		t.Errorf("expected the unredacted value, got %q", shown.String())
+	}
+}
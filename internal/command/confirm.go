@@ -0,0 +1,51 @@
+package command
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AssumeYesEnv is the environment variable that answers yes to every
+// confirmation prompt, for CI jobs that can't pass --force.
+const AssumeYesEnv = "VSG_ASSUME_YES"
+
+// confirmAction prompts the user for confirmation on stdin
+func confirmAction() bool {
+	return confirm(os.Stdin)
+}
+
+// confirm prompts for confirmation and reads the answer from in. It accepts
+// "y" or "yes" in any case with surrounding whitespace. A closed or empty
+// input (non-interactive stdin) counts as no.
+func confirm(in io.Reader) bool {
+	fmt.Fprint(stdout, "\nAre you sure? [y/N]: ")
+
+	if assumeYes() {
+		fmt.Fprintf(stdout, "yes (%s is set)\n", AssumeYesEnv)
+		return true
+	}
+
+	reader := bufio.NewReader(in)
+	response, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false
+	}
+	if errors.Is(err, io.EOF) {
+		// Keep later output off the prompt line
+		fmt.Fprintln(stdout)
+	}
+
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes"
+}
+
+// assumeYes reports whether VSG_ASSUME_YES is set to a true value.
+func assumeYes() bool {
+	yes, err := strconv.ParseBool(os.Getenv(AssumeYesEnv))
+	return err == nil && yes
+}
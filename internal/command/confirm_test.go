@@ -0,0 +1,43 @@
+package command
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestConfirm(t *testing.T) {
+	orig := stdout
+	stdout = io.Discard
+	t.Cleanup(func() { stdout = orig })
+
+	tests := []struct {
+		name      string
+		input     string
+		assumeYes string
+		expected  bool
+	}{
+		{"yes", "yes\n", "", true},
+		{"short yes", "y\n", "", true},
+		{"uppercase with whitespace", "  YES \n", "", true},
+		{"no", "n\n", "", false},
+		{"empty line", "\n", "", false},
+		{"other answer", "sure\n", "", false},
+		{"eof", "", "", false},
+		{"answer without newline", "y", "", true},
+		{"assume yes", "", "1", true},
+		{"assume yes true", "n\n", "true", true},
+		{"assume yes disabled", "", "0", false},
+		{"assume yes invalid", "", "maybe", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(AssumeYesEnv, tt.assumeYes)
+
+			if got := confirm(strings.NewReader(tt.input)); got != tt.expected {
+				t.Errorf("confirm(%q) with %s=%q = %v, want %v", tt.input, AssumeYesEnv, tt.assumeYes, got, tt.expected)
+			}
+		})
+	}
+}
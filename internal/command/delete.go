@@ -1,16 +1,17 @@
 package command
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
 	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
 )
 
@@ -67,9 +68,11 @@ func init() {
 	deleteCmd.Flags().BoolVar(&deleteHard, "hard", false, "destroy version data permanently (KV v2 only)")
 	deleteCmd.Flags().BoolVar(&deleteFull, "full", false, "remove all versions and metadata (KV v2 only)")
 	deleteCmd.Flags().StringVar(&deleteKeys, "keys", "", "comma-separated list of keys to delete (path mode only)")
-	deleteCmd.Flags().StringSliceVarP(&deleteTarget, "target", "t", nil, "target secrets by label (config mode, comma-separated or repeated)")
-	deleteCmd.Flags().StringSliceVarP(&deleteExclude, "exclude", "e", nil, "exclude secrets by label (config mode, comma-separated or repeated)")
+	deleteCmd.Flags().StringSliceVarP(&deleteTarget, "target", "t", nil, "target secrets by label or glob (config mode, comma-separated or repeated)")
+	deleteCmd.Flags().StringSliceVarP(&deleteExclude, "exclude", "e", nil, "exclude secrets by label or glob (config mode, comma-separated or repeated)")
 	deleteCmd.Flags().BoolVar(&deleteAll, "all", false, "delete all secrets in config (config mode)")
+
+	registerBlockCompletion(deleteCmd)
 }
 
 func runDelete(cmd *cobra.Command, args []string) error {
@@ -90,7 +93,7 @@ func runDelete(cmd *cobra.Command, args []string) error {
 	}
 
 	// Config mode requires --config
-	if hasConfigMode && configFile == "" {
+	if hasConfigMode && len(configFiles) == 0 && configDir == "" {
 		return fmt.Errorf("config mode requires --config flag")
 	}
 
@@ -140,10 +143,10 @@ func runDeletePathMode(ctx context.Context, log *slog.Logger, path string) error
 
 	log.Debug("connecting to vault", "address", vaultAddr)
 
-	vaultClient, err := vault.NewClientFromEnv(vaultAddr, namespace)
+	vaultClient, err := vault.NewClientFromEnv(vaultAddr, namespace, vaultToken, vaultOptions()...)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error: failed to connect to Vault:", err)
-		os.Exit(ExitVaultError)
+		fmt.Fprintln(stderr, "Error: failed to connect to Vault:", err)
+		return &exitError{Code: ExitVaultError}
 	}
 
 	// Create KV client (auto-detect version)
@@ -167,20 +170,20 @@ func runDeletePathMode(ctx context.Context, log *slog.Logger, path string) error
 
 	// Confirm deletion
 	if !deleteForce {
-		fmt.Printf("The following secret will be %s:\n", action)
-		fmt.Printf("  Path: %s\n", path)
+		fmt.Fprintf(stdout, "The following secret will be %s:\n", action)
+		fmt.Fprintf(stdout, "  Path: %s\n", path)
 
 		if deleteKeys != "" {
-			fmt.Printf("  Keys: %s\n", deleteKeys)
+			fmt.Fprintf(stdout, "  Keys: %s\n", deleteKeys)
 		}
 		if deleteFull {
-			fmt.Println("  WARNING: This will remove ALL versions and metadata!")
+			fmt.Fprintln(stdout, "  WARNING: This will remove ALL versions and metadata!")
 		} else if deleteHard {
-			fmt.Println("  WARNING: This will permanently destroy version data!")
+			fmt.Fprintln(stdout, "  WARNING: This will permanently destroy version data!")
 		}
 
 		if !confirmAction() {
-			fmt.Println("Canceled.")
+			fmt.Fprintln(stdout, "Canceled.")
 			return nil
 		}
 	}
@@ -196,25 +199,25 @@ func runDeletePathMode(ctx context.Context, log *slog.Logger, path string) error
 		}
 		err = kv.DeleteKeys(ctx, subpath, keys)
 		if err == nil {
-			fmt.Printf("Deleted keys [%s] from %s\n", deleteKeys, path)
+			fmt.Fprintf(stdout, "Deleted keys [%s] from %s\n", deleteKeys, path)
 		}
 
 	case deleteFull:
 		err = kv.DestroyMetadata(ctx, subpath)
 		if err == nil {
-			fmt.Printf("Permanently removed all versions of %s\n", path)
+			fmt.Fprintf(stdout, "Permanently removed all versions of %s\n", path)
 		}
 
 	case deleteHard:
 		err = kv.DestroyVersions(ctx, subpath)
 		if err == nil {
-			fmt.Printf("Destroyed version data of %s\n", path)
+			fmt.Fprintf(stdout, "Destroyed version data of %s\n", path)
 		}
 
 	default:
 		err = kv.Delete(ctx, subpath)
 		if err == nil {
-			fmt.Printf("Soft deleted %s (recoverable in KV v2)\n", path)
+			fmt.Fprintf(stdout, "Soft deleted %s (recoverable in KV v2)\n", path)
 		}
 	}
 
@@ -228,55 +231,40 @@ func runDeletePathMode(ctx context.Context, log *slog.Logger, path string) error
 // runDeleteConfigMode handles config-based deletion
 func runDeleteConfigMode(ctx context.Context, log *slog.Logger) error {
 	// Load config
-	cfgPath, err := getConfigFile()
+	cfgPaths, err := getConfigFiles()
 	if err != nil {
 		return err
 	}
 
-	log.Debug("loading config", "path", cfgPath)
+	log.Debug("loading config", "paths", cfgPaths)
 
-	vars := parseVars()
-	cfg, err := config.Load(cfgPath, vars)
+	cfg, err := loadConfig(ctx, cfgPaths)
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
 	}
 
+	if err := engine.ValidateLabels(slices.Concat(deleteTarget, deleteExclude)); err != nil {
+		return err
+	}
+
 	// Build list of secrets to delete
 	secretsToDelete := make([]config.SecretBlock, 0, len(cfg.Secrets))
 	for name, block := range cfg.Secrets {
 		// If using --target, only include targeted secrets
-		if len(deleteTarget) > 0 {
-			targeted := false
-			for _, t := range deleteTarget {
-				if t == name {
-					targeted = true
-					break
-				}
-			}
-			if !targeted {
-				continue
-			}
+		if len(deleteTarget) > 0 && !engine.MatchLabel(deleteTarget, name) {
+			continue
 		}
 
 		// If using --all with --exclude, skip excluded secrets
-		if deleteAll && len(deleteExclude) > 0 {
-			excluded := false
-			for _, e := range deleteExclude {
-				if e == name {
-					excluded = true
-					break
-				}
-			}
-			if excluded {
-				continue
-			}
+		if deleteAll && engine.MatchLabel(deleteExclude, name) {
+			continue
 		}
 
 		secretsToDelete = append(secretsToDelete, block)
 	}
 
 	if len(secretsToDelete) == 0 {
-		fmt.Println("No secrets to delete.")
+		fmt.Fprintln(stdout, "No secrets to delete.")
 		return nil
 	}
 
@@ -293,19 +281,19 @@ func runDeleteConfigMode(ctx context.Context, log *slog.Logger) error {
 
 	// Confirm deletion
 	if !deleteForce {
-		fmt.Printf("The following %d secret(s) will be %s:\n", len(secretsToDelete), action)
+		fmt.Fprintf(stdout, "The following %d secret(s) will be %s:\n", len(secretsToDelete), action)
 		for _, block := range secretsToDelete {
-			fmt.Printf("  - %s (%s)\n", block.Name, block.FullPath())
+			fmt.Fprintf(stdout, "  - %s (%s)\n", block.Name, block.FullPath())
 		}
 
 		if deleteFull {
-			fmt.Println("\nWARNING: This will remove ALL versions and metadata!")
+			fmt.Fprintln(stdout, "\nWARNING: This will remove ALL versions and metadata!")
 		} else if deleteHard {
-			fmt.Println("\nWARNING: This will permanently destroy version data!")
+			fmt.Fprintln(stdout, "\nWARNING: This will permanently destroy version data!")
 		}
 
 		if !confirmAction() {
-			fmt.Println("Canceled.")
+			fmt.Fprintln(stdout, "Canceled.")
 			return nil
 		}
 	}
@@ -326,10 +314,10 @@ func runDeleteConfigMode(ctx context.Context, log *slog.Logger) error {
 
 	log.Debug("connecting to vault", "address", vaultAddr)
 
-	vaultClient, err := vault.NewClientFromEnv(vaultAddr, namespace)
+	vaultClient, err := vault.NewClientFromEnv(vaultAddr, namespace, cfg.Vault.Auth.Token, vaultOptions()...)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error: failed to connect to Vault:", err)
-		os.Exit(ExitVaultError)
+		fmt.Fprintln(stderr, "Error: failed to connect to Vault:", err)
+		return &exitError{Code: ExitVaultError}
 	}
 
 	// Delete each secret
@@ -348,19 +336,19 @@ func runDeleteConfigMode(ctx context.Context, log *slog.Logger) error {
 		case deleteFull:
 			err = kv.DestroyMetadata(ctx, block.Path)
 			if err == nil {
-				fmt.Printf("Permanently removed all versions of %s (%s)\n", block.Name, block.FullPath())
+				fmt.Fprintf(stdout, "Permanently removed all versions of %s (%s)\n", block.Name, block.FullPath())
 			}
 
 		case deleteHard:
 			err = kv.DestroyVersions(ctx, block.Path)
 			if err == nil {
-				fmt.Printf("Destroyed version data of %s (%s)\n", block.Name, block.FullPath())
+				fmt.Fprintf(stdout, "Destroyed version data of %s (%s)\n", block.Name, block.FullPath())
 			}
 
 		default:
 			err = kv.Delete(ctx, block.Path)
 			if err == nil {
-				fmt.Printf("Soft deleted %s (%s)\n", block.Name, block.FullPath())
+				fmt.Fprintf(stdout, "Soft deleted %s (%s)\n", block.Name, block.FullPath())
 			}
 		}
 
@@ -371,26 +359,12 @@ func runDeleteConfigMode(ctx context.Context, log *slog.Logger) error {
 
 	// Report errors
 	if len(errors) > 0 {
-		fmt.Fprintln(os.Stderr, "\nErrors:")
+		fmt.Fprintln(stderr, "\nErrors:")
 		for _, e := range errors {
-			fmt.Fprintln(os.Stderr, " -", e.Error())
+			fmt.Fprintln(stderr, " -", e.Error())
 		}
-		os.Exit(ExitPartialFailure)
+		return &exitError{Code: ExitPartialFailure}
 	}
 
 	return nil
 }
-
-// confirmAction prompts the user for confirmation
-func confirmAction() bool {
-	fmt.Print("\nAre you sure? [y/N]: ")
-
-	reader := bufio.NewReader(os.Stdin)
-	response, err := reader.ReadString('\n')
-	if err != nil {
-		return false
-	}
-
-	response = strings.TrimSpace(strings.ToLower(response))
-	return response == "y" || response == "yes"
-}
@@ -2,19 +2,22 @@ package command
 
 import (
 	"fmt"
-	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
-	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
 	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/state"
 	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
 )
 
 var (
-	diffOutput  string
-	diffTarget  []string
-	diffExclude []string
+	diffOutput        string
+	diffTarget        []string
+	diffExclude       []string
+	diffShowUnchanged bool
+	diffNoSummary     bool
+	diffState         string
 )
 
 var diffCmd = &cobra.Command{
@@ -24,8 +27,23 @@ var diffCmd = &cobra.Command{
 defined in the configuration file and shows what changes would be made.
 
 This is equivalent to 'apply --dry-run' but with more output options.
-Use --target to diff specific secrets by label.
-Use --exclude to skip specific secrets by label.`,
+Use --target to diff specific secrets by label or glob (e.g. prod-*).
+Use --exclude to skip specific secrets by label or glob. An exclude wins
+over a target matching the same secret.
+
+Nothing is written, so up to --concurrency blocks are read from Vault and
+resolved at once. The output is always in block name order.
+
+The text output shows only changes and unmanaged keys. --show-unchanged
+lists the unchanged and ignored keys too, and --no-summary leaves out the
+summary line. Both are independent of --verbose, which only controls
+logging. --output compact prints one line of counts per block, such as
+"prod-app: +2 ~1 -0", instead of the keys.
+
+Diff exits 1 when there are changes to apply. With --state-file, the
+file an apply records with --state-file, it also checks whether Vault
+still holds what the last apply wrote, and exits 5 instead when a secret
+was changed outside vsg since.`,
 	Example: `  # Show diff in text format
   vsg diff --config config.hcl
 
@@ -35,6 +53,21 @@ Use --exclude to skip specific secrets by label.`,
   # Show diff in JSON format
   vsg diff --config config.hcl --output json
 
+  # Unified diff for a pull request comment
+  vsg diff --config config.hcl --output patch
+
+  # One line of counts per block
+  vsg diff --config config.hcl --output compact
+
+  # Tell drift in Vault (exit 5) from pending config changes (exit 1)
+  vsg diff --config config.hcl --state-file .vsg-state.json
+
+  # Hide values entirely
+  vsg diff --config config.hcl --mask full
+
+  # Every key, without the summary line
+  vsg diff --config config.hcl --show-unchanged --no-summary
+
   # Diff specific secrets by label
   vsg diff --config config.hcl --target prod-app
   vsg diff --config config.hcl -t prod-app -t prod-db
@@ -47,25 +80,53 @@ Use --exclude to skip specific secrets by label.`,
 func init() {
 	rootCmd.AddCommand(diffCmd)
 
-	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "text", "output format: text, json")
-	diffCmd.Flags().StringSliceVarP(&diffTarget, "target", "t", nil, "target specific secrets by label (comma-separated or repeated)")
-	diffCmd.Flags().StringSliceVarP(&diffExclude, "exclude", "e", nil, "exclude secrets by label (comma-separated or repeated)")
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "text", "output format: text, json, yaml, patch, compact")
+	diffCmd.Flags().StringSliceVarP(&diffTarget, "target", "t", nil, "target specific secrets by label or glob (comma-separated or repeated)")
+	diffCmd.Flags().StringSliceVarP(&diffExclude, "exclude", "e", nil, "exclude secrets by label or glob (comma-separated or repeated)")
+	diffCmd.Flags().IntVar(&concurrency, "concurrency", defaultConcurrency, "maximum number of secret blocks read and resolved at once")
+	diffCmd.Flags().StringVar(&maskMode, "mask", string(engine.MaskPartial), "how values are masked in the output: partial, full, length-only")
+	diffCmd.Flags().BoolVar(&diffShowUnchanged, "show-unchanged", false, "list unchanged and ignored keys in the text output")
+	diffCmd.Flags().StringVar(&devDeterministic, "dev-deterministic", "", "INSECURE, dev only: derive generate() values from this seed and each mount, path and key")
+	diffCmd.Flags().BoolVar(&reportSources, "report-sources", false, "list the source URLs fetched, with cache hits and sizes, after the diff")
+	diffCmd.Flags().BoolVar(&diffNoSummary, "no-summary", false, "leave the summary line out of the text output")
+	diffCmd.Flags().StringVar(&diffState, "state-file", "", "exit 5 if Vault changed since the apply recorded in this state file")
+	diffCmd.Flags().IntVar(&parallelFetch, "parallel-fetch", 0, "fetch up to this many json/yaml/raw sources at once before processing blocks (0 = fetch as needed)")
+	diffCmd.Flags().BoolVar(&noFetchCache, "no-fetch-cache", false, "fetch a source again for every value using it instead of once per run")
+	diffCmd.Flags().BoolVar(&failOnUnmanaged, "fail-on-unmanaged", false, "exit 4 if a secret holds keys the config doesn't manage")
+
+	registerBlockCompletion(diffCmd)
 }
 
 func runDiff(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 	log := getLogger()
 
+	mask, err := engine.ParseMaskMode(maskMode)
+	if err != nil {
+		return err
+	}
+	seed, err := deterministicSeed(cmd)
+	if err != nil {
+		return err
+	}
+
+	var st *state.State
+	if diffState != "" {
+		st, err = state.Load(diffState)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Load config
-	cfgPath, err := getConfigFile()
+	cfgPaths, err := getConfigFiles()
 	if err != nil {
 		return err
 	}
 
-	log.Debug("loading config", "path", cfgPath)
+	log.Debug("loading config", "paths", cfgPaths)
 
-	vars := parseVars()
-	cfg, err := config.Load(cfgPath, vars)
+	cfg, err := loadConfig(ctx, cfgPaths)
 	if err != nil {
 		return fmt.Errorf("loading config: %w", err)
 	}
@@ -73,35 +134,45 @@ func runDiff(cmd *cobra.Command, args []string) error {
 	// Create Vault client
 	log.Debug("connecting to vault", "address", cfg.Vault.Address)
 
-	vaultClient, err := vault.NewClient(cfg.Vault)
+	vaultClient, err := vault.NewClient(cfg.Vault, vaultOptions()...)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error: failed to connect to Vault:", err)
-		os.Exit(ExitVaultError)
+		fmt.Fprintln(stderr, "Error: failed to connect to Vault:", err)
+		return &exitError{Code: ExitVaultError}
 	}
+	defer vaultClient.Close()
 
 	// Check Vault health
 	if err := vaultClient.CheckHealth(ctx); err != nil {
-		fmt.Fprintln(os.Stderr, "Error: Vault health check failed:", err)
-		os.Exit(ExitVaultError)
+		fmt.Fprintln(stderr, "Error: Vault health check failed:", err)
+		return &exitError{Code: ExitVaultError}
 	}
 
 	// Set up fetchers
 	registry := setupFetchers(ctx)
+	//nolint:errcheck // Best effort close on defer
+	defer registry.Close()
 
 	// Create engine
 	eng := engine.NewEngine(vaultClient, registry, cfg.Defaults, log)
 
-	// Run plan (dry-run)
+	// Run plan (dry-run). Nothing is written, so blocks are read and
+	// resolved concurrently; the diff keeps the sorted block order.
 	opts := engine.Options{
-		DryRun:  true,
-		Target:  diffTarget,
-		Exclude: diffExclude,
+		DryRun:         true,
+		Target:         diffTarget,
+		Exclude:        diffExclude,
+		Concurrency:    concurrency,
+		ParallelFetch:  parallelFetch,
+		CommandTimeout: commandTimeout,
+
+		DevDeterministicSeed: seed,
 	}
 
 	result, err := eng.Plan(ctx, cfg, opts)
 	if err != nil {
 		return err
 	}
+	result.Diff.Mask = mask
 
 	// Output diff
 	switch diffOutput {
@@ -110,32 +181,74 @@ func runDiff(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return fmt.Errorf("formatting JSON: %w", err)
 		}
-		fmt.Println(jsonOutput)
+		fmt.Fprintln(stdout, jsonOutput)
 
-	case "text":
-		if verbose {
-			fmt.Println(engine.FormatDiffVerbose(result.Diff))
-		} else {
-			fmt.Println(engine.FormatDiff(result.Diff))
+	case "yaml":
+		yamlOutput, err := result.Diff.ToYAML()
+		if err != nil {
+			return fmt.Errorf("formatting YAML: %w", err)
 		}
+		fmt.Fprint(stdout, yamlOutput)
+
+	case "text":
+		fmt.Fprintln(stdout, engine.FormatDiff(result.Diff, engine.FormatOptions{
+			ShowUnchanged: diffShowUnchanged,
+			NoSummary:     diffNoSummary,
+		}))
+
+	case "patch":
+		fmt.Fprint(stdout, engine.FormatDiffPatch(result.Diff))
+
+	case "compact":
+		fmt.Fprint(stdout, engine.FormatDiffCompact(result.Diff, engine.FormatOptions{
+			NoSummary: diffNoSummary,
+		}))
 
 	default:
-		return fmt.Errorf("unknown output format: %s (use 'text' or 'json')", diffOutput)
+		return fmt.Errorf("unknown output format: %s (use 'text', 'json', 'yaml', 'patch' or 'compact')", diffOutput)
+	}
+
+	if reportSources {
+		writeSourceReport(stderr, registry.Stats())
 	}
 
 	// Handle errors
 	if len(result.Errors) > 0 {
-		fmt.Fprintln(os.Stderr, "\nErrors:")
+		fmt.Fprintln(stderr, "\nErrors:")
 		for _, e := range result.Errors {
-			fmt.Fprintln(os.Stderr, " -", e.Error())
+			fmt.Fprintln(stderr, " -", e.Error())
 		}
-		os.Exit(ExitPartialFailure)
+		return &exitError{Code: classifyErrors(result.Errors)}
 	}
 
 	// Exit with non-zero if there are changes (useful for CI)
-	if result.Diff.HasChanges() {
-		os.Exit(1)
+	code, drifted := diffExitCode(result.Diff, st, reportUnmanaged(result.Diff))
+	if len(drifted) > 0 {
+		fmt.Fprintf(stderr, "\nDrift: changed in Vault since the last apply: %s\n", strings.Join(drifted, ", "))
+	}
+	if code != ExitSuccess {
+		return &exitError{Code: code}
 	}
 
 	return nil
 }
+
+// diffExitCode returns the exit code of a diff: ExitDrift if the state
+// records an apply whose result Vault no longer holds, ExitPartialFailure
+// if unmanaged keys fail the run, 1 if there are changes to apply, and
+// ExitSuccess otherwise. It also returns the drifted blocks. st is nil
+// without --state-file.
+func diffExitCode(diff *engine.Diff, st *state.State, unmanaged bool) (int, []string) {
+	if st != nil {
+		if drifted := st.Drifted(diff); len(drifted) > 0 {
+			return ExitDrift, drifted
+		}
+	}
+	if unmanaged {
+		return ExitPartialFailure, nil
+	}
+	if diff.HasChanges() {
+		return 1, nil
+	}
+	return ExitSuccess, nil
+}
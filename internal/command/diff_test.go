@@ -0,0 +1,146 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/state"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
+)
+
+// fakeKV is a KV v2 store serving a single secret.
+type fakeKV struct {
+	mu      sync.Mutex
+	data    map[string]interface{}
+	version int
+}
+
+func (f *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodGet {
+		if f.data == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": f.data, "metadata": map[string]interface{}{"version": f.version}},
+		})
+		return
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	f.data = body.Data
+	f.version++
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"version": f.version}})
+}
+
+func (f *fakeKV) set(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[key] = value
+}
+
+func TestDiffExitCode(t *testing.T) {
+	store := &fakeKV{}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	eng := engine.NewEngine(client, fetcher.NewRegistry(), config.Defaults{
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	configWith := func(host string) *config.Config {
+		return &config.Config{
+			Secrets: map[string]config.SecretBlock{
+				"app": {Name: "app", Mount: "secret", Path: "app", Version: 2, Content: map[string]config.Value{
+					"host": {Type: config.ValueTypeStatic, Static: host},
+				}},
+			},
+		}
+	}
+
+	// Apply and record the state
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, err := state.Load(path)
+	if err != nil {
+		t.Fatalf("loading state: %v", err)
+	}
+	result, err := eng.Reconcile(context.Background(), configWith("db.internal"), engine.Options{})
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("apply failed: %v %v", err, result.Errors)
+	}
+	st.Record(result, map[string]string{"app": "h-app"}, time.Now())
+	if err := st.Save(path); err != nil {
+		t.Fatalf("saving state: %v", err)
+	}
+	if st, err = state.Load(path); err != nil {
+		t.Fatalf("loading state: %v", err)
+	}
+
+	diff := func(cfg *config.Config) (int, []string) {
+		t.Helper()
+		result, err := eng.Plan(context.Background(), cfg, engine.Options{DryRun: true})
+		if err != nil || len(result.Errors) != 0 {
+			t.Fatalf("diff failed: %v %v", err, result.Errors)
+		}
+		return diffExitCode(result.Diff, st, false)
+	}
+
+	if code, drifted := diff(configWith("db.internal")); code != ExitSuccess || drifted != nil {
+		t.Errorf("in sync: got exit %d, drifted %v", code, drifted)
+	}
+
+	// A config change is pending, Vault is as applied
+	if code, drifted := diff(configWith("db2.internal")); code != 1 || drifted != nil {
+		t.Errorf("pending change: got exit %d, drifted %v, want exit 1", code, drifted)
+	}
+
+	// Someone changes the secret outside vsg
+	store.set("host", "evil.example.com")
+	if code, drifted := diff(configWith("db.internal")); code != ExitDrift || !slices.Equal(drifted, []string{"app"}) {
+		t.Errorf("drift: got exit %d, drifted %v, want exit %d for app", code, drifted, ExitDrift)
+	}
+
+	// Drift outranks unmanaged keys failing the run
+	result, err = eng.Plan(context.Background(), configWith("db.internal"), engine.Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code, _ := diffExitCode(result.Diff, st, true); code != ExitDrift {
+		t.Errorf("drift and unmanaged keys: got exit %d, want %d", code, ExitDrift)
+	}
+	if code, _ := diffExitCode(result.Diff, nil, true); code != ExitPartialFailure {
+		t.Errorf("unmanaged keys: got exit %d, want %d", code, ExitPartialFailure)
+	}
+
+	// Without a state file, drift is just a pending change
+	result, err = eng.Plan(context.Background(), configWith("db.internal"), engine.Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code, _ := diffExitCode(result.Diff, nil, false); code != 1 {
+		t.Errorf("without state: got exit %d, want 1", code)
+	}
+}
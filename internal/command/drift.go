@@ -0,0 +1,136 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
+)
+
+var (
+	driftOutput  string
+	driftTarget  []string
+	driftExclude []string
+)
+
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Report which secrets differ from the configuration",
+	Long: `Drift plans the config like diff, but reports per block instead of per
+key, for monitoring and alerting: which blocks have changes pending, which
+hold keys in Vault that the config doesn't manage, and which failed.
+
+The report starts with one line of counts, followed by a line per block
+that isn't in sync. No values are shown, masked or not. --output json
+prints every block with its status: pending, unmanaged, failed or in_sync.
+
+Drift exits 5 when any block has changes pending or unmanaged keys, and
+0 when every block is in sync. Failures exit as they do for diff.`,
+	Example: `  # Report drift
+  vsg drift --config config.hcl
+
+  # JSON for an alerting pipeline
+  vsg drift --config config.hcl --output json
+
+  # Only production secrets
+  vsg drift --config config.hcl --target 'prod-*'`,
+	RunE: runDrift,
+}
+
+func init() {
+	rootCmd.AddCommand(driftCmd)
+
+	driftCmd.Flags().StringVarP(&driftOutput, "output", "o", "text", "output format: text, json")
+	driftCmd.Flags().StringSliceVarP(&driftTarget, "target", "t", nil, "target specific secrets by label or glob (comma-separated or repeated)")
+	driftCmd.Flags().StringSliceVarP(&driftExclude, "exclude", "e", nil, "exclude secrets by label or glob (comma-separated or repeated)")
+	driftCmd.Flags().IntVar(&concurrency, "concurrency", defaultConcurrency, "maximum number of secret blocks read and resolved at once")
+	driftCmd.Flags().IntVar(&parallelFetch, "parallel-fetch", 0, "fetch up to this many json/yaml/raw sources at once before processing blocks (0 = fetch as needed)")
+	driftCmd.Flags().BoolVar(&noFetchCache, "no-fetch-cache", false, "fetch a source again for every value using it instead of once per run")
+
+	registerBlockCompletion(driftCmd)
+}
+
+func runDrift(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	log := getLogger()
+
+	if driftOutput != "text" && driftOutput != "json" {
+		return fmt.Errorf("unknown output format: %s (use 'text' or 'json')", driftOutput)
+	}
+
+	// Load config
+	cfgPaths, err := getConfigFiles()
+	if err != nil {
+		return err
+	}
+
+	log.Debug("loading config", "paths", cfgPaths)
+
+	cfg, err := loadConfig(ctx, cfgPaths)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	// Create Vault client
+	log.Debug("connecting to vault", "address", cfg.Vault.Address)
+
+	vaultClient, err := vault.NewClient(cfg.Vault, vaultOptions()...)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error: failed to connect to Vault:", err)
+		return &exitError{Code: ExitVaultError}
+	}
+	defer vaultClient.Close()
+
+	// Check Vault health
+	if err := vaultClient.CheckHealth(ctx); err != nil {
+		fmt.Fprintln(stderr, "Error: Vault health check failed:", err)
+		return &exitError{Code: ExitVaultError}
+	}
+
+	registry := setupFetchers(ctx)
+	//nolint:errcheck // Best effort close on defer
+	defer registry.Close()
+	eng := engine.NewEngine(vaultClient, registry, cfg.Defaults, log)
+
+	result, err := eng.Plan(ctx, cfg, engine.Options{
+		Target:         driftTarget,
+		Exclude:        driftExclude,
+		Concurrency:    concurrency,
+		ParallelFetch:  parallelFetch,
+		CommandTimeout: commandTimeout,
+	})
+	if err != nil {
+		return err
+	}
+
+	report := engine.NewDriftReport(result)
+	if driftOutput == "json" {
+		out, err := report.ToJSON()
+		if err != nil {
+			return fmt.Errorf("formatting JSON: %w", err)
+		}
+		fmt.Fprintln(stdout, out)
+	} else {
+		fmt.Fprint(stdout, engine.FormatDriftReport(report))
+	}
+
+	if code := driftExitCode(report, result.Errors); code != ExitSuccess {
+		return &exitError{Code: code}
+	}
+	return nil
+}
+
+// driftExitCode returns the exit code of a drift report: the code of the
+// errors if any block failed, as for diff, ExitDrift if any block drifted,
+// and ExitSuccess otherwise.
+func driftExitCode(report *engine.DriftReport, errs []engine.BlockError) int {
+	if len(errs) > 0 {
+		return classifyErrors(errs)
+	}
+	if report.HasDrift() {
+		return ExitDrift
+	}
+	return ExitSuccess
+}
@@ -0,0 +1,38 @@
+package command
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+)
+
+func TestDriftExitCode(t *testing.T) {
+	pending := &engine.Result{Diff: &engine.Diff{Blocks: []engine.BlockDiff{
+		{Name: "app", Changes: []engine.SecretChange{{Key: "password", Change: engine.ChangeUpdate}}},
+	}}}
+	inSync := &engine.Result{Diff: &engine.Diff{Blocks: []engine.BlockDiff{
+		{Name: "app", Changes: []engine.SecretChange{{Key: "password", Change: engine.ChangeNone}}},
+	}}}
+	fetchErrs := []engine.BlockError{{Block: "app", Key: "db_host", Err: &engine.FetchError{URL: "s3://bucket/state.json", Err: errors.New("NoSuchKey")}}}
+
+	tests := []struct {
+		name     string
+		result   *engine.Result
+		errs     []engine.BlockError
+		expected int
+	}{
+		{"in sync", inSync, nil, ExitSuccess},
+		{"drift", pending, nil, ExitDrift},
+		{"failed", pending, fetchErrs, ExitFetchError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.result.Errors = tt.errs
+			if got := driftExitCode(engine.NewDriftReport(tt.result), tt.errs); got != tt.expected {
+				t.Errorf("driftExitCode() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+)
+
+var (
+	exportFormat  string
+	exportTarget  []string
+	exportExclude []string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print resolved secret values as dotenv or JSON",
+	Long: `Export resolves every value in the configuration and prints the result,
+without reading from or writing to Vault.
+
+Values are resolved as if the secrets did not exist yet: generate() and
+uuid() produce new values on every run, and strategies never keep an
+existing value. vault() values can't be resolved and fail the export.
+
+The dotenv format prints KEY=value lines, with a comment naming each
+block. Keys must be valid environment variable names and unique across
+the exported blocks. The json format prints an object keyed by block name.
+
+Values are printed in the clear. Nothing is printed if any value fails
+to resolve.`,
+	Example: `  # Write a .env file for local development
+  vsg export --config config.hcl --target dev-app > .env
+
+  # JSON keyed by block name
+  vsg export --config config.hcl --format json`,
+	Args: cobra.NoArgs,
+	RunE: runExport,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVar(&exportFormat, "format", "dotenv", "output format: dotenv, json")
+	exportCmd.Flags().StringSliceVarP(&exportTarget, "target", "t", nil, "target specific secrets by label or glob (comma-separated or repeated)")
+	exportCmd.Flags().StringSliceVarP(&exportExclude, "exclude", "e", nil, "exclude secrets by label or glob (comma-separated or repeated)")
+	exportCmd.Flags().BoolVar(&noFetchCache, "no-fetch-cache", false, "fetch a source again for every value using it instead of once per run")
+
+	registerBlockCompletion(exportCmd)
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	if exportFormat != "dotenv" && exportFormat != "json" {
+		return fmt.Errorf("unknown format: %s (use 'dotenv' or 'json')", exportFormat)
+	}
+
+	if err := engine.ValidateLabels(slices.Concat(exportTarget, exportExclude)); err != nil {
+		return err
+	}
+
+	cfgPaths, err := getConfigFiles()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(ctx, cfgPaths)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	// No Vault client: vault() values fail with engine.ErrNoVaultReader
+	registry := setupFetchers(ctx)
+	//nolint:errcheck // Best effort close on defer
+	defer registry.Close()
+
+	resolver := engine.NewResolver(registry, nil, cfg.Defaults.Generate, cfg.Defaults.Strategy)
+	resolver.SetPolicies(cfg.Defaults.Policies)
+
+	values, errs := engine.ResolveBlocks(ctx, resolver, cfg, engine.Options{
+		Target:         exportTarget,
+		Exclude:        exportExclude,
+		CommandTimeout: commandTimeout,
+	})
+	if len(errs) > 0 {
+		fmt.Fprintln(stderr, "Errors:")
+		for _, e := range errs {
+			fmt.Fprintln(stderr, " -", e.Error())
+		}
+		return &exitError{Code: ExitPartialFailure}
+	}
+
+	// The export is the secret values themselves, so it bypasses the
+	// redaction writer, which would corrupt values such as DSNs
+	out := cmd.OutOrStdout()
+	if exportFormat == "json" {
+		data, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return fmt.Errorf("formatting JSON: %w", err)
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+
+	return writeDotenv(out, values)
+}
+
+// writeDotenv writes values as dotenv KEY=value lines, blocks and keys in
+// sorted order, each block preceded by a comment with its name. Nothing is
+// written if a key is not a valid environment variable name or is used by
+// more than one block.
+func writeDotenv(w io.Writer, values map[string]map[string]string) error {
+	blocks := make([]string, 0, len(values))
+	for name := range values {
+		blocks = append(blocks, name)
+	}
+	sort.Strings(blocks)
+
+	// Block that first used each key, to catch keys that would silently
+	// override each other when the file is sourced
+	seen := make(map[string]string)
+
+	var b strings.Builder
+	for i, name := range blocks {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "# %s\n", name)
+
+		keys := make([]string, 0, len(values[name]))
+		for key := range values[name] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if !dotenvNameRe.MatchString(key) {
+				return fmt.Errorf("block %q: key %q is not a valid environment variable name", name, key)
+			}
+			if other, ok := seen[key]; ok {
+				return fmt.Errorf("key %q is set by both block %q and block %q", key, other, name)
+			}
+			seen[key] = name
+			fmt.Fprintf(&b, "%s=%s\n", key, dotenvValue(values[name][key]))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotenvValue quotes a value for a dotenv file. Values made only of safe
+// characters are written bare. Anything else is double-quoted, escaping
+// backslashes, double quotes, line breaks, and the "$" and "`" that shells
+// and dotenv loaders expand inside double quotes.
+func dotenvValue(value string) string {
+	if value != "" && strings.Trim(value, dotenvSafeChars) == "" {
+		return value
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(value) + `"`
+}
+
+// dotenvNameRe matches the names a shell accepts for environment variables.
+var dotenvNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// dotenvSafeChars are the characters that never need quoting in a dotenv value.
+const dotenvSafeChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_-.,/:@+"
@@ -0,0 +1,97 @@
+package command
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDotenvValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"plain", "db.internal", "db.internal"},
+		{"url", "https://example.com/path", "https://example.com/path"},
+		{"empty", "", `""`},
+		{"equals", "a=b", `"a=b"`},
+		{"base64 padding", "c2VjcmV0==", `"c2VjcmV0=="`},
+		{"spaces", "hello world", `"hello world"`},
+		{"double quotes", `say "hi"`, `"say \"hi\""`},
+		{"single quote", "it's", `"it's"`},
+		{"newline", "line1\nline2", `"line1\nline2"`},
+		{"crlf", "line1\r\nline2", `"line1\r\nline2"`},
+		{"backslash", `C:\path`, `"C:\\path"`},
+		{"dollar", "pa$$word", `"pa\$\$word"`},
+		{"variable", "${HOME}", `"\${HOME}"`},
+		{"backtick", "a`id`b", "\"a\\`id\\`b\""},
+		{"hash", "abc#def", `"abc#def"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dotenvValue(tt.value); got != tt.expected {
+				t.Errorf("dotenvValue(%q) = %s, want %s", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteDotenv(t *testing.T) {
+	values := map[string]map[string]string{
+		"db":  {"PASSWORD": "p=\"q\"\n", "HOST": "db.internal"},
+		"app": {"API_KEY": "abc123"},
+	}
+
+	var buf bytes.Buffer
+	if err := writeDotenv(&buf, values); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "# app\n" +
+		"API_KEY=abc123\n" +
+		"\n" +
+		"# db\n" +
+		"HOST=db.internal\n" +
+		"PASSWORD=\"p=\\\"q\\\"\\n\"\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteDotenv_InvalidName(t *testing.T) {
+	for _, key := range []string{"my-key", "1KEY", "KEY NAME", "a.b", ""} {
+		t.Run(key, func(t *testing.T) {
+			values := map[string]map[string]string{"app": {key: "x", "OK": "y"}}
+
+			var buf bytes.Buffer
+			err := writeDotenv(&buf, values)
+			if err == nil || !strings.Contains(err.Error(), "not a valid environment variable name") {
+				t.Fatalf("expected invalid name error, got %v", err)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("expected no output, got %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestWriteDotenv_DuplicateKey(t *testing.T) {
+	values := map[string]map[string]string{
+		"db":  {"HOST": "db.internal"},
+		"app": {"HOST": "app.internal", "PORT": "8080"},
+	}
+
+	var buf bytes.Buffer
+	err := writeDotenv(&buf, values)
+	if err == nil {
+		t.Fatal("expected duplicate key error")
+	}
+	if want := `key "HOST" is set by both block "app" and block "db"`; err.Error() != want {
+		t.Errorf("error = %q, want %q", err.Error(), want)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got %q", buf.String())
+	}
+}
@@ -0,0 +1,55 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFormatConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	formatted := "secret \"app\" {\n  path = \"app\"\n  content {\n    user = \"app\"\n  }\n}\n"
+	files := map[string]string{
+		"app.hcl": "secret \"app\" {\npath=\"app\"\ncontent {\nuser=\"app\"\n}\n}\n",
+		"db.hcl":  "secret \"db\" {\n  path = \"db\"\n  content {\n    user = \"db\"\n  }\n}\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	origDir := configDir
+	configDir = dir
+	t.Cleanup(func() { configDir = origDir })
+
+	// --check reports the file without touching it
+	changed, err := formatConfigFiles(t.Context(), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	appPath := filepath.Join(dir, "app.hcl")
+	if !slices.Equal(changed, []string{appPath}) {
+		t.Errorf("changed = %v, want [%s]", changed, appPath)
+	}
+	if data, _ := os.ReadFile(appPath); string(data) != files["app.hcl"] {
+		t.Errorf("check mode rewrote the file:\n%s", data)
+	}
+
+	// Without --check the file is rewritten
+	if _, err := formatConfigFiles(t.Context(), false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(appPath); string(data) != formatted {
+		t.Errorf("formatted file =\n%s\nwant\n%s", data, formatted)
+	}
+
+	changed, err = formatConfigFiles(t.Context(), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("expected no changes after formatting, got %v", changed)
+	}
+}
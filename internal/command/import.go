@@ -0,0 +1,288 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/spf13/cobra"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
+)
+
+// defaultImportDepth is how many levels of subpaths import descends by
+// default, so a mistyped prefix doesn't walk a whole mount.
+const defaultImportDepth = 10
+
+var (
+	importOutput string
+	importDepth  int
+	importMask   string
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <path>",
+	Short: "Write a config skeleton for the secrets stored under a path",
+	Long: `Import walks a Vault path tree and writes a secret block for every secret
+below it, to adopt an existing Vault into a config.
+
+The path is given as mount or mount/subpath (e.g. secret/myapp). The KV
+version of the mount is detected automatically. Each block is named after
+its path below the mount, with slashes turned into dashes, and lists the
+secret's keys with masked placeholders. Two paths that get the same name,
+such as a/b and a-b, are an error. Values are never written in the
+clear: replace each placeholder with the function that should produce the
+value before applying the config.
+
+Subpaths are walked at most --depth levels below the path. Deeper subpaths
+are left out and logged as a warning.
+
+By default the skeleton is printed. --output writes it to a file, or, given
+a directory (an existing one, or a path ending in a slash), to one file per
+top-level entry under the path, such as team-a.hcl for team-a/db and
+team-a/web. Existing files are never overwritten.`,
+	Example: `  # Print a skeleton for every secret under secret/myapp
+  vsg import secret/myapp
+
+  # One file per team under configs/
+  vsg import secret/teams --output configs/
+
+  # Only the secrets directly under the path
+  vsg import secret/myapp --depth 1`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImport,
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringVarP(&importOutput, "output", "o", "", "write the skeleton to this file, or one file per top-level entry to this directory")
+	importCmd.Flags().IntVar(&importDepth, "depth", defaultImportDepth, "how many levels of subpaths to walk (0 = no limit)")
+	importCmd.Flags().StringVar(&importMask, "mask", string(engine.MaskFull), "how the placeholder values are masked: full, length-only")
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	log := getLogger()
+
+	mode, err := engine.ParseMaskMode(importMask)
+	if err != nil {
+		return err
+	}
+	// Partial masking would write part of every value into the skeleton
+	if mode == engine.MaskPartial {
+		return fmt.Errorf("invalid --mask %q: import supports only full and length-only", importMask)
+	}
+	if importDepth < 0 {
+		return fmt.Errorf("invalid --depth %d: must be 0 or more", importDepth)
+	}
+
+	mount, subpath := parsePath(args[0])
+	if mount == "" {
+		return fmt.Errorf("invalid path %q: must include a mount (e.g., secret/myapp)", args[0])
+	}
+
+	vaultClient, err := vault.NewClientFromEnv(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_NAMESPACE"), vaultToken, vaultOptions()...)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error: failed to connect to Vault:", err)
+		return &exitError{Code: ExitVaultError}
+	}
+
+	log.Debug("connected to vault", "address", vaultClient.Address())
+
+	kv, err := vault.NewKVClient(vaultClient, mount, vault.KVVersionAuto)
+	if err != nil {
+		return fmt.Errorf("creating KV client: %w", err)
+	}
+
+	secrets, skipped, err := importTree(ctx, kv, subpath, importDepth, mode)
+	if err != nil {
+		return err
+	}
+	for _, path := range skipped {
+		log.Warn("subpath deeper than --depth left out", "path", strings.Trim(subpath+"/"+path, "/"))
+	}
+	if len(secrets) == 0 {
+		log.Warn("no secrets found", "path", args[0])
+		return nil
+	}
+
+	switch {
+	case importOutput == "":
+		_, err = stdout.Write(renderSkeleton(secrets))
+		return err
+	case strings.HasSuffix(importOutput, "/") || isDir(importOutput):
+		return writeSkeletonFiles(importOutput, secrets)
+	default:
+		return writeNewFile(importOutput, renderSkeleton(secrets))
+	}
+}
+
+// importedSecret is a secret found by import, with its keys' placeholders.
+type importedSecret struct {
+	Mount string
+	Path  string
+
+	// Rel is the path relative to the imported prefix
+	Rel string
+
+	// Keys maps each key to its masked placeholder
+	Keys map[string]string
+}
+
+// Name returns the secret block name: the path with slashes turned into
+// dashes.
+func (s importedSecret) Name() string {
+	return strings.ReplaceAll(s.Path, "/", "-")
+}
+
+// secretTreeReader lists and reads the secrets of a KV mount.
+type secretTreeReader interface {
+	lister
+	Read(ctx context.Context, path string) (map[string]interface{}, error)
+	Mount() string
+}
+
+// importTree reads every secret below prefix, at most maxDepth levels of
+// subpaths deep, and masks its values. The subpaths left out are returned
+// as walkListDepth reports them.
+func importTree(ctx context.Context, kv secretTreeReader, prefix string, maxDepth int, mode engine.MaskMode) ([]importedSecret, []string, error) {
+	names, skipped, err := walkListDepth(ctx, kv, prefix, maxDepth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secrets := make([]importedSecret, 0, len(names))
+	for _, name := range names {
+		path := strings.Trim(prefix+"/"+name, "/")
+		data, err := kv.Read(ctx, path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		keys := make(map[string]string, len(data))
+		for key, value := range data {
+			s, ok := value.(string)
+			if !ok {
+				raw, err := json.Marshal(value)
+				if err != nil {
+					return nil, nil, fmt.Errorf("encoding %s key %q: %w", path, key, err)
+				}
+				s = string(raw)
+			}
+			keys[key] = engine.MaskValue(s, mode)
+		}
+
+		secrets = append(secrets, importedSecret{Mount: kv.Mount(), Path: path, Rel: name, Keys: keys})
+	}
+
+	// Paths such as a/b and a-b get the same block name
+	named := make(map[string]string, len(secrets))
+	for _, secret := range secrets {
+		if prev, exists := named[secret.Name()]; exists {
+			return nil, nil, fmt.Errorf("secrets %s and %s would both be named %q", prev, secret.Path, secret.Name())
+		}
+		named[secret.Name()] = secret.Path
+	}
+	return secrets, skipped, nil
+}
+
+// renderSkeleton renders a secret block per secret as formatted HCL. Keys
+// that aren't identifiers are declared in a group, as config dump does.
+func renderSkeleton(secrets []importedSecret) []byte {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+
+	for i, secret := range secrets {
+		if i > 0 {
+			body.AppendNewline()
+		}
+		block := body.AppendNewBlock("secret", []string{secret.Name()}).Body()
+		block.SetAttributeValue("mount", cty.StringVal(secret.Mount))
+		block.SetAttributeValue("path", cty.StringVal(secret.Path))
+		block.AppendNewline()
+
+		content := block.AppendNewBlock("content", nil).Body()
+		keys := make([]string, 0, len(secret.Keys))
+		for key := range secret.Keys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var groupKeys []string
+		for _, key := range keys {
+			if !hclsyntax.ValidIdentifier(key) {
+				groupKeys = append(groupKeys, key)
+				continue
+			}
+			content.SetAttributeValue(key, cty.StringVal(secret.Keys[key]))
+		}
+		for _, key := range groupKeys {
+			content.AppendNewline()
+			group := content.AppendNewBlock("group", nil).Body()
+			group.SetAttributeValue("keys", cty.ListVal([]cty.Value{cty.StringVal(key)}))
+			group.SetAttributeValue("value", cty.StringVal(secret.Keys[key]))
+		}
+	}
+
+	return hclwrite.Format(f.Bytes())
+}
+
+// writeSkeletonFiles writes one skeleton file per top-level entry under the
+// imported prefix into dir, named after the entry.
+func writeSkeletonFiles(dir string, secrets []importedSecret) error {
+	groups := make(map[string][]importedSecret)
+	for _, secret := range secrets {
+		top, _, _ := strings.Cut(secret.Rel, "/")
+		groups[top] = append(groups[top], secret)
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+
+	tops := make([]string, 0, len(groups))
+	for top := range groups {
+		tops = append(tops, top)
+	}
+	sort.Strings(tops)
+
+	for _, top := range tops {
+		if err := writeNewFile(filepath.Join(dir, top+".hcl"), renderSkeleton(groups[top])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNewFile writes data to a file that must not exist yet.
+func writeNewFile(name string, data []byte) error {
+	// #nosec G304 -- Output path is intentionally user-provided
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	fmt.Fprintln(stdout, name)
+	return nil
+}
+
+// isDir reports whether name is an existing directory.
+func isDir(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.IsDir()
+}
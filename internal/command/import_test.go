@@ -0,0 +1,182 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
+)
+
+// seededVault serves a KV v2 mount named secret holding the given secrets,
+// keyed by path.
+func seededVault(t *testing.T, secrets map[string]map[string]interface{}) *vault.KVClient {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if prefix, ok := strings.CutPrefix(r.URL.Path, "/v1/secret/metadata"); ok && (r.Method == "LIST" || r.URL.Query().Get("list") == "true") {
+			prefix = strings.Trim(prefix, "/")
+			if prefix != "" {
+				prefix += "/"
+			}
+			var keys []string
+			for path := range secrets {
+				rest, ok := strings.CutPrefix(path, prefix)
+				if !ok {
+					continue
+				}
+				if dir, _, nested := strings.Cut(rest, "/"); nested {
+					rest = dir + "/"
+				}
+				if !slices.Contains(keys, rest) {
+					keys = append(keys, rest)
+				}
+			}
+			if len(keys) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+			return
+		}
+
+		if path, ok := strings.CutPrefix(r.URL.Path, "/v1/secret/data/"); ok && r.Method == http.MethodGet {
+			if data, ok := secrets[path]; ok {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"data": map[string]interface{}{"data": data, "metadata": map[string]interface{}{"version": 1}},
+				})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	kv, err := vault.NewKVClient(client, "secret", vault.KVVersion2)
+	if err != nil {
+		t.Fatalf("creating KV client: %v", err)
+	}
+	return kv
+}
+
+func TestImportTree(t *testing.T) {
+	kv := seededVault(t, map[string]map[string]interface{}{
+		"teams/a/db":       {"password": "hunter2-secret", "db.host": "db.internal"},
+		"teams/a/web":      {"api_key": "sk-live-123456", "replicas": 3},
+		"teams/b/db":       {"password": "other-secret"},
+		"teams/b/deep/x/y": {"token": "too-deep"},
+		"teams/shared":     {"region": "eu-west-1"},
+		"other/app":        {"key": "outside"},
+	})
+
+	secrets, skipped, err := importTree(context.Background(), kv, "teams", 2, engine.MaskFull)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(skipped, []string{"b/deep/"}) {
+		t.Errorf("skipped = %v, want [b/deep/]", skipped)
+	}
+
+	var names []string
+	for _, s := range secrets {
+		names = append(names, s.Name())
+	}
+	if expected := []string{"teams-a-db", "teams-a-web", "teams-b-db", "teams-shared"}; !slices.Equal(names, expected) {
+		t.Errorf("names = %v, want %v", names, expected)
+	}
+
+	skeleton := string(renderSkeleton(secrets))
+	for _, secret := range []string{"hunter2-secret", "sk-live-123456", "other-secret", "eu-west-1", "outside", "too-deep"} {
+		if strings.Contains(skeleton, secret) {
+			t.Errorf("skeleton contains %q:\n%s", secret, skeleton)
+		}
+	}
+
+	// The skeleton is a valid config describing the imported paths
+	cfg, err := config.ParseHCL([]byte(skeleton), "import.hcl", nil)
+	if err != nil {
+		t.Fatalf("skeleton doesn't parse: %v\n%s", err, skeleton)
+	}
+	block := cfg.Secrets["teams-a-db"]
+	if block.Mount != "secret" || block.Path != "teams/a/db" {
+		t.Errorf("teams-a-db = %s/%s", block.Mount, block.Path)
+	}
+	for _, key := range []string{"password", "db.host"} {
+		if v := block.Content[key]; v.Type != config.ValueTypeStatic || v.Static != engine.FullMask {
+			t.Errorf("teams-a-db %s = %+v, want a masked placeholder", key, v)
+		}
+	}
+	if v := cfg.Secrets["teams-a-web"].Content["replicas"]; v.Static != engine.FullMask {
+		t.Errorf("replicas = %+v, want a masked placeholder", v)
+	}
+}
+
+func TestImportTree_NameCollision(t *testing.T) {
+	kv := seededVault(t, map[string]map[string]interface{}{
+		"app/db": {"password": "x"},
+		"app-db": {"password": "y"},
+	})
+
+	_, _, err := importTree(context.Background(), kv, "", 0, engine.MaskFull)
+	if err == nil || !strings.Contains(err.Error(), `would both be named "app-db"`) {
+		t.Errorf("expected a name collision error, got %v", err)
+	}
+}
+
+func TestWriteSkeletonFiles(t *testing.T) {
+	kv := seededVault(t, map[string]map[string]interface{}{
+		"teams/a/db":   {"password": "x"},
+		"teams/a/web":  {"password": "y"},
+		"teams/b/db":   {"password": "z"},
+		"teams/shared": {"region": "eu-west-1"},
+	})
+
+	secrets, _, err := importTree(context.Background(), kv, "teams", 0, engine.MaskFull)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "configs")
+	if err := writeSkeletonFiles(dir, secrets); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, e := range entries {
+		files = append(files, e.Name())
+	}
+	if expected := []string{"a.hcl", "b.hcl", "shared.hcl"}; !slices.Equal(files, expected) {
+		t.Errorf("files = %v, want %v", files, expected)
+	}
+
+	cfg, err := config.LoadFiles([]string{dir}, nil)
+	if err != nil {
+		t.Fatalf("skeleton files don't load: %v", err)
+	}
+	if len(cfg.Secrets) != 4 {
+		t.Errorf("expected 4 secret blocks, got %d", len(cfg.Secrets))
+	}
+
+	// Existing files are never overwritten
+	if err := writeSkeletonFiles(dir, secrets); err == nil {
+		t.Error("expected an error for existing files")
+	}
+}
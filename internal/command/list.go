@@ -0,0 +1,127 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
+)
+
+var listRecursive bool
+
+var listCmd = &cobra.Command{
+	Use:   "list <path>",
+	Short: "List secrets stored under a path in Vault",
+	Long: `List prints the secrets and subpaths directly under a path, one per line.
+Subpaths end with a slash.
+
+The path is given as mount or mount/subpath (e.g. secret/myapp). The KV
+version of the mount is detected automatically.
+
+With --recursive, subpaths are walked and every secret below the path is
+printed, relative to it. A path with nothing under it prints nothing.`,
+	Example: `  # Secrets and subpaths under secret/myapp
+  vsg list secret/myapp
+
+  # Every secret in the mount
+  vsg list secret --recursive`,
+	Args: cobra.ExactArgs(1),
+	RunE: runList,
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().BoolVarP(&listRecursive, "recursive", "r", false, "list secrets in subpaths too")
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	log := getLogger()
+
+	mount, subpath := parsePath(args[0])
+	if mount == "" {
+		return fmt.Errorf("invalid path %q: must include a mount (e.g., secret/myapp)", args[0])
+	}
+
+	vaultClient, err := vault.NewClientFromEnv(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_NAMESPACE"), vaultToken, vaultOptions()...)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error: failed to connect to Vault:", err)
+		return &exitError{Code: ExitVaultError}
+	}
+
+	log.Debug("connected to vault", "address", vaultClient.Address())
+
+	kv, err := vault.NewKVClient(vaultClient, mount, vault.KVVersionAuto)
+	if err != nil {
+		return fmt.Errorf("creating KV client: %w", err)
+	}
+
+	var keys []string
+	if listRecursive {
+		keys, err = walkList(ctx, kv, subpath)
+	} else {
+		keys, err = kv.List(ctx, subpath)
+		sort.Strings(keys)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		fmt.Fprintln(stdout, key)
+	}
+	return nil
+}
+
+// lister lists the keys directly under a path, see vault.KVClient.List.
+type lister interface {
+	List(ctx context.Context, path string) ([]string, error)
+}
+
+// walkList lists every secret below path, descending into subpaths. The
+// returned names are relative to path and sorted.
+func walkList(ctx context.Context, l lister, path string) ([]string, error) {
+	secrets, _, err := walkListDepth(ctx, l, path, 0)
+	return secrets, err
+}
+
+// walkListDepth is walkList descending at most maxDepth levels below path
+// (0 = no limit): with 1, only the secrets directly under path are listed.
+// The subpaths left unlisted are returned too, relative to path and sorted.
+func walkListDepth(ctx context.Context, l lister, path string, maxDepth int) (secrets, skipped []string, err error) {
+	var walk func(prefix string, depth int) error
+	walk = func(prefix string, depth int) error {
+		keys, err := l.List(ctx, strings.Trim(path+"/"+prefix, "/"))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if strings.HasSuffix(key, "/") {
+				if maxDepth > 0 && depth >= maxDepth {
+					skipped = append(skipped, prefix+key)
+					continue
+				}
+				if err := walk(prefix+key, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			secrets = append(secrets, prefix+key)
+		}
+		return nil
+	}
+
+	if err := walk("", 1); err != nil {
+		return nil, nil, err
+	}
+
+	sort.Strings(secrets)
+	sort.Strings(skipped)
+	return secrets, skipped, nil
+}
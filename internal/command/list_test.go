@@ -0,0 +1,52 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// mapLister lists keys from a map of path to keys.
+type mapLister map[string][]string
+
+func (m mapLister) List(ctx context.Context, path string) ([]string, error) {
+	if path == "broken" {
+		return nil, errors.New("permission denied")
+	}
+	return m[path], nil
+}
+
+func TestWalkList(t *testing.T) {
+	l := mapLister{
+		"":             {"myapp/", "shared"},
+		"myapp":        {"prod/", "dev/", "config"},
+		"myapp/dev":    {"db"},
+		"myapp/prod":   {"db", "nested/"},
+		"myapp/prod/n": {"unused"},
+	}
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"", []string{"myapp/config", "myapp/dev/db", "myapp/prod/db", "shared"}},
+		{"myapp", []string{"config", "dev/db", "prod/db"}},
+		{"myapp/prod/", []string{"db"}},
+		{"missing", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := walkList(context.Background(), l, tt.path)
+		if err != nil {
+			t.Fatalf("walkList(%q): unexpected error: %v", tt.path, err)
+		}
+		if !slices.Equal(got, tt.expected) {
+			t.Errorf("walkList(%q) = %v, want %v", tt.path, got, tt.expected)
+		}
+	}
+
+	if _, err := walkList(context.Background(), mapLister{"": {"broken/"}}, ""); err == nil {
+		t.Error("expected the error of a failing subpath")
+	}
+}
@@ -0,0 +1,176 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
+)
+
+var (
+	readOutput     string
+	readShowValues bool
+	readVersion    int
+)
+
+var readCmd = &cobra.Command{
+	Use:   "read <path>",
+	Short: "Display a secret stored in Vault",
+	Long: `Read fetches a secret from Vault and displays its keys and values.
+
+The path is given as mount/subpath (e.g. secret/myapp). The KV version of
+the mount is detected automatically.
+
+--version reads an older version of a KV v2 secret instead of the latest.
+
+Values are masked by default. Use --show-values to reveal them, as
+stored: the output redaction, which masks tokens and credentials in URLs
+elsewhere, doesn't apply to them. When a config is given (--config or
+VSG_CONFIG), keys matching its redact.always_mask patterns stay fully
+masked even with --show-values.`,
+	Example: `  # Show keys with masked values
+  vsg read secret/myapp
+
+  # Reveal values
+  vsg read secret/myapp --show-values
+
+  # JSON output
+  vsg read secret/myapp --output json
+
+  # An older version
+  vsg read secret/myapp --version 3`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRead,
+}
+
+func init() {
+	rootCmd.AddCommand(readCmd)
+
+	readCmd.Flags().StringVarP(&readOutput, "output", "o", "text", "output format: text, json")
+	readCmd.Flags().BoolVar(&readShowValues, "show-values", false, "show secret values instead of masking them")
+	readCmd.Flags().IntVar(&readVersion, "version", 0, "KV v2 version to read (0 = latest)")
+}
+
+func runRead(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	log := getLogger()
+	path := args[0]
+
+	if readOutput != "text" && readOutput != "json" {
+		return fmt.Errorf("unknown output format: %s (use 'text' or 'json')", readOutput)
+	}
+	if readVersion < 0 {
+		return fmt.Errorf("invalid --version %d: must be 0 or more", readVersion)
+	}
+
+	mount, subpath, err := readPath(path)
+	if err != nil {
+		return err
+	}
+
+	// The config is optional here, only its redaction settings are used
+	var alwaysMask []string
+	if cfgPaths, err := getConfigFiles(); err == nil {
+		cfg, err := loadConfig(ctx, cfgPaths)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		alwaysMask = cfg.Redact.AlwaysMask
+	}
+
+	vaultClient, err := vault.NewClientFromEnv(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_NAMESPACE"), vaultToken, vaultOptions()...)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error: failed to connect to Vault:", err)
+		return &exitError{Code: ExitVaultError}
+	}
+
+	log.Debug("connected to vault", "address", vaultClient.Address())
+
+	kv, err := vault.NewKVClient(vaultClient, mount, vault.KVVersionAuto)
+	if err != nil {
+		return fmt.Errorf("creating KV client: %w", err)
+	}
+
+	var data map[string]interface{}
+	if readVersion > 0 {
+		data, err = kv.ReadAtVersion(ctx, subpath, readVersion)
+	} else {
+		data, err = kv.Read(ctx, subpath)
+	}
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		if readVersion > 0 {
+			return fmt.Errorf("version %d of secret %s not found or deleted", readVersion, path)
+		}
+		return fmt.Errorf("secret %s not found", path)
+	}
+
+	values := readValues(data, readShowValues, alwaysMask)
+
+	// Revealed values are what the user asked to see, so they bypass the
+	// redaction writer, which would mask tokens and DSNs among them
+	out := stdout
+	if readShowValues {
+		out = cmd.OutOrStdout()
+	}
+	return writeSecret(out, path, kv.Version(), readVersion, values, readOutput)
+}
+
+// readPath splits the path of a secret to read into its mount and subpath,
+// which must both be given.
+func readPath(path string) (mount, subpath string, err error) {
+	mount, subpath = parsePath(path)
+	if subpath == "" {
+		return "", "", fmt.Errorf("invalid path %q: must include mount and subpath (e.g., secret/myapp)", path)
+	}
+	return mount, subpath, nil
+}
+
+// readValues returns the values of a secret as they are displayed: masked
+// unless showValues, and fully masked for keys matching alwaysMask.
+func readValues(data map[string]interface{}, showValues bool, alwaysMask []string) map[string]string {
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		values[k] = engine.DisplayValue(k, fmt.Sprintf("%v", v), showValues, alwaysMask)
+	}
+	return values
+}
+
+// writeSecret writes the values of the secret at path to w as JSON, or as
+// text sorted by key under a header with the KV version of the mount and
+// the version read, if one was given.
+func writeSecret(w io.Writer, path string, kvVersion vault.KVVersion, version int, values map[string]string, output string) error {
+	if output == "json" {
+		data, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshaling secret: %w", err)
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if version > 0 {
+		fmt.Fprintf(w, "=== %s (KV v%d, version %d)\n", path, kvVersion, version)
+	} else {
+		fmt.Fprintf(w, "=== %s (KV v%d)\n", path, kvVersion)
+	}
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s = %s\n", k, values[k])
+	}
+
+	return nil
+}
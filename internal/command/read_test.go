@@ -0,0 +1,103 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"testing"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+)
+
+func TestReadPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		mount   string
+		subpath string
+		wantErr bool
+	}{
+		{path: "secret/myapp", mount: "secret", subpath: "myapp"},
+		{path: "/kv/teams/a/db/", mount: "kv", subpath: "teams/a/db"},
+		{path: "secret", wantErr: true},
+		{path: "secret/", wantErr: true},
+		{path: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		mount, subpath, err := readPath(tt.path)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("readPath(%q): expected an error", tt.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("readPath(%q): unexpected error: %v", tt.path, err)
+			continue
+		}
+		if mount != tt.mount || subpath != tt.subpath {
+			t.Errorf("readPath(%q) = %q, %q, want %q, %q", tt.path, mount, subpath, tt.mount, tt.subpath)
+		}
+	}
+}
+
+func TestReadValues(t *testing.T) {
+	data := map[string]interface{}{
+		"password": "hunter2-secret",
+		"api_key":  "sk-live-123456",
+		"port":     5432,
+	}
+	alwaysMask := []string{"api_*"}
+
+	// Masked by default
+	expected := map[string]string{
+		"password": engine.MaskValue("hunter2-secret", engine.MaskPartial),
+		"api_key":  engine.FullMask,
+		"port":     engine.MaskValue("5432", engine.MaskPartial),
+	}
+	if got := readValues(data, false, alwaysMask); !maps.Equal(got, expected) {
+		t.Errorf("masked: got %v, want %v", got, expected)
+	}
+
+	// Revealed, except for always_mask keys
+	expected = map[string]string{
+		"password": "hunter2-secret",
+		"api_key":  engine.FullMask,
+		"port":     "5432",
+	}
+	if got := readValues(data, true, alwaysMask); !maps.Equal(got, expected) {
+		t.Errorf("shown: got %v, want %v", got, expected)
+	}
+}
+
+func TestWriteSecret(t *testing.T) {
+	values := map[string]string{"password": "hunter2", "host": "db.internal"}
+
+	var out bytes.Buffer
+	if err := writeSecret(&out, "secret/myapp", 2, 0, values, "text"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "=== secret/myapp (KV v2)\n  host = db.internal\n  password = hunter2\n"; out.String() != expected {
+		t.Errorf("text output = %q, want %q", out.String(), expected)
+	}
+
+	out.Reset()
+	if err := writeSecret(&out, "secret/myapp", 2, 3, values, "text"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "=== secret/myapp (KV v2, version 3)\n"; !bytes.HasPrefix(out.Bytes(), []byte(expected)) {
+		t.Errorf("versioned output = %q, want a %q header", out.String(), expected)
+	}
+
+	out.Reset()
+	if err := writeSecret(&out, "secret/myapp", 2, 0, values, "json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", out.String(), err)
+	}
+	if !maps.Equal(got, values) {
+		t.Errorf("JSON output = %v, want %v", got, values)
+	}
+}
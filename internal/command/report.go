@@ -0,0 +1,90 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+)
+
+// RunReport is the record of an apply run written by --report, for audit.
+// It holds block names, paths, change counts, and errors, never values.
+type RunReport struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Config    []string      `json:"config"`
+	DryRun    bool          `json:"dry_run"`
+	Applied   bool          `json:"applied"`
+	Totals    ChangeCounts  `json:"totals"`
+	Blocks    []BlockReport `json:"blocks"`
+	Errors    []string      `json:"errors"`
+}
+
+// BlockReport is the part of a RunReport about one secret block.
+type BlockReport struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	ChangeCounts
+}
+
+// ChangeCounts counts the keys of a diff by change type, see Diff.Summary.
+type ChangeCounts struct {
+	Add       int `json:"add"`
+	Update    int `json:"update"`
+	Delete    int `json:"delete"`
+	Unmanaged int `json:"unmanaged"`
+	Unchanged int `json:"unchanged"`
+}
+
+func changeCounts(diff *engine.Diff) ChangeCounts {
+	var c ChangeCounts
+	c.Add, c.Update, c.Delete, c.Unmanaged, c.Unchanged = diff.Summary()
+	return c
+}
+
+func blockChangeCounts(block *engine.BlockDiff) ChangeCounts {
+	var c ChangeCounts
+	c.Add, c.Update, c.Delete, c.Unmanaged, c.Unchanged = block.Summary()
+	return c
+}
+
+// newRunReport builds the report of an apply run from its result.
+func newRunReport(result *engine.Result, cfgPaths []string, dryRun bool, at time.Time) *RunReport {
+	report := &RunReport{
+		Timestamp: at.UTC(),
+		Config:    cfgPaths,
+		DryRun:    dryRun,
+		Applied:   result.Applied,
+		Totals:    changeCounts(result.Diff),
+		Blocks:    make([]BlockReport, 0, len(result.Diff.Blocks)),
+		Errors:    make([]string, 0, len(result.Errors)),
+	}
+
+	for _, block := range result.Diff.Blocks {
+		report.Blocks = append(report.Blocks, BlockReport{
+			Name:         block.Name,
+			Path:         block.FullPath(),
+			ChangeCounts: blockChangeCounts(&block),
+		})
+	}
+	for _, e := range result.Errors {
+		report.Errors = append(report.Errors, e.Error())
+	}
+
+	return report
+}
+
+// writeRunReport writes report to path as indented JSON. Errors are
+// redacted like any other output, since they may quote source content.
+func writeRunReport(path string, report *RunReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("formatting report: %w", err)
+	}
+
+	if err := os.WriteFile(path, []byte(redactor.String(string(data))+"\n"), 0o600); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package command
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+)
+
+func TestNewRunReport(t *testing.T) {
+	result := testApplyResult()
+	result.Diff.Blocks = append(result.Diff.Blocks, engine.BlockDiff{
+		Name:  "cache",
+		Mount: "secret",
+		Path:  "cache",
+		Changes: []engine.SecretChange{
+			{Key: "token", Change: engine.ChangeNone, OldValue: "tok", NewValue: "tok"},
+			{Key: "legacy", Change: engine.ChangeDelete, OldValue: "old-value"},
+		},
+	})
+	at := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	report := newRunReport(result, []string{"config.hcl"}, false, at)
+
+	if !report.Timestamp.Equal(at) || !report.Applied || report.DryRun {
+		t.Errorf("unexpected run fields: %+v", report)
+	}
+	if len(report.Config) != 1 || report.Config[0] != "config.hcl" {
+		t.Errorf("config = %v", report.Config)
+	}
+	if want := (ChangeCounts{Add: 1, Update: 1, Delete: 1, Unchanged: 1}); report.Totals != want {
+		t.Errorf("totals = %+v, want %+v", report.Totals, want)
+	}
+	if len(report.Blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %+v", report.Blocks)
+	}
+	if b := report.Blocks[0]; b.Name != "app" || b.Path != "secret/app" || b.Add != 1 || b.Update != 1 {
+		t.Errorf("unexpected app block: %+v", b)
+	}
+	if b := report.Blocks[1]; b.Name != "cache" || b.Delete != 1 || b.Unchanged != 1 {
+		t.Errorf("unexpected cache block: %+v", b)
+	}
+	if len(report.Errors) != 1 || report.Errors[0] != "db/password: fetch failed" {
+		t.Errorf("errors = %v", report.Errors)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := writeRunReport(path, report); err != nil {
+		t.Fatalf("writing report: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("report is not valid JSON: %v\n%s", err, data)
+	}
+	for _, value := range []string{"super-secret", "old-host", "new-host", "old-value", "tok\""} {
+		if strings.Contains(string(data), value) {
+			t.Errorf("report contains the value %q:\n%s", value, data)
+		}
+	}
+}
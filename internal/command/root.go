@@ -2,14 +2,24 @@ package command
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/redact"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
 )
 
 // Exit codes
@@ -19,16 +29,36 @@ const (
 	ExitVaultError     = 2
 	ExitFetchError     = 3
 	ExitPartialFailure = 4
+	ExitDrift          = 5
 )
 
 var (
 	// Global flags
-	configFile string
-	verbose    bool
-	cliVars    []string
+	configFiles    []string
+	configDir      string
+	baseDefaults   string
+	verbose        bool
+	cliVars        []string
+	cliVaultVars   []string
+	vaultToken     string
+	maxFetchSize   int64
+	kvVersion      int
+	defaultMount   string
+	commandTimeout time.Duration
+	vaultRetries   int
+	vaultRetryWait time.Duration
 
 	// Logger
 	logger *slog.Logger
+
+	// Output writers - all command output and logs pass through redaction
+	redactor           = redact.New(redact.DefaultRules()...)
+	stdout   io.Writer = redact.NewWriter(os.Stdout, redactor)
+	stderr   io.Writer = redact.NewWriter(os.Stderr, redactor)
+
+	// vaultVarValues are the values read by --var-from-vault, which are
+	// redacted from output like credentials
+	vaultVarValues []string
 )
 
 // rootCmd is the base command
@@ -42,17 +72,25 @@ generated passwords, commands, and static values.
 Use declarative HCL configuration for GitOps workflows.`,
 	SilenceUsage:  true,
 	SilenceErrors: true,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		// Set up logging
 		level := slog.LevelInfo
 		if verbose {
 			level = slog.LevelDebug
 		}
 
-		handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		handler := slog.NewTextHandler(stderr, &slog.HandlerOptions{
 			Level: level,
 		})
 		logger = slog.New(handler)
+
+		if kvVersion < 0 || kvVersion > 2 {
+			return fmt.Errorf("invalid --kv-version %d: must be 1 or 2", kvVersion)
+		}
+		if vaultRetries < 1 {
+			return fmt.Errorf("invalid --vault-retries %d: must be at least 1", vaultRetries)
+		}
+		return nil
 	},
 }
 
@@ -61,15 +99,62 @@ func Execute() {
 	ctx := context.Background()
 
 	if err := rootCmd.ExecuteContext(ctx); err != nil {
-		fmt.Fprintln(os.Stderr, "Error:", err)
-		os.Exit(ExitConfigError)
+		var exitErr *exitError
+		if !errors.As(err, &exitErr) {
+			fmt.Fprintln(stderr, "Error:", err)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitError is returned by a command that has already reported why it
+// failed, to exit with Code once its deferred cleanup has run.
+type exitError struct {
+	Code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// exitCode returns the exit code of a command that failed with err, from
+// the type of error it wraps. Errors of no known type are usage or config
+// errors.
+func exitCode(err error) int {
+	var (
+		exitErr   *exitError
+		configErr *config.ConfigError
+		vaultErr  *engine.VaultError
+		fetchErr  *engine.FetchError
+	)
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.Code
+	case errors.As(err, &configErr):
+		return ExitConfigError
+	case errors.As(err, &vaultErr):
+		return ExitVaultError
+	case errors.As(err, &fetchErr):
+		return ExitFetchError
+	default:
+		return ExitConfigError
 	}
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "config file path (or set VSG_CONFIG)")
+	rootCmd.PersistentFlags().StringArrayVarP(&configFiles, "config", "c", nil, "config file path, glob, or http(s) URL, can be repeated (or set VSG_CONFIG)")
+	rootCmd.PersistentFlags().StringVar(&configDir, "config-dir", "", "directory whose *.hcl files make up the config")
+	rootCmd.PersistentFlags().StringVar(&baseDefaults, "base", "", "defaults-only HCL file or http(s) URL beneath the config's defaults block (or set "+config.BaseDefaultsEnv+")")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().StringArrayVar(&cliVars, "var", nil, "set variable KEY=VALUE (can be repeated)")
+	rootCmd.PersistentFlags().StringArrayVar(&cliVaultVars, "var-from-vault", nil, "set variable KEY=mount/path#key from Vault before the config is parsed (can be repeated)")
+	rootCmd.PersistentFlags().Int64Var(&maxFetchSize, "max-fetch-size", fetcher.DefaultMaxFetchSize, "maximum size in bytes of content fetched from a source URL")
+	rootCmd.PersistentFlags().DurationVar(&commandTimeout, "command-timeout", 0, "maximum run time of command() values without a timeout option (0 = no limit)")
+	rootCmd.PersistentFlags().StringVar(&defaultMount, "mount", "", "KV mount for secrets without an explicit mount, overrides defaults.mount")
+	rootCmd.PersistentFlags().IntVar(&kvVersion, "kv-version", 0, "KV version (1 or 2) for every secret, skipping auto-detection (per-secret version still wins)")
+	rootCmd.PersistentFlags().IntVar(&vaultRetries, "vault-retries", vault.DefaultMaxAttempts, "attempts per Vault request on 429, 5xx and connection errors (1 = no retries)")
+	rootCmd.PersistentFlags().DurationVar(&vaultRetryWait, "vault-retry-delay", vault.DefaultRetryDelay, "delay before the first retry of a Vault request, doubled after each attempt")
+	rootCmd.PersistentFlags().StringVar(&vaultToken, "vault-token", "", "Vault token to log in with, in place of VAULT_TOKEN and the config's auth method (insecure: visible in process list, prefer VAULT_TOKEN for automation)")
 }
 
 // parseVars converts --var flags to a Variables map.
@@ -84,17 +169,141 @@ func parseVars() config.Variables {
 	return vars
 }
 
-// getConfigFile returns the config file path from flag or environment
-func getConfigFile() (string, error) {
-	if configFile != "" {
-		return configFile, nil
+// configVars returns the variables for parsing the config: --var-from-vault
+// values read from Vault, overridden by --var values.
+func configVars(ctx context.Context) (config.Variables, error) {
+	vars := make(config.Variables)
+
+	vaultVarValues = nil
+	if len(cliVaultVars) > 0 {
+		// The config isn't parsed yet, so its vault block can't be used.
+		// Connect with VAULT_ADDR, VAULT_NAMESPACE, and VAULT_TOKEN instead.
+		client, err := vault.NewClientFromEnv(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_NAMESPACE"), vaultToken, vaultOptions()...)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to Vault for --var-from-vault: %w", err)
+		}
+		defer client.Close()
+
+		vaultVars, err := readVaultVars(ctx, engine.NewVaultReader(client), cliVaultVars)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(vars, vaultVars)
+
+		// Values from Vault may be secrets: redact them before they can
+		// show up in a config error
+		vaultVarValues = slices.Collect(maps.Values(vaultVars))
+		if err := redactor.SetPatterns(redactPatterns(nil)...); err != nil {
+			return nil, err
+		}
+	}
+
+	maps.Copy(vars, parseVars())
+	return vars, nil
+}
+
+// readVaultVars reads --var-from-vault values, given as NAME=path#key.
+func readVaultVars(ctx context.Context, reader engine.VaultReader, specs []string) (config.Variables, error) {
+	vars := make(config.Variables, len(specs))
+	for _, spec := range specs {
+		name, ref, ok := strings.Cut(spec, "=")
+		path, key, hasKey := strings.Cut(ref, "#")
+		if !ok || !hasKey || name == "" || path == "" || key == "" {
+			return nil, fmt.Errorf("invalid --var-from-vault %q: expected NAME=mount/path#key", spec)
+		}
+
+		value, err := reader.ReadSecret(ctx, path, key, 0)
+		if err != nil {
+			return nil, fmt.Errorf("--var-from-vault %s: %w", name, err)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// getConfigFiles returns the config paths from --config and --config-dir,
+// or from the environment if neither is given
+func getConfigFiles() ([]string, error) {
+	paths := slices.Clone(configFiles)
+	if configDir != "" {
+		paths = append(paths, configDir)
+	}
+	if len(paths) > 0 {
+		return paths, nil
 	}
 
 	if envConfig := os.Getenv("VSG_CONFIG"); envConfig != "" {
-		return envConfig, nil
+		return []string{envConfig}, nil
+	}
+
+	return nil, fmt.Errorf("config file required: use --config, --config-dir, or set VSG_CONFIG")
+}
+
+// getBaseDefaults returns the base defaults file from --base, or from the
+// environment if it isn't given. Empty means no base.
+func getBaseDefaults() string {
+	if baseDefaults != "" {
+		return baseDefaults
+	}
+	return os.Getenv(config.BaseDefaultsEnv)
+}
+
+// loadConfig loads the config files with CLI variables, applies Vault flag
+// overrides, and installs its redaction patterns for all subsequent output.
+func loadConfig(ctx context.Context, paths []string) (*config.Config, error) {
+	vars, err := configVars(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.LoadFilesWithBase(getBaseDefaults(), paths, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// Catch password policies that can never generate before anything runs
+	if err := engine.CheckPolicies(cfg); err != nil {
+		return nil, &config.ConfigError{Err: err}
 	}
 
-	return "", fmt.Errorf("config file required: use --config or set VSG_CONFIG")
+	// A token on the command line replaces the config's auth method, so
+	// it's never posted to another method's login or ignored by it
+	if vaultToken != "" {
+		cfg.Vault.Auth = config.AuthConfig{Method: "token", Token: vaultToken}
+	}
+	if defaultMount != "" {
+		cfg.SetDefaultMount(defaultMount)
+	}
+
+	if err := redactor.SetPatterns(redactPatterns(cfg)...); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// redactPatterns returns the config's redaction patterns, if cfg isn't nil,
+// plus any credentials passed on the command line and values read by
+// --var-from-vault.
+func redactPatterns(cfg *config.Config) []string {
+	var patterns []string
+	if cfg != nil {
+		patterns = slices.Clone(cfg.Redact.Patterns)
+	}
+	for _, secret := range append([]string{vaultToken}, vaultVarValues...) {
+		if secret != "" {
+			patterns = append(patterns, regexp.QuoteMeta(secret))
+		}
+	}
+	return patterns
+}
+
+// vaultOptions returns the Vault client options set by global flags.
+func vaultOptions() []vault.ClientOption {
+	return []vault.ClientOption{
+		vault.WithKVVersion(vault.KVVersion(kvVersion)),
+		vault.WithRetry(vaultRetries, vaultRetryWait),
+	}
 }
 
 // getLogger returns the configured logger
@@ -0,0 +1,157 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/redact"
+)
+
+// fakeVaultReader serves secrets from a map keyed by "path#key".
+type fakeVaultReader map[string]string
+
+func (f fakeVaultReader) ReadSecret(ctx context.Context, path, key string, version int) (string, error) {
+	value, ok := f[path+"#"+key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found in secret %s", key, path)
+	}
+	return value, nil
+}
+
+func TestReadVaultVars(t *testing.T) {
+	reader := fakeVaultReader{"secret/meta#environment": "staging"}
+
+	vars, err := readVaultVars(context.Background(), reader, []string{"ENV=secret/meta#environment"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vars["ENV"] != "staging" {
+		t.Fatalf("ENV = %q, want staging", vars["ENV"])
+	}
+
+	// The variable feeds env() when the config is parsed
+	hcl := `
+secret "app" {
+  path = "${env("ENV")}/app"
+  content {
+    key = "value"
+  }
+}
+`
+	cfg, err := config.ParseHCL([]byte(hcl), "test.hcl", vars)
+	if err != nil {
+		t.Fatalf("parsing config: %v", err)
+	}
+	if got := cfg.Secrets["app"].Path; got != "staging/app" {
+		t.Errorf("path = %q, want staging/app", got)
+	}
+}
+
+func TestReadVaultVarsErrors(t *testing.T) {
+	reader := fakeVaultReader{"secret/meta#environment": "staging"}
+
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{"ENV", "expected NAME=mount/path#key"},
+		{"ENV=secret/meta", "expected NAME=mount/path#key"},
+		{"=secret/meta#environment", "expected NAME=mount/path#key"},
+		{"ENV=secret/meta#", "expected NAME=mount/path#key"},
+		{"ENV=secret/meta#region", `--var-from-vault ENV: key "region" not found`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := readVaultVars(context.Background(), reader, []string{tt.spec})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_VaultTokenFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vsg.hcl")
+	hcl := `
+vault {
+  address = "https://vault.example.com"
+  auth {
+    method = "jwt"
+    role   = "ci"
+    jwt    = "eyJ"
+  }
+}
+
+secret "app" {
+  path = "app"
+  content {
+    key = "value"
+  }
+}
+`
+	if err := os.WriteFile(path, []byte(hcl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig(context.Background(), []string{path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auth := cfg.Vault.Auth; auth.Method != "jwt" || auth.JWT != "eyJ" || auth.Token != "" {
+		t.Errorf("unexpected auth without --vault-token: %+v", auth)
+	}
+
+	// The flag's token is used with token auth, not posted as the JWT
+	vaultToken = "hvs.flag-token"
+	t.Cleanup(func() {
+		vaultToken = ""
+		_ = redactor.SetPatterns()
+	})
+	cfg, err = loadConfig(context.Background(), []string{path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := (config.AuthConfig{Method: "token", Token: "hvs.flag-token"}); cfg.Vault.Auth != expected {
+		t.Errorf("Auth = %+v, want %+v", cfg.Vault.Auth, expected)
+	}
+}
+
+func TestConfigVars_RedactsVaultValues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/sys/mounts" {
+			_, _ = w.Write([]byte(`{"data":{"secret/":{"type":"kv","options":{"version":"2"}}}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"db_password":"hunter2-from-vault"},"metadata":{"version":1}}}`))
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	cliVaultVars = []string{"DB_PASSWORD=secret/meta#db_password"}
+	t.Cleanup(func() {
+		cliVaultVars = nil
+		vaultVarValues = nil
+		_ = redactor.SetPatterns()
+	})
+
+	vars, err := configVars(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vars["DB_PASSWORD"] != "hunter2-from-vault" {
+		t.Fatalf("DB_PASSWORD = %q, want hunter2-from-vault", vars["DB_PASSWORD"])
+	}
+	if got := redactor.String("password is hunter2-from-vault"); got != "password is "+redact.Placeholder {
+		t.Errorf("expected the value to be redacted, got %q", got)
+	}
+}
@@ -19,11 +19,11 @@ var versionCmd = &cobra.Command{
 	Short: "Print version information",
 	Long:  `Print the version, commit hash, and build date of vsg.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("vsg %s\n", Version)
-		fmt.Printf("  commit:     %s\n", Commit)
-		fmt.Printf("  built:      %s\n", BuildDate)
-		fmt.Printf("  go version: %s\n", runtime.Version())
-		fmt.Printf("  platform:   %s/%s\n", runtime.GOOS, runtime.GOARCH)
+		fmt.Fprintf(stdout, "vsg %s\n", Version)
+		fmt.Fprintf(stdout, "  commit:     %s\n", Commit)
+		fmt.Fprintf(stdout, "  built:      %s\n", BuildDate)
+		fmt.Fprintf(stdout, "  go version: %s\n", runtime.Version())
+		fmt.Fprintf(stdout, "  platform:   %s/%s\n", runtime.GOOS, runtime.GOARCH)
 	},
 }
 
@@ -0,0 +1,177 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/metrics"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
+)
+
+var (
+	watchInterval time.Duration
+	watchTarget   []string
+	watchExclude  []string
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Continuously apply secrets to Vault on an interval",
+	Long: `Watch runs apply in a loop, re-reading the configuration file and
+reconciling secrets with Vault on every cycle.
+
+This is intended for running VSG as a long-lived sidecar or daemon that keeps
+Vault in sync with the configuration. Each cycle reloads the config, so edits
+are picked up on the next run. Source files are fetched fresh on every cycle.
+
+Errors in a single cycle are logged and do not stop the loop.
+The command exits cleanly on SIGINT or SIGTERM.`,
+	Example: `  # Re-apply every 5 minutes (default)
+  vsg watch --config config.hcl
+
+  # Re-apply every 30 seconds
+  vsg watch --config config.hcl --interval 30s
+
+  # Watch specific secrets only
+  vsg watch --config config.hcl --interval 1m --target prod-app`,
+	RunE: runWatch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 5*time.Minute, "time between reconciliation cycles")
+	watchCmd.Flags().StringSliceVarP(&watchTarget, "target", "t", nil, "target specific secrets by label or glob (comma-separated or repeated)")
+	watchCmd.Flags().StringSliceVarP(&watchExclude, "exclude", "e", nil, "exclude secrets by label or glob (comma-separated or repeated)")
+	watchCmd.Flags().StringVar(&metricsFile, "metrics-file", "", "write Prometheus textfile metrics to this path after each cycle")
+	watchCmd.Flags().IntVar(&concurrency, "concurrency", defaultConcurrency, "maximum number of secret blocks processed at once")
+	watchCmd.Flags().IntVar(&parallelFetch, "parallel-fetch", 0, "fetch up to this many json/yaml/raw sources at once before processing blocks (0 = fetch as needed)")
+	watchCmd.Flags().BoolVar(&noFetchCache, "no-fetch-cache", false, "fetch a source again for every value using it instead of once per run")
+	watchCmd.Flags().BoolVar(&checkCapabilities, "check-capabilities", false, "verify the token can read and write every targeted path before each cycle")
+	watchCmd.Flags().BoolVar(&checkAndSet, "cas", false, "write KV v2 secrets with check-and-set, failing a block changed since it was read")
+
+	registerBlockCompletion(watchCmd)
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	if watchInterval <= 0 {
+		return fmt.Errorf("--interval must be greater than zero")
+	}
+	// Checked once up front, so a bad pattern doesn't fail every cycle
+	if err := engine.ValidateLabels(slices.Concat(watchTarget, watchExclude)); err != nil {
+		return err
+	}
+
+	cfgPaths, err := getConfigFiles()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log := getLogger()
+	log.Info("starting watch", "config", cfgPaths, "interval", watchInterval.String())
+
+	// The fetchers and their cloud clients last for the whole watch; only
+	// the cache is cleared, so each cycle still fetches fresh
+	registry := setupFetchers(ctx)
+	//nolint:errcheck // Best effort close on defer
+	defer registry.Close()
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for cycle := 1; ; cycle++ {
+		registry.ClearCache()
+		runWatchCycle(ctx, log, registry, cfgPaths, cycle)
+
+		select {
+		case <-ctx.Done():
+			log.Info("stopping watch", "cycles", cycle)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runWatchCycle performs a single reconciliation and logs its outcome.
+// Failures are logged rather than returned so the watch loop keeps running.
+func runWatchCycle(ctx context.Context, log *slog.Logger, registry *fetcher.Registry, cfgPaths []string, cycle int) {
+	start := time.Now()
+	log = log.With("cycle", cycle)
+
+	result, err := reconcileOnce(ctx, log, registry, cfgPaths)
+	if err != nil {
+		log.Error("cycle failed", "error", err, "duration", time.Since(start).String())
+		return
+	}
+
+	writeMetrics(metrics.Run{
+		Command: "watch",
+		Result:  result,
+		Start:   start,
+		End:     time.Now(),
+	})
+
+	adds, updates, deletes, unmanaged, unchanged := result.Diff.Summary()
+	for _, e := range result.Errors {
+		log.Error("secret failed", "error", e.Error())
+	}
+
+	log.Info("cycle complete",
+		"added", adds,
+		"updated", updates,
+		"deleted", deletes,
+		"unmanaged", unmanaged,
+		"unchanged", unchanged,
+		"errors", len(result.Errors),
+		"applied", result.Applied,
+		"duration", time.Since(start).String(),
+	)
+}
+
+// reconcileOnce loads the config and runs a full reconciliation against
+// Vault, fetching sources through registry.
+func reconcileOnce(ctx context.Context, log *slog.Logger, registry *fetcher.Registry, cfgPaths []string) (*engine.Result, error) {
+	cfg, err := loadConfig(ctx, cfgPaths)
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+
+	vaultClient, err := vault.NewClient(cfg.Vault, vaultOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to vault: %w", err)
+	}
+	// Each cycle logs in again, so the renewal ends with the cycle
+	defer vaultClient.Close()
+
+	if err := vaultClient.CheckHealth(ctx); err != nil {
+		return nil, fmt.Errorf("vault health check: %w", err)
+	}
+
+	eng := engine.NewEngine(vaultClient, registry, cfg.Defaults, log)
+
+	opts := engine.Options{
+		Target:  watchTarget,
+		Exclude: watchExclude,
+
+		CheckCapabilities: checkCapabilities,
+		CheckAndSet:       checkAndSet,
+		Concurrency:       concurrency,
+		ParallelFetch:     parallelFetch,
+		CommandTimeout:    commandTimeout,
+	}
+
+	return eng.Reconcile(ctx, cfg, opts)
+}
@@ -0,0 +1,157 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
+)
+
+// newWatchVault serves fakeKV behind a healthy /v1/sys/health, calling
+// onWrite after every write.
+func newWatchVault(t *testing.T, store *fakeKV, onWrite func()) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/sys/health" {
+			_, _ = w.Write([]byte(`{"initialized": true, "sealed": false}`))
+			return
+		}
+		store.ServeHTTP(w, r)
+		if r.Method != http.MethodGet && onWrite != nil {
+			onWrite()
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("VAULT_TOKEN", "test-token")
+	return server
+}
+
+// writeWatchConfig writes a config with one static key for the server.
+func writeWatchConfig(t *testing.T, address string) string {
+	t.Helper()
+
+	cfgPath := filepath.Join(t.TempDir(), "vsg.hcl")
+	hcl := fmt.Sprintf(`
+vault {
+  address = %q
+  auth {
+    method = "token"
+  }
+}
+
+secret "app" {
+  path    = "app"
+  version = 2
+
+  content {
+    host = "db.internal"
+  }
+}
+`, address)
+	if err := os.WriteFile(cfgPath, []byte(hcl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cfgPath
+}
+
+func TestReconcileOnce(t *testing.T) {
+	store := &fakeKV{}
+	server := newWatchVault(t, store, nil)
+	cfgPath := writeWatchConfig(t, server.URL)
+
+	log := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	result, err := reconcileOnce(context.Background(), log, fetcher.NewRegistry(), []string{cfgPath})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected block errors: %v", result.Errors)
+	}
+	if !result.Applied {
+		t.Error("expected the changes to be applied")
+	}
+	if store.data["host"] != "db.internal" {
+		t.Errorf("expected host to be written, got %v", store.data)
+	}
+}
+
+func TestRunWatchCycle(t *testing.T) {
+	store := &fakeKV{}
+	server := newWatchVault(t, store, nil)
+	cfgPath := writeWatchConfig(t, server.URL)
+
+	var logs bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&logs, nil))
+	registry := fetcher.NewRegistry()
+
+	runWatchCycle(context.Background(), log, registry, []string{cfgPath}, 1)
+	if !strings.Contains(logs.String(), `msg="cycle complete" cycle=1 added=1`) {
+		t.Errorf("expected the first cycle to add the key, got:\n%s", logs.String())
+	}
+
+	// Nothing left to do on the next cycle
+	logs.Reset()
+	runWatchCycle(context.Background(), log, registry, []string{cfgPath}, 2)
+	if !strings.Contains(logs.String(), `msg="cycle complete" cycle=2 added=0 updated=0 deleted=0 unmanaged=0 unchanged=1 errors=0`) {
+		t.Errorf("expected the second cycle to change nothing, got:\n%s", logs.String())
+	}
+
+	// A failed cycle is logged, not returned
+	logs.Reset()
+	runWatchCycle(context.Background(), log, registry, []string{filepath.Join(t.TempDir(), "missing.hcl")}, 3)
+	if !strings.Contains(logs.String(), `msg="cycle failed" cycle=3`) {
+		t.Errorf("expected the cycle failure to be logged, got:\n%s", logs.String())
+	}
+}
+
+func TestWatch_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cancel once the first cycle has written, long before the next tick
+	store := &fakeKV{}
+	server := newWatchVault(t, store, cancel)
+	cfgPath := writeWatchConfig(t, server.URL)
+
+	var logs bytes.Buffer
+	configFiles = []string{cfgPath}
+	watchInterval = time.Hour
+	logger = slog.New(slog.NewTextHandler(&logs, nil))
+	t.Cleanup(func() {
+		watchCmd.SetContext(context.Background())
+		watchInterval = 5 * time.Minute
+		configFiles = nil
+		logger = nil
+		_ = redactor.SetPatterns()
+	})
+
+	watchCmd.SetContext(ctx)
+	done := make(chan error, 1)
+	go func() { done <- runWatch(watchCmd, nil) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("watch didn't stop after cancellation")
+	}
+
+	if !strings.Contains(logs.String(), `msg="stopping watch" cycles=1`) {
+		t.Errorf("expected the watch to stop after one cycle, got:\n%s", logs.String())
+	}
+	if store.data["host"] != "db.internal" {
+		t.Errorf("expected host to be written, got %v", store.data)
+	}
+}
@@ -1,18 +1,154 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
 )
 
+// ConfigTokenEnv is the environment variable holding an optional bearer token
+// used when loading the config from an HTTP(S) URL. If unset, VSG_HTTP_TOKEN
+// is used.
+const ConfigTokenEnv = "VSG_CONFIG_TOKEN"
+
+// BaseDefaultsEnv is the environment variable naming the base defaults file
+// when --base isn't given, see LoadFilesWithBase.
+const BaseDefaultsEnv = "VSG_BASE_DEFAULTS"
+
+// ConfigError is returned when the config can't be read or is invalid, as
+// opposed to a failure while running it.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
 // Load reads and parses a config file from the given path.
+// The path may be a local file or an http:// or https:// URL.
 // The vars parameter provides CLI variable overrides for env() functions.
 func Load(path string, vars Variables) (*Config, error) {
+	return LoadFiles([]string{path}, vars)
+}
+
+// LoadFiles reads the config files at the given paths and parses them as one
+// config (see ParseHCLFiles). Besides a local file or an http(s) URL, a path
+// may be a directory, meaning every *.hcl file in it, or a glob pattern.
+// A file given more than once is read once. Errors are *ConfigError.
+func LoadFiles(paths []string, vars Variables) (*Config, error) {
+	return LoadFilesWithBase("", paths, vars)
+}
+
+// LoadFilesWithBase is LoadFiles with the defaults of a shared base file
+// beneath the config's own: each setting of the config's defaults block
+// overrides the base's, and a policy replaces the base's policy of the same
+// name. The base, a local file or an http(s) URL, holds only a defaults
+// block. An empty base is no base.
+func LoadFilesWithBase(base string, paths []string, vars Variables) (*Config, error) {
+	names, err := ExpandConfigPaths(paths)
+	if err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+
+	files := make([]File, 0, len(names)+1)
+	if base != "" {
+		data, err := readConfig(base)
+		if err != nil {
+			return nil, &ConfigError{Err: fmt.Errorf("base defaults: %w", err)}
+		}
+		files = append(files, File{Name: base, Data: data, Base: true})
+	}
+	for _, name := range names {
+		data, err := readConfig(name)
+		if err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+		files = append(files, File{Name: name, Data: data})
+	}
+
+	cfg, err := ParseHCLFiles(files, vars)
+	if err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	return cfg, nil
+}
+
+// ExpandConfigPaths expands directories and glob patterns into the config
+// files they match, in sorted order, and drops repeated files.
+func ExpandConfigPaths(paths []string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, p := range paths {
+		if isURL(p) {
+			add(p)
+			continue
+		}
+
+		pattern := p
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			pattern = filepath.Join(p, "*.hcl")
+		} else if !strings.ContainsAny(p, "*?[") {
+			add(p)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config pattern %q: %w", p, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no config files match %s", pattern)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			add(match)
+		}
+	}
+
+	return names, nil
+}
+
+// readConfig returns the raw config from a local file or HTTP(S) URL.
+func readConfig(path string) ([]byte, error) {
+	if isURL(path) {
+		var opts []fetcher.HTTPFetcherOption
+		if token := os.Getenv(ConfigTokenEnv); token != "" {
+			opts = append(opts, fetcher.WithHTTPToken(token))
+		}
+
+		data, err := fetcher.NewHTTPFetcher(opts...).Fetch(context.Background(), path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config: %w", err)
+		}
+		return data, nil
+	}
+
 	// #nosec G304 -- Config file path is intentionally user-provided
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading config file: %w", err)
 	}
+	return data, nil
+}
 
-	return ParseHCL(data, path, vars)
+// isURL reports whether path is an http:// or https:// URL.
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
 }
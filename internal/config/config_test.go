@@ -1,7 +1,21 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestParseHCL_ValidConfig(t *testing.T) {
@@ -101,6 +115,223 @@ secret "test-secret" {
 	}
 }
 
+func TestParseHCL_GenerateLetterMinimums(t *testing.T) {
+	hcl := `
+defaults {
+  generate {
+    length        = 24
+    min_lowercase = 2
+  }
+}
+
+secret "test-secret" {
+  path = "test"
+
+  content {
+    password = generate({min_lowercase = 4, min_uppercase = 3})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Defaults.Generate.MinLower != 2 {
+		t.Errorf("expected defaults min_lowercase=2, got %d", cfg.Defaults.Generate.MinLower)
+	}
+
+	val := cfg.Secrets["test-secret"].Content["password"]
+	if val.Generate == nil || val.Generate.MinLower != 4 || val.Generate.MinUpper != 3 {
+		t.Fatalf("unexpected generate policy: %+v", val.Generate)
+	}
+	if got := FormatValue(val); !strings.Contains(got, "min_lowercase = 4") || !strings.Contains(got, "min_uppercase = 3") {
+		t.Errorf("FormatValue() = %s", got)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{"too long", `generate({length = 12, digits = 2, symbols = 2, min_lowercase = 5, min_uppercase = 4})`, "length 12 is too small for 2 digits + 2 symbols + 5 lowercase + 4 uppercase"},
+		{"no upper", `generate({no_upper = true, min_uppercase = 2})`, "min_uppercase can't be used with no_upper"},
+		{"inherited symbols", `generate({length = 11, digits = 2, min_lowercase = 5})`, "length 11 is too small for 2 digits + 5 symbols"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseHCL([]byte(strings.Replace(hcl, `generate({min_lowercase = 4, min_uppercase = 3})`, tt.value, 1)), "test.hcl", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseHCL_GenerateExcludeAmbiguous(t *testing.T) {
+	hcl := `
+defaults {
+  generate {
+    exclude_ambiguous = true
+  }
+}
+
+secret "test-secret" {
+  path = "test"
+
+  content {
+    password = generate({exclude_ambiguous = true})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Defaults.Generate.ExcludeAmbiguous {
+		t.Error("expected defaults exclude_ambiguous to be set")
+	}
+
+	val := cfg.Secrets["test-secret"].Content["password"]
+	if val.Generate == nil || !val.Generate.ExcludeAmbiguous {
+		t.Fatalf("unexpected generate policy: %+v", val.Generate)
+	}
+	if got := FormatValue(val); !strings.Contains(got, "exclude_ambiguous = true") {
+		t.Errorf("FormatValue() = %s", got)
+	}
+}
+
+func TestParseHCL_GenerateRequireEachClass(t *testing.T) {
+	hcl := `
+defaults {
+  generate {
+    require_each_class = true
+  }
+}
+
+secret "test-secret" {
+  path = "test"
+
+  content {
+    pin      = generate({length = 8, digits = 0, symbols = 0, require_each_class = true})
+    password = generate({length = 2, digits = 0, symbols = 0})
+  }
+}
+`
+
+	_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err == nil || !strings.Contains(err.Error(), `key "password": length 2 is too small`) {
+		t.Fatalf("expected the inherited require_each_class to need more length, got: %v", err)
+	}
+
+	cfg, err := ParseHCL([]byte(strings.Replace(hcl, "length = 2", "length = 4", 1)), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Defaults.Generate.RequireEachClass {
+		t.Error("expected defaults require_each_class to be set")
+	}
+	val := cfg.Secrets["test-secret"].Content["pin"]
+	if val.Generate == nil || !val.Generate.RequireEachClass {
+		t.Fatalf("unexpected generate policy: %+v", val.Generate)
+	}
+	if got := FormatValue(val); !strings.Contains(got, "require_each_class = true") {
+		t.Errorf("FormatValue() = %s", got)
+	}
+}
+
+func TestParseHCL_GenerateMinEntropy(t *testing.T) {
+	hcl := `
+defaults {
+  policy "strong" {
+    min_entropy = 128
+  }
+}
+
+secret "test-secret" {
+  path = "test"
+
+  content {
+    api_key = generate({min_entropy = 96})
+    token   = generate({policy = "strong"})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	strong := cfg.Defaults.Policies["strong"]
+	if strong.MinEntropy != 128 || strong.Length != 0 {
+		t.Errorf("expected the policy length to be derived from min_entropy 128, got length %d min_entropy %d", strong.Length, strong.MinEntropy)
+	}
+	val := cfg.Secrets["test-secret"].Content["api_key"]
+	if val.Generate == nil || val.Generate.MinEntropy != 96 || val.Generate.Length != 0 {
+		t.Fatalf("unexpected generate policy: %+v", val.Generate)
+	}
+	if got := FormatValue(val); !strings.Contains(got, "min_entropy = 96") {
+		t.Errorf("FormatValue() = %s", got)
+	}
+
+	for _, bad := range []string{"-1", "12.5", `"high"`} {
+		src := strings.Replace(hcl, "min_entropy = 96", "min_entropy = "+bad, 1)
+		if _, err := ParseHCL([]byte(src), "test.hcl", nil); err == nil || !strings.Contains(err.Error(), "min_entropy must be a whole number") {
+			t.Errorf("min_entropy = %s: expected an error, got %v", bad, err)
+		}
+	}
+}
+
+func TestParseHCL_JSONEncode(t *testing.T) {
+	hcl := `
+secret "test-secret" {
+  path = "test"
+
+  content {
+    config  = jsonencode({b = "x", a = 1, nested = {enabled = true, hosts = ["h1", "h2"]}})
+    encoded = base64encode(jsonencode({a = 1}))
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["test-secret"].Content
+	config := content["config"]
+	if config.Type != ValueTypeStatic {
+		t.Fatalf("expected a static value, got %s", config.Type)
+	}
+	want := `{"a":1,"b":"x","nested":{"enabled":true,"hosts":["h1","h2"]}}`
+	if config.Static != want {
+		t.Errorf("Static = %s, want %s", config.Static, want)
+	}
+	if got := content["encoded"].Static; got != "eyJhIjoxfQ==" {
+		t.Errorf("encoded Static = %s", got)
+	}
+}
+
+func TestParseHCL_JSONEncodeRejectsValueFunctions(t *testing.T) {
+	hcl := `
+secret "test-secret" {
+  path = "test"
+
+  content {
+    config = jsonencode({password = generate()})
+  }
+}
+`
+
+	_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err == nil || !strings.Contains(err.Error(), "can't contain generate()") {
+		t.Fatalf("expected an error for a value function, got: %v", err)
+	}
+}
+
 func TestParseHCL_JSONFunction(t *testing.T) {
 	hcl := `
 secret "test-secret" {
@@ -182,6 +413,41 @@ secret "test-secret" {
 	}
 }
 
+func TestParseHCL_VaultMaxConns(t *testing.T) {
+	hcl := `
+vault {
+  address   = "https://vault.example.com"
+  max_conns = 16
+}
+
+secret "app" {
+  path = "app"
+
+  content {
+    user = "app"
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Vault.MaxConns != 16 {
+		t.Errorf("MaxConns = %d, want 16", cfg.Vault.MaxConns)
+	}
+	if dump := string(DumpHCL(cfg, DumpOptions{})); !strings.Contains(dump, "max_conns = 16") {
+		t.Errorf("dump missing max_conns:\n%s", dump)
+	}
+
+	for _, bad := range []string{`-1`, `"many"`} {
+		_, err := ParseHCL([]byte(strings.Replace(hcl, "16", bad, 1)), "test.hcl", nil)
+		if err == nil || !strings.Contains(err.Error(), "max_conns") {
+			t.Errorf("max_conns = %s: expected an error, got %v", bad, err)
+		}
+	}
+}
+
 func TestParseHCL_VaultFunction(t *testing.T) {
 	hcl := `
 secret "test-secret" {
@@ -210,6 +476,42 @@ secret "test-secret" {
 	}
 }
 
+func TestParseHCL_VaultFunctionVersion(t *testing.T) {
+	hcl := `
+secret "test-secret" {
+  path = "test"
+
+  content {
+    pinned = vault("secret/shared", "api_key", { version = 3 })
+    latest = vault("secret/shared", "api_key")
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["test-secret"].Content
+	if content["pinned"].VaultVersion != 3 {
+		t.Errorf("expected version 3, got %d", content["pinned"].VaultVersion)
+	}
+	if content["latest"].VaultVersion != 0 {
+		t.Errorf("expected no version, got %d", content["latest"].VaultVersion)
+	}
+	if got := FormatValue(content["pinned"]); got != `vault("secret/shared", "api_key", {version = 3})` {
+		t.Errorf("unexpected FormatValue: %s", got)
+	}
+
+	for _, bad := range []string{"0", "-1", "1.5", `"3"`} {
+		src := strings.Replace(hcl, "version = 3", "version = "+bad, 1)
+		if _, err := ParseHCL([]byte(src), "test.hcl", nil); err == nil || !strings.Contains(err.Error(), "version must be a positive whole number") {
+			t.Errorf("version = %s: expected an error, got %v", bad, err)
+		}
+	}
+}
+
 func TestParseHCL_Command(t *testing.T) {
 	hcl := `
 secret "test-secret" {
@@ -755,6 +1057,52 @@ secret "default-secret" {
 	}
 }
 
+func TestParseHCL_DefaultsEnabled(t *testing.T) {
+	hcl := `
+defaults {
+  enabled = false
+}
+
+secret "opted-in" {
+  path    = "opted-in"
+  enabled = true
+
+  content {
+    key = "value"
+  }
+}
+
+secret "unset" {
+  path = "unset"
+
+  content {
+    key = "value"
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Defaults.Enabled == nil || *cfg.Defaults.Enabled {
+		t.Errorf("expected defaults.enabled = false, got %v", cfg.Defaults.Enabled)
+	}
+	optedIn := cfg.Secrets["opted-in"]
+	if !optedIn.IsEnabled() {
+		t.Error("explicit enabled = true should override defaults.enabled = false")
+	}
+
+	unset := cfg.Secrets["unset"]
+	if unset.Enabled == nil {
+		t.Fatal("expected defaults.enabled to be applied to the block")
+	}
+	if unset.IsEnabled() {
+		t.Error("IsEnabled() should return false for a block without enabled under defaults.enabled = false")
+	}
+}
+
 func TestSecretBlock_IsEnabled(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1066,6 +1414,27 @@ secret "test-secret" {
 	}
 }
 
+func TestDetectDependencyCycles(t *testing.T) {
+	// A hash of an ssh_keygen() public key whose private key is a hash of
+	// the public key's hash: the cycle runs through the public key's edge
+	content := map[string]Value{
+		"deploy_key":      {Type: ValueTypePbkdf2, Pbkdf2: &Pbkdf2Config{FromKey: "deploy_key_hash"}},
+		"deploy_key_pub":  {Type: ValueTypeSSHPublicKey, SSHKey: &SSHKeyConfig{Type: SSHKeyTypeEd25519, FromKey: "deploy_key"}},
+		"deploy_key_hash": {Type: ValueTypeBcrypt, Bcrypt: &BcryptConfig{FromKey: "deploy_key_pub"}},
+	}
+	if err := detectDependencyCycles("test", content); err == nil || !strings.Contains(err.Error(), "circular reference") {
+		t.Errorf("expected a circular reference error, got %v", err)
+	}
+
+	// A certificate whose private key is missing
+	content = map[string]Value{
+		"tls": {Type: ValueTypeTLSCert, TLSCert: &TLSCertConfig{FromKey: "tls" + TLSKeySuffix}},
+	}
+	if err := detectDependencyCycles("test", content); err == nil || !strings.Contains(err.Error(), "non-existent key") {
+		t.Errorf("expected a missing reference error, got %v", err)
+	}
+}
+
 func TestParseHCL_MultipleHashes(t *testing.T) {
 	hcl := `
 secret "test-secret" {
@@ -1095,3 +1464,2382 @@ secret "test-secret" {
 		t.Error("expected pbkdf2 type for pbkdf2_hash")
 	}
 }
+
+func TestParseHCL_Redact(t *testing.T) {
+	hcl := `
+redact {
+  patterns = ["(?i)password=[^&\\s]+", "internal-[a-z0-9]+"]
+}
+
+secret "test-secret" {
+  path = "test"
+
+  content {
+    key = "value"
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cfg.Redact.Patterns) != 2 {
+		t.Fatalf("expected 2 patterns, got %d", len(cfg.Redact.Patterns))
+	}
+	if cfg.Redact.Patterns[0] != `(?i)password=[^&\s]+` {
+		t.Errorf("unexpected first pattern: %q", cfg.Redact.Patterns[0])
+	}
+}
+
+func TestParseHCL_RedactInvalidPattern(t *testing.T) {
+	hcl := `
+redact {
+  patterns = ["([unclosed"]
+}
+
+secret "test-secret" {
+  path = "test"
+
+  content {
+    key = "value"
+  }
+}
+`
+
+	_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err == nil {
+		t.Fatal("expected error for invalid redaction pattern")
+	}
+}
+
+func TestParseHCL_RedactAlwaysMask(t *testing.T) {
+	hcl := `
+redact {
+  always_mask = ["*_private_key", "root_*"]
+}
+
+secret "test-secret" {
+  path = "test"
+
+  content {
+    key = "value"
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(cfg.Redact.AlwaysMask, []string{"*_private_key", "root_*"}) {
+		t.Errorf("unexpected always_mask: %v", cfg.Redact.AlwaysMask)
+	}
+
+	_, err = ParseHCL([]byte(strings.Replace(hcl, `"root_*"`, `"root_[*"`, 1)), "test.hcl", nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid always_mask pattern") {
+		t.Errorf("expected invalid pattern error, got: %v", err)
+	}
+}
+
+func TestParseHCL_NamedPolicy(t *testing.T) {
+	hcl := `
+defaults {
+  policy "corporate-strong" {
+    length     = 48
+    digits     = 8
+    symbols    = 8
+    symbol_set = "!@#"
+  }
+
+  policy "pin" {
+    length   = 6
+    digits   = 6
+    symbols  = 0
+    no_upper = true
+  }
+}
+
+secret "test-secret" {
+  path = "test"
+
+  content {
+    api_key = generate({policy = "corporate-strong"})
+    pin     = generate({policy = "pin", strategy = "update"})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	strong, ok := cfg.Defaults.Policies["corporate-strong"]
+	if !ok {
+		t.Fatal("expected corporate-strong policy")
+	}
+	if strong.Length != 48 || strong.Digits != 8 || strong.Symbols != 8 || strong.SymbolCharacters != "!@#" {
+		t.Errorf("unexpected corporate-strong policy: %+v", strong)
+	}
+
+	apiKey := cfg.Secrets["test-secret"].Content["api_key"]
+	if apiKey.PolicyName != "corporate-strong" {
+		t.Errorf("expected policy name 'corporate-strong', got %q", apiKey.PolicyName)
+	}
+	if apiKey.Generate != nil {
+		t.Error("expected no inline policy when only a named policy is referenced")
+	}
+
+	pin := cfg.Secrets["test-secret"].Content["pin"]
+	if pin.PolicyName != "pin" {
+		t.Errorf("expected policy name 'pin', got %q", pin.PolicyName)
+	}
+	if pin.Strategy != StrategyUpdate {
+		t.Errorf("expected update strategy, got %q", pin.Strategy)
+	}
+}
+
+func TestParseHCL_NamedPolicyInheritsGenerate(t *testing.T) {
+	// The policy comes before the generate block and still starts from it
+	hcl := `
+defaults {
+  policy "long" {
+    length = 40
+  }
+
+  generate {
+    symbols      = 3
+    symbol_set   = "-_"
+    allow_repeat = false
+  }
+}
+
+secret "app" {
+  path = "app"
+
+  content {
+    token = generate({policy = "long"})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	long := cfg.Defaults.Policies["long"]
+	if long.Length != 40 || long.Digits != 5 || long.Symbols != 3 || long.SymbolCharacters != "-_" {
+		t.Errorf("unexpected long policy: %+v", long)
+	}
+	if long.AllowRepeat == nil || *long.AllowRepeat {
+		t.Errorf("expected allow_repeat = false from defaults.generate, got %v", long.AllowRepeat)
+	}
+}
+
+func TestParseHCL_UnknownNamedPolicy(t *testing.T) {
+	hcl := `
+secret "test-secret" {
+  path = "test"
+
+  content {
+    api_key = generate({policy = "missing"})
+  }
+}
+`
+
+	_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err == nil {
+		t.Fatal("expected error for unknown policy")
+	}
+}
+
+func TestParseHCL_DuplicateNamedPolicy(t *testing.T) {
+	hcl := `
+defaults {
+  policy "strong" {
+    length = 32
+  }
+  policy "strong" {
+    length = 64
+  }
+}
+
+secret "test-secret" {
+  path = "test"
+
+  content {
+    api_key = generate({policy = "strong"})
+  }
+}
+`
+
+	_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err == nil {
+		t.Fatal("expected error for duplicate policy name")
+	}
+}
+
+func TestParseHCL_NestedKeys(t *testing.T) {
+	hcl := `
+secret "nested" {
+  path        = "nested"
+  nested_keys = true
+
+  content {
+    password = "secret"
+  }
+}
+
+secret "flat" {
+  path = "flat"
+
+  content {
+    password = "secret"
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Secrets["nested"].NestedKeys {
+		t.Error("expected nested_keys to be true")
+	}
+	if cfg.Secrets["flat"].NestedKeys {
+		t.Error("expected nested_keys to default to false")
+	}
+}
+
+func TestParseHCL_NestedKeysConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    string
+		nested  bool
+		wantErr string
+	}{
+		{"parent and child", `["db", "db/password"]`, true, `secret "app": nested_keys: key "db/password" conflicts with key "db"`},
+		{"grandparent", `["a", "a/b/c"]`, true, `key "a/b/c" conflicts with key "a"`},
+		{"empty segment", `["db//password"]`, true, `key "db//password" has an empty path segment`},
+		{"siblings", `["db/user", "db/password"]`, true, ""},
+		{"flat block", `["db", "db/password"]`, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := fmt.Sprintf(`
+secret "app" {
+  path        = "app"
+  nested_keys = %t
+
+  content {
+    group {
+      keys  = %s
+      value = "x"
+    }
+  }
+}
+`, tt.nested, tt.keys)
+
+			_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseHCL_IgnoreKeysFile(t *testing.T) {
+	hcl := `
+secret "shared" {
+  path             = "shared"
+  prune            = true
+  ignore_keys_file = "s3://bucket/shared-ignore.txt"
+
+  content {
+    key = "value"
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := cfg.Secrets["shared"].IgnoreKeysFile; got != "s3://bucket/shared-ignore.txt" {
+		t.Errorf("expected ignore_keys_file to be parsed, got %q", got)
+	}
+}
+
+func TestParseHCL_UUIDFunction(t *testing.T) {
+	hcl := `
+secret "service" {
+  path = "service"
+
+  content {
+    instance_id = uuid()
+    session_id  = uuid({strategy = "update"})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["service"].Content
+
+	if content["instance_id"].Type != ValueTypeUUID {
+		t.Errorf("expected uuid type, got %s", content["instance_id"].Type)
+	}
+	if content["instance_id"].Strategy != "" {
+		t.Errorf("expected default strategy, got %s", content["instance_id"].Strategy)
+	}
+	if content["session_id"].Strategy != StrategyUpdate {
+		t.Errorf("expected update strategy, got %s", content["session_id"].Strategy)
+	}
+	if cfg.Defaults.Strategy.UUID != StrategyCreate {
+		t.Errorf("expected uuid default strategy create, got %s", cfg.Defaults.Strategy.UUID)
+	}
+}
+
+func TestParseHCL_PipeOption(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    password = generate({length = 16, pipe = "tr a-z A-Z"})
+    token    = command("echo token", {strategy = "update", pipe = "base64"})
+    host     = json("file:///tmp/outputs.json", ".db.host", {pipe = "tr -d ' '"})
+    plain    = uuid()
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["app"].Content
+
+	if content["password"].Pipe != "tr a-z A-Z" {
+		t.Errorf("password pipe = %q", content["password"].Pipe)
+	}
+	if content["token"].Pipe != "base64" {
+		t.Errorf("token pipe = %q", content["token"].Pipe)
+	}
+	if content["token"].Strategy != StrategyUpdate {
+		t.Errorf("expected update strategy alongside pipe, got %s", content["token"].Strategy)
+	}
+	if content["host"].Pipe != "tr -d ' '" {
+		t.Errorf("host pipe = %q", content["host"].Pipe)
+	}
+	if content["plain"].Pipe != "" {
+		t.Errorf("expected no pipe by default, got %q", content["plain"].Pipe)
+	}
+}
+
+func TestParseHCL_CommandTimeout(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    token = command("vault-token-helper get", {timeout = "30s"})
+    plain = command("echo plain")
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["app"].Content
+	if content["token"].Timeout != 30*time.Second {
+		t.Errorf("expected timeout 30s, got %s", content["token"].Timeout)
+	}
+	if content["plain"].Timeout != 0 {
+		t.Errorf("expected no timeout by default, got %s", content["plain"].Timeout)
+	}
+	if got := FormatValue(content["token"]); got != `command("vault-token-helper get", {timeout = "30s"})` {
+		t.Errorf("unexpected dump: %s", got)
+	}
+
+	for _, timeout := range []string{"30", "-1s"} {
+		hcl := `
+secret "app" {
+  path = "app"
+  content { token = command("sleep 1", {timeout = "` + timeout + `"}) }
+}
+`
+		if _, err := ParseHCL([]byte(hcl), "test.hcl", nil); err == nil || !strings.Contains(err.Error(), "invalid timeout") {
+			t.Errorf("timeout %q: expected an invalid timeout error, got %v", timeout, err)
+		}
+	}
+}
+
+func TestParseHCL_BlockForce(t *testing.T) {
+	hcl := `
+secret "tokens" {
+  path  = "ephemeral"
+  force = true
+  content { token = generate() }
+}
+
+secret "app" {
+  path = "app"
+  content { password = generate() }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !cfg.Secrets["tokens"].Force {
+		t.Error("expected force = true on tokens")
+	}
+	if cfg.Secrets["app"].Force {
+		t.Error("expected force to default to false")
+	}
+	dumped, err := ParseHCL(DumpHCL(cfg, DumpOptions{}), "dump.hcl", nil)
+	if err != nil {
+		t.Fatalf("dump doesn't parse: %v", err)
+	}
+	if !dumped.Secrets["tokens"].Force || dumped.Secrets["app"].Force {
+		t.Error("expected force to survive the dump")
+	}
+}
+
+func TestSetDefaultMount(t *testing.T) {
+	hcl := `
+defaults {
+  mount = "kv"
+}
+
+secret "inherited" {
+  path = "app"
+  content { a = "1" }
+}
+
+secret "explicit" {
+  mount = "team-kv"
+  path  = "app"
+  content { a = "1" }
+}
+
+secret "explicit_default" {
+  mount = "kv"
+  path  = "other"
+  content { a = "1" }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg.SetDefaultMount("kv-staging")
+
+	if cfg.Defaults.Mount != "kv-staging" {
+		t.Errorf("defaults.mount = %q, want kv-staging", cfg.Defaults.Mount)
+	}
+	expected := map[string]string{
+		"inherited":        "kv-staging",
+		"explicit":         "team-kv",
+		"explicit_default": "kv",
+	}
+	for name, mount := range expected {
+		if got := cfg.Secrets[name].Mount; got != mount {
+			t.Errorf("%s: mount = %q, want %q", name, got, mount)
+		}
+	}
+}
+
+func TestParseHCL_CommandStdinEnv(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    hashed = command("caddy hash-password", {stdin = generate({length = 16}), env = {HOME = "/tmp", CADDY_MODE = "bcrypt"}})
+    static = command("cat", {stdin = "hello"})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["app"].Content
+	hashed := content["hashed"]
+	if hashed.Stdin == nil || hashed.Stdin.Type != ValueTypeGenerate || hashed.Stdin.Generate == nil || hashed.Stdin.Generate.Length != 16 {
+		t.Errorf("unexpected stdin %+v", hashed.Stdin)
+	}
+	if hashed.Env["HOME"] != "/tmp" || hashed.Env["CADDY_MODE"] != "bcrypt" {
+		t.Errorf("unexpected env %v", hashed.Env)
+	}
+
+	static := content["static"]
+	if static.Stdin == nil || static.Stdin.Type != ValueTypeStatic || static.Stdin.Static != "hello" {
+		t.Errorf("unexpected stdin %+v", static.Stdin)
+	}
+	if static.Env != nil {
+		t.Errorf("expected no env, got %v", static.Env)
+	}
+	if got := FormatValue(static); got != `command("cat", {stdin = "hello"})` {
+		t.Errorf("unexpected dump: %s", got)
+	}
+	if got := FormatValue(Value{Type: ValueTypeCommand, Command: "env", Env: map[string]string{"B": "2", "A": "1"}}); got != `command("env", {env = {A = "1", B = "2"}})` {
+		t.Errorf("unexpected dump: %s", got)
+	}
+}
+
+func TestParseHCL_CommandOutputOptions(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    keytab = command("make-keytab", {binary = "base64", normalize_newlines = true})
+    plain  = command("echo plain")
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keytab := cfg.Secrets["app"].Content["keytab"]
+	if !keytab.NormalizeNewlines || keytab.Binary != BinaryBase64 {
+		t.Errorf("unexpected options %+v", keytab)
+	}
+	if got := FormatValue(keytab); got != `command("make-keytab", {normalize_newlines = true, binary = "base64"})` {
+		t.Errorf("unexpected dump: %s", got)
+	}
+	plain := cfg.Secrets["app"].Content["plain"]
+	if plain.NormalizeNewlines || plain.Binary != "" {
+		t.Errorf("expected no output options by default, got %+v", plain)
+	}
+
+	bad := "secret \"app\" {\n  path = \"app\"\n  content { v = command(\"x\", {binary = \"hex\"}) }\n}\n"
+	if _, err := ParseHCL([]byte(bad), "test.hcl", nil); err == nil || !strings.Contains(err.Error(), `unknown binary "hex"`) {
+		t.Errorf("expected an unknown binary error, got %v", err)
+	}
+}
+
+func TestParseHCL_CommandStdinEnvErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"stdin number", `v = command("cat", {stdin = 5})`, "stdin must be a string or a value function"},
+		{"stdin env_all", `v = command("cat", {stdin = env_all("APP_")})`, "stdin cannot be env_all()"},
+		{"env not a map", `v = command("env", {env = "FOO=bar"})`, "env must be a map of strings"},
+		{"env bad name", `v = command("env", {env = {"FOO-BAR" = "x"}})`, "invalid variable name"},
+		{"env not a string", `v = command("env", {env = {FOO = ["x"]}})`, "env FOO must be a string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := "secret \"app\" {\n  path = \"app\"\n  content {\n    " + tt.content + "\n  }\n}\n"
+			_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseHCL_SourceAs(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    port     = yaml("s3://bucket/app.yaml", ".db.port", {as = "number"})
+    debug    = json("s3://bucket/app.json", ".debug", {as = "bool"})
+    host     = yaml("s3://bucket/app.yaml", ".db.host", {as = "string"})
+    password = yaml("s3://bucket/app.yaml", ".db.password")
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["app"].Content
+	expected := map[string]WriteType{"port": WriteTypeNumber, "debug": WriteTypeBool, "host": "", "password": ""}
+	for key, as := range expected {
+		if content[key].As != as {
+			t.Errorf("%s: expected as %q, got %q", key, as, content[key].As)
+		}
+	}
+	if got := FormatValue(content["port"]); got != `yaml("s3://bucket/app.yaml", ".db.port", {as = "number"})` {
+		t.Errorf("unexpected dump: %s", got)
+	}
+
+	errorTests := []struct {
+		value   string
+		wantErr string
+	}{
+		{`yaml("s3://b/a.yaml", ".port", {as = "int"})`, `unknown as "int"`},
+		{`yaml("s3://b/a.yaml", ".port", {as = "number", pipe = "cat"})`, "can't be combined with pipe"},
+		{`base64encode(json("s3://b/a.json", ".debug", {as = "bool"}))`, "can't be combined with pipe or base64 transforms"},
+		{`hash(yaml("s3://b/a.yaml", ".port", {as = "number"}), {algo = "bcrypt"})`, "hash() value can't use as"},
+	}
+	for _, tt := range errorTests {
+		hcl := `
+secret "app" {
+  path = "app"
+  content { key = ` + tt.value + ` }
+}
+`
+		if _, err := ParseHCL([]byte(hcl), "test.hcl", nil); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.value, tt.wantErr, err)
+		}
+	}
+}
+
+func TestParseHCL_GeneratePassphrase(t *testing.T) {
+	hcl := `
+secret "recovery" {
+  path = "recovery"
+
+  content {
+    default_phrase = generate({mode = "passphrase"})
+    custom_phrase  = generate({mode = "passphrase", words = 5, separator = " ", capitalize = true, number = true})
+    no_separator   = generate({mode = "passphrase", separator = ""})
+    password       = generate({mode = "password", length = 16})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["recovery"].Content
+
+	def := content["default_phrase"].Passphrase
+	if def == nil {
+		t.Fatal("expected passphrase policy for default_phrase")
+	}
+	if *def != DefaultPassphrasePolicy() {
+		t.Errorf("expected default passphrase policy, got %+v", *def)
+	}
+
+	custom := content["custom_phrase"].Passphrase
+	if custom == nil {
+		t.Fatal("expected passphrase policy for custom_phrase")
+	}
+	expected := PassphrasePolicy{Words: 5, Separator: " ", Capitalize: true, Number: true}
+	if *custom != expected {
+		t.Errorf("expected %+v, got %+v", expected, *custom)
+	}
+
+	if sep := content["no_separator"].Passphrase.Separator; sep != "" {
+		t.Errorf("expected empty separator, got %q", sep)
+	}
+
+	if content["password"].Passphrase != nil {
+		t.Error("expected no passphrase policy in password mode")
+	}
+	if content["password"].Generate == nil || content["password"].Generate.Length != 16 {
+		t.Error("expected password policy with length 16")
+	}
+}
+
+func TestParseHCL_GenerateInvalidMode(t *testing.T) {
+	hcl := `
+secret "test" {
+  path = "test"
+
+  content {
+    key = generate({mode = "emoji"})
+  }
+}
+`
+
+	_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err == nil {
+		t.Fatal("expected error for unknown generate mode")
+	}
+	if !strings.Contains(err.Error(), "unknown generate mode") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseHCL_PassphraseWords(t *testing.T) {
+	tests := []struct {
+		words   int
+		wantErr string
+	}{
+		{words: 64},
+		{words: -1, wantErr: "words must be at least 1"},
+		{words: 65, wantErr: "words must be at most 64"},
+	}
+
+	for _, tt := range tests {
+		hcl := fmt.Sprintf(`
+secret "test" {
+  path = "test"
+
+  content {
+    phrase = generate({mode = "passphrase", words = %d})
+  }
+}
+`, tt.words)
+
+		_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("words = %d: unexpected error: %v", tt.words, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("words = %d: expected %q, got %v", tt.words, tt.wantErr, err)
+		}
+	}
+}
+
+func TestLoad_FromURL(t *testing.T) {
+	t.Setenv(ConfigTokenEnv, "config-token")
+
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`
+secret "app" {
+  path = "app"
+
+  content {
+    password = generate()
+  }
+}
+`))
+	}))
+	defer server.Close()
+
+	cfg, err := Load(server.URL+"/app.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := cfg.Secrets["app"]; !ok {
+		t.Error("expected secret block 'app' from remote config")
+	}
+	if gotAuth != "Bearer config-token" {
+		t.Errorf("Authorization = %q, want %q", gotAuth, "Bearer config-token")
+	}
+}
+
+func TestLoad_FromURLErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	_, err := Load(server.URL+"/missing.hcl", nil)
+	if err == nil {
+		t.Fatal("expected error for missing remote config")
+	}
+	if !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected status code in error, got: %v", err)
+	}
+}
+
+// writeConfigFiles writes name -> contents files into a new temp directory
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadFiles_Merge(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"vault.hcl": `
+vault {
+  address = "https://vault.example.com"
+}
+`,
+		"defaults.hcl": `
+defaults {
+  mount = "kv"
+}
+`,
+		"teams/payments.hcl": `
+secret "payments" {
+  path = "payments"
+  content {
+    key = "value"
+  }
+}
+`,
+		"teams/search.hcl": `
+secret "search" {
+  path = "search"
+  content {
+    key = "value"
+  }
+}
+`,
+		"teams/README.md": "not a config file",
+	})
+
+	cfg, err := LoadFiles([]string{dir, filepath.Join(dir, "teams", "*.hcl")}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Vault.Address != "https://vault.example.com" {
+		t.Errorf("Vault.Address = %q", cfg.Vault.Address)
+	}
+	for _, name := range []string{"payments", "search"} {
+		block, ok := cfg.Secrets[name]
+		if !ok {
+			t.Fatalf("expected secret block %q", name)
+		}
+		// Defaults from one file apply to the secrets of the others
+		if block.Mount != "kv" {
+			t.Errorf("%s: Mount = %q, want kv", name, block.Mount)
+		}
+	}
+}
+
+func TestLoadFiles_Errors(t *testing.T) {
+	secret := func(name string) string {
+		return `
+secret "` + name + `" {
+  path = "` + name + `"
+  content {
+    key = "value"
+  }
+}
+`
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "duplicate secret across files",
+			files:   map[string]string{"a.hcl": secret("app"), "b.hcl": secret("app")},
+			wantErr: `duplicate secret block name: "app"`,
+		},
+		{
+			name: "conflicting defaults",
+			files: map[string]string{
+				"a.hcl": "defaults {\n  mount = \"kv\"\n}\n" + secret("app"),
+				"b.hcl": "defaults {\n  mount = \"secret\"\n}\n",
+			},
+			wantErr: "defaults block is defined more than once",
+		},
+		{
+			name: "two vault blocks",
+			files: map[string]string{
+				"a.hcl": "vault {\n  address = \"https://a\"\n}\n" + secret("app"),
+				"b.hcl": "vault {\n  address = \"https://b\"\n}\n",
+			},
+			wantErr: "vault block is defined more than once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeConfigFiles(t, tt.files)
+			_, err := LoadFiles([]string{dir}, nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Errorf("expected a *ConfigError, got %T", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+			// Both definitions are pointed at
+			if !strings.Contains(err.Error(), "a.hcl") || !strings.Contains(err.Error(), "b.hcl") {
+				t.Errorf("expected both files in error, got: %v", err)
+			}
+		})
+	}
+
+	t.Run("no matches", func(t *testing.T) {
+		_, err := LoadFiles([]string{filepath.Join(t.TempDir(), "*.hcl")}, nil)
+		if err == nil || !strings.Contains(err.Error(), "no config files match") {
+			t.Errorf("expected no match error, got: %v", err)
+		}
+	})
+}
+
+const baseDefaultsHCL = `
+defaults {
+  mount   = "kv"
+  version = 2
+
+  strategy {
+    json = "create"
+    uuid = "update"
+  }
+
+  generate {
+    length     = 40
+    symbols    = 2
+    symbol_set = "-_"
+  }
+
+  policy "strong" {
+    min_entropy = 128
+  }
+
+  policy "pin" {
+    length  = 8
+    digits  = 4
+    symbols = 0
+  }
+}
+`
+
+func TestLoadFilesWithBase(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.hcl": baseDefaultsHCL,
+		"config/app.hcl": `
+defaults {
+  mount = "secret"
+
+  strategy {
+    json = "update"
+  }
+
+  generate {
+    length = 24
+  }
+
+  policy "pin" {
+    length = 12
+  }
+}
+
+secret "app" {
+  path = "app"
+  content {
+    key = "value"
+  }
+}
+`,
+	})
+
+	cfg, err := LoadFilesWithBase(filepath.Join(dir, "base.hcl"), []string{filepath.Join(dir, "config")}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d := cfg.Defaults
+
+	// Settings of the local defaults override the base's one by one
+	if d.Mount != "secret" || d.Version != 2 {
+		t.Errorf("Mount = %q, Version = %d, want secret and 2", d.Mount, d.Version)
+	}
+	if d.Strategy.JSON != StrategyUpdate || d.Strategy.UUID != StrategyUpdate || d.Strategy.Generate != StrategyCreate {
+		t.Errorf("unexpected strategies: %+v", d.Strategy)
+	}
+	if d.Generate.Length != 24 || d.Generate.Symbols != 2 || d.Generate.SymbolCharacters != "-_" || d.Generate.Digits != 5 {
+		t.Errorf("unexpected generate defaults: %+v", d.Generate)
+	}
+
+	// A local policy replaces the base's of the same name as a whole, and
+	// both start from the merged generate defaults
+	if pin := d.Policies["pin"]; pin.Length != 12 || pin.Digits != 5 || pin.Symbols != 2 || pin.SymbolCharacters != "-_" {
+		t.Errorf("unexpected pin policy: %+v", pin)
+	}
+	if strong := d.Policies["strong"]; strong.MinEntropy != 128 || strong.Length != 0 || strong.SymbolCharacters != "-_" {
+		t.Errorf("expected the base's strong policy, got %+v", strong)
+	}
+
+	if block := cfg.Secrets["app"]; block.Mount != "secret" || block.Version != 2 {
+		t.Errorf("app: Mount = %q, Version = %d", block.Mount, block.Version)
+	}
+}
+
+func TestLoadFilesWithBase_NoLocalDefaults(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.hcl": baseDefaultsHCL,
+		"app.hcl": `
+secret "app" {
+  path = "app"
+  content {
+    key = "value"
+  }
+}
+`,
+	})
+
+	cfg, err := LoadFilesWithBase(filepath.Join(dir, "base.hcl"), []string{filepath.Join(dir, "app.hcl")}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Defaults.Mount != "kv" || cfg.Defaults.Generate.Length != 40 || cfg.Defaults.Strategy.JSON != StrategyCreate {
+		t.Errorf("expected the base's defaults, got %+v", cfg.Defaults)
+	}
+	if len(cfg.Defaults.Policies) != 2 {
+		t.Errorf("expected the base's policies, got %v", cfg.Defaults.Policies)
+	}
+	if block := cfg.Secrets["app"]; block.Mount != "kv" {
+		t.Errorf("app: Mount = %q, want kv", block.Mount)
+	}
+}
+
+func TestLoadFilesWithBase_Errors(t *testing.T) {
+	app := `
+secret "app" {
+  path = "app"
+  content {
+    key = "value"
+  }
+}
+`
+	tests := []struct {
+		name    string
+		base    string
+		wantErr string
+	}{
+		{
+			name:    "secret block in base",
+			base:    baseDefaultsHCL + app,
+			wantErr: "only a defaults block is allowed, found a secret block",
+		},
+		{
+			name:    "no defaults block",
+			base:    "",
+			wantErr: "has no defaults block",
+		},
+		{
+			name:    "invalid defaults",
+			base:    "defaults {\n  generate {\n    min_entropy = \"high\"\n  }\n}\n",
+			wantErr: "min_entropy must be a whole number of bits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeConfigFiles(t, map[string]string{"base.hcl": tt.base, "app.hcl": app})
+			_, err := LoadFilesWithBase(filepath.Join(dir, "base.hcl"), []string{filepath.Join(dir, "app.hcl")}, nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Errorf("expected a *ConfigError, got %T", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "base.hcl") {
+				t.Errorf("expected error containing %q and the file, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		dir := writeConfigFiles(t, map[string]string{"app.hcl": app})
+		_, err := LoadFilesWithBase(filepath.Join(dir, "base.hcl"), []string{filepath.Join(dir, "app.hcl")}, nil)
+		if err == nil || !strings.Contains(err.Error(), "base defaults") {
+			t.Errorf("expected a base defaults error, got: %v", err)
+		}
+	})
+}
+
+func TestParseHCL_DefaultsMinEntropy(t *testing.T) {
+	cfg, err := ParseHCL([]byte(`
+defaults {
+  generate {
+    min_entropy = 128
+  }
+}
+
+secret "app" {
+  path = "app"
+  content {
+    key = generate()
+  }
+}
+`), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The length is derived from min_entropy, not the built-in default
+	if cfg.Defaults.Generate.Length != 0 || cfg.Defaults.Generate.MinEntropy != 128 {
+		t.Errorf("unexpected generate defaults: %+v", cfg.Defaults.Generate)
+	}
+}
+
+func TestExpandConfigPaths(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{"b.hcl": "", "a.hcl": "", "c.txt": ""})
+
+	got, err := ExpandConfigPaths([]string{
+		filepath.Join(dir, "b.hcl"),
+		dir,
+		"https://config.example.com/app.hcl",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join(dir, "b.hcl"),
+		filepath.Join(dir, "a.hcl"),
+		"https://config.example.com/app.hcl",
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("ExpandConfigPaths() = %v, want %v", got, expected)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	unformatted := `secret "app" {
+path = "app"
+    content {
+  password = generate({length=32})
+      db_host="db.internal"
+    }
+}
+`
+	files := []File{{Name: "app.hcl", Data: []byte(unformatted)}}
+
+	formatted, err := Format(files, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `secret "app" {
+  path = "app"
+  content {
+    password = generate({ length = 32 })
+    db_host  = "db.internal"
+  }
+}
+`
+	if got := string(formatted[0].Data); got != want {
+		t.Errorf("Format() =\n%s\nwant\n%s", got, want)
+	}
+
+	before, err := ParseHCL([]byte(unformatted), "app.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after, err := ParseHCL(formatted[0].Data, "app.hcl", nil)
+	if err != nil {
+		t.Fatalf("formatted config doesn't parse: %v", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("formatting changed the config:\nbefore %+v\nafter  %+v", before, after)
+	}
+
+	// Already formatted files come back unchanged
+	again, err := Format(formatted, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(again[0].Data) != want {
+		t.Errorf("formatting twice changed the file:\n%s", again[0].Data)
+	}
+}
+
+func TestFormat_InvalidConfig(t *testing.T) {
+	_, err := Format([]File{{Name: "app.hcl", Data: []byte(`secret "app" {`)}}, nil)
+	if err == nil {
+		t.Fatal("expected an error for invalid HCL")
+	}
+}
+
+func TestParseHCL_HashFunction(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    password_hash = hash(generate({length = 24}), {algo = "bcrypt", cost = 12})
+    token_hash    = hash(command("echo token"), {algo = "argon2", variant = "i", strategy = "create"})
+    static_hash   = hash("admin", {algo = "pbkdf2", iterations = 1000})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["app"].Content
+
+	pw := content["password_hash"]
+	if pw.Type != ValueTypeHash || pw.HashAlgorithm != ValueTypeBcrypt {
+		t.Fatalf("expected bcrypt hash, got %s/%s", pw.Type, pw.HashAlgorithm)
+	}
+	if pw.Bcrypt == nil || pw.Bcrypt.Cost != 12 {
+		t.Errorf("expected bcrypt cost 12, got %+v", pw.Bcrypt)
+	}
+	if pw.Inner == nil || pw.Inner.Type != ValueTypeGenerate || pw.Inner.Generate == nil || pw.Inner.Generate.Length != 24 {
+		t.Errorf("expected wrapped generate with length 24, got %+v", pw.Inner)
+	}
+
+	token := content["token_hash"]
+	if token.Argon2 == nil || token.Argon2.Variant != "i" {
+		t.Errorf("expected argon2 variant i, got %+v", token.Argon2)
+	}
+	if token.Strategy != StrategyCreate {
+		t.Errorf("expected create strategy, got %s", token.Strategy)
+	}
+	if token.Inner == nil || token.Inner.Command != "echo token" {
+		t.Errorf("expected wrapped command, got %+v", token.Inner)
+	}
+
+	static := content["static_hash"]
+	if static.Pbkdf2 == nil || static.Pbkdf2.Iterations != 1000 {
+		t.Errorf("expected pbkdf2 iterations 1000, got %+v", static.Pbkdf2)
+	}
+	if static.Inner == nil || static.Inner.Type != ValueTypeStatic || static.Inner.Static != "admin" {
+		t.Errorf("expected wrapped static value, got %+v", static.Inner)
+	}
+}
+
+func TestParseHCL_HashFunctionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{"missing algo", `hash(generate())`, "requires 'algo'"},
+		{"unknown algo", `hash(generate(), {algo = "md5"})`, "unknown algo"},
+		{"nested hash", `hash(hash(generate(), {algo = "bcrypt"}), {algo = "bcrypt"})`, "value must be"},
+		{"wrapped hash function", `hash(bcrypt({from = "other"}), {algo = "bcrypt"})`, "cannot wrap bcrypt()"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    other = generate()
+    value = ` + tt.value + `
+  }
+}
+`
+			_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseHCL_RawMaxSize(t *testing.T) {
+	hcl := `
+secret "certs" {
+  path = "certs"
+
+  content {
+    cert   = raw("file:///etc/ssl/cert.pem")
+    bundle = raw("s3://bucket/bundle.pem", {max_size = 4194304, strategy = "create"})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["certs"].Content
+	if content["cert"].MaxSize != 0 {
+		t.Errorf("expected default max size, got %d", content["cert"].MaxSize)
+	}
+	if content["bundle"].MaxSize != 4194304 {
+		t.Errorf("expected max size 4194304, got %d", content["bundle"].MaxSize)
+	}
+	if content["bundle"].Strategy != StrategyCreate {
+		t.Errorf("expected create strategy, got %s", content["bundle"].Strategy)
+	}
+}
+
+func TestParseHCL_RawJSONFormat(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    verbatim = raw("s3://bucket/app.json")
+    compact  = raw("s3://bucket/app.json", {minify = true})
+    pretty   = raw("s3://bucket/app.json", {pretty = true, minify = false})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["app"].Content
+	expected := map[string]string{"verbatim": "", "compact": JSONFormatMinify, "pretty": JSONFormatPretty}
+	for key, want := range expected {
+		if got := content[key].JSONFormat; got != want {
+			t.Errorf("%s JSONFormat = %q, want %q", key, got, want)
+		}
+	}
+	if got := FormatValue(content["compact"]); got != `raw("s3://bucket/app.json", {minify = true})` {
+		t.Errorf("FormatValue() = %s", got)
+	}
+
+	for _, opts := range []string{`{minify = true, pretty = true}`, `{minify = "yes"}`} {
+		_, err := ParseHCL([]byte(strings.Replace(hcl, `{minify = true}`, opts, 1)), "test.hcl", nil)
+		if err == nil {
+			t.Errorf("expected an error for %s", opts)
+		}
+	}
+}
+
+func TestParseHCL_GroupBlock(t *testing.T) {
+	hcl := `
+secret "queues" {
+  path = "queues"
+
+  content {
+    username = "app"
+
+    group {
+      keys  = ["orders", "payments", "emails"]
+      value = generate({length = 32, symbols = 0})
+    }
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["queues"].Content
+	if len(content) != 4 {
+		t.Fatalf("expected 4 keys, got %d", len(content))
+	}
+
+	seen := make(map[*PasswordPolicy]bool)
+	for _, key := range []string{"orders", "payments", "emails"} {
+		val, ok := content[key]
+		if !ok {
+			t.Fatalf("expected key %q from group", key)
+		}
+		if val.Type != ValueTypeGenerate || val.Generate == nil || val.Generate.Length != 32 || val.Generate.Symbols != 0 {
+			t.Errorf("key %q: expected generate with shared policy, got %+v", key, val)
+			continue
+		}
+		if seen[val.Generate] {
+			t.Errorf("key %q shares its policy struct with another key", key)
+		}
+		seen[val.Generate] = true
+	}
+}
+
+func TestParseHCL_GroupBlockErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   string
+		wantErr string
+	}{
+		{"duplicate key", `keys = ["username", "other"]`, "defined more than once"},
+		{"keys not a list", `keys = "single"`, "list of strings"},
+		{"empty key", `keys = [""]`, "must not be empty"},
+		{"unknown block", "keys = [\"a\"]\n      }\n      other {", "unexpected \"other\" block"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    username = "app"
+
+    group {
+      ` + tt.group + `
+      value = generate()
+    }
+  }
+}
+`
+			_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseHCL_MetadataBlock(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  metadata {
+    owner      = "platform"
+    ticket     = "OPS-${env("TICKET")}"
+    managed-by = "vsg"
+  }
+
+  content {
+    key = "value"
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", Variables{"TICKET": "42"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"owner": "platform", "ticket": "OPS-42", "managed-by": "vsg"}
+	if !maps.Equal(cfg.Secrets["app"].Metadata, expected) {
+		t.Errorf("Metadata = %v, want %v", cfg.Secrets["app"].Metadata, expected)
+	}
+}
+
+func TestParseHCL_MetadataBlockErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr string
+	}{
+		{"non-string value", `metadata { owner = 5 }`, "must be a string"},
+		{"kv v1", "version = 1\n  metadata { owner = \"me\" }", "requires KV version 2"},
+		{"duplicate block", "metadata { a = \"1\" }\n  metadata { b = \"2\" }", "only one metadata block"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+secret "app" {
+  path = "app"
+  ` + tt.secret + `
+
+  content {
+    key = "value"
+  }
+}
+`
+			_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseHCL_GenerateExpireAfter(t *testing.T) {
+	hcl := `
+secret "tokens" {
+  path = "tokens"
+
+  content {
+    token  = generate({expire_after = "24h"})
+    hashed = hash(generate({expire_after = "24h"}), {algo = "bcrypt"})
+    static = "value"
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	block := cfg.Secrets["tokens"]
+	if got := block.Content["token"].ExpireAfter; got != 24*time.Hour {
+		t.Errorf("token ExpireAfter = %v, want 24h", got)
+	}
+	if got := block.ExpireAfter(); got != 24*time.Hour {
+		t.Errorf("block ExpireAfter() = %v, want 24h", got)
+	}
+
+	// Round-trips through the dump
+	dumped, err := ParseHCL(DumpHCL(cfg, DumpOptions{}), "dump.hcl", nil)
+	if err != nil {
+		t.Fatalf("parsing dump: %v", err)
+	}
+	if got := dumped.Secrets["tokens"].Content["token"].ExpireAfter; got != 24*time.Hour {
+		t.Errorf("dumped ExpireAfter = %v, want 24h", got)
+	}
+}
+
+func TestParseHCL_GenerateExpireAfterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr string
+	}{
+		{"invalid duration", `content { token = generate({expire_after = "1 day"}) }`, "invalid expire_after"},
+		{"negative duration", `content { token = generate({expire_after = "-1h"}) }`, "invalid expire_after"},
+		{"kv v1", "version = 1\n  content { token = generate({expire_after = \"1h\"}) }", "requires KV version 2"},
+		{"conflicting", "content {\n    a = generate({expire_after = \"1h\"})\n    b = generate({expire_after = \"2h\"})\n  }", "all values must agree"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+secret "app" {
+  path = "app"
+  ` + tt.secret + `
+}
+`
+			_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseHCL_SSHKeygen(t *testing.T) {
+	hcl := `
+secret "deploy" {
+  path = "deploy"
+
+  content {
+    deploy_key = ssh_keygen()
+    legacy_key = ssh_keygen({type = "rsa", strategy = "update"})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["deploy"].Content
+	if len(content) != 4 {
+		t.Fatalf("expected 4 keys, got %v", sortedKeys(content))
+	}
+
+	private := content["deploy_key"]
+	if private.Type != ValueTypeSSHKey || private.SSHKey.Type != SSHKeyTypeEd25519 {
+		t.Errorf("deploy_key = %+v, want an ed25519 private key", private)
+	}
+	public := content["deploy_key_pub"]
+	if public.Type != ValueTypeSSHPublicKey || public.SSHKey.FromKey != "deploy_key" {
+		t.Errorf("deploy_key_pub = %+v, want the public key of deploy_key", public)
+	}
+
+	legacy := content["legacy_key"]
+	if legacy.SSHKey.Type != SSHKeyTypeRSA || legacy.SSHKey.Bits != DefaultRSABits || legacy.Strategy != StrategyUpdate {
+		t.Errorf("legacy_key = %+v, want a %d bit rsa key with strategy update", legacy.SSHKey, DefaultRSABits)
+	}
+	if content["legacy_key_pub"].Strategy != StrategyUpdate {
+		t.Error("expected the public key to share the keypair's strategy")
+	}
+
+	// The dump has one ssh_keygen() per keypair and parses back the same
+	dump := string(DumpHCL(cfg, DumpOptions{}))
+	if strings.Contains(dump, "deploy_key_pub") {
+		t.Errorf("expected public keys to be left out of the dump:\n%s", dump)
+	}
+	dumped, err := ParseHCL([]byte(dump), "dump.hcl", nil)
+	if err != nil {
+		t.Fatalf("parsing dump: %v", err)
+	}
+	if !reflect.DeepEqual(dumped.Secrets["deploy"].Content, content) {
+		t.Errorf("dump round trip changed the content:\n%s", dump)
+	}
+}
+
+func TestParseHCL_SSHKeygenErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown type", `key = ssh_keygen({type = "dsa"})`, "unknown ssh key type"},
+		{"bits on ed25519", `key = ssh_keygen({bits = 4096})`, "bits only applies to rsa keys"},
+		{"small rsa key", `key = ssh_keygen({type = "rsa", bits = 1024})`, "at least 2048 bits"},
+		{"public key collision", "key = ssh_keygen()\n    key_pub = \"static\"", `key "key_pub" is defined more than once`},
+		{"hashed", `key = hash(ssh_keygen(), {algo = "bcrypt"})`, "hash() value must be"},
+		{"group", "group {\n      keys  = [\"a\", \"b\"]\n      value = ssh_keygen()\n    }", "can only be used directly in a content block"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+secret "app" {
+  path = "app"
+  content {
+    ` + tt.content + `
+  }
+}
+`
+			_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseHCL_TLSCert(t *testing.T) {
+	hcl := `
+secret "ingress" {
+  path = "ingress"
+
+  content {
+    ca  = tls_cert({common_name = "Internal CA", is_ca = true, ttl = "87600h"})
+    tls = tls_cert({
+      common_name = "api.internal"
+      sans        = ["api.internal", "10.0.0.1"]
+      issuer      = "secret/ca"
+      strategy    = "update"
+    })
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["ingress"].Content
+	if len(content) != 4 {
+		t.Fatalf("expected 4 keys, got %v", sortedKeys(content))
+	}
+
+	ca := content["ca.crt"]
+	if ca.Type != ValueTypeTLSCert || !ca.TLSCert.IsCA || ca.TLSCert.TTL != 87600*time.Hour || ca.TLSCert.FromKey != "ca.key" {
+		t.Errorf("ca.crt = %+v, want a CA certificate for ca.key", ca.TLSCert)
+	}
+	if content["ca.key"].Type != ValueTypeTLSKey {
+		t.Errorf("ca.key = %+v, want a tls key", content["ca.key"])
+	}
+
+	cert := content["tls.crt"].TLSCert
+	if cert.CommonName != "api.internal" || !slices.Equal(cert.SANs, []string{"api.internal", "10.0.0.1"}) {
+		t.Errorf("tls.crt = %+v, want common name and sans from the config", cert)
+	}
+	if cert.TTL != DefaultTLSCertTTL {
+		t.Errorf("expected default ttl %s, got %s", DefaultTLSCertTTL, cert.TTL)
+	}
+	if cert.Issuer != "secret/ca" || cert.IssuerName != "tls" {
+		t.Errorf("expected issuer secret/ca with default name tls, got %s %s", cert.Issuer, cert.IssuerName)
+	}
+	if content["tls.key"].Strategy != StrategyUpdate || content["tls.crt"].Strategy != StrategyUpdate {
+		t.Error("expected the key and certificate to share the strategy")
+	}
+
+	// The dump has one tls_cert() per certificate and parses back the same
+	dump := string(DumpHCL(cfg, DumpOptions{}))
+	if strings.Contains(dump, ".key") {
+		t.Errorf("expected keys to be left out of the dump:\n%s", dump)
+	}
+	dumped, err := ParseHCL([]byte(dump), "dump.hcl", nil)
+	if err != nil {
+		t.Fatalf("parsing dump: %v", err)
+	}
+	if !reflect.DeepEqual(dumped.Secrets["ingress"].Content, content) {
+		t.Errorf("dump round trip changed the content:\n%s", dump)
+	}
+}
+
+func TestParseHCL_TLSCertErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"no common name", `tls = tls_cert({sans = ["a"]})`, "requires common_name"},
+		{"bad ttl", `tls = tls_cert({common_name = "a", ttl = "1 year"})`, "invalid ttl"},
+		{"negative ttl", `tls = tls_cert({common_name = "a", ttl = "-1h"})`, "invalid ttl"},
+		{"sans not a list", `tls = tls_cert({common_name = "a", sans = "a"})`, "must be a list of strings"},
+		{"issuer name without issuer", `tls = tls_cert({common_name = "a", issuer_name = "ca"})`, "issuer_name requires issuer"},
+		{"hashed", `tls = hash(tls_cert({common_name = "a"}), {algo = "bcrypt"})`, "hash() value must be"},
+		{"group", "group {\n      keys  = [\"a\", \"b\"]\n      value = tls_cert({common_name = \"a\"})\n    }", "can only be used directly in a content block"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+secret "app" {
+  path = "app"
+  content {
+    ` + tt.content + `
+  }
+}
+`
+			_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseHCL_Base64Transforms(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    cert    = base64decode(raw("s3://bucket/cert.b64", {max_size = 4096}))
+    token   = base64encode(command("cat token", {pipe = "tr -d '\\n'"}))
+    round   = base64decode(base64encode(raw("s3://bucket/blob")))
+    literal = base64encode("hello")
+    decoded = base64decode("aGVsbG8=")
+    hashed  = hash(base64decode(raw("s3://bucket/pw.b64")), {algo = "bcrypt"})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content := cfg.Secrets["app"].Content
+
+	tests := []struct {
+		key      string
+		expected []Transform
+	}{
+		{"cert", []Transform{TransformBase64Decode}},
+		{"token", []Transform{TransformBase64Encode}},
+		{"round", []Transform{TransformBase64Encode, TransformBase64Decode}},
+	}
+	for _, tt := range tests {
+		if !slices.Equal(content[tt.key].Transforms, tt.expected) {
+			t.Errorf("%s: Transforms = %v, want %v", tt.key, content[tt.key].Transforms, tt.expected)
+		}
+	}
+
+	if content["cert"].MaxSize != 4096 {
+		t.Errorf("expected raw options to be kept, got MaxSize %d", content["cert"].MaxSize)
+	}
+	if content["token"].Pipe == "" {
+		t.Error("expected command pipe to be kept")
+	}
+	if content["literal"].Type != ValueTypeStatic || content["literal"].Static != "aGVsbG8=" {
+		t.Errorf("expected literal to be encoded at parse time, got %+v", content["literal"])
+	}
+	if content["decoded"].Static != "hello" {
+		t.Errorf("expected literal to be decoded at parse time, got %q", content["decoded"].Static)
+	}
+	if inner := content["hashed"].Inner; inner == nil || !slices.Equal(inner.Transforms, []Transform{TransformBase64Decode}) {
+		t.Errorf("expected hash() inner value to keep its transform, got %+v", inner)
+	}
+}
+
+func TestParseHCL_Base64TransformErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{"invalid literal", `base64decode("not base64!")`, "invalid base64"},
+		{"legacy hash", `base64encode(bcrypt({from = "password"}))`, "can't wrap bcrypt()"},
+		{"hash function", `base64encode(hash(generate(), {algo = "bcrypt"}))`, "hashes can't be transformed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    password = generate()
+    key      = ` + tt.value + `
+  }
+}
+`
+			_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+			if !strings.Contains(err.Error(), "key") {
+				t.Errorf("expected error to name the key, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestDumpHCL(t *testing.T) {
+	hcl := `
+vault {
+  address = "https://vault.example.com"
+  auth {
+    method = "token"
+    token  = "hvs.do-not-print"
+  }
+}
+
+defaults {
+  mount = "kv"
+}
+
+secret "app" {
+  path = "${env("ENV")}/app"
+
+  content {
+    password = generate({length = 24, symbols = 0})
+    host     = json("s3://bucket/out.json", ".db.host", {strategy = "create"})
+    cert     = base64decode(raw("s3://bucket/cert"))
+    name     = "app-$${suffix}"
+
+    group {
+      keys  = ["db/password"]
+      value = hash(generate(), {algo = "bcrypt", cost = 10})
+    }
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", Variables{"ENV": "prod"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `vault {
+  address = "https://vault.example.com"
+  auth {
+    method = "token"
+    token  = "(redacted)"
+  }
+}
+
+defaults {
+  mount   = "kv"
+  version = 0
+
+  strategy {
+    generate = "create"
+    json     = "update"
+    yaml     = "update"
+    raw      = "update"
+    static   = "update"
+    command  = "update"
+    vault    = "update"
+    uuid     = "create"
+  }
+
+  generate {
+    length       = 32
+    digits       = 5
+    symbols      = 5
+    symbol_set   = "-_$@"
+    no_upper     = false
+    allow_repeat = true
+  }
+}
+
+secret "app" {
+  mount       = "kv"
+  path        = "prod/app"
+  prune       = false
+  nested_keys = false
+  enabled     = true
+
+  content {
+    cert     = base64decode(raw("s3://bucket/cert"))
+    host     = json("s3://bucket/out.json", ".db.host", { strategy = "create" })
+    name     = "app-$${suffix}"
+    password = generate({ length = 24, symbols = 0 })
+
+    group {
+      keys  = ["db/password"]
+      value = hash(generate(), { algo = "bcrypt", cost = 10 })
+    }
+  }
+}
+`
+
+	dump := string(DumpHCL(cfg, DumpOptions{}))
+	if dump != expected {
+		t.Errorf("unexpected dump:\n%s\nwant:\n%s", dump, expected)
+	}
+
+	// The dump parses back to the same effective config
+	reparsed, err := ParseHCL([]byte(dump), "dump.hcl", nil)
+	if err != nil {
+		t.Fatalf("dump does not parse: %v", err)
+	}
+	if again := string(DumpHCL(reparsed, DumpOptions{})); again != dump {
+		t.Errorf("dump is not stable across a round trip:\n%s", again)
+	}
+}
+
+func TestDumpJSON(t *testing.T) {
+	hcl := `
+secret "app" {
+  path    = "app"
+  enabled = false
+
+  metadata {
+    owner = "platform"
+  }
+
+  content {
+    id = uuid()
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := DumpJSON(cfg, DumpOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var dump struct {
+		Defaults struct {
+			Mount string `json:"mount"`
+		} `json:"defaults"`
+		Secrets map[string]struct {
+			Mount    string            `json:"mount"`
+			Enabled  bool              `json:"enabled"`
+			Metadata map[string]string `json:"metadata"`
+			Content  map[string]string `json:"content"`
+		} `json:"secrets"`
+	}
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatalf("dump is not valid JSON: %v\n%s", err, data)
+	}
+
+	app := dump.Secrets["app"]
+	if dump.Defaults.Mount != "secret" || app.Mount != "secret" {
+		t.Errorf("expected default mount to be applied, got defaults=%q block=%q", dump.Defaults.Mount, app.Mount)
+	}
+	if app.Enabled {
+		t.Error("expected enabled = false")
+	}
+	if app.Metadata["owner"] != "platform" {
+		t.Errorf("unexpected metadata: %v", app.Metadata)
+	}
+	if app.Content["id"] != "uuid()" {
+		t.Errorf("content id = %q, want %q", app.Content["id"], "uuid()")
+	}
+}
+
+func TestDumpYAML(t *testing.T) {
+	hcl := `
+vault {
+  auth {
+    method = "token"
+    token  = "hvs.secret"
+  }
+}
+
+secret "app" {
+  path = "app"
+
+  content {
+    username = "admin"
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := DumpYAML(cfg, DumpOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var dump struct {
+		Vault struct {
+			Auth struct {
+				Token string `yaml:"token"`
+			} `yaml:"auth"`
+		} `yaml:"vault"`
+		Secrets map[string]struct {
+			Mount   string            `yaml:"mount"`
+			Content map[string]string `yaml:"content"`
+		} `yaml:"secrets"`
+	}
+	if err := yaml.Unmarshal(data, &dump); err != nil {
+		t.Fatalf("dump is not valid YAML: %v\n%s", err, data)
+	}
+
+	if dump.Vault.Auth.Token != redactedCredential {
+		t.Errorf("token = %q, want it redacted", dump.Vault.Auth.Token)
+	}
+	app := dump.Secrets["app"]
+	if app.Mount != "secret" {
+		t.Errorf("mount = %q, want %q", app.Mount, "secret")
+	}
+	if app.Content["username"] != `"admin"` {
+		t.Errorf("content username = %q, want %q", app.Content["username"], `"admin"`)
+	}
+}
+
+func TestParseHCL_JSONMulti(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    username = "app"
+
+    outputs = json_multi("s3://bucket/terraform.tfstate", {
+      db_host = ".outputs.db_host.value"
+      db_port = ".outputs.db_port.value"
+    }, {strategy = "create"})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := cfg.Secrets["app"].Content
+	if _, ok := content["outputs"]; ok {
+		t.Error("the json_multi() attribute name should not become a key")
+	}
+	if len(content) != 3 {
+		t.Fatalf("expected 3 keys, got %d", len(content))
+	}
+
+	for key, query := range map[string]string{"db_host": ".outputs.db_host.value", "db_port": ".outputs.db_port.value"} {
+		val := content[key]
+		if val.Type != ValueTypeJSON || val.URL != "s3://bucket/terraform.tfstate" || val.Query != query {
+			t.Errorf("%s: unexpected value %+v", key, val)
+		}
+		if val.Strategy != StrategyCreate {
+			t.Errorf("%s: expected options to apply to every key, got strategy %q", key, val.Strategy)
+		}
+	}
+}
+
+func TestParseHCL_JSONMultiErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			"collides with explicit key",
+			"db_host = \"static\"\n    outputs = json_multi(\"s3://b/s\", {db_host = \".a\"})",
+			`key "db_host" is defined more than once`,
+		},
+		{
+			"collides across sets",
+			"a = json_multi(\"s3://b/s\", {k = \".a\"})\n    b = json_multi(\"s3://b/t\", {k = \".b\"})",
+			`key "k" is defined more than once`,
+		},
+		{
+			"non-string query",
+			`outputs = json_multi("s3://b/s", {k = 5})`,
+			"must be a string",
+		},
+		{
+			"empty queries",
+			`outputs = json_multi("s3://b/s", {})`,
+			"at least one key",
+		},
+		{
+			"wrapped in hash",
+			`outputs = hash(json_multi("s3://b/s", {k = ".a"}), {algo = "bcrypt"})`,
+			"hash() value must be",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    ` + tt.content + `
+  }
+}
+`
+			_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseHCL_EnvAll(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    env = env_all("APP_", {strategy = "create"})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	val := cfg.Secrets["app"].Content["env"]
+	if val.Type != ValueTypeEnvAll || val.Prefix != "APP_" || val.Strategy != StrategyCreate {
+		t.Errorf("unexpected value %+v", val)
+	}
+	if got := FormatValue(val); got != `env_all("APP_", {strategy = "create"})` {
+		t.Errorf("FormatValue() = %s", got)
+	}
+}
+
+func TestParseHCL_EnvAllErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"empty prefix", `env = env_all("")`, "non-empty prefix"},
+		{"wrapped in hash", `env = hash(env_all("APP_"), {algo = "bcrypt"})`, "hash() cannot wrap env_all()"},
+		{"in group", "group {\n      keys  = [\"a\"]\n      value = env_all(\"APP_\")\n    }", "can't be used in a group block"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    ` + tt.content + `
+  }
+}
+`
+			_, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseHCL_MapFrom(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    db = map_from("file:///srv/outputs.json", {filter = "db_*"})
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	val := cfg.Secrets["app"].Content["db"]
+	if val.Type != ValueTypeMapFrom || val.URL != "file:///srv/outputs.json" || val.Filter != "db_*" {
+		t.Errorf("unexpected value %+v", val)
+	}
+	if got := FormatValue(val); got != `map_from("file:///srv/outputs.json", {filter = "db_*"})` {
+		t.Errorf("FormatValue() = %s", got)
+	}
+
+	hcl = strings.Replace(hcl, `"db_*"`, `"db_["`, 1)
+	if _, err := ParseHCL([]byte(hcl), "test.hcl", nil); err == nil || !strings.Contains(err.Error(), "filter") {
+		t.Errorf("expected filter error, got: %v", err)
+	}
+}
+
+func TestParseHCL_ForEachFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"billing.json", "orders.json", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(`{"db_host": "db"}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "nested.json"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	hcl := `
+secret "app" {
+  for_each = files("file://` + dir + `/*.json")
+  path     = "apps/${each.key}"
+
+  content {
+    name    = each.key
+    db_host = json(each.value, ".db_host")
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	names := slices.Sorted(maps.Keys(cfg.Secrets))
+	if !slices.Equal(names, []string{"app[billing]", "app[orders]"}) {
+		t.Fatalf("expected one block per JSON file, got %v", names)
+	}
+
+	billing := cfg.Secrets["app[billing]"]
+	if billing.Path != "apps/billing" {
+		t.Errorf("path = %q, want %q", billing.Path, "apps/billing")
+	}
+	if billing.Content["name"].Static != "billing" {
+		t.Errorf("name = %q, want %q", billing.Content["name"].Static, "billing")
+	}
+	if url := billing.Content["db_host"].URL; url != "file://"+filepath.Join(dir, "billing.json") {
+		t.Errorf("db_host url = %q, want the billing file", url)
+	}
+}
+
+func TestParseHCL_ForEach(t *testing.T) {
+	tests := []struct {
+		name    string
+		forEach string
+		want    []string
+		wantErr string
+	}{
+		{"map", `{a = "x", b = "y"}`, []string{"app[a]", "app[b]"}, ""},
+		{"set", `["a", "b"]`, []string{"app[a]", "app[b]"}, ""},
+		{"empty", `[]`, nil, "no secrets defined"},
+		{"repeated", `["a", "a"]`, nil, `key "a" is listed more than once`},
+		{"not strings", `[1, {}]`, nil, "must be a map or a set of strings"},
+		{"remote", `files("s3://bucket/apps/")`, nil, "can only list file:// sources"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+secret "app" {
+  for_each = ` + tt.forEach + `
+  path     = "apps/${each.key}"
+
+  content {
+    value = each.value
+  }
+}
+`
+			cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if names := slices.Sorted(maps.Keys(cfg.Secrets)); !slices.Equal(names, tt.want) {
+				t.Errorf("blocks = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHCL_IgnoreKeys(t *testing.T) {
+	hcl := `
+secret "app" {
+  path        = "app"
+  ignore_keys = ["sessionToken", "lastRotated"]
+
+  content {
+    username = "admin"
+  }
+}
+`
+
+	cfg, err := ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys := cfg.Secrets["app"].IgnoreKeys; !slices.Equal(keys, []string{"sessionToken", "lastRotated"}) {
+		t.Errorf("ignore_keys = %v", keys)
+	}
+
+	conflict := strings.Replace(hcl, `"lastRotated"]`, `"username"]`, 1)
+	if _, err := ParseHCL([]byte(conflict), "test.hcl", nil); err == nil || !strings.Contains(err.Error(), `key "username" is in both content and ignore_keys`) {
+		t.Errorf("expected a conflict error, got %v", err)
+	}
+}
@@ -0,0 +1,687 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// redactedCredential replaces Vault auth credentials in dumps.
+const redactedCredential = "(redacted)"
+
+// DumpOptions controls how secret values are shown in a dump.
+type DumpOptions struct {
+	// MaskStatic, when set, replaces each static value with its result. It
+	// is called with the content key holding the value. Static values
+	// nested in other functions, such as a command() stdin, are masked under
+	// the same key.
+	MaskStatic func(key, value string) string
+}
+
+// format renders the value of key with FormatValue, after masking its
+// static values.
+func (o DumpOptions) format(key string, v Value) string {
+	if o.MaskStatic == nil {
+		return FormatValue(v)
+	}
+	return FormatValue(maskStatics(v, func(s string) string { return o.MaskStatic(key, s) }))
+}
+
+// maskStatics returns a copy of v with mask applied to its static value
+// and to those of the values it wraps.
+func maskStatics(v Value, mask func(string) string) Value {
+	if v.Type == ValueTypeStatic {
+		v.Static = mask(v.Static)
+	}
+	if v.Stdin != nil {
+		stdin := maskStatics(*v.Stdin, mask)
+		v.Stdin = &stdin
+	}
+	if v.Inner != nil {
+		inner := maskStatics(*v.Inner, mask)
+		v.Inner = &inner
+	}
+	return v
+}
+
+// dumpConfig is the JSON form of a dumped Config.
+type dumpConfig struct {
+	Vault    dumpVault             `json:"vault" yaml:"vault"`
+	Defaults dumpDefaults          `json:"defaults" yaml:"defaults"`
+	Redact   []string              `json:"redact_patterns,omitempty" yaml:"redact_patterns,omitempty"`
+	Mask     []string              `json:"always_mask,omitempty" yaml:"always_mask,omitempty"`
+	Secrets  map[string]dumpSecret `json:"secrets" yaml:"secrets"`
+}
+
+type dumpVault struct {
+	Address   string   `json:"address,omitempty" yaml:"address,omitempty"`
+	Namespace string   `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	MaxConns  int      `json:"max_conns,omitempty" yaml:"max_conns,omitempty"`
+	Auth      dumpAuth `json:"auth" yaml:"auth"`
+}
+
+type dumpAuth struct {
+	Method      string `json:"method,omitempty" yaml:"method,omitempty"`
+	Token       string `json:"token,omitempty" yaml:"token,omitempty"`
+	Role        string `json:"role,omitempty" yaml:"role,omitempty"`
+	RoleID      string `json:"role_id,omitempty" yaml:"role_id,omitempty"`
+	SecretID    string `json:"secret_id,omitempty" yaml:"secret_id,omitempty"`
+	MountPath   string `json:"mount_path,omitempty" yaml:"mount_path,omitempty"`
+	Region      string `json:"region,omitempty" yaml:"region,omitempty"`
+	HeaderValue string `json:"header_value,omitempty" yaml:"header_value,omitempty"`
+	JWTPath     string `json:"jwt_path,omitempty" yaml:"jwt_path,omitempty"`
+	JWTEnv      string `json:"jwt_env,omitempty" yaml:"jwt_env,omitempty"`
+	Username    string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password    string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+type dumpDefaults struct {
+	Mount    string                `json:"mount" yaml:"mount"`
+	Version  int                   `json:"version" yaml:"version"`
+	Strategy map[string]Strategy   `json:"strategy" yaml:"strategy"`
+	Generate dumpPolicy            `json:"generate" yaml:"generate"`
+	Policies map[string]dumpPolicy `json:"policies,omitempty" yaml:"policies,omitempty"`
+}
+
+type dumpPolicy struct {
+	Length           int    `json:"length" yaml:"length"`
+	Digits           int    `json:"digits" yaml:"digits"`
+	Symbols          int    `json:"symbols" yaml:"symbols"`
+	SymbolSet        string `json:"symbol_set" yaml:"symbol_set"`
+	NoUpper          bool   `json:"no_upper" yaml:"no_upper"`
+	MinLower         int    `json:"min_lowercase,omitempty" yaml:"min_lowercase,omitempty"`
+	MinUpper         int    `json:"min_uppercase,omitempty" yaml:"min_uppercase,omitempty"`
+	AllowRepeat      bool   `json:"allow_repeat" yaml:"allow_repeat"`
+	ShellSafe        bool   `json:"shell_safe" yaml:"shell_safe"`
+	JSONSafe         bool   `json:"json_safe" yaml:"json_safe"`
+	ExcludeAmbiguous bool   `json:"exclude_ambiguous,omitempty" yaml:"exclude_ambiguous,omitempty"`
+	RequireEachClass bool   `json:"require_each_class,omitempty" yaml:"require_each_class,omitempty"`
+	MinEntropy       int    `json:"min_entropy,omitempty" yaml:"min_entropy,omitempty"`
+}
+
+type dumpSecret struct {
+	Mount          string            `json:"mount" yaml:"mount"`
+	Path           string            `json:"path" yaml:"path"`
+	Version        int               `json:"version" yaml:"version"`
+	Prune          bool              `json:"prune" yaml:"prune"`
+	Force          bool              `json:"force,omitempty" yaml:"force,omitempty"`
+	NestedKeys     bool              `json:"nested_keys" yaml:"nested_keys"`
+	IgnoreKeysFile string            `json:"ignore_keys_file,omitempty" yaml:"ignore_keys_file,omitempty"`
+	IgnoreKeys     []string          `json:"ignore_keys,omitempty" yaml:"ignore_keys,omitempty"`
+	Enabled        bool              `json:"enabled" yaml:"enabled"`
+	Metadata       map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Content        map[string]string `json:"content" yaml:"content"`
+}
+
+// DumpJSON renders the effective config, after defaults and variable
+// substitution, as indented JSON. Secret values are shown as the HCL
+// expression that produces them; nothing is resolved. Vault credentials
+// are redacted, and static values are masked as opts says.
+func DumpJSON(cfg *Config, opts DumpOptions) ([]byte, error) {
+	data, err := json.MarshalIndent(newDump(cfg, opts), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding config: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// DumpYAML renders the effective config as YAML, with the same fields,
+// redaction and masking as DumpJSON.
+func DumpYAML(cfg *Config, opts DumpOptions) ([]byte, error) {
+	data, err := yaml.Marshal(newDump(cfg, opts))
+	if err != nil {
+		return nil, fmt.Errorf("encoding config: %w", err)
+	}
+	return data, nil
+}
+
+// newDump builds the structured dump shared by DumpJSON and DumpYAML.
+func newDump(cfg *Config, opts DumpOptions) dumpConfig {
+	out := dumpConfig{
+		Vault: dumpVault{
+			Address:   cfg.Vault.Address,
+			Namespace: cfg.Vault.Namespace,
+			MaxConns:  cfg.Vault.MaxConns,
+			Auth: dumpAuth{
+				Method:      cfg.Vault.Auth.Method,
+				Token:       redactCredential(cfg.Vault.Auth.Token),
+				Role:        cfg.Vault.Auth.Role,
+				RoleID:      cfg.Vault.Auth.RoleID,
+				SecretID:    redactCredential(cfg.Vault.Auth.SecretID),
+				MountPath:   cfg.Vault.Auth.MountPath,
+				Region:      cfg.Vault.Auth.Region,
+				HeaderValue: cfg.Vault.Auth.HeaderValue,
+				JWTPath:     cfg.Vault.Auth.JWTPath,
+				JWTEnv:      cfg.Vault.Auth.JWTEnv,
+				Username:    cfg.Vault.Auth.Username,
+				Password:    redactCredential(cfg.Vault.Auth.Password),
+			},
+		},
+		Defaults: dumpDefaults{
+			Mount:    cfg.Defaults.Mount,
+			Version:  cfg.Defaults.Version,
+			Strategy: strategyMap(cfg.Defaults.Strategy),
+			Generate: toDumpPolicy(cfg.Defaults.Generate),
+		},
+		Redact:  cfg.Redact.Patterns,
+		Mask:    cfg.Redact.AlwaysMask,
+		Secrets: make(map[string]dumpSecret, len(cfg.Secrets)),
+	}
+
+	if len(cfg.Defaults.Policies) > 0 {
+		out.Defaults.Policies = make(map[string]dumpPolicy, len(cfg.Defaults.Policies))
+		for name, policy := range cfg.Defaults.Policies {
+			out.Defaults.Policies[name] = toDumpPolicy(policy)
+		}
+	}
+
+	for name, secret := range cfg.Secrets {
+		content := make(map[string]string, len(secret.Content))
+		for key, val := range secret.Content {
+			content[key] = opts.format(key, val)
+		}
+		out.Secrets[name] = dumpSecret{
+			Mount:          secret.Mount,
+			Path:           secret.Path,
+			Version:        secret.Version,
+			Prune:          secret.Prune,
+			Force:          secret.Force,
+			NestedKeys:     secret.NestedKeys,
+			IgnoreKeysFile: secret.IgnoreKeysFile,
+			IgnoreKeys:     secret.IgnoreKeys,
+			Enabled:        secret.IsEnabled(),
+			Metadata:       secret.Metadata,
+			Content:        content,
+		}
+	}
+
+	return out
+}
+
+// DumpHCL renders the effective config, after defaults and variable
+// substitution, as canonical HCL that parses back to the same config.
+// Vault credentials are redacted, and static values are masked as opts
+// says, in which case the masked values are what parses back.
+func DumpHCL(cfg *Config, opts DumpOptions) []byte {
+	var b strings.Builder
+
+	b.WriteString("vault {\n")
+	writeAttr(&b, "address", cfg.Vault.Address)
+	writeAttr(&b, "namespace", cfg.Vault.Namespace)
+	if cfg.Vault.MaxConns > 0 {
+		fmt.Fprintf(&b, "max_conns = %d\n", cfg.Vault.MaxConns)
+	}
+	b.WriteString("auth {\n")
+	writeAttr(&b, "method", cfg.Vault.Auth.Method)
+	writeAttr(&b, "token", redactCredential(cfg.Vault.Auth.Token))
+	writeAttr(&b, "role", cfg.Vault.Auth.Role)
+	writeAttr(&b, "role_id", cfg.Vault.Auth.RoleID)
+	writeAttr(&b, "secret_id", redactCredential(cfg.Vault.Auth.SecretID))
+	writeAttr(&b, "mount_path", cfg.Vault.Auth.MountPath)
+	writeAttr(&b, "region", cfg.Vault.Auth.Region)
+	writeAttr(&b, "header_value", cfg.Vault.Auth.HeaderValue)
+	writeAttr(&b, "jwt_path", cfg.Vault.Auth.JWTPath)
+	writeAttr(&b, "jwt_env", cfg.Vault.Auth.JWTEnv)
+	writeAttr(&b, "username", cfg.Vault.Auth.Username)
+	writeAttr(&b, "password", redactCredential(cfg.Vault.Auth.Password))
+	b.WriteString("}\n}\n\n")
+
+	b.WriteString("defaults {\n")
+	writeAttr(&b, "mount", cfg.Defaults.Mount)
+	fmt.Fprintf(&b, "version = %d\n\n", cfg.Defaults.Version)
+	b.WriteString("strategy {\n")
+	strategies := strategyMap(cfg.Defaults.Strategy)
+	for _, name := range hclStrategyNames {
+		writeAttr(&b, name, string(strategies[name]))
+	}
+	b.WriteString("}\n")
+	writePolicyBlock(&b, "generate", cfg.Defaults.Generate)
+	for _, name := range sortedKeys(cfg.Defaults.Policies) {
+		writePolicyBlock(&b, fmt.Sprintf("policy %s", hclString(name)), cfg.Defaults.Policies[name])
+	}
+	b.WriteString("}\n")
+
+	if len(cfg.Redact.Patterns) > 0 || len(cfg.Redact.AlwaysMask) > 0 {
+		b.WriteString("\nredact {\n")
+		if len(cfg.Redact.Patterns) > 0 {
+			fmt.Fprintf(&b, "patterns = [%s]\n", hclStringList(cfg.Redact.Patterns))
+		}
+		if len(cfg.Redact.AlwaysMask) > 0 {
+			fmt.Fprintf(&b, "always_mask = [%s]\n", hclStringList(cfg.Redact.AlwaysMask))
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, name := range sortedKeys(cfg.Secrets) {
+		secret := cfg.Secrets[name]
+
+		fmt.Fprintf(&b, "\nsecret %s {\n", hclString(name))
+		writeAttr(&b, "mount", secret.Mount)
+		writeAttr(&b, "path", secret.Path)
+		if secret.Version != 0 {
+			fmt.Fprintf(&b, "version = %d\n", secret.Version)
+		}
+		fmt.Fprintf(&b, "prune = %t\n", secret.Prune)
+		if secret.Force {
+			b.WriteString("force = true\n")
+		}
+		fmt.Fprintf(&b, "nested_keys = %t\n", secret.NestedKeys)
+		writeAttr(&b, "ignore_keys_file", secret.IgnoreKeysFile)
+		if len(secret.IgnoreKeys) > 0 {
+			fmt.Fprintf(&b, "ignore_keys = [%s]\n", hclStringList(secret.IgnoreKeys))
+		}
+		fmt.Fprintf(&b, "enabled = %t\n", secret.IsEnabled())
+
+		if len(secret.Metadata) > 0 {
+			b.WriteString("\nmetadata {\n")
+			for _, key := range sortedKeys(secret.Metadata) {
+				fmt.Fprintf(&b, "%s = %s\n", key, hclString(secret.Metadata[key]))
+			}
+			b.WriteString("}\n")
+		}
+
+		// Keys that aren't identifiers can only be declared in a group
+		var groupKeys []string
+		b.WriteString("\ncontent {\n")
+		for _, key := range sortedKeys(secret.Content) {
+			// The public key comes back with the private key's ssh_keygen()
+			if secret.Content[key].Type == ValueTypeSSHPublicKey {
+				continue
+			}
+			// tls_cert() declares both keys under the name without suffix
+			switch secret.Content[key].Type {
+			case ValueTypeTLSKey:
+				continue
+			case ValueTypeTLSCert:
+				fmt.Fprintf(&b, "%s = %s\n", strings.TrimSuffix(key, TLSCertSuffix), opts.format(key, secret.Content[key]))
+				continue
+			}
+			if !hclsyntax.ValidIdentifier(key) {
+				groupKeys = append(groupKeys, key)
+				continue
+			}
+			fmt.Fprintf(&b, "%s = %s\n", key, opts.format(key, secret.Content[key]))
+		}
+		for _, key := range groupKeys {
+			fmt.Fprintf(&b, "\ngroup {\nkeys = [%s]\nvalue = %s\n}\n", hclString(key), opts.format(key, secret.Content[key]))
+		}
+		b.WriteString("}\n}\n")
+	}
+
+	return hclwrite.Format([]byte(b.String()))
+}
+
+// FormatValue renders a value as the HCL expression that produces it,
+// e.g. generate({length = 32}) or json("s3://bucket/out.json", ".db.host").
+func FormatValue(v Value) string {
+	var expr string
+	opts := newOptionList()
+
+	switch v.Type {
+	case ValueTypeStatic:
+		expr = hclString(v.Static)
+
+	case ValueTypeGenerate:
+		switch {
+		case v.Passphrase != nil:
+			opts.add("mode", hclString("passphrase"))
+			opts.add("words", strconv.Itoa(v.Passphrase.Words))
+			opts.add("separator", hclString(v.Passphrase.Separator))
+			opts.addBool("capitalize", v.Passphrase.Capitalize)
+			opts.addBool("number", v.Passphrase.Number)
+		case v.PolicyName != "":
+			opts.add("policy", hclString(v.PolicyName))
+		case v.Generate != nil:
+			if v.Generate.Length > 0 {
+				opts.add("length", strconv.Itoa(v.Generate.Length))
+			}
+			// Zero digits means the base policy's digits
+			if v.Generate.Digits > 0 {
+				opts.add("digits", strconv.Itoa(v.Generate.Digits))
+			}
+			if v.Generate.SymbolsSet {
+				opts.add("symbols", strconv.Itoa(v.Generate.Symbols))
+			}
+			if v.Generate.SymbolCharacters != "" {
+				opts.add("symbol_set", hclString(v.Generate.SymbolCharacters))
+			}
+			opts.addBool("no_upper", v.Generate.NoUpper)
+			if v.Generate.MinLower > 0 {
+				opts.add("min_lowercase", strconv.Itoa(v.Generate.MinLower))
+			}
+			if v.Generate.MinUpper > 0 {
+				opts.add("min_uppercase", strconv.Itoa(v.Generate.MinUpper))
+			}
+			if v.Generate.AllowRepeat != nil && !*v.Generate.AllowRepeat {
+				opts.add("allow_repeat", "false")
+			}
+			opts.addBool("shell_safe", v.Generate.ShellSafe)
+			opts.addBool("json_safe", v.Generate.JSONSafe)
+			opts.addBool("exclude_ambiguous", v.Generate.ExcludeAmbiguous)
+			opts.addBool("require_each_class", v.Generate.RequireEachClass)
+			if v.Generate.MinEntropy > 0 {
+				opts.add("min_entropy", strconv.Itoa(v.Generate.MinEntropy))
+			}
+		}
+		if v.ExpireAfter > 0 {
+			opts.add("expire_after", hclString(v.ExpireAfter.String()))
+		}
+		expr = "generate(" + opts.withCommon(v).render() + ")"
+
+	case ValueTypeUUID:
+		expr = "uuid(" + opts.withCommon(v).render() + ")"
+
+	case ValueTypeJSON, ValueTypeYAML:
+		if v.As != "" {
+			opts.add("as", hclString(string(v.As)))
+		}
+		expr = callExpr(string(v.Type), []string{hclString(v.URL), hclString(v.Query)}, opts.withCommon(v))
+
+	case ValueTypeRaw:
+		if v.MaxSize > 0 {
+			opts.add("max_size", strconv.FormatInt(v.MaxSize, 10))
+		}
+		opts.addBool("minify", v.JSONFormat == JSONFormatMinify)
+		opts.addBool("pretty", v.JSONFormat == JSONFormatPretty)
+		expr = callExpr("raw", []string{hclString(v.URL)}, opts.withCommon(v))
+
+	case ValueTypeVault:
+		if v.VaultVersion > 0 {
+			opts.add("version", strconv.Itoa(v.VaultVersion))
+		}
+		expr = callExpr("vault", []string{hclString(v.VaultPath), hclString(v.VaultKey)}, opts.withCommon(v))
+
+	case ValueTypeCommand:
+		if v.Timeout > 0 {
+			opts.add("timeout", hclString(v.Timeout.String()))
+		}
+		if v.Stdin != nil {
+			opts.add("stdin", FormatValue(*v.Stdin))
+		}
+		if len(v.Env) > 0 {
+			env := make([]string, 0, len(v.Env))
+			for _, name := range sortedKeys(v.Env) {
+				env = append(env, name+" = "+hclString(v.Env[name]))
+			}
+			opts.add("env", "{"+strings.Join(env, ", ")+"}")
+		}
+		opts.addBool("normalize_newlines", v.NormalizeNewlines)
+		if v.Binary != "" {
+			opts.add("binary", hclString(v.Binary))
+		}
+		expr = callExpr("command", []string{hclString(v.Command)}, opts.withCommon(v))
+
+	case ValueTypeEnvAll:
+		expr = callExpr("env_all", []string{hclString(v.Prefix)}, opts.withCommon(v))
+
+	case ValueTypeMapFrom:
+		if v.Filter != "" {
+			opts.add("filter", hclString(v.Filter))
+		}
+		expr = callExpr("map_from", []string{hclString(v.URL)}, opts.withCommon(v))
+
+	case ValueTypeBcrypt, ValueTypeArgon2, ValueTypePbkdf2:
+		opts.add("from", hclString(hashFromKey(v)))
+		addHashOptions(opts, v.Type, v)
+		expr = callExpr(string(v.Type), nil, opts.withCommon(v))
+
+	case ValueTypeSSHKey:
+		opts.add("type", hclString(v.SSHKey.Type))
+		if v.SSHKey.Type == SSHKeyTypeRSA {
+			opts.add("bits", strconv.Itoa(v.SSHKey.Bits))
+		}
+		expr = "ssh_keygen(" + opts.withCommon(v).render() + ")"
+
+	case ValueTypeSSHPublicKey:
+		// Produced by the ssh_keygen() of the private key, not by its own call
+		expr = fmt.Sprintf("<public key of %s>", v.SSHKey.FromKey)
+
+	case ValueTypeTLSCert:
+		opts.add("common_name", hclString(v.TLSCert.CommonName))
+		if len(v.TLSCert.SANs) > 0 {
+			opts.add("sans", "["+hclStringList(v.TLSCert.SANs)+"]")
+		}
+		opts.add("ttl", hclString(v.TLSCert.TTL.String()))
+		opts.addBool("is_ca", v.TLSCert.IsCA)
+		if v.TLSCert.Issuer != "" {
+			opts.add("issuer", hclString(v.TLSCert.Issuer))
+			opts.add("issuer_name", hclString(v.TLSCert.IssuerName))
+		}
+		expr = "tls_cert(" + opts.withCommon(v).render() + ")"
+
+	case ValueTypeTLSKey:
+		// Produced by the tls_cert() of the certificate, not by its own call
+		expr = fmt.Sprintf("<private key of tls_cert(%s)>", hclString(v.TLSCert.CommonName))
+
+	case ValueTypeHash:
+		inner := "null"
+		if v.Inner != nil {
+			inner = FormatValue(*v.Inner)
+		}
+		opts.add("algo", hclString(string(v.HashAlgorithm)))
+		addHashOptions(opts, v.HashAlgorithm, v)
+		expr = callExpr("hash", []string{inner}, opts.withCommon(v))
+
+	default:
+		expr = fmt.Sprintf("<unknown %s>", v.Type)
+	}
+
+	for _, t := range v.Transforms {
+		expr = fmt.Sprintf("%s(%s)", t, expr)
+	}
+	return expr
+}
+
+// hashFromKey returns the source key of a bcrypt(), argon2() or pbkdf2() value.
+func hashFromKey(v Value) string {
+	switch {
+	case v.Bcrypt != nil:
+		return v.Bcrypt.FromKey
+	case v.Argon2 != nil:
+		return v.Argon2.FromKey
+	case v.Pbkdf2 != nil:
+		return v.Pbkdf2.FromKey
+	}
+	return ""
+}
+
+// addHashOptions adds the non-default hashing parameters of v for algo.
+func addHashOptions(opts *optionList, algo ValueType, v Value) {
+	switch algo {
+	case ValueTypeBcrypt:
+		if v.Bcrypt != nil && v.Bcrypt.Cost > 0 {
+			opts.add("cost", strconv.Itoa(v.Bcrypt.Cost))
+		}
+	case ValueTypeArgon2:
+		if v.Argon2 == nil {
+			return
+		}
+		if v.Argon2.Variant != "" {
+			opts.add("variant", hclString(v.Argon2.Variant))
+		}
+		if v.Argon2.Memory > 0 {
+			opts.add("memory", strconv.FormatUint(uint64(v.Argon2.Memory), 10))
+		}
+		if v.Argon2.Iterations > 0 {
+			opts.add("iterations", strconv.FormatUint(uint64(v.Argon2.Iterations), 10))
+		}
+		if v.Argon2.Parallelism > 0 {
+			opts.add("parallelism", strconv.FormatUint(uint64(v.Argon2.Parallelism), 10))
+		}
+	case ValueTypePbkdf2:
+		if v.Pbkdf2 == nil {
+			return
+		}
+		if v.Pbkdf2.Variant != "" {
+			opts.add("variant", hclString(v.Pbkdf2.Variant))
+		}
+		if v.Pbkdf2.Iterations > 0 {
+			opts.add("iterations", strconv.Itoa(v.Pbkdf2.Iterations))
+		}
+	}
+}
+
+// optionList collects "name = expr" pairs for a function's options object.
+type optionList struct {
+	pairs []string
+}
+
+func newOptionList() *optionList {
+	return &optionList{}
+}
+
+func (o *optionList) add(name, expr string) {
+	o.pairs = append(o.pairs, name+" = "+expr)
+}
+
+func (o *optionList) addBool(name string, b bool) {
+	if b {
+		o.add(name, "true")
+	}
+}
+
+// withCommon adds the strategy and pipe options shared by all functions.
+func (o *optionList) withCommon(v Value) *optionList {
+	if v.Strategy != "" {
+		o.add("strategy", hclString(string(v.Strategy)))
+	}
+	if v.Pipe != "" {
+		o.add("pipe", hclString(v.Pipe))
+	}
+	return o
+}
+
+func (o *optionList) render() string {
+	if len(o.pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(o.pairs, ", ") + "}"
+}
+
+// callExpr renders name(args..., {options}).
+func callExpr(name string, args []string, opts *optionList) string {
+	if rendered := opts.render(); rendered != "" {
+		args = append(args, rendered)
+	}
+	return name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// hclStrategyNames are the strategy defaults settable in HCL, in dump order.
+var hclStrategyNames = []string{"generate", "json", "yaml", "raw", "static", "command", "vault", "uuid"}
+
+// strategyMap returns every strategy default keyed by value type.
+func strategyMap(s StrategyDefaults) map[string]Strategy {
+	return map[string]Strategy{
+		"generate": s.Generate,
+		"json":     s.JSON,
+		"yaml":     s.YAML,
+		"raw":      s.Raw,
+		"static":   s.Static,
+		"command":  s.Command,
+		"vault":    s.Vault,
+		"uuid":     s.UUID,
+		"bcrypt":   s.Bcrypt,
+		"argon2":   s.Argon2,
+		"pbkdf2":   s.Pbkdf2,
+	}
+}
+
+func toDumpPolicy(p PasswordPolicy) dumpPolicy {
+	return dumpPolicy{
+		Length:           p.Length,
+		Digits:           p.Digits,
+		Symbols:          p.Symbols,
+		SymbolSet:        p.SymbolCharacters,
+		NoUpper:          p.NoUpper,
+		MinLower:         p.MinLower,
+		MinUpper:         p.MinUpper,
+		AllowRepeat:      p.AllowRepeat == nil || *p.AllowRepeat,
+		ShellSafe:        p.ShellSafe,
+		JSONSafe:         p.JSONSafe,
+		ExcludeAmbiguous: p.ExcludeAmbiguous,
+		RequireEachClass: p.RequireEachClass,
+		MinEntropy:       p.MinEntropy,
+	}
+}
+
+func writePolicyBlock(b *strings.Builder, header string, p PasswordPolicy) {
+	d := toDumpPolicy(p)
+	fmt.Fprintf(b, "\n%s {\n", header)
+	// A policy with min_entropy and no length derives its length
+	if d.Length > 0 {
+		fmt.Fprintf(b, "length = %d\n", d.Length)
+	}
+	fmt.Fprintf(b, "digits = %d\n", d.Digits)
+	fmt.Fprintf(b, "symbols = %d\n", d.Symbols)
+	fmt.Fprintf(b, "symbol_set = %s\n", hclString(d.SymbolSet))
+	fmt.Fprintf(b, "no_upper = %t\n", d.NoUpper)
+	fmt.Fprintf(b, "allow_repeat = %t\n", d.AllowRepeat)
+	// Only shown when set, as few configs use them
+	if d.MinLower > 0 {
+		fmt.Fprintf(b, "min_lowercase = %d\n", d.MinLower)
+	}
+	if d.MinUpper > 0 {
+		fmt.Fprintf(b, "min_uppercase = %d\n", d.MinUpper)
+	}
+	if d.ShellSafe {
+		b.WriteString("shell_safe = true\n")
+	}
+	if d.JSONSafe {
+		b.WriteString("json_safe = true\n")
+	}
+	if d.ExcludeAmbiguous {
+		b.WriteString("exclude_ambiguous = true\n")
+	}
+	if d.RequireEachClass {
+		b.WriteString("require_each_class = true\n")
+	}
+	if d.MinEntropy > 0 {
+		fmt.Fprintf(b, "min_entropy = %d\n", d.MinEntropy)
+	}
+	b.WriteString("}\n")
+}
+
+// writeAttr writes a string attribute, skipping empty values.
+func writeAttr(b *strings.Builder, name, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(b, "%s = %s\n", name, hclString(value))
+}
+
+// hclString renders s as an HCL string literal, escaping template sequences.
+func hclString(s string) string {
+	return string(hclwrite.TokensForValue(cty.StringVal(s)).Bytes())
+}
+
+// hclStringList renders strings as the elements of an HCL list.
+func hclStringList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = hclString(v)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func redactCredential(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redactedCredential
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
+)
+
+// forEachSchema picks the for_each attribute out of a secret block
+var forEachSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "for_each"},
+	},
+}
+
+// secretInstance is one secret block a secret declaration expands to: the
+// declaration itself, or one per for_each entry.
+type secretInstance struct {
+	name    string
+	evalCtx *hcl.EvalContext
+}
+
+// expandForEach returns the secret blocks a secret declaration expands to.
+// Without for_each, that's the block itself. With for_each, a map or a set
+// of strings, it's one block per entry, named name[key], whose attributes
+// and content can refer to each.key and each.value. A set's values are
+// their own keys. Entries are returned in key order.
+func expandForEach(block *hcl.Block, name string, evalCtx *hcl.EvalContext) ([]secretInstance, error) {
+	content, _, diags := block.Body.PartialContent(forEachSchema)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%s", diags.Error())
+	}
+
+	attr, exists := content.Attributes["for_each"]
+	if !exists {
+		return []secretInstance{{name: name, evalCtx: evalCtx}}, nil
+	}
+
+	val, valDiags := attr.Expr.Value(evalCtx)
+	if valDiags.HasErrors() {
+		return nil, fmt.Errorf("evaluating for_each: %s", valDiags.Error())
+	}
+
+	entries, err := forEachEntries(val)
+	if err != nil {
+		return nil, fmt.Errorf("for_each %w", err)
+	}
+
+	instances := make([]secretInstance, 0, len(entries))
+	for _, key := range sortedKeys(entries) {
+		child := evalCtx.NewChild()
+		child.Variables = map[string]cty.Value{
+			"each": cty.ObjectVal(map[string]cty.Value{
+				"key":   cty.StringVal(key),
+				"value": cty.StringVal(entries[key]),
+			}),
+		}
+		instances = append(instances, secretInstance{name: name + "[" + key + "]", evalCtx: child})
+	}
+	return instances, nil
+}
+
+// forEachEntries converts a for_each value to its keys and values.
+func forEachEntries(val cty.Value) (map[string]string, error) {
+	if val.IsNull() || !val.IsKnown() {
+		return nil, fmt.Errorf("must be a map or a set of strings")
+	}
+
+	entries := make(map[string]string)
+	ty := val.Type()
+	switch {
+	case ty.IsMapType() || ty.IsObjectType():
+		for key, v := range val.AsValueMap() {
+			if v.IsNull() || v.Type() != cty.String {
+				return nil, fmt.Errorf("value of %q must be a string", key)
+			}
+			entries[key] = v.AsString()
+		}
+
+	case ty.IsSetType() || ty.IsListType() || ty.IsTupleType():
+		list, err := stringList(val)
+		if err != nil {
+			return nil, fmt.Errorf("must be a map or a set of strings")
+		}
+		for _, v := range list {
+			if _, exists := entries[v]; exists {
+				return nil, fmt.Errorf("key %q is listed more than once", v)
+			}
+			entries[v] = v
+		}
+
+	default:
+		return nil, fmt.Errorf("must be a map or a set of strings")
+	}
+
+	for key := range entries {
+		if key == "" {
+			return nil, fmt.Errorf("keys must not be empty")
+		}
+	}
+	return entries, nil
+}
+
+// makeFilesFunction creates the files() function, which lists the sources
+// matching a pattern for for_each:
+//
+//	for_each = files("file:///srv/apps/*.json")
+//
+// It returns a map of each source's file name, without the extension, to
+// its URI, listed when the config is loaded. Only file:// sources can be
+// listed for now.
+func makeFilesFunction() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "pattern", Type: cty.String},
+		},
+		Type: function.StaticReturnType(cty.Map(cty.String)),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			pattern := args[0].AsString()
+
+			local := fetcher.NewLocalFetcher()
+			if !local.Supports(pattern) {
+				return cty.NilVal, fmt.Errorf("files() can only list file:// sources, got %q", pattern)
+			}
+
+			uris, err := local.List(context.Background(), pattern)
+			if err != nil {
+				return cty.NilVal, fmt.Errorf("files(): %w", err)
+			}
+			if len(uris) == 0 {
+				return cty.MapValEmpty(cty.String), nil
+			}
+
+			files := make(map[string]cty.Value, len(uris))
+			for _, uri := range uris {
+				base := path.Base(uri)
+				key := strings.TrimSuffix(base, path.Ext(base))
+				if prev, exists := files[key]; exists {
+					return cty.NilVal, fmt.Errorf("files(): %s and %s both have the key %q", prev.AsString(), uri, key)
+				}
+				files[key] = cty.StringVal(uri)
+			}
+			return cty.MapVal(files), nil
+		},
+	})
+}
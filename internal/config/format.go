@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// Format rewrites config files in the canonical HCL style: consistent
+// indentation, aligned equals signs, and normalized spacing. The files are
+// parsed as one config before and after formatting, and an error is
+// returned if the formatted files don't describe the same config.
+func Format(files []File, vars Variables) ([]File, error) {
+	before, err := ParseHCLFiles(files, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	formatted := make([]File, len(files))
+	for i, f := range files {
+		// hclwrite formats whatever tokens it gets, so reject invalid syntax
+		// before it can be rewritten
+		if _, diags := hclsyntax.ParseConfig(f.Data, f.Name, hcl.Pos{Line: 1, Column: 1}); diags.HasErrors() {
+			return nil, fmt.Errorf("parsing HCL: %s", diags.Error())
+		}
+		formatted[i] = File{Name: f.Name, Data: hclwrite.Format(f.Data)}
+	}
+
+	after, err := ParseHCLFiles(formatted, vars)
+	if err != nil {
+		return nil, fmt.Errorf("formatted config no longer parses: %w", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		return nil, fmt.Errorf("formatting changed the meaning of the config")
+	}
+
+	return formatted, nil
+}
@@ -1,40 +1,99 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"maps"
 	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
 )
 
 // Variables holds CLI --var values and environment variable overrides.
 type Variables map[string]string
 
+// File is the name and contents of one config file.
+type File struct {
+	Name string
+	Data []byte
+
+	// Base marks a base file: it holds only a defaults block, which the
+	// other files' defaults block is parsed over (see LoadFilesWithBase)
+	Base bool
+}
+
 // ParseHCL parses HCL configuration data with the given variables.
 func ParseHCL(data []byte, filename string, vars Variables) (*Config, error) {
-	file, diags := hclsyntax.ParseConfig(data, filename, hcl.Pos{Line: 1, Column: 1})
-	if diags.HasErrors() {
-		return nil, fmt.Errorf("parsing HCL: %s", diags.Error())
-	}
+	return ParseHCLFiles([]File{{Name: filename, Data: data}}, vars)
+}
 
+// ParseHCLFiles parses several HCL files as one config, e.g. vault.hcl,
+// defaults.hcl, and a file of secret blocks per team. The vault, defaults, and
+// redact blocks may each be defined once across all files, and the defaults
+// apply to the secret blocks of every file. The defaults of a base file are
+// the starting point of the defaults block, or the defaults if there's none.
+func ParseHCLFiles(files []File, vars Variables) (*Config, error) {
 	// Build evaluation context with custom functions
 	evalCtx := buildEvalContext(vars)
 
-	// Parse top-level blocks
-	content, diags := file.Body.Content(rootSchema)
-	if diags.HasErrors() {
-		return nil, fmt.Errorf("parsing config structure: %s", diags.Error())
+	var blocks hcl.Blocks
+	var base *Defaults
+	for _, f := range files {
+		file, diags := hclsyntax.ParseConfig(f.Data, f.Name, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("parsing HCL: %s", diags.Error())
+		}
+
+		// Parse top-level blocks
+		content, diags := file.Body.Content(rootSchema)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("parsing config structure: %s", diags.Error())
+		}
+
+		if f.Base {
+			if base != nil {
+				return nil, fmt.Errorf("only one base defaults file is allowed")
+			}
+			defaults, err := parseBaseFile(f.Name, content.Blocks, evalCtx)
+			if err != nil {
+				return nil, err
+			}
+			base = defaults
+			continue
+		}
+		blocks = append(blocks, content.Blocks...)
 	}
 
 	cfg := &Config{
 		Secrets: make(map[string]SecretBlock),
 	}
+	if base != nil {
+		cfg.Defaults = *base
+	}
+
+	// Where each singleton block and secret block was defined, to point at
+	// both definitions of a duplicate
+	defined := make(map[string]hcl.Range)
+	secretDefined := make(map[string]hcl.Range)
 
 	// Process blocks
-	for _, block := range content.Blocks {
+	for _, block := range blocks {
+		if block.Type != "secret" {
+			if prev, exists := defined[block.Type]; exists {
+				return nil, fmt.Errorf("%s block is defined more than once: %s and %s", block.Type, prev, block.DefRange)
+			}
+			defined[block.Type] = block.DefRange
+		}
+
 		switch block.Type {
 		case "vault":
 			vault, err := parseVaultBlock(block, evalCtx)
@@ -44,12 +103,19 @@ func ParseHCL(data []byte, filename string, vars Variables) (*Config, error) {
 			cfg.Vault = *vault
 
 		case "defaults":
-			defaults, err := parseDefaultsBlock(block, evalCtx)
+			defaults, err := parseDefaultsBlock(block, evalCtx, base)
 			if err != nil {
 				return nil, fmt.Errorf("parsing defaults block: %w", err)
 			}
 			cfg.Defaults = *defaults
 
+		case "redact":
+			redact, err := parseRedactBlock(block, evalCtx)
+			if err != nil {
+				return nil, fmt.Errorf("parsing redact block: %w", err)
+			}
+			cfg.Redact = *redact
+
 		case "secret":
 			if len(block.Labels) != 1 {
 				return nil, fmt.Errorf("secret block requires exactly one label (name)")
@@ -57,22 +123,39 @@ func ParseHCL(data []byte, filename string, vars Variables) (*Config, error) {
 			name := block.Labels[0]
 
 			// Check for duplicate names
-			if _, exists := cfg.Secrets[name]; exists {
-				return nil, fmt.Errorf("duplicate secret block name: %q", name)
+			if prev, exists := secretDefined[name]; exists {
+				return nil, fmt.Errorf("duplicate secret block name: %q (%s and %s)", name, prev, block.DefRange)
 			}
+			secretDefined[name] = block.DefRange
 
-			secretBlock, err := parseSecretBlock(block, name, evalCtx)
+			instances, err := expandForEach(block, name, evalCtx)
 			if err != nil {
 				return nil, fmt.Errorf("parsing secret block %q: %w", name, err)
 			}
 
-			cfg.Secrets[name] = *secretBlock
+			for _, inst := range instances {
+				if prev, exists := secretDefined[inst.name]; exists && inst.name != name {
+					return nil, fmt.Errorf("duplicate secret block name: %q (%s and %s)", inst.name, prev, block.DefRange)
+				}
+				secretDefined[inst.name] = block.DefRange
+
+				secretBlock, err := parseSecretBlock(block, inst.name, inst.evalCtx)
+				if err != nil {
+					return nil, fmt.Errorf("parsing secret block %q: %w", inst.name, err)
+				}
+
+				cfg.Secrets[inst.name] = *secretBlock
+			}
 		}
 	}
 
 	// Apply defaults
 	applyDefaults(cfg)
 
+	if err := parsePolicies(&cfg.Defaults, evalCtx); err != nil {
+		return nil, fmt.Errorf("parsing defaults block: %w", err)
+	}
+
 	// Validate
 	if err := validate(cfg); err != nil {
 		return nil, err
@@ -86,10 +169,35 @@ var rootSchema = &hcl.BodySchema{
 	Blocks: []hcl.BlockHeaderSchema{
 		{Type: "vault"},
 		{Type: "defaults"},
+		{Type: "redact"},
 		{Type: "secret", LabelNames: []string{"name"}},
 	},
 }
 
+// parseBaseFile parses the blocks of a base file, which must be a single
+// defaults block.
+func parseBaseFile(name string, blocks hcl.Blocks, evalCtx *hcl.EvalContext) (*Defaults, error) {
+	var defaults *Defaults
+	for _, block := range blocks {
+		if block.Type != "defaults" {
+			return nil, fmt.Errorf("base defaults file %s: only a defaults block is allowed, found a %s block at %s", name, block.Type, block.DefRange)
+		}
+		if defaults != nil {
+			return nil, fmt.Errorf("base defaults file %s: defaults block is defined more than once", name)
+		}
+
+		var err error
+		defaults, err = parseDefaultsBlock(block, evalCtx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("parsing defaults block of base file %s: %w", name, err)
+		}
+	}
+	if defaults == nil {
+		return nil, fmt.Errorf("base defaults file %s has no defaults block", name)
+	}
+	return defaults, nil
+}
+
 // buildEvalContext creates the HCL evaluation context with custom functions
 func buildEvalContext(vars Variables) *hcl.EvalContext {
 	return &hcl.EvalContext{
@@ -104,6 +212,18 @@ func buildEvalContext(vars Variables) *hcl.EvalContext {
 			"bcrypt":   makeBcryptFunction(),
 			"argon2":   makeArgon2Function(),
 			"pbkdf2":   makePbkdf2Function(),
+			"uuid":     makeUUIDFunction(),
+			"hash":     makeHashFunction(),
+			"files":    makeFilesFunction(),
+
+			"json_multi":   makeJSONMultiFunction(),
+			"env_all":      makeEnvAllFunction(),
+			"map_from":     makeMapFromFunction(),
+			"ssh_keygen":   makeSSHKeygenFunction(),
+			"tls_cert":     makeTLSCertFunction(),
+			"base64encode": makeTransformFunction(TransformBase64Encode),
+			"base64decode": makeTransformFunction(TransformBase64Decode),
+			"jsonencode":   makeJSONEncodeFunction(),
 		},
 	}
 }
@@ -131,27 +251,139 @@ func makeEnvFunction(vars Variables) function.Function {
 
 // valueMarkerType is the cty object type for value markers
 var valueMarkerType = cty.Object(map[string]cty.Type{
-	"_type":         cty.String,
-	"_strategy":     cty.String,
-	"_url":          cty.String,
-	"_query":        cty.String,
-	"_vault_path":   cty.String,
-	"_vault_key":    cty.String,
-	"_command":      cty.String,
-	"_length":       cty.Number,
-	"_digits":       cty.Number,
-	"_symbols":      cty.Number,
-	"_symbol_set":   cty.String,
-	"_no_upper":     cty.Bool,
-	"_allow_repeat": cty.Bool,
-	"_from":         cty.String,
-	"_cost":         cty.Number,
-	"_variant":      cty.String,
-	"_memory":       cty.Number,
-	"_iterations":   cty.Number,
-	"_parallelism":  cty.Number,
+	"_type":               cty.String,
+	"_strategy":           cty.String,
+	"_url":                cty.String,
+	"_query":              cty.String,
+	"_vault_path":         cty.String,
+	"_vault_key":          cty.String,
+	"_vault_version":      cty.Number,
+	"_command":            cty.String,
+	"_length":             cty.Number,
+	"_digits":             cty.Number,
+	"_symbols":            cty.Number,
+	"_symbol_set":         cty.String,
+	"_no_upper":           cty.Bool,
+	"_min_lower":          cty.Number,
+	"_min_upper":          cty.Number,
+	"_allow_repeat":       cty.Bool,
+	"_shell_safe":         cty.Bool,
+	"_json_safe":          cty.Bool,
+	"_exclude_ambiguous":  cty.Bool,
+	"_require_each_class": cty.Bool,
+	"_min_entropy":        cty.Number,
+	"_from":               cty.String,
+	"_cost":               cty.Number,
+	"_variant":            cty.String,
+	"_memory":             cty.Number,
+	"_iterations":         cty.Number,
+	"_parallelism":        cty.Number,
+	"_policy":             cty.String,
+	"_mode":               cty.String,
+	"_words":              cty.Number,
+	"_separator":          cty.String,
+	"_capitalize":         cty.Bool,
+	"_number":             cty.Bool,
+	"_pipe":               cty.String,
+	"_static":             cty.String,
+	"_max_size":           cty.Number,
+	"_json_format":        cty.String,
+	"_transforms":         cty.String,
+	"_prefix":             cty.String,
+	"_filter":             cty.String,
+	"_expire_after":       cty.String,
+	"_timeout":            cty.String,
+	"_as":                 cty.String,
+	"_stdin":              cty.String, // JSON-encoded value marker, see encodeStdin
+	"_env":                cty.Map(cty.String),
+	"_normalize_newlines": cty.Bool,
+	"_binary":             cty.String,
 })
 
+// hashMarkerType is the cty object type returned by hash(). It extends the
+// value marker with the hash algorithm and the wrapped value's marker.
+var hashMarkerType = func() cty.Type {
+	attrs := valueMarkerType.AttributeTypes()
+	hashAttrs := make(map[string]cty.Type, len(attrs)+2)
+	for k, t := range attrs {
+		hashAttrs[k] = t
+	}
+	hashAttrs["_algo"] = cty.String
+	hashAttrs["_inner"] = valueMarkerType
+	return cty.Object(hashAttrs)
+}()
+
+// newValueMarker returns the marker attributes for a value type with every
+// option set to its "unset" value. Functions override what they need.
+func newValueMarker(valueType string) map[string]cty.Value {
+	return map[string]cty.Value{
+		"_type":               cty.StringVal(valueType),
+		"_strategy":           cty.StringVal(""),
+		"_url":                cty.StringVal(""),
+		"_query":              cty.StringVal(""),
+		"_vault_path":         cty.StringVal(""),
+		"_vault_key":          cty.StringVal(""),
+		"_vault_version":      cty.NumberIntVal(0),
+		"_command":            cty.StringVal(""),
+		"_length":             cty.NumberIntVal(0),
+		"_digits":             cty.NumberIntVal(-1), // -1 means use default
+		"_symbols":            cty.NumberIntVal(-1),
+		"_symbol_set":         cty.StringVal(""),
+		"_no_upper":           cty.False,
+		"_min_lower":          cty.NumberIntVal(0),
+		"_min_upper":          cty.NumberIntVal(0),
+		"_allow_repeat":       cty.True,
+		"_shell_safe":         cty.False,
+		"_json_safe":          cty.False,
+		"_exclude_ambiguous":  cty.False,
+		"_require_each_class": cty.False,
+		"_min_entropy":        cty.NumberIntVal(0),
+		"_from":               cty.StringVal(""),
+		"_cost":               cty.NumberIntVal(0),
+		"_variant":            cty.StringVal(""),
+		"_memory":             cty.NumberIntVal(0),
+		"_iterations":         cty.NumberIntVal(0),
+		"_parallelism":        cty.NumberIntVal(0),
+		"_policy":             cty.StringVal(""),
+		"_mode":               cty.StringVal(""),
+		"_words":              cty.NumberIntVal(0),
+		"_separator":          cty.NullVal(cty.String), // null means use default
+		"_capitalize":         cty.False,
+		"_number":             cty.False,
+		"_pipe":               cty.StringVal(""),
+		"_static":             cty.StringVal(""),
+		"_max_size":           cty.NumberIntVal(0),
+		"_json_format":        cty.StringVal(""),
+		"_transforms":         cty.StringVal(""), // comma-separated, innermost first
+		"_prefix":             cty.StringVal(""),
+		"_filter":             cty.StringVal(""),
+		"_expire_after":       cty.StringVal(""),
+		"_timeout":            cty.StringVal(""),
+		"_as":                 cty.StringVal(""),
+		"_stdin":              cty.StringVal(""),
+		"_env":                cty.MapValEmpty(cty.String),
+		"_normalize_newlines": cty.False,
+		"_binary":             cty.StringVal(""),
+	}
+}
+
+// applyCommonOptions copies options shared by all value functions
+// (strategy, pipe) from object arguments into the marker.
+func applyCommonOptions(result map[string]cty.Value, args []cty.Value) {
+	for _, arg := range args {
+		if !arg.Type().IsObjectType() {
+			continue
+		}
+		opts := arg.AsValueMap()
+		if s, ok := opts["strategy"]; ok {
+			result["_strategy"] = s
+		}
+		if p, ok := opts["pipe"]; ok {
+			result["_pipe"] = p
+		}
+	}
+}
+
 // makeGenerateFunction creates the generate() function
 func makeGenerateFunction() function.Function {
 	return function.New(&function.Spec{
@@ -162,27 +394,7 @@ func makeGenerateFunction() function.Function {
 		},
 		Type: function.StaticReturnType(valueMarkerType),
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
-			result := map[string]cty.Value{
-				"_type":         cty.StringVal("generate"),
-				"_strategy":     cty.StringVal(""),
-				"_url":          cty.StringVal(""),
-				"_query":        cty.StringVal(""),
-				"_vault_path":   cty.StringVal(""),
-				"_vault_key":    cty.StringVal(""),
-				"_command":      cty.StringVal(""),
-				"_length":       cty.NumberIntVal(0),
-				"_digits":       cty.NumberIntVal(-1), // -1 means use default
-				"_symbols":      cty.NumberIntVal(-1),
-				"_symbol_set":   cty.StringVal(""),
-				"_no_upper":     cty.False,
-				"_allow_repeat": cty.True,
-				"_from":         cty.StringVal(""),
-				"_cost":         cty.NumberIntVal(0),
-				"_variant":      cty.StringVal(""),
-				"_memory":       cty.NumberIntVal(0),
-				"_iterations":   cty.NumberIntVal(0),
-				"_parallelism":  cty.NumberIntVal(0),
-			}
+			result := newValueMarker("generate")
 
 			// Parse named arguments from varargs
 			for _, arg := range args {
@@ -199,20 +411,225 @@ func makeGenerateFunction() function.Function {
 							result["_symbol_set"] = v
 						case "no_upper":
 							result["_no_upper"] = v
+						case "min_lowercase":
+							result["_min_lower"] = v
+						case "min_uppercase":
+							result["_min_upper"] = v
 						case "allow_repeat":
 							result["_allow_repeat"] = v
-						case "strategy":
-							result["_strategy"] = v
+						case "shell_safe":
+							result["_shell_safe"] = v
+						case "json_safe":
+							result["_json_safe"] = v
+						case "exclude_ambiguous":
+							result["_exclude_ambiguous"] = v
+						case "require_each_class":
+							result["_require_each_class"] = v
+						case "min_entropy":
+							if _, err := entropyBits(v); err != nil {
+								return cty.NilVal, err
+							}
+							result["_min_entropy"] = v
+						case "policy":
+							result["_policy"] = v
+						case "mode":
+							result["_mode"] = v
+						case "words":
+							result["_words"] = v
+						case "separator":
+							result["_separator"] = v
+						case "capitalize":
+							result["_capitalize"] = v
+						case "number":
+							result["_number"] = v
+						case "expire_after":
+							result["_expire_after"] = v
+						}
+					}
+				}
+			}
+			applyCommonOptions(result, args)
+
+			return cty.ObjectVal(result), nil
+		},
+	})
+}
+
+// makeUUIDFunction creates the uuid() function for random identifiers
+func makeUUIDFunction() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{},
+		VarParam: &function.Parameter{
+			Name: "options",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: function.StaticReturnType(valueMarkerType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			result := newValueMarker("uuid")
+			applyCommonOptions(result, args)
+
+			return cty.ObjectVal(result), nil
+		},
+	})
+}
+
+// makeHashFunction creates the hash() function, which hashes the resolved
+// result of another value, e.g. hash(generate(), {algo = "bcrypt"})
+func makeHashFunction() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "value", Type: cty.DynamicPseudoType},
+		},
+		VarParam: &function.Parameter{
+			Name: "options",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: function.StaticReturnType(hashMarkerType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			var inner cty.Value
+			switch {
+			case args[0].Type() == cty.String:
+				marker := newValueMarker("static")
+				marker["_static"] = args[0]
+				inner = cty.ObjectVal(marker)
+			case args[0].Type().Equals(valueMarkerType):
+				inner = args[0]
+			default:
+				return cty.NilVal, fmt.Errorf("hash() value must be a string or a value function such as generate()")
+			}
+
+			result := newValueMarker("hash")
+			result["_algo"] = cty.StringVal("")
+			result["_inner"] = inner
+
+			// Parse options from varargs
+			for _, arg := range args[1:] {
+				if arg.Type().IsObjectType() {
+					for k, v := range arg.AsValueMap() {
+						switch k {
+						case "algo":
+							result["_algo"] = v
+						case "cost":
+							result["_cost"] = v
+						case "variant":
+							result["_variant"] = v
+						case "memory":
+							result["_memory"] = v
+						case "iterations":
+							result["_iterations"] = v
+						case "parallelism":
+							result["_parallelism"] = v
 						}
 					}
 				}
 			}
+			applyCommonOptions(result, args[1:])
+
+			// Validate required 'algo' parameter
+			switch algo := result["_algo"].AsString(); algo {
+			case "bcrypt", "argon2", "pbkdf2":
+			case "":
+				return cty.NilVal, fmt.Errorf("hash() requires 'algo' parameter")
+			default:
+				return cty.NilVal, fmt.Errorf("hash() unknown algo %q (expected bcrypt, argon2, or pbkdf2)", algo)
+			}
 
 			return cty.ObjectVal(result), nil
 		},
 	})
 }
 
+// makeTransformFunction creates base64encode() or base64decode(). A string
+// argument is transformed immediately; a value function such as raw() gets the
+// transform recorded and applied after it resolves.
+func makeTransformFunction(transform Transform) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "value", Type: cty.DynamicPseudoType},
+		},
+		Type: func(args []cty.Value) (cty.Type, error) {
+			switch {
+			case args[0].Type() == cty.String, args[0].Type().Equals(valueMarkerType):
+				return args[0].Type(), nil
+			default:
+				return cty.NilType, fmt.Errorf("%s() value must be a string or a value function such as raw(); hashes can't be transformed", transform)
+			}
+		},
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if args[0].Type() == cty.String {
+				out, err := ApplyTransform(transform, args[0].AsString())
+				if err != nil {
+					return cty.NilVal, err
+				}
+				return cty.StringVal(out), nil
+			}
+
+			marker := args[0].AsValueMap()
+			switch ValueType(marker["_type"].AsString()) {
+			case ValueTypeBcrypt, ValueTypeArgon2, ValueTypePbkdf2:
+				return cty.NilVal, fmt.Errorf("%s() can't wrap %s(): the stored hash is verified on every run", transform, marker["_type"].AsString())
+			}
+
+			transforms := marker["_transforms"].AsString()
+			if transforms != "" {
+				transforms += ","
+			}
+			marker["_transforms"] = cty.StringVal(transforms + string(transform))
+
+			return cty.ObjectVal(marker), nil
+		},
+	})
+}
+
+// makeJSONEncodeFunction creates the jsonencode() function, which turns an
+// HCL object, list or scalar into a static JSON string, e.g.
+// jsonencode({a = 1, b = "x"}). Object keys are written in sorted order.
+func makeJSONEncodeFunction() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "value", Type: cty.DynamicPseudoType, AllowNull: true},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			val := args[0]
+
+			// Value functions resolve at apply time, so there is nothing to
+			// encode while the config is parsed
+			err := cty.Walk(val, func(_ cty.Path, v cty.Value) (bool, error) {
+				if v.Type().Equals(valueMarkerType) {
+					return false, fmt.Errorf("jsonencode() value can't contain %s(): only static values can be encoded", v.GetAttr("_type").AsString())
+				}
+				return true, nil
+			})
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			data, err := ctyjson.Marshal(val, val.Type())
+			if err != nil {
+				return cty.NilVal, fmt.Errorf("jsonencode: %w", err)
+			}
+			return cty.StringVal(string(data)), nil
+		},
+	})
+}
+
+// ApplyTransform applies a single transform to value. Empty input stays empty.
+func ApplyTransform(transform Transform, value string) (string, error) {
+	switch transform {
+	case TransformBase64Encode:
+		return base64.StdEncoding.EncodeToString([]byte(value)), nil
+	case TransformBase64Decode:
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("base64decode: invalid base64 input: %w", err)
+		}
+		return string(decoded), nil
+	default:
+		return "", fmt.Errorf("unknown transform %q", transform)
+	}
+}
+
 // makeSourceFunction creates the json() or yaml() function
 func makeSourceFunction(sourceType string) function.Function {
 	return function.New(&function.Spec{
@@ -228,43 +645,99 @@ func makeSourceFunction(sourceType string) function.Function {
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
 			url := args[0].AsString()
 			query := args[1].AsString()
-			strategy := ""
 
-			// Parse optional strategy from varargs
-			for i := 2; i < len(args); i++ {
-				arg := args[i]
-				if arg.Type().IsObjectType() {
-					if s, ok := arg.AsValueMap()["strategy"]; ok {
-						strategy = s.AsString()
-					}
+			result := newValueMarker(sourceType)
+			applyCommonOptions(result, args[2:])
+			result["_url"] = cty.StringVal(url)
+			result["_query"] = cty.StringVal(query)
+
+			for _, arg := range args[2:] {
+				if !arg.Type().IsObjectType() {
+					continue
+				}
+				if as, ok := arg.AsValueMap()["as"]; ok {
+					result["_as"] = as
+				}
+			}
+
+			return cty.ObjectVal(result), nil
+		},
+	})
+}
+
+// makeJSONMultiFunction creates the json_multi() function, which extracts
+// several keys from one JSON document:
+//
+//	outputs = json_multi(url, {db_host = ".db.host", db_port = ".db.port"})
+//
+// It returns an object holding one json() marker per key. The content block
+// splats these into separate keys; the attribute name only labels the set.
+func makeJSONMultiFunction() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "url", Type: cty.String},
+			{Name: "queries", Type: cty.DynamicPseudoType},
+		},
+		VarParam: &function.Parameter{
+			Name: "options",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			queries := args[1]
+			if !queries.Type().IsObjectType() && !queries.Type().IsMapType() {
+				return cty.NilVal, fmt.Errorf("json_multi() queries must be an object of key = query pairs")
+			}
+			if queries.LengthInt() == 0 {
+				return cty.NilVal, fmt.Errorf("json_multi() requires at least one key")
+			}
+
+			values := make(map[string]cty.Value, queries.LengthInt())
+			for key, query := range queries.AsValueMap() {
+				if query.IsNull() || query.Type() != cty.String {
+					return cty.NilVal, fmt.Errorf("json_multi() query for %q must be a string", key)
 				}
+
+				marker := newValueMarker("json")
+				applyCommonOptions(marker, args[2:])
+				marker["_url"] = args[0]
+				marker["_query"] = query
+				values[key] = cty.ObjectVal(marker)
 			}
 
 			return cty.ObjectVal(map[string]cty.Value{
-				"_type":         cty.StringVal(sourceType),
-				"_strategy":     cty.StringVal(strategy),
-				"_url":          cty.StringVal(url),
-				"_query":        cty.StringVal(query),
-				"_vault_path":   cty.StringVal(""),
-				"_vault_key":    cty.StringVal(""),
-				"_command":      cty.StringVal(""),
-				"_length":       cty.NumberIntVal(0),
-				"_digits":       cty.NumberIntVal(-1),
-				"_symbols":      cty.NumberIntVal(-1),
-				"_symbol_set":   cty.StringVal(""),
-				"_no_upper":     cty.False,
-				"_allow_repeat": cty.True,
-				"_from":         cty.StringVal(""),
-				"_cost":         cty.NumberIntVal(0),
-				"_variant":      cty.StringVal(""),
-				"_memory":       cty.NumberIntVal(0),
-				"_iterations":   cty.NumberIntVal(0),
-				"_parallelism":  cty.NumberIntVal(0),
+				"_type":   cty.StringVal(multiMarkerType),
+				"_values": cty.ObjectVal(values),
 			}), nil
 		},
 	})
 }
 
+// multiMarkerType is the _type of the object returned by json_multi()
+const multiMarkerType = "json_multi"
+
+// isMultiMarker reports whether val was returned by json_multi().
+func isMultiMarker(val cty.Value) bool {
+	if !val.Type().IsObjectType() || !val.Type().HasAttribute("_values") {
+		return false
+	}
+	t := val.GetAttr("_type")
+	return t.Type() == cty.String && t.AsString() == multiMarkerType
+}
+
+// expandMultiMarker converts a json_multi() result into one Value per key.
+func expandMultiMarker(val cty.Value) (map[string]Value, error) {
+	values := make(map[string]Value)
+	for key, marker := range val.GetAttr("_values").AsValueMap() {
+		value, err := ctyValueToValue(marker)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
 // makeRawFunction creates the raw() function
 func makeRawFunction() function.Function {
 	return function.New(&function.Spec{
@@ -278,39 +751,41 @@ func makeRawFunction() function.Function {
 		Type: function.StaticReturnType(valueMarkerType),
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
 			url := args[0].AsString()
-			strategy := ""
 
-			// Parse optional strategy from varargs
-			for i := 1; i < len(args); i++ {
-				arg := args[i]
-				if arg.Type().IsObjectType() {
-					if s, ok := arg.AsValueMap()["strategy"]; ok {
-						strategy = s.AsString()
+			result := newValueMarker("raw")
+			applyCommonOptions(result, args[1:])
+			result["_url"] = cty.StringVal(url)
+
+			for _, arg := range args[1:] {
+				if !arg.Type().IsObjectType() {
+					continue
+				}
+				opts := arg.AsValueMap()
+				if v, ok := opts["max_size"]; ok {
+					result["_max_size"] = v
+				}
+				for _, format := range []string{JSONFormatMinify, JSONFormatPretty} {
+					v, ok := opts[format]
+					if !ok {
+						continue
+					}
+					if v.Type() != cty.Bool {
+						return cty.NilVal, fmt.Errorf("raw() %s must be true or false", format)
 					}
+					if v.False() {
+						continue
+					}
+					if current := result["_json_format"].AsString(); current != "" && current != format {
+						return cty.NilVal, fmt.Errorf("raw() can't both minify and pretty-print")
+					}
+					result["_json_format"] = cty.StringVal(format)
 				}
 			}
+			if result["_max_size"].LessThan(cty.NumberIntVal(0)).True() {
+				return cty.NilVal, fmt.Errorf("raw() max_size must not be negative")
+			}
 
-			return cty.ObjectVal(map[string]cty.Value{
-				"_type":         cty.StringVal("raw"),
-				"_strategy":     cty.StringVal(strategy),
-				"_url":          cty.StringVal(url),
-				"_query":        cty.StringVal(""),
-				"_vault_path":   cty.StringVal(""),
-				"_vault_key":    cty.StringVal(""),
-				"_command":      cty.StringVal(""),
-				"_length":       cty.NumberIntVal(0),
-				"_digits":       cty.NumberIntVal(-1),
-				"_symbols":      cty.NumberIntVal(-1),
-				"_symbol_set":   cty.StringVal(""),
-				"_no_upper":     cty.False,
-				"_allow_repeat": cty.True,
-				"_from":         cty.StringVal(""),
-				"_cost":         cty.NumberIntVal(0),
-				"_variant":      cty.StringVal(""),
-				"_memory":       cty.NumberIntVal(0),
-				"_iterations":   cty.NumberIntVal(0),
-				"_parallelism":  cty.NumberIntVal(0),
-			}), nil
+			return cty.ObjectVal(result), nil
 		},
 	})
 }
@@ -330,39 +805,27 @@ func makeVaultFunction() function.Function {
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
 			vaultPath := args[0].AsString()
 			vaultKey := args[1].AsString()
-			strategy := ""
 
-			// Parse optional strategy from varargs
-			for i := 2; i < len(args); i++ {
-				arg := args[i]
-				if arg.Type().IsObjectType() {
-					if s, ok := arg.AsValueMap()["strategy"]; ok {
-						strategy = s.AsString()
-					}
+			result := newValueMarker("vault")
+			applyCommonOptions(result, args[2:])
+			result["_vault_path"] = cty.StringVal(vaultPath)
+			result["_vault_key"] = cty.StringVal(vaultKey)
+
+			for _, arg := range args[2:] {
+				if !arg.Type().IsObjectType() {
+					continue
+				}
+				v, ok := arg.AsValueMap()["version"]
+				if !ok {
+					continue
 				}
+				if v.Type() != cty.Number || !v.AsBigFloat().IsInt() || v.LessThan(cty.NumberIntVal(1)).True() {
+					return cty.NilVal, fmt.Errorf("vault() version must be a positive whole number")
+				}
+				result["_vault_version"] = v
 			}
 
-			return cty.ObjectVal(map[string]cty.Value{
-				"_type":         cty.StringVal("vault"),
-				"_strategy":     cty.StringVal(strategy),
-				"_url":          cty.StringVal(""),
-				"_query":        cty.StringVal(""),
-				"_vault_path":   cty.StringVal(vaultPath),
-				"_vault_key":    cty.StringVal(vaultKey),
-				"_command":      cty.StringVal(""),
-				"_length":       cty.NumberIntVal(0),
-				"_digits":       cty.NumberIntVal(-1),
-				"_symbols":      cty.NumberIntVal(-1),
-				"_symbol_set":   cty.StringVal(""),
-				"_no_upper":     cty.False,
-				"_allow_repeat": cty.True,
-				"_from":         cty.StringVal(""),
-				"_cost":         cty.NumberIntVal(0),
-				"_variant":      cty.StringVal(""),
-				"_memory":       cty.NumberIntVal(0),
-				"_iterations":   cty.NumberIntVal(0),
-				"_parallelism":  cty.NumberIntVal(0),
-			}), nil
+			return cty.ObjectVal(result), nil
 		},
 	})
 }
@@ -380,39 +843,393 @@ func makeCommandFunction() function.Function {
 		Type: function.StaticReturnType(valueMarkerType),
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
 			cmd := args[0].AsString()
-			strategy := ""
 
-			// Parse optional strategy from varargs
-			for i := 1; i < len(args); i++ {
-				arg := args[i]
-				if arg.Type().IsObjectType() {
-					if s, ok := arg.AsValueMap()["strategy"]; ok {
-						strategy = s.AsString()
+			result := newValueMarker("command")
+			applyCommonOptions(result, args[1:])
+			result["_command"] = cty.StringVal(cmd)
+
+			for _, arg := range args[1:] {
+				if !arg.Type().IsObjectType() {
+					continue
+				}
+				for k, v := range arg.AsValueMap() {
+					switch k {
+					case "timeout":
+						result["_timeout"] = v
+					case "stdin":
+						stdin, err := encodeStdin(v)
+						if err != nil {
+							return cty.NilVal, err
+						}
+						result["_stdin"] = stdin
+					case "env":
+						env, err := commandEnv(v)
+						if err != nil {
+							return cty.NilVal, err
+						}
+						result["_env"] = env
+					case "normalize_newlines":
+						result["_normalize_newlines"] = v
+					case "binary":
+						result["_binary"] = v
 					}
 				}
 			}
 
-			return cty.ObjectVal(map[string]cty.Value{
-				"_type":         cty.StringVal("command"),
-				"_strategy":     cty.StringVal(strategy),
-				"_url":          cty.StringVal(""),
-				"_query":        cty.StringVal(""),
-				"_vault_path":   cty.StringVal(""),
-				"_vault_key":    cty.StringVal(""),
-				"_command":      cty.StringVal(cmd),
-				"_length":       cty.NumberIntVal(0),
-				"_digits":       cty.NumberIntVal(-1),
-				"_symbols":      cty.NumberIntVal(-1),
-				"_symbol_set":   cty.StringVal(""),
-				"_no_upper":     cty.False,
-				"_allow_repeat": cty.True,
-				"_from":         cty.StringVal(""),
-				"_cost":         cty.NumberIntVal(0),
-				"_variant":      cty.StringVal(""),
-				"_memory":       cty.NumberIntVal(0),
-				"_iterations":   cty.NumberIntVal(0),
-				"_parallelism":  cty.NumberIntVal(0),
-			}), nil
+			return cty.ObjectVal(result), nil
+		},
+	})
+}
+
+// encodeStdin encodes the stdin option of command(), a string or a value
+// function, as a JSON value marker. Markers can't nest in valueMarkerType,
+// so the marker travels as a string and is decoded by ctyValueToValue.
+func encodeStdin(val cty.Value) (cty.Value, error) {
+	switch {
+	case val.Type() == cty.String:
+		marker := newValueMarker("static")
+		marker["_static"] = val
+		val = cty.ObjectVal(marker)
+	case val.Type().Equals(valueMarkerType):
+	default:
+		return cty.NilVal, fmt.Errorf("command() stdin must be a string or a value function such as generate()")
+	}
+
+	data, err := ctyjson.Marshal(val, valueMarkerType)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("encoding command() stdin: %w", err)
+	}
+	return cty.StringVal(string(data)), nil
+}
+
+// envNamePattern matches valid environment variable names.
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// commandEnv converts the env option of command() to a map of strings.
+func commandEnv(val cty.Value) (cty.Value, error) {
+	if val.IsNull() || !(val.Type().IsObjectType() || val.Type().IsMapType()) {
+		return cty.NilVal, fmt.Errorf("command() env must be a map of strings")
+	}
+
+	env := make(map[string]cty.Value)
+	for name, v := range val.AsValueMap() {
+		if !envNamePattern.MatchString(name) {
+			return cty.NilVal, fmt.Errorf("command() env: invalid variable name %q", name)
+		}
+		if v.IsNull() || v.Type() != cty.String {
+			return cty.NilVal, fmt.Errorf("command() env %s must be a string", name)
+		}
+		env[name] = v
+	}
+	if len(env) == 0 {
+		return cty.MapValEmpty(cty.String), nil
+	}
+	return cty.MapVal(env), nil
+}
+
+// makeSSHKeygenFunction creates the ssh_keygen() function, which generates
+// an SSH keypair stored under two keys: the private key under the attribute
+// name and the public key under the name with a "_pub" suffix.
+//
+//	deploy_key = ssh_keygen({type = "rsa", bits = 4096})
+func makeSSHKeygenFunction() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{},
+		VarParam: &function.Parameter{
+			Name: "options",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: function.StaticReturnType(sshKeygenMarkerType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			result := map[string]cty.Value{
+				"_type":     cty.StringVal("ssh_keygen"),
+				"_key_type": cty.StringVal(SSHKeyTypeEd25519),
+				"_bits":     cty.NumberIntVal(0),
+				"_strategy": cty.StringVal(""),
+			}
+
+			for _, arg := range args {
+				if !arg.Type().IsObjectType() {
+					continue
+				}
+				for k, v := range arg.AsValueMap() {
+					switch k {
+					case "type":
+						result["_key_type"] = v
+					case "bits":
+						result["_bits"] = v
+					case "strategy":
+						result["_strategy"] = v
+					}
+				}
+			}
+
+			return cty.ObjectVal(result), nil
+		},
+	})
+}
+
+// sshKeygenMarkerType is the cty object type returned by ssh_keygen(). It's
+// distinct from valueMarkerType so the keypair can't be used where a single
+// value is expected.
+var sshKeygenMarkerType = cty.Object(map[string]cty.Type{
+	"_type":     cty.String,
+	"_key_type": cty.String,
+	"_bits":     cty.Number,
+	"_strategy": cty.String,
+})
+
+// isSSHKeygenMarker reports whether val was returned by ssh_keygen().
+func isSSHKeygenMarker(val cty.Value) bool {
+	return val.Type().Equals(sshKeygenMarkerType)
+}
+
+// expandSSHKeygenMarker converts an ssh_keygen() result assigned to name into
+// the private key value and the public key value derived from it.
+func expandSSHKeygenMarker(name string, val cty.Value) (map[string]Value, error) {
+	valMap := val.AsValueMap()
+
+	keyType := valMap["_key_type"].AsString()
+	bits, _ := valMap["_bits"].AsBigFloat().Int64()
+	switch keyType {
+	case SSHKeyTypeEd25519:
+		if bits != 0 {
+			return nil, fmt.Errorf("bits only applies to rsa keys")
+		}
+	case SSHKeyTypeRSA:
+		if bits == 0 {
+			bits = DefaultRSABits
+		}
+		if bits < MinRSABits {
+			return nil, fmt.Errorf("rsa keys need at least %d bits, got %d", MinRSABits, bits)
+		}
+	default:
+		return nil, fmt.Errorf("unknown ssh key type %q (expected %q or %q)", keyType, SSHKeyTypeEd25519, SSHKeyTypeRSA)
+	}
+
+	strategy := Strategy(valMap["_strategy"].AsString())
+	return map[string]Value{
+		name: {
+			Type:     ValueTypeSSHKey,
+			Strategy: strategy,
+			SSHKey:   &SSHKeyConfig{Type: keyType, Bits: int(bits)},
+		},
+		name + SSHPublicKeySuffix: {
+			Type:     ValueTypeSSHPublicKey,
+			Strategy: strategy,
+			SSHKey:   &SSHKeyConfig{Type: keyType, Bits: int(bits), FromKey: name},
+		},
+	}, nil
+}
+
+// makeTLSCertFunction creates the tls_cert() function, which issues a TLS
+// certificate for a new private key, stored under two keys: <name>.crt and
+// <name>.key for the attribute name.
+//
+//	tls = tls_cert({common_name = "svc.internal", sans = ["svc.internal"]})
+func makeTLSCertFunction() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{},
+		VarParam: &function.Parameter{
+			Name: "options",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: function.StaticReturnType(tlsCertMarkerType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			result := map[string]cty.Value{
+				"_type":        cty.StringVal("tls_cert"),
+				"_common_name": cty.StringVal(""),
+				"_sans":        cty.StringVal(""),
+				"_ttl":         cty.StringVal(""),
+				"_is_ca":       cty.False,
+				"_issuer":      cty.StringVal(""),
+				"_issuer_name": cty.StringVal(""),
+				"_strategy":    cty.StringVal(""),
+			}
+
+			for _, arg := range args {
+				if !arg.Type().IsObjectType() {
+					continue
+				}
+				for k, v := range arg.AsValueMap() {
+					switch k {
+					case "common_name":
+						result["_common_name"] = v
+					case "sans":
+						sans, err := stringList(v)
+						if err != nil {
+							return cty.NilVal, fmt.Errorf("tls_cert() sans: %w", err)
+						}
+						result["_sans"] = cty.StringVal(strings.Join(sans, ","))
+					case "ttl":
+						result["_ttl"] = v
+					case "is_ca":
+						result["_is_ca"] = v
+					case "issuer":
+						result["_issuer"] = v
+					case "issuer_name":
+						result["_issuer_name"] = v
+					case "strategy":
+						result["_strategy"] = v
+					}
+				}
+			}
+
+			return cty.ObjectVal(result), nil
+		},
+	})
+}
+
+// tlsCertMarkerType is the cty object type returned by tls_cert(). SANs are
+// comma-separated, as they can't contain commas.
+var tlsCertMarkerType = cty.Object(map[string]cty.Type{
+	"_type":        cty.String,
+	"_common_name": cty.String,
+	"_sans":        cty.String,
+	"_ttl":         cty.String,
+	"_is_ca":       cty.Bool,
+	"_issuer":      cty.String,
+	"_issuer_name": cty.String,
+	"_strategy":    cty.String,
+})
+
+// isTLSCertMarker reports whether val was returned by tls_cert().
+func isTLSCertMarker(val cty.Value) bool {
+	return val.Type().Equals(tlsCertMarkerType)
+}
+
+// expandTLSCertMarker converts a tls_cert() result assigned to name into the
+// private key value and the certificate value issued for it.
+func expandTLSCertMarker(name string, val cty.Value) (map[string]Value, error) {
+	valMap := val.AsValueMap()
+
+	cert := TLSCertConfig{
+		CommonName: valMap["_common_name"].AsString(),
+		TTL:        DefaultTLSCertTTL,
+		IsCA:       valMap["_is_ca"].True(),
+		Issuer:     valMap["_issuer"].AsString(),
+		IssuerName: valMap["_issuer_name"].AsString(),
+	}
+	if cert.CommonName == "" {
+		return nil, fmt.Errorf("tls_cert() requires common_name")
+	}
+	if sans := valMap["_sans"].AsString(); sans != "" {
+		cert.SANs = strings.Split(sans, ",")
+	}
+	if ttl := valMap["_ttl"].AsString(); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid ttl %q: must be a positive duration like \"8760h\"", ttl)
+		}
+		cert.TTL = d
+	}
+	if cert.IssuerName != "" && cert.Issuer == "" {
+		return nil, fmt.Errorf("issuer_name requires issuer")
+	}
+	if cert.Issuer != "" && cert.IssuerName == "" {
+		cert.IssuerName = "tls"
+	}
+
+	strategy := Strategy(valMap["_strategy"].AsString())
+	keyConfig := cert
+	cert.FromKey = name + TLSKeySuffix
+	return map[string]Value{
+		name + TLSKeySuffix: {
+			Type:     ValueTypeTLSKey,
+			Strategy: strategy,
+			TLSCert:  &keyConfig,
+		},
+		name + TLSCertSuffix: {
+			Type:     ValueTypeTLSCert,
+			Strategy: strategy,
+			TLSCert:  &cert,
+		},
+	}, nil
+}
+
+// stringList converts a list or tuple of strings.
+func stringList(val cty.Value) ([]string, error) {
+	if val.IsNull() || !(val.Type().IsListType() || val.Type().IsTupleType() || val.Type().IsSetType()) {
+		return nil, fmt.Errorf("must be a list of strings")
+	}
+	var list []string
+	for _, v := range val.AsValueSlice() {
+		if v.IsNull() || v.Type() != cty.String {
+			return nil, fmt.Errorf("must be a list of strings")
+		}
+		list = append(list, v.AsString())
+	}
+	return list, nil
+}
+
+// makeEnvAllFunction creates the env_all() function, which captures every
+// environment variable with a prefix as a key, with the prefix stripped.
+// Variables are read when the block is processed, not at parse time.
+func makeEnvAllFunction() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "prefix", Type: cty.String},
+		},
+		VarParam: &function.Parameter{
+			Name: "options",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: function.StaticReturnType(valueMarkerType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			prefix := args[0].AsString()
+			if prefix == "" {
+				return cty.NilVal, fmt.Errorf("env_all() requires a non-empty prefix")
+			}
+
+			result := newValueMarker("env_all")
+			applyCommonOptions(result, args[1:])
+			result["_prefix"] = cty.StringVal(prefix)
+
+			return cty.ObjectVal(result), nil
+		},
+	})
+}
+
+// makeMapFromFunction creates the map_from() function, which writes every
+// top-level key of a JSON or YAML object as a key of the block:
+//
+//	all = map_from("s3://bucket/outputs.json", {filter = "db_*"})
+//
+// The filter is a glob matched against the document's keys. The document
+// is fetched when the block is processed, not at parse time.
+func makeMapFromFunction() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "url", Type: cty.String},
+		},
+		VarParam: &function.Parameter{
+			Name: "options",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: function.StaticReturnType(valueMarkerType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			url := args[0].AsString()
+			if url == "" {
+				return cty.NilVal, fmt.Errorf("map_from() requires a non-empty url")
+			}
+
+			result := newValueMarker("map_from")
+			applyCommonOptions(result, args[1:])
+			result["_url"] = cty.StringVal(url)
+
+			for _, arg := range args[1:] {
+				if !arg.Type().IsObjectType() {
+					continue
+				}
+				if filter, ok := arg.AsValueMap()["filter"]; ok {
+					if _, err := path.Match(filter.AsString(), ""); err != nil {
+						return cty.NilVal, fmt.Errorf("map_from() filter %q: %w", filter.AsString(), err)
+					}
+					result["_filter"] = filter
+				}
+			}
+
+			return cty.ObjectVal(result), nil
 		},
 	})
 }
@@ -427,27 +1244,7 @@ func makeBcryptFunction() function.Function {
 		},
 		Type: function.StaticReturnType(valueMarkerType),
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
-			result := map[string]cty.Value{
-				"_type":         cty.StringVal("bcrypt"),
-				"_strategy":     cty.StringVal(""),
-				"_url":          cty.StringVal(""),
-				"_query":        cty.StringVal(""),
-				"_vault_path":   cty.StringVal(""),
-				"_vault_key":    cty.StringVal(""),
-				"_command":      cty.StringVal(""),
-				"_length":       cty.NumberIntVal(0),
-				"_digits":       cty.NumberIntVal(-1),
-				"_symbols":      cty.NumberIntVal(-1),
-				"_symbol_set":   cty.StringVal(""),
-				"_no_upper":     cty.False,
-				"_allow_repeat": cty.True,
-				"_from":         cty.StringVal(""),
-				"_cost":         cty.NumberIntVal(0),
-				"_variant":      cty.StringVal(""),
-				"_memory":       cty.NumberIntVal(0),
-				"_iterations":   cty.NumberIntVal(0),
-				"_parallelism":  cty.NumberIntVal(0),
-			}
+			result := newValueMarker("bcrypt")
 
 			// Parse options from varargs
 			for _, arg := range args {
@@ -485,27 +1282,7 @@ func makeArgon2Function() function.Function {
 		},
 		Type: function.StaticReturnType(valueMarkerType),
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
-			result := map[string]cty.Value{
-				"_type":         cty.StringVal("argon2"),
-				"_strategy":     cty.StringVal(""),
-				"_url":          cty.StringVal(""),
-				"_query":        cty.StringVal(""),
-				"_vault_path":   cty.StringVal(""),
-				"_vault_key":    cty.StringVal(""),
-				"_command":      cty.StringVal(""),
-				"_length":       cty.NumberIntVal(0),
-				"_digits":       cty.NumberIntVal(-1),
-				"_symbols":      cty.NumberIntVal(-1),
-				"_symbol_set":   cty.StringVal(""),
-				"_no_upper":     cty.False,
-				"_allow_repeat": cty.True,
-				"_from":         cty.StringVal(""),
-				"_cost":         cty.NumberIntVal(0),
-				"_variant":      cty.StringVal(""),
-				"_memory":       cty.NumberIntVal(0),
-				"_iterations":   cty.NumberIntVal(0),
-				"_parallelism":  cty.NumberIntVal(0),
-			}
+			result := newValueMarker("argon2")
 
 			// Parse options from varargs
 			for _, arg := range args {
@@ -549,27 +1326,7 @@ func makePbkdf2Function() function.Function {
 		},
 		Type: function.StaticReturnType(valueMarkerType),
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
-			result := map[string]cty.Value{
-				"_type":         cty.StringVal("pbkdf2"),
-				"_strategy":     cty.StringVal(""),
-				"_url":          cty.StringVal(""),
-				"_query":        cty.StringVal(""),
-				"_vault_path":   cty.StringVal(""),
-				"_vault_key":    cty.StringVal(""),
-				"_command":      cty.StringVal(""),
-				"_length":       cty.NumberIntVal(0),
-				"_digits":       cty.NumberIntVal(-1),
-				"_symbols":      cty.NumberIntVal(-1),
-				"_symbol_set":   cty.StringVal(""),
-				"_no_upper":     cty.False,
-				"_allow_repeat": cty.True,
-				"_from":         cty.StringVal(""),
-				"_cost":         cty.NumberIntVal(0),
-				"_variant":      cty.StringVal(""),
-				"_memory":       cty.NumberIntVal(0),
-				"_iterations":   cty.NumberIntVal(0),
-				"_parallelism":  cty.NumberIntVal(0),
-			}
+			result := newValueMarker("pbkdf2")
 
 			// Parse options from varargs
 			for _, arg := range args {
@@ -607,6 +1364,7 @@ func parseVaultBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*VaultConfig,
 		Attributes: []hcl.AttributeSchema{
 			{Name: "address"},
 			{Name: "namespace"},
+			{Name: "max_conns"},
 		},
 		Blocks: []hcl.BlockHeaderSchema{
 			{Type: "auth"},
@@ -633,6 +1391,21 @@ func parseVaultBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*VaultConfig,
 		vault.Namespace = val.AsString()
 	}
 
+	if attr, exists := content.Attributes["max_conns"]; exists {
+		val, diags := attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("evaluating max_conns: %s", diags.Error())
+		}
+		if val.Type() != cty.Number {
+			return nil, fmt.Errorf("max_conns must be a number")
+		}
+		n, _ := val.AsBigFloat().Int64()
+		if n < 0 {
+			return nil, fmt.Errorf("max_conns must not be negative")
+		}
+		vault.MaxConns = int(n)
+	}
+
 	// Parse auth block
 	for _, authBlock := range content.Blocks {
 		if authBlock.Type == "auth" {
@@ -659,6 +1432,13 @@ func parseAuthBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*AuthConfig, er
 			{Name: "role_id"},
 			{Name: "secret_id"},
 			{Name: "mount_path"},
+			{Name: "region"},
+			{Name: "header_value"},
+			{Name: "jwt"},
+			{Name: "jwt_path"},
+			{Name: "jwt_env"},
+			{Name: "username"},
+			{Name: "password"},
 		},
 	})
 	if diags.HasErrors() {
@@ -666,12 +1446,19 @@ func parseAuthBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*AuthConfig, er
 	}
 
 	attrMap := map[string]*string{
-		"method":     &auth.Method,
-		"token":      &auth.Token,
-		"role":       &auth.Role,
-		"role_id":    &auth.RoleID,
-		"secret_id":  &auth.SecretID,
-		"mount_path": &auth.MountPath,
+		"method":       &auth.Method,
+		"token":        &auth.Token,
+		"role":         &auth.Role,
+		"role_id":      &auth.RoleID,
+		"secret_id":    &auth.SecretID,
+		"mount_path":   &auth.MountPath,
+		"region":       &auth.Region,
+		"header_value": &auth.HeaderValue,
+		"jwt":          &auth.JWT,
+		"jwt_path":     &auth.JWTPath,
+		"jwt_env":      &auth.JWTEnv,
+		"username":     &auth.Username,
+		"password":     &auth.Password,
 	}
 
 	for name, ptr := range attrMap {
@@ -687,21 +1474,29 @@ func parseAuthBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*AuthConfig, er
 	return auth, nil
 }
 
-// parseDefaultsBlock parses the defaults configuration block
-func parseDefaultsBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*Defaults, error) {
+// parseDefaultsBlock parses the defaults configuration block. With a base,
+// the defaults of a base file, it starts from those instead of the built-in
+// defaults, so each setting of the block overrides the base's.
+func parseDefaultsBlock(block *hcl.Block, evalCtx *hcl.EvalContext, base *Defaults) (*Defaults, error) {
 	defaults := &Defaults{
 		Strategy: DefaultStrategyDefaults(),
 		Generate: DefaultPasswordPolicy(),
 	}
+	if base != nil {
+		*defaults = *base
+		defaults.policyBlocks = slices.Clone(base.policyBlocks)
+	}
 
 	content, diags := block.Body.Content(&hcl.BodySchema{
 		Attributes: []hcl.AttributeSchema{
 			{Name: "mount"},
 			{Name: "version"},
+			{Name: "enabled"},
 		},
 		Blocks: []hcl.BlockHeaderSchema{
 			{Type: "strategy"},
 			{Type: "generate"},
+			{Type: "policy", LabelNames: []string{"name"}},
 		},
 	})
 	if diags.HasErrors() {
@@ -727,30 +1522,69 @@ func parseDefaultsBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*Defaults,
 		defaults.Version = int(n)
 	}
 
+	// Parse enabled attribute (optional, defaults to true)
+	if attr, exists := content.Attributes["enabled"]; exists {
+		val, diags := attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("evaluating enabled: %s", diags.Error())
+		}
+		enabled := val.True()
+		defaults.Enabled = &enabled
+	}
+
+	policyDefined := make(map[string]bool)
 	for _, innerBlock := range content.Blocks {
 		switch innerBlock.Type {
 		case "strategy":
-			strategy, err := parseStrategyBlock(innerBlock, evalCtx)
+			strategy, err := parseStrategyBlock(innerBlock, evalCtx, defaults.Strategy)
 			if err != nil {
 				return nil, fmt.Errorf("parsing strategy block: %w", err)
 			}
 			defaults.Strategy = *strategy
 
 		case "generate":
-			policy, err := parseGenerateBlock(innerBlock, evalCtx)
+			policy, err := parseGenerateBlock(innerBlock, evalCtx, defaults.Generate)
 			if err != nil {
 				return nil, fmt.Errorf("parsing generate block: %w", err)
 			}
 			defaults.Generate = *policy
+
+		case "policy":
+			name := innerBlock.Labels[0]
+			if policyDefined[name] {
+				return nil, fmt.Errorf("duplicate policy name: %q", name)
+			}
+			policyDefined[name] = true
+			// Policies start from the merged generate defaults, which are
+			// only known once every defaults block is parsed
+			defaults.policyBlocks = append(defaults.policyBlocks, innerBlock)
 		}
 	}
 
 	return defaults, nil
 }
 
-// parseStrategyBlock parses the strategy defaults block
-func parseStrategyBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*StrategyDefaults, error) {
-	strategy := DefaultStrategyDefaults()
+// parsePolicies parses the policy blocks of the defaults, the base file's
+// first, each starting from the merged generate defaults. A policy replaces
+// the base file's policy of the same name as a whole.
+func parsePolicies(defaults *Defaults, evalCtx *hcl.EvalContext) error {
+	for _, block := range defaults.policyBlocks {
+		name := block.Labels[0]
+		policy, err := parseGenerateBlock(block, evalCtx, defaults.Generate)
+		if err != nil {
+			return fmt.Errorf("parsing policy %q: %w", name, err)
+		}
+		if defaults.Policies == nil {
+			defaults.Policies = make(map[string]PasswordPolicy)
+		}
+		defaults.Policies[name] = *policy
+	}
+	defaults.policyBlocks = nil
+	return nil
+}
+
+// parseStrategyBlock parses the strategy defaults block over strategy
+func parseStrategyBlock(block *hcl.Block, evalCtx *hcl.EvalContext, strategy StrategyDefaults) (*StrategyDefaults, error) {
 
 	content, diags := block.Body.Content(&hcl.BodySchema{
 		Attributes: []hcl.AttributeSchema{
@@ -761,6 +1595,7 @@ func parseStrategyBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*StrategyDe
 			{Name: "static"},
 			{Name: "command"},
 			{Name: "vault"},
+			{Name: "uuid"},
 		},
 	})
 	if diags.HasErrors() {
@@ -775,6 +1610,7 @@ func parseStrategyBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*StrategyDe
 		"static":   &strategy.Static,
 		"command":  &strategy.Command,
 		"vault":    &strategy.Vault,
+		"uuid":     &strategy.UUID,
 	}
 
 	for name, ptr := range attrMap {
@@ -790,9 +1626,9 @@ func parseStrategyBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*StrategyDe
 	return &strategy, nil
 }
 
-// parseGenerateBlock parses the generate defaults block
-func parseGenerateBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*PasswordPolicy, error) {
-	policy := DefaultPasswordPolicy()
+// parseGenerateBlock parses a generate or policy block over policy, which
+// holds the values of the attributes it doesn't set
+func parseGenerateBlock(block *hcl.Block, evalCtx *hcl.EvalContext, policy PasswordPolicy) (*PasswordPolicy, error) {
 
 	content, diags := block.Body.Content(&hcl.BodySchema{
 		Attributes: []hcl.AttributeSchema{
@@ -801,7 +1637,14 @@ func parseGenerateBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*PasswordPo
 			{Name: "symbols"},
 			{Name: "symbol_set"},
 			{Name: "no_upper"},
+			{Name: "min_lowercase"},
+			{Name: "min_uppercase"},
 			{Name: "allow_repeat"},
+			{Name: "shell_safe"},
+			{Name: "json_safe"},
+			{Name: "exclude_ambiguous"},
+			{Name: "require_each_class"},
+			{Name: "min_entropy"},
 		},
 	})
 	if diags.HasErrors() {
@@ -817,63 +1660,213 @@ func parseGenerateBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*PasswordPo
 		policy.Length = int(n)
 	}
 
-	if attr, exists := content.Attributes["digits"]; exists {
+	if attr, exists := content.Attributes["digits"]; exists {
+		val, diags := attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("evaluating digits: %s", diags.Error())
+		}
+		n, _ := val.AsBigFloat().Int64()
+		policy.Digits = int(n)
+	}
+
+	if attr, exists := content.Attributes["symbols"]; exists {
+		val, diags := attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("evaluating symbols: %s", diags.Error())
+		}
+		n, _ := val.AsBigFloat().Int64()
+		policy.Symbols = int(n)
+	}
+
+	if attr, exists := content.Attributes["symbol_set"]; exists {
+		val, diags := attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("evaluating symbol_set: %s", diags.Error())
+		}
+		policy.SymbolCharacters = val.AsString()
+	}
+
+	if attr, exists := content.Attributes["no_upper"]; exists {
+		val, diags := attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("evaluating no_upper: %s", diags.Error())
+		}
+		policy.NoUpper = val.True()
+	}
+
+	if attr, exists := content.Attributes["min_lowercase"]; exists {
+		val, diags := attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("evaluating min_lowercase: %s", diags.Error())
+		}
+		n, _ := val.AsBigFloat().Int64()
+		policy.MinLower = int(n)
+	}
+
+	if attr, exists := content.Attributes["min_uppercase"]; exists {
+		val, diags := attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("evaluating min_uppercase: %s", diags.Error())
+		}
+		n, _ := val.AsBigFloat().Int64()
+		policy.MinUpper = int(n)
+	}
+
+	if attr, exists := content.Attributes["allow_repeat"]; exists {
+		val, diags := attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("evaluating allow_repeat: %s", diags.Error())
+		}
+		b := val.True()
+		policy.AllowRepeat = &b
+	}
+
+	if attr, exists := content.Attributes["shell_safe"]; exists {
+		val, diags := attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("evaluating shell_safe: %s", diags.Error())
+		}
+		policy.ShellSafe = val.True()
+	}
+
+	if attr, exists := content.Attributes["json_safe"]; exists {
+		val, diags := attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("evaluating json_safe: %s", diags.Error())
+		}
+		policy.JSONSafe = val.True()
+	}
+
+	if attr, exists := content.Attributes["exclude_ambiguous"]; exists {
 		val, diags := attr.Expr.Value(evalCtx)
 		if diags.HasErrors() {
-			return nil, fmt.Errorf("evaluating digits: %s", diags.Error())
+			return nil, fmt.Errorf("evaluating exclude_ambiguous: %s", diags.Error())
 		}
-		n, _ := val.AsBigFloat().Int64()
-		policy.Digits = int(n)
+		policy.ExcludeAmbiguous = val.True()
 	}
 
-	if attr, exists := content.Attributes["symbols"]; exists {
+	if attr, exists := content.Attributes["require_each_class"]; exists {
 		val, diags := attr.Expr.Value(evalCtx)
 		if diags.HasErrors() {
-			return nil, fmt.Errorf("evaluating symbols: %s", diags.Error())
+			return nil, fmt.Errorf("evaluating require_each_class: %s", diags.Error())
 		}
-		n, _ := val.AsBigFloat().Int64()
-		policy.Symbols = int(n)
+		policy.RequireEachClass = val.True()
 	}
 
-	if attr, exists := content.Attributes["symbol_set"]; exists {
+	if attr, exists := content.Attributes["min_entropy"]; exists {
 		val, diags := attr.Expr.Value(evalCtx)
 		if diags.HasErrors() {
-			return nil, fmt.Errorf("evaluating symbol_set: %s", diags.Error())
+			return nil, fmt.Errorf("evaluating min_entropy: %s", diags.Error())
+		}
+		bits, err := entropyBits(val)
+		if err != nil {
+			return nil, err
+		}
+		policy.MinEntropy = bits
+		// The length is derived from min_entropy unless it's given
+		if _, exists := content.Attributes["length"]; !exists {
+			policy.Length = 0
 		}
-		policy.SymbolCharacters = val.AsString()
 	}
 
-	if attr, exists := content.Attributes["no_upper"]; exists {
+	return &policy, nil
+}
+
+// entropyBits converts a min_entropy value to bits, 0 when unset.
+func entropyBits(val cty.Value) (int, error) {
+	if val.Type() != cty.Number || !val.AsBigFloat().IsInt() || val.LessThan(cty.NumberIntVal(0)).True() {
+		return 0, fmt.Errorf("min_entropy must be a whole number of bits")
+	}
+	bits, _ := val.AsBigFloat().Int64()
+	return int(bits), nil
+}
+
+// parseRedactBlock parses the redact configuration block
+func parseRedactBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (*RedactConfig, error) {
+	redact := &RedactConfig{}
+
+	content, diags := block.Body.Content(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "patterns"},
+			{Name: "always_mask"},
+		},
+	})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%s", diags.Error())
+	}
+
+	if attr, exists := content.Attributes["patterns"]; exists {
 		val, diags := attr.Expr.Value(evalCtx)
 		if diags.HasErrors() {
-			return nil, fmt.Errorf("evaluating no_upper: %s", diags.Error())
+			return nil, fmt.Errorf("evaluating patterns: %s", diags.Error())
+		}
+		if !val.Type().IsTupleType() && !val.Type().IsListType() {
+			return nil, fmt.Errorf("patterns must be a list of strings")
+		}
+		for _, v := range val.AsValueSlice() {
+			if v.Type() != cty.String {
+				return nil, fmt.Errorf("patterns must be a list of strings")
+			}
+			redact.Patterns = append(redact.Patterns, v.AsString())
 		}
-		policy.NoUpper = val.True()
 	}
 
-	if attr, exists := content.Attributes["allow_repeat"]; exists {
+	if attr, exists := content.Attributes["always_mask"]; exists {
 		val, diags := attr.Expr.Value(evalCtx)
 		if diags.HasErrors() {
-			return nil, fmt.Errorf("evaluating allow_repeat: %s", diags.Error())
+			return nil, fmt.Errorf("evaluating always_mask: %s", diags.Error())
+		}
+		if !val.Type().IsTupleType() && !val.Type().IsListType() {
+			return nil, fmt.Errorf("always_mask must be a list of strings")
+		}
+		for _, v := range val.AsValueSlice() {
+			if v.Type() != cty.String {
+				return nil, fmt.Errorf("always_mask must be a list of strings")
+			}
+			pattern := v.AsString()
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid always_mask pattern %q: %w", pattern, err)
+			}
+			redact.AlwaysMask = append(redact.AlwaysMask, pattern)
 		}
-		b := val.True()
-		policy.AllowRepeat = &b
 	}
 
-	return &policy, nil
+	return redact, nil
 }
 
 // secretBlockSchema defines the schema for secret blocks (v2.0 format)
 var secretBlockSchema = &hcl.BodySchema{
 	Attributes: []hcl.AttributeSchema{
+		{Name: "for_each"}, // Expanded by expandForEach
 		{Name: "mount"},
 		{Name: "path", Required: true},
 		{Name: "version"},
 		{Name: "prune"},
+		{Name: "force"},
+		{Name: "nested_keys"},
+		{Name: "ignore_keys_file"},
+		{Name: "ignore_keys"},
 		{Name: "enabled"},
 	},
 	Blocks: []hcl.BlockHeaderSchema{
 		{Type: "content"},
+		{Type: "metadata"},
+	},
+}
+
+// contentBlockSchema matches the blocks allowed inside content {}. Every
+// other entry is an attribute naming a secret key.
+var contentBlockSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "group"},
+	},
+}
+
+// groupBlockSchema is the schema for group {} blocks inside content {}
+var groupBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "keys", Required: true},
+		{Name: "value", Required: true},
 	},
 }
 
@@ -926,7 +1919,47 @@ func parseSecretBlock(block *hcl.Block, name string, evalCtx *hcl.EvalContext) (
 		secret.Prune = val.True()
 	}
 
-	// Parse enabled attribute (optional, defaults to true)
+	// Parse force attribute (optional)
+	if attr, exists := bodyContent.Attributes["force"]; exists {
+		val, valDiags := attr.Expr.Value(evalCtx)
+		if valDiags.HasErrors() {
+			return nil, fmt.Errorf("evaluating force: %s", valDiags.Error())
+		}
+		secret.Force = val.True()
+	}
+
+	// Parse nested_keys attribute (optional)
+	if attr, exists := bodyContent.Attributes["nested_keys"]; exists {
+		val, valDiags := attr.Expr.Value(evalCtx)
+		if valDiags.HasErrors() {
+			return nil, fmt.Errorf("evaluating nested_keys: %s", valDiags.Error())
+		}
+		secret.NestedKeys = val.True()
+	}
+
+	// Parse ignore_keys_file attribute (optional)
+	if attr, exists := bodyContent.Attributes["ignore_keys_file"]; exists {
+		val, valDiags := attr.Expr.Value(evalCtx)
+		if valDiags.HasErrors() {
+			return nil, fmt.Errorf("evaluating ignore_keys_file: %s", valDiags.Error())
+		}
+		secret.IgnoreKeysFile = val.AsString()
+	}
+
+	// Parse ignore_keys attribute (optional)
+	if attr, exists := bodyContent.Attributes["ignore_keys"]; exists {
+		val, valDiags := attr.Expr.Value(evalCtx)
+		if valDiags.HasErrors() {
+			return nil, fmt.Errorf("evaluating ignore_keys: %s", valDiags.Error())
+		}
+		keys, err := stringList(val)
+		if err != nil {
+			return nil, fmt.Errorf("ignore_keys %w", err)
+		}
+		secret.IgnoreKeys = keys
+	}
+
+	// Parse enabled attribute (optional, defaults to defaults.enabled)
 	if attr, exists := bodyContent.Attributes["enabled"]; exists {
 		val, valDiags := attr.Expr.Value(evalCtx)
 		if valDiags.HasErrors() {
@@ -936,33 +1969,92 @@ func parseSecretBlock(block *hcl.Block, name string, evalCtx *hcl.EvalContext) (
 		secret.Enabled = &enabled
 	}
 
-	// Parse content block (required)
-	var contentBlock *hcl.Block
+	// Parse content block (required) and metadata block (optional)
+	var contentBlock, metadataBlock *hcl.Block
 	for _, b := range bodyContent.Blocks {
-		if b.Type == "content" {
+		switch b.Type {
+		case "content":
 			if contentBlock != nil {
 				return nil, fmt.Errorf("only one content block allowed per secret")
 			}
 			contentBlock = b
+		case "metadata":
+			if metadataBlock != nil {
+				return nil, fmt.Errorf("only one metadata block allowed per secret")
+			}
+			metadataBlock = b
+		}
+	}
+
+	if metadataBlock != nil {
+		if secret.Version == 1 {
+			return nil, fmt.Errorf("metadata block requires KV version 2")
 		}
+		metadata, err := parseMetadataBlock(metadataBlock, evalCtx)
+		if err != nil {
+			return nil, err
+		}
+		secret.Metadata = metadata
 	}
 
 	if contentBlock == nil {
 		return nil, fmt.Errorf("content block is required")
 	}
 
-	// Parse all attributes in the content block as secret key-value pairs
-	contentAttrs, attrDiags := contentBlock.Body.JustAttributes()
-	if attrDiags.HasErrors() {
-		return nil, fmt.Errorf("parsing content block: %s", attrDiags.Error())
+	groups, _, groupDiags := contentBlock.Body.PartialContent(contentBlockSchema)
+	if groupDiags.HasErrors() {
+		return nil, fmt.Errorf("parsing content block: %s", groupDiags.Error())
+	}
+
+	// JustAttributes rejects any nested block, even ones already consumed by
+	// PartialContent, so read the attributes from the syntax body directly.
+	syntaxBody, ok := contentBlock.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("parsing content block: unsupported body type %T", contentBlock.Body)
+	}
+	for _, b := range syntaxBody.Blocks {
+		if b.Type != "group" {
+			return nil, fmt.Errorf("parsing content block: unexpected %q block", b.Type)
+		}
 	}
 
-	for keyName, attr := range contentAttrs {
+	// Parse all attributes in the content block as secret key-value pairs.
+	// json_multi(), ssh_keygen(), and tls_cert() attributes expand into several keys, merged afterwards so
+	// collisions with explicit keys are caught whatever the attribute order.
+	multi := make(map[string]map[string]Value)
+	for keyName, attr := range syntaxBody.Attributes {
 		val, valDiags := attr.Expr.Value(evalCtx)
 		if valDiags.HasErrors() {
 			return nil, fmt.Errorf("evaluating %s: %s", keyName, valDiags.Error())
 		}
 
+		if isMultiMarker(val) {
+			values, err := expandMultiMarker(val)
+			if err != nil {
+				return nil, fmt.Errorf("converting %s: %w", keyName, err)
+			}
+			multi[keyName] = values
+			continue
+		}
+
+		if isSSHKeygenMarker(val) {
+			values, err := expandSSHKeygenMarker(keyName, val)
+			if err != nil {
+				return nil, fmt.Errorf("converting %s: %w", keyName, err)
+			}
+			multi[keyName] = values
+			continue
+		}
+
+		if isTLSCertMarker(val) {
+			values, err := expandTLSCertMarker(keyName, val)
+			if err != nil {
+				return nil, fmt.Errorf("converting %s: %w", keyName, err)
+			}
+			multi[keyName] = values
+			continue
+		}
+
 		value, err := ctyValueToValue(val)
 		if err != nil {
 			return nil, fmt.Errorf("converting %s: %w", keyName, err)
@@ -970,13 +2062,153 @@ func parseSecretBlock(block *hcl.Block, name string, evalCtx *hcl.EvalContext) (
 		secret.Content[keyName] = value
 	}
 
+	for _, setName := range sortedKeys(multi) {
+		for _, key := range sortedKeys(multi[setName]) {
+			if _, exists := secret.Content[key]; exists {
+				return nil, fmt.Errorf("%s: key %q is defined more than once", setName, key)
+			}
+			secret.Content[key] = multi[setName][key]
+		}
+	}
+
+	for _, group := range groups.Blocks {
+		if err := parseGroupBlock(group, evalCtx, secret.Content); err != nil {
+			return nil, err
+		}
+	}
+
 	if len(secret.Content) == 0 {
 		return nil, fmt.Errorf("content block must contain at least one key")
 	}
 
+	if err := validateExpireAfter(secret); err != nil {
+		return nil, err
+	}
+
 	return secret, nil
 }
 
+// validateNestedKeys checks that the keys of a nested_keys block can all be
+// written as nested objects: no key may be empty between its "/"
+// separators, and none may also be the parent of another, such as "db" and
+// "db/password". Keys from env_all() and map_from() are only known when
+// planning, which checks them again.
+func validateNestedKeys(content map[string]Value) error {
+	keys := make(map[string]bool, len(content))
+	for key, val := range content {
+		if val.Type != ValueTypeEnvAll && val.Type != ValueTypeMapFrom {
+			keys[key] = true
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		parts := strings.Split(key, "/")
+		if slices.Contains(parts, "") {
+			return fmt.Errorf("key %q has an empty path segment", key)
+		}
+		for i := 1; i < len(parts); i++ {
+			if parent := strings.Join(parts[:i], "/"); keys[parent] {
+				return fmt.Errorf("key %q conflicts with key %q", key, parent)
+			}
+		}
+	}
+	return nil
+}
+
+// validateExpireAfter checks that every generate() expire_after in a block
+// agrees, since delete_version_after is set on the secret as a whole.
+func validateExpireAfter(secret *SecretBlock) error {
+	var first string
+	var expireAfter time.Duration
+	for _, key := range sortedKeys(secret.Content) {
+		d := secret.Content[key].expireAfter()
+		if d == 0 {
+			continue
+		}
+		if secret.Version == 1 {
+			return fmt.Errorf("%s: expire_after requires KV version 2", key)
+		}
+		if expireAfter == 0 {
+			first, expireAfter = key, d
+			continue
+		}
+		if d != expireAfter {
+			return fmt.Errorf("%s: expire_after %s differs from %s on %s; it applies to the whole secret, so all values must agree", key, d, expireAfter, first)
+		}
+	}
+	return nil
+}
+
+// parseMetadataBlock parses a metadata {} block into custom metadata.
+// Every attribute must be a string.
+func parseMetadataBlock(block *hcl.Block, evalCtx *hcl.EvalContext) (map[string]string, error) {
+	attrs, diags := block.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("parsing metadata block: %s", diags.Error())
+	}
+
+	metadata := make(map[string]string, len(attrs))
+	for key, attr := range attrs {
+		val, valDiags := attr.Expr.Value(evalCtx)
+		if valDiags.HasErrors() {
+			return nil, fmt.Errorf("evaluating metadata %s: %s", key, valDiags.Error())
+		}
+		if val.IsNull() || val.Type() != cty.String {
+			return nil, fmt.Errorf("metadata %s must be a string", key)
+		}
+		metadata[key] = val.AsString()
+	}
+
+	return metadata, nil
+}
+
+// parseGroupBlock expands a group {} block into one value per key. Each key
+// gets its own Value and is resolved independently, so a group of generate()
+// keys produces distinct passwords sharing one policy.
+func parseGroupBlock(block *hcl.Block, evalCtx *hcl.EvalContext, content map[string]Value) error {
+	body, diags := block.Body.Content(groupBlockSchema)
+	if diags.HasErrors() {
+		return fmt.Errorf("parsing group block: %s", diags.Error())
+	}
+
+	keysVal, diags := body.Attributes["keys"].Expr.Value(evalCtx)
+	if diags.HasErrors() {
+		return fmt.Errorf("evaluating group keys: %s", diags.Error())
+	}
+	if !keysVal.Type().IsTupleType() && !keysVal.Type().IsListType() {
+		return fmt.Errorf("group keys must be a list of strings")
+	}
+
+	val, diags := body.Attributes["value"].Expr.Value(evalCtx)
+	if diags.HasErrors() {
+		return fmt.Errorf("evaluating group value: %s", diags.Error())
+	}
+
+	for _, k := range keysVal.AsValueSlice() {
+		if k.Type() != cty.String || k.IsNull() {
+			return fmt.Errorf("group keys must be a list of strings")
+		}
+		keyName := k.AsString()
+		if keyName == "" {
+			return fmt.Errorf("group keys must not be empty")
+		}
+		if _, exists := content[keyName]; exists {
+			return fmt.Errorf("key %q is defined more than once", keyName)
+		}
+
+		value, err := ctyValueToValue(val)
+		if err != nil {
+			return fmt.Errorf("converting %s: %w", keyName, err)
+		}
+		if value.Type == ValueTypeEnvAll || value.Type == ValueTypeMapFrom {
+			return fmt.Errorf("%s() can't be used in a group block", value.Type)
+		}
+		content[keyName] = value
+	}
+
+	return nil
+}
+
 // ctyValueToValue converts a cty.Value to our Value type
 func ctyValueToValue(val cty.Value) (Value, error) {
 	// If it's a string, it's a static value
@@ -989,18 +2221,57 @@ func ctyValueToValue(val cty.Value) (Value, error) {
 
 	// If it's our marker object, decode it
 	if val.Type().IsObjectType() {
+		if isMultiMarker(val) {
+			return Value{}, fmt.Errorf("json_multi() can only be used directly in a content block")
+		}
+		if isSSHKeygenMarker(val) {
+			return Value{}, fmt.Errorf("ssh_keygen() can only be used directly in a content block")
+		}
+		if isTLSCertMarker(val) {
+			return Value{}, fmt.Errorf("tls_cert() can only be used directly in a content block")
+		}
+
 		valMap := val.AsValueMap()
 
 		typeStr := valMap["_type"].AsString()
 		strategyStr := valMap["_strategy"].AsString()
 
 		v := Value{
-			Strategy: Strategy(strategyStr),
+			Strategy:   Strategy(strategyStr),
+			Pipe:       valMap["_pipe"].AsString(),
+			Transforms: decodeTransforms(valMap["_transforms"]),
 		}
 
 		switch typeStr {
 		case "generate":
 			v.Type = ValueTypeGenerate
+			v.PolicyName = valMap["_policy"].AsString()
+
+			if expireAfter := valMap["_expire_after"].AsString(); expireAfter != "" {
+				d, err := time.ParseDuration(expireAfter)
+				if err != nil || d <= 0 {
+					return Value{}, fmt.Errorf("invalid expire_after %q: must be a positive duration like \"24h\"", expireAfter)
+				}
+				v.ExpireAfter = d
+			}
+
+			switch mode := valMap["_mode"].AsString(); mode {
+			case "", "password":
+			case "passphrase":
+				passphrase := DefaultPassphrasePolicy()
+				if words, _ := valMap["_words"].AsBigFloat().Int64(); words != 0 {
+					passphrase.Words = int(words)
+				}
+				if sep := valMap["_separator"]; !sep.IsNull() {
+					passphrase.Separator = sep.AsString()
+				}
+				passphrase.Capitalize = valMap["_capitalize"].True()
+				passphrase.Number = valMap["_number"].True()
+				v.Passphrase = &passphrase
+				return v, nil
+			default:
+				return Value{}, fmt.Errorf("unknown generate mode %q (expected \"password\" or \"passphrase\")", mode)
+			}
 
 			// Parse password policy if any custom values set
 			length, _ := valMap["_length"].AsBigFloat().Int64()
@@ -1008,10 +2279,20 @@ func ctyValueToValue(val cty.Value) (Value, error) {
 			symbols, _ := valMap["_symbols"].AsBigFloat().Int64()
 			symbolSet := valMap["_symbol_set"].AsString()
 			noUpper := valMap["_no_upper"].True()
+			minLower, _ := valMap["_min_lower"].AsBigFloat().Int64()
+			minUpper, _ := valMap["_min_upper"].AsBigFloat().Int64()
 			allowRepeat := valMap["_allow_repeat"].True()
+			shellSafe := valMap["_shell_safe"].True()
+			jsonSafe := valMap["_json_safe"].True()
+			excludeAmbiguous := valMap["_exclude_ambiguous"].True()
+			requireEachClass := valMap["_require_each_class"].True()
+			minEntropy, err := entropyBits(valMap["_min_entropy"])
+			if err != nil {
+				return Value{}, err
+			}
 
 			// Only set policy if any non-default values
-			if length > 0 || digits >= 0 || symbols >= 0 || symbolSet != "" || noUpper || !allowRepeat {
+			if length > 0 || digits >= 0 || symbols >= 0 || symbolSet != "" || noUpper || minLower > 0 || minUpper > 0 || !allowRepeat || shellSafe || jsonSafe || excludeAmbiguous || requireEachClass || minEntropy > 0 {
 				policy := &PasswordPolicy{}
 				if length > 0 {
 					policy.Length = int(length)
@@ -1021,77 +2302,135 @@ func ctyValueToValue(val cty.Value) (Value, error) {
 				}
 				if symbols >= 0 {
 					policy.Symbols = int(symbols)
+					policy.SymbolsSet = true
 				}
 				if symbolSet != "" {
 					policy.SymbolCharacters = symbolSet
 				}
 				policy.NoUpper = noUpper
+				policy.MinLower = int(minLower)
+				policy.MinUpper = int(minUpper)
 				policy.AllowRepeat = &allowRepeat
+				policy.ShellSafe = shellSafe
+				policy.JSONSafe = jsonSafe
+				policy.ExcludeAmbiguous = excludeAmbiguous
+				policy.RequireEachClass = requireEachClass
+				policy.MinEntropy = minEntropy
 				v.Generate = policy
 			}
 
-		case "json":
-			v.Type = ValueTypeJSON
-			v.URL = valMap["_url"].AsString()
-			v.Query = valMap["_query"].AsString()
+		case "uuid":
+			v.Type = ValueTypeUUID
 
-		case "yaml":
-			v.Type = ValueTypeYAML
+		case "json", "yaml":
+			v.Type = ValueType(typeStr)
 			v.URL = valMap["_url"].AsString()
 			v.Query = valMap["_query"].AsString()
 
+			switch as := WriteType(valMap["_as"].AsString()); as {
+			case "", WriteTypeString:
+			case WriteTypeNumber, WriteTypeBool:
+				// The value is written as is, so it can't be changed afterwards
+				if v.Pipe != "" || len(v.Transforms) > 0 {
+					return Value{}, fmt.Errorf("as = %q can't be combined with pipe or base64 transforms", as)
+				}
+				v.As = as
+			default:
+				return Value{}, fmt.Errorf("unknown as %q (expected %q, %q, or %q)", as, WriteTypeString, WriteTypeNumber, WriteTypeBool)
+			}
+
 		case "raw":
 			v.Type = ValueTypeRaw
 			v.URL = valMap["_url"].AsString()
+			v.MaxSize, _ = valMap["_max_size"].AsBigFloat().Int64()
+			v.JSONFormat = valMap["_json_format"].AsString()
 
 		case "vault":
 			v.Type = ValueTypeVault
 			v.VaultPath = valMap["_vault_path"].AsString()
 			v.VaultKey = valMap["_vault_key"].AsString()
+			version, _ := valMap["_vault_version"].AsBigFloat().Int64()
+			v.VaultVersion = int(version)
 
 		case "command":
 			v.Type = ValueTypeCommand
 			v.Command = valMap["_command"].AsString()
+			if timeout := valMap["_timeout"].AsString(); timeout != "" {
+				d, err := time.ParseDuration(timeout)
+				if err != nil || d <= 0 {
+					return Value{}, fmt.Errorf("invalid timeout %q: must be a positive duration like \"30s\"", timeout)
+				}
+				v.Timeout = d
+			}
 
-		case "bcrypt":
-			v.Type = ValueTypeBcrypt
-			cost, _ := valMap["_cost"].AsBigFloat().Int64()
-			v.Bcrypt = &BcryptConfig{
-				FromKey: valMap["_from"].AsString(),
-				Cost:    int(cost),
+			if stdin := valMap["_stdin"].AsString(); stdin != "" {
+				marker, err := ctyjson.Unmarshal([]byte(stdin), valueMarkerType)
+				if err != nil {
+					return Value{}, fmt.Errorf("decoding command() stdin: %w", err)
+				}
+				inner, err := ctyValueToValue(marker)
+				if err != nil {
+					return Value{}, fmt.Errorf("command() stdin: %w", err)
+				}
+				switch inner.Type {
+				case ValueTypeBcrypt, ValueTypeArgon2, ValueTypePbkdf2, ValueTypeEnvAll, ValueTypeMapFrom:
+					return Value{}, fmt.Errorf("command() stdin cannot be %s()", inner.Type)
+				}
+				v.Stdin = &inner
 			}
 
-		case "argon2":
-			v.Type = ValueTypeArgon2
-			memory, _ := valMap["_memory"].AsBigFloat().Int64()
-			iterations, _ := valMap["_iterations"].AsBigFloat().Int64()
-			parallelism, _ := valMap["_parallelism"].AsBigFloat().Int64()
-			// Validate bounds for safe conversion
-			if memory < 0 || memory > 0xFFFFFFFF {
-				return Value{}, fmt.Errorf("argon2 memory out of range: %d", memory)
+			if env := valMap["_env"]; env.LengthInt() > 0 {
+				v.Env = make(map[string]string)
+				for name, val := range env.AsValueMap() {
+					v.Env[name] = val.AsString()
+				}
 			}
-			if iterations < 0 || iterations > 0xFFFFFFFF {
-				return Value{}, fmt.Errorf("argon2 iterations out of range: %d", iterations)
+
+			v.NormalizeNewlines = valMap["_normalize_newlines"].True()
+			switch binary := valMap["_binary"].AsString(); binary {
+			case "", BinaryBase64:
+				v.Binary = binary
+			default:
+				return Value{}, fmt.Errorf("unknown binary %q: only \"base64\" is supported", binary)
 			}
-			if parallelism < 0 || parallelism > 255 {
-				return Value{}, fmt.Errorf("argon2 parallelism out of range: %d", parallelism)
+
+		case "env_all":
+			v.Type = ValueTypeEnvAll
+			v.Prefix = valMap["_prefix"].AsString()
+
+		case "map_from":
+			v.Type = ValueTypeMapFrom
+			v.URL = valMap["_url"].AsString()
+			v.Filter = valMap["_filter"].AsString()
+
+		case "bcrypt", "argon2", "pbkdf2":
+			v.Type = ValueType(typeStr)
+			if err := decodeHashOptions(&v, v.Type, valMap); err != nil {
+				return Value{}, err
 			}
-			v.Argon2 = &Argon2Config{
-				FromKey:     valMap["_from"].AsString(),
-				Variant:     valMap["_variant"].AsString(),
-				Memory:      uint32(memory),     // #nosec G115 -- bounds checked above
-				Iterations:  uint32(iterations), // #nosec G115 -- bounds checked above
-				Parallelism: uint8(parallelism), // #nosec G115 -- bounds checked above
+
+		case "hash":
+			v.Type = ValueTypeHash
+			v.HashAlgorithm = ValueType(valMap["_algo"].AsString())
+			if err := decodeHashOptions(&v, v.HashAlgorithm, valMap); err != nil {
+				return Value{}, err
 			}
 
-		case "pbkdf2":
-			v.Type = ValueTypePbkdf2
-			iterations, _ := valMap["_iterations"].AsBigFloat().Int64()
-			v.Pbkdf2 = &Pbkdf2Config{
-				FromKey:    valMap["_from"].AsString(),
-				Variant:    valMap["_variant"].AsString(),
-				Iterations: int(iterations),
+			inner, err := ctyValueToValue(valMap["_inner"])
+			if err != nil {
+				return Value{}, fmt.Errorf("hash() value: %w", err)
 			}
+			if inner.Type == ValueTypeBcrypt || inner.Type == ValueTypeArgon2 || inner.Type == ValueTypePbkdf2 || inner.Type == ValueTypeEnvAll || inner.Type == ValueTypeMapFrom {
+				return Value{}, fmt.Errorf("hash() cannot wrap %s()", inner.Type)
+			}
+			if inner.As != "" {
+				return Value{}, fmt.Errorf("hash() value can't use as, the hash is always a string")
+			}
+			v.Inner = &inner
+
+		case "static":
+			v.Type = ValueTypeStatic
+			v.Static = valMap["_static"].AsString()
 
 		default:
 			return Value{}, fmt.Errorf("unknown value type: %s", typeStr)
@@ -1103,6 +2442,66 @@ func ctyValueToValue(val cty.Value) (Value, error) {
 	return Value{}, fmt.Errorf("unsupported value type: %s", val.Type().FriendlyName())
 }
 
+// decodeTransforms decodes the comma-separated _transforms marker field.
+func decodeTransforms(val cty.Value) []Transform {
+	if val.IsNull() || val.AsString() == "" {
+		return nil
+	}
+	var transforms []Transform
+	for _, t := range strings.Split(val.AsString(), ",") {
+		transforms = append(transforms, Transform(t))
+	}
+	return transforms
+}
+
+// decodeHashOptions sets the hashing configuration for algo on v from the
+// marker attributes shared by bcrypt(), argon2(), pbkdf2() and hash().
+func decodeHashOptions(v *Value, algo ValueType, valMap map[string]cty.Value) error {
+	switch algo {
+	case ValueTypeBcrypt:
+		cost, _ := valMap["_cost"].AsBigFloat().Int64()
+		v.Bcrypt = &BcryptConfig{
+			FromKey: valMap["_from"].AsString(),
+			Cost:    int(cost),
+		}
+
+	case ValueTypeArgon2:
+		memory, _ := valMap["_memory"].AsBigFloat().Int64()
+		iterations, _ := valMap["_iterations"].AsBigFloat().Int64()
+		parallelism, _ := valMap["_parallelism"].AsBigFloat().Int64()
+		// Validate bounds for safe conversion
+		if memory < 0 || memory > 0xFFFFFFFF {
+			return fmt.Errorf("argon2 memory out of range: %d", memory)
+		}
+		if iterations < 0 || iterations > 0xFFFFFFFF {
+			return fmt.Errorf("argon2 iterations out of range: %d", iterations)
+		}
+		if parallelism < 0 || parallelism > 255 {
+			return fmt.Errorf("argon2 parallelism out of range: %d", parallelism)
+		}
+		v.Argon2 = &Argon2Config{
+			FromKey:     valMap["_from"].AsString(),
+			Variant:     valMap["_variant"].AsString(),
+			Memory:      uint32(memory),     // #nosec G115 -- bounds checked above
+			Iterations:  uint32(iterations), // #nosec G115 -- bounds checked above
+			Parallelism: uint8(parallelism), // #nosec G115 -- bounds checked above
+		}
+
+	case ValueTypePbkdf2:
+		iterations, _ := valMap["_iterations"].AsBigFloat().Int64()
+		v.Pbkdf2 = &Pbkdf2Config{
+			FromKey:    valMap["_from"].AsString(),
+			Variant:    valMap["_variant"].AsString(),
+			Iterations: int(iterations),
+		}
+
+	default:
+		return fmt.Errorf("unknown hash algorithm: %s", algo)
+	}
+
+	return nil
+}
+
 // applyDefaults applies default values to the config
 func applyDefaults(cfg *Config) {
 	// Apply default mount if not set
@@ -1117,7 +2516,8 @@ func applyDefaults(cfg *Config) {
 
 	// Apply password policy defaults
 	defaults := DefaultPasswordPolicy()
-	if cfg.Defaults.Generate.Length == 0 {
+	// A zero length with min_entropy is derived from it
+	if cfg.Defaults.Generate.Length == 0 && cfg.Defaults.Generate.MinEntropy == 0 {
 		cfg.Defaults.Generate.Length = defaults.Length
 	}
 	if cfg.Defaults.Generate.Digits == 0 {
@@ -1138,36 +2538,28 @@ func applyDefaults(cfg *Config) {
 		// Apply default mount
 		if block.Mount == "" {
 			block.Mount = cfg.Defaults.Mount
+			block.mountInherited = true
 		}
 		// Apply default version (0 means auto-detect)
 		if block.Version == 0 && cfg.Defaults.Version != 0 {
 			block.Version = cfg.Defaults.Version
 		}
+		// Apply default enabled state (nil means enabled)
+		if block.Enabled == nil && cfg.Defaults.Enabled != nil {
+			enabled := *cfg.Defaults.Enabled
+			block.Enabled = &enabled
+		}
 		cfg.Secrets[name] = block
 	}
 }
 
-// detectHashCycles checks for circular references and missing references in hash functions
-func detectHashCycles(name string, content map[string]Value) error {
-	// Build dependency map: key -> key it references (for hash functions only)
+// detectDependencyCycles checks for circular and missing references between
+// keys computed from other keys (see Value.DependsOn).
+func detectDependencyCycles(name string, content map[string]Value) error {
+	// Build dependency map: key -> key it is computed from
 	deps := make(map[string]string)
 	for key, val := range content {
-		var fromKey string
-		switch val.Type {
-		case ValueTypeBcrypt:
-			if val.Bcrypt != nil {
-				fromKey = val.Bcrypt.FromKey
-			}
-		case ValueTypeArgon2:
-			if val.Argon2 != nil {
-				fromKey = val.Argon2.FromKey
-			}
-		case ValueTypePbkdf2:
-			if val.Pbkdf2 != nil {
-				fromKey = val.Pbkdf2.FromKey
-			}
-		}
-		if fromKey != "" {
+		if fromKey := val.DependsOn(); fromKey != "" {
 			deps[key] = fromKey
 		}
 	}
@@ -1199,6 +2591,48 @@ func detectHashCycles(name string, content map[string]Value) error {
 	return nil
 }
 
+// checkPolicyLength checks that a password policy's length leaves room for
+// its required digits, symbols and letters, including one uppercase letter
+// unless no_upper is set. With require_each_class, every letter class and
+// digits need one character at least; the symbol is checked when the
+// policy is tried out, as it depends on the symbols left to pick from.
+func checkPolicyLength(policy PasswordPolicy) error {
+	// The length is derived from min_entropy when the password is
+	// generated, and is always long enough
+	if policy.Length == 0 && policy.MinEntropy > 0 {
+		return nil
+	}
+
+	if policy.RequireEachClass {
+		policy.MinLower = max(policy.MinLower, 1)
+		if !policy.NoUpper {
+			policy.MinUpper = max(policy.MinUpper, 1)
+		}
+		policy.Digits = max(policy.Digits, 1)
+	}
+
+	if policy.NoUpper && policy.MinUpper > 0 {
+		return fmt.Errorf("min_uppercase can't be used with no_upper")
+	}
+	if policy.MinLower < 0 || policy.MinUpper < 0 {
+		return fmt.Errorf("min_lowercase and min_uppercase can't be negative")
+	}
+
+	minRequired := policy.Digits + policy.Symbols + policy.MinLower + policy.MinUpper
+	if !policy.NoUpper && policy.MinUpper == 0 {
+		minRequired++ // At least one uppercase
+	}
+	if policy.Length >= minRequired {
+		return nil
+	}
+	if policy.MinLower > 0 || policy.MinUpper > 0 {
+		return fmt.Errorf("length %d is too small for %d digits + %d symbols + %d lowercase + %d uppercase",
+			policy.Length, policy.Digits, policy.Symbols, policy.MinLower, policy.MinUpper)
+	}
+	return fmt.Errorf("length %d is too small for %d digits + %d symbols",
+		policy.Length, policy.Digits, policy.Symbols)
+}
+
 // validate validates the configuration
 func validate(cfg *Config) error {
 	if len(cfg.Secrets) == 0 {
@@ -1206,15 +2640,21 @@ func validate(cfg *Config) error {
 	}
 
 	// Validate default generate policy
-	{
-		policy := cfg.Defaults.Generate
-		minRequired := policy.Digits + policy.Symbols
-		if !policy.NoUpper {
-			minRequired++ // At least one uppercase
+	if err := checkPolicyLength(cfg.Defaults.Generate); err != nil {
+		return fmt.Errorf("defaults.generate: %w", err)
+	}
+
+	// Validate named policies
+	for policyName, policy := range cfg.Defaults.Policies {
+		if err := checkPolicyLength(policy); err != nil {
+			return fmt.Errorf("defaults.policy %q: %w", policyName, err)
 		}
-		if policy.Length < minRequired {
-			return fmt.Errorf("defaults.generate: length %d is too small for %d digits + %d symbols",
-				policy.Length, policy.Digits, policy.Symbols)
+	}
+
+	// Validate redaction patterns
+	for _, pattern := range cfg.Redact.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("redact: invalid pattern %q: %w", pattern, err)
 		}
 	}
 
@@ -1234,6 +2674,19 @@ func validate(cfg *Config) error {
 			return fmt.Errorf("secret %q: version must be 1 or 2 (or 0 for auto)", name)
 		}
 
+		// An ignored key is left alone, so it can't be managed too
+		for _, key := range block.IgnoreKeys {
+			if _, exists := block.Content[key]; exists {
+				return fmt.Errorf("secret %q: key %q is in both content and ignore_keys", name, key)
+			}
+		}
+
+		if block.NestedKeys {
+			if err := validateNestedKeys(block.Content); err != nil {
+				return fmt.Errorf("secret %q: nested_keys: %w", name, err)
+			}
+		}
+
 		// Check for unique mount+path combinations
 		fullPath := block.FullPath()
 		if existingName, exists := fullPaths[fullPath]; exists {
@@ -1241,14 +2694,43 @@ func validate(cfg *Config) error {
 		}
 		fullPaths[fullPath] = name
 
-		// Check for hash function reference cycles and missing references
-		if err := detectHashCycles(name, block.Content); err != nil {
+		// Check for dependency cycles and missing references
+		if err := detectDependencyCycles(name, block.Content); err != nil {
 			return err
 		}
 
-		// Validate generate policies
+		// Validate generate policies, including values wrapped by hash()
 		for key, val := range block.Content {
-			if val.Type == ValueTypeGenerate && val.Generate != nil {
+			if val.Type == ValueTypeHash && val.Inner != nil {
+				val = *val.Inner
+			}
+			if val.Type != ValueTypeGenerate {
+				continue
+			}
+
+			if val.Passphrase != nil {
+				if val.PolicyName != "" {
+					return fmt.Errorf("secret %q key %q: policy cannot be used with passphrase mode", name, key)
+				}
+				if val.Passphrase.Words < 1 {
+					return fmt.Errorf("secret %q key %q: words must be at least 1", name, key)
+				}
+				if val.Passphrase.Words > MaxPassphraseWords {
+					return fmt.Errorf("secret %q key %q: words must be at most %d", name, key, MaxPassphraseWords)
+				}
+				continue
+			}
+
+			base := cfg.Defaults.Generate
+			if val.PolicyName != "" {
+				named, ok := cfg.Defaults.Policies[val.PolicyName]
+				if !ok {
+					return fmt.Errorf("secret %q key %q: unknown policy %q", name, key, val.PolicyName)
+				}
+				base = named
+			}
+
+			if val.Generate != nil {
 				policy := val.Generate
 				if policy.Length > 0 && policy.Length < 1 {
 					return fmt.Errorf("secret %q key %q: length must be at least 1", name, key)
@@ -1256,24 +2738,31 @@ func validate(cfg *Config) error {
 
 				digits := policy.Digits
 				if digits < 0 {
-					digits = cfg.Defaults.Generate.Digits
+					digits = base.Digits
 				}
 				symbols := policy.Symbols
-				if symbols < 0 {
-					symbols = cfg.Defaults.Generate.Symbols
+				if !policy.SymbolsSet {
+					symbols = base.Symbols
 				}
 				length := policy.Length
-				if length == 0 {
-					length = cfg.Defaults.Generate.Length
+				if length == 0 && policy.MinEntropy == 0 {
+					length = base.Length
 				}
 
-				minRequired := digits + symbols
-				if !policy.NoUpper {
-					minRequired++ // At least one uppercase
+				merged := *policy
+				merged.Length, merged.Digits, merged.Symbols = length, digits, symbols
+				if merged.MinLower == 0 {
+					merged.MinLower = base.MinLower
+				}
+				if merged.MinUpper == 0 && !merged.NoUpper {
+					merged.MinUpper = base.MinUpper
+				}
+				merged.RequireEachClass = merged.RequireEachClass || base.RequireEachClass
+				if merged.MinEntropy == 0 {
+					merged.MinEntropy = base.MinEntropy
 				}
-				if length < minRequired {
-					return fmt.Errorf("secret %q key %q: length %d is too small for %d digits + %d symbols",
-						name, key, length, digits, symbols)
+				if err := checkPolicyLength(merged); err != nil {
+					return fmt.Errorf("secret %q key %q: %w", name, key, err)
 				}
 			}
 		}
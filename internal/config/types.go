@@ -1,5 +1,11 @@
 package config
 
+import (
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
 // Strategy defines how a value should be reconciled with Vault.
 type Strategy string
 
@@ -8,6 +14,10 @@ const (
 	StrategyCreate Strategy = "create"
 	// StrategyUpdate creates new keys and updates changed values.
 	StrategyUpdate Strategy = "update"
+	// StrategyReplace resolves like StrategyUpdate, but a change to the value
+	// replaces the whole secret: keys not in the config are dropped, and on
+	// KV v2 the previous version is soft-deleted.
+	StrategyReplace Strategy = "replace"
 )
 
 // Config represents the root configuration structure.
@@ -20,6 +30,19 @@ type Config struct {
 
 	// Secrets contains secret block definitions keyed by name
 	Secrets map[string]SecretBlock
+
+	// Redact contains additional output redaction rules
+	Redact RedactConfig
+}
+
+// RedactConfig contains user-defined redaction rules for logs and output.
+type RedactConfig struct {
+	// Patterns are regular expressions whose matches are redacted
+	Patterns []string
+
+	// AlwaysMask are glob patterns of keys whose values are always fully
+	// masked, even when values are otherwise shown
+	AlwaysMask []string
 }
 
 // VaultConfig contains Vault connection settings.
@@ -32,17 +55,22 @@ type VaultConfig struct {
 
 	// Auth contains authentication settings
 	Auth AuthConfig
+
+	// MaxConns caps the connections open to Vault at once, and how many
+	// are kept idle for reuse (0 = no cap)
+	MaxConns int
 }
 
 // AuthConfig contains Vault authentication settings.
 type AuthConfig struct {
-	// Method is the auth method: token, kubernetes, approle
+	// Method is the auth method: token, kubernetes, approle, aws, jwt,
+	// userpass, ldap
 	Method string
 
 	// Token is used for token auth method
 	Token string
 
-	// Role is used for kubernetes and approle auth methods
+	// Role is used for kubernetes, approle, aws and jwt auth methods
 	Role string
 
 	// RoleID is used for approle auth method
@@ -53,6 +81,28 @@ type AuthConfig struct {
 
 	// MountPath is the auth mount path (default depends on method)
 	MountPath string
+
+	// Region is the STS region for aws auth method (default us-east-1)
+	Region string
+
+	// HeaderValue is the X-Vault-AWS-IAM-Server-ID header value for aws
+	// auth method, if the backend requires one
+	HeaderValue string
+
+	// JWT is the JWT for jwt auth method
+	JWT string
+
+	// JWTPath is a file holding the JWT for jwt auth method
+	JWTPath string
+
+	// JWTEnv is an environment variable holding the JWT for jwt auth method
+	JWTEnv string
+
+	// Username is used for userpass and ldap auth methods
+	Username string
+
+	// Password is used for userpass and ldap auth methods
+	Password string
 }
 
 // StrategyDefaults defines default strategies per value type.
@@ -67,6 +117,7 @@ type StrategyDefaults struct {
 	Bcrypt   Strategy
 	Argon2   Strategy
 	Pbkdf2   Strategy
+	UUID     Strategy
 }
 
 // DefaultStrategyDefaults returns the default strategy configuration.
@@ -82,6 +133,7 @@ func DefaultStrategyDefaults() StrategyDefaults {
 		Bcrypt:   StrategyUpdate, // Keep in sync with source key
 		Argon2:   StrategyUpdate, // Keep in sync with source key
 		Pbkdf2:   StrategyUpdate, // Keep in sync with source key
+		UUID:     StrategyCreate, // Don't regenerate existing identifiers
 	}
 }
 
@@ -93,11 +145,22 @@ type Defaults struct {
 	// Version is the default KV engine version (1 or 2, auto-detect if 0)
 	Version int
 
+	// Enabled is the default for secret blocks that don't set enabled
+	// (default: true). Set to false to require an explicit opt-in per block.
+	Enabled *bool
+
 	// Strategy contains default strategies per value type
 	Strategy StrategyDefaults
 
 	// Generate contains default password generation policy
 	Generate PasswordPolicy
+
+	// Policies contains named password policies referenced by generate({policy = "..."})
+	Policies map[string]PasswordPolicy
+
+	// policyBlocks are the policy blocks not parsed yet, the base file's
+	// first
+	policyBlocks hcl.Blocks
 }
 
 // PasswordPolicy defines password generation parameters.
@@ -111,14 +174,47 @@ type PasswordPolicy struct {
 	// Symbols is the minimum number of symbols (default: 5)
 	Symbols int
 
+	// SymbolsSet is set when a generate() call gives symbols, so that
+	// symbols = 0 overrides the policy it's merged over instead of
+	// inheriting its symbols like any other unset option
+	SymbolsSet bool
+
 	// SymbolCharacters is the set of allowed symbols (default: "-_$@")
 	SymbolCharacters string
 
 	// NoUpper excludes uppercase letters when true (default: false)
 	NoUpper bool
 
+	// MinLower is the minimum number of lowercase letters (default: 0)
+	MinLower int
+
+	// MinUpper is the minimum number of uppercase letters (default: 0)
+	MinUpper int
+
 	// AllowRepeat allows repeated characters when true (default: true)
 	AllowRepeat *bool
+
+	// ShellSafe leaves out symbols with a special meaning to the shell,
+	// such as $, ` and quotes (default: false)
+	ShellSafe bool
+
+	// JSONSafe leaves out symbols that need escaping in a JSON string:
+	// " and \ (default: false)
+	JSONSafe bool
+
+	// ExcludeAmbiguous leaves out the letters and digits easily mistaken
+	// for one another: l, I, 1, O and 0 (default: false)
+	ExcludeAmbiguous bool
+
+	// RequireEachClass guarantees at least one lowercase letter, uppercase
+	// letter (unless NoUpper), digit and symbol (unless no symbols are
+	// left to pick from), even when their minimums are zero (default: false)
+	RequireEachClass bool
+
+	// MinEntropy is the minimum entropy of the password in bits. With no
+	// Length, the length is the shortest that reaches it; with a Length, a
+	// password that falls short is an error (default: 0, no minimum)
+	MinEntropy int
 }
 
 // DefaultPasswordPolicy returns the default password generation policy.
@@ -134,6 +230,97 @@ func DefaultPasswordPolicy() PasswordPolicy {
 	}
 }
 
+// MaxPassphraseWords bounds the word count to keep output reasonable.
+const MaxPassphraseWords = 64
+
+// PassphrasePolicy defines diceware-style passphrase generation parameters.
+type PassphrasePolicy struct {
+	// Words is the number of words (default: 6, at most MaxPassphraseWords)
+	Words int
+
+	// Separator joins the words (default: "-")
+	Separator string
+
+	// Capitalize capitalizes the first letter of each word (default: false)
+	Capitalize bool
+
+	// Number appends a random number 0-99 as a final element (default: false)
+	Number bool
+}
+
+// DefaultPassphrasePolicy returns the default passphrase generation policy.
+func DefaultPassphrasePolicy() PassphrasePolicy {
+	return PassphrasePolicy{
+		Words:     6,
+		Separator: "-",
+	}
+}
+
+// SSHKeyConfig defines an ssh_keygen() keypair.
+type SSHKeyConfig struct {
+	// Type is the key algorithm: "ed25519" (default) or "rsa"
+	Type string
+
+	// Bits is the RSA key size (default: 4096)
+	Bits int
+
+	// FromKey is set on the public key: the key holding the private key
+	FromKey string
+}
+
+// SSH key types accepted by ssh_keygen().
+const (
+	SSHKeyTypeEd25519 = "ed25519"
+	SSHKeyTypeRSA     = "rsa"
+)
+
+// RSA key sizes for ssh_keygen({type = "rsa"}).
+const (
+	DefaultRSABits = 4096
+	MinRSABits     = 2048
+)
+
+// SSHPublicKeySuffix is appended to an ssh_keygen() key's name to name the
+// key holding its public key.
+const SSHPublicKeySuffix = "_pub"
+
+// TLSCertConfig defines a tls_cert() certificate and key pair.
+type TLSCertConfig struct {
+	// CommonName is the certificate subject's common name (required)
+	CommonName string
+
+	// SANs are the subject alternative names: DNS names and IP addresses
+	SANs []string
+
+	// TTL is how long the certificate is valid (default: 8760h)
+	TTL time.Duration
+
+	// IsCA makes the certificate a CA that can sign other certificates
+	IsCA bool
+
+	// Issuer is the Vault path of the CA that signs the certificate.
+	// Empty means self-signed.
+	Issuer string
+
+	// IssuerName is the name the issuer's tls_cert() was assigned to: its
+	// certificate and key are read from the <name>.crt and <name>.key keys
+	// at Issuer (default: "tls")
+	IssuerName string
+
+	// FromKey is set on the certificate: the key holding its private key
+	FromKey string
+}
+
+// DefaultTLSCertTTL is the validity of a tls_cert() certificate when ttl
+// isn't set.
+const DefaultTLSCertTTL = 365 * 24 * time.Hour
+
+// Key name suffixes of a tls_cert() pair.
+const (
+	TLSCertSuffix = ".crt"
+	TLSKeySuffix  = ".key"
+)
+
 // BcryptConfig defines bcrypt hashing parameters.
 type BcryptConfig struct {
 	// FromKey is the key name to hash (must exist in same secret block)
@@ -190,16 +377,102 @@ type SecretBlock struct {
 	// Prune deletes keys in Vault that are not defined in config
 	Prune bool
 
-	// Enabled controls whether this secret block is processed (default: true)
+	// Force regenerates the block's generated values on every apply, as
+	// --force does for all blocks
+	Force bool
+
+	// NestedKeys writes keys containing "/" as nested objects
+	// (e.g. "db/password" becomes {"db": {"password": ...}})
+	NestedKeys bool
+
+	// IgnoreKeysFile is a URL to a newline-delimited list of keys that are
+	// managed externally: never pruned and never reported as unmanaged
+	IgnoreKeysFile string
+
+	// IgnoreKeys lists more externally managed keys, in the config itself
+	IgnoreKeys []string
+
+	// Enabled controls whether this secret block is processed
+	// (default: defaults.enabled, or true if that is not set either).
 	// When false, the block is skipped unless explicitly targeted via --target flag
 	Enabled *bool
 
 	// Content contains secret key-value pairs (moved from direct attributes in v1.x)
 	Content map[string]Value
+
+	// Metadata is written to the secret's KV v2 custom_metadata
+	// (owner, ticket, managed-by, ...)
+	Metadata map[string]string
+
+	// mountInherited is set when Mount came from defaults.mount, so
+	// SetDefaultMount knows which blocks follow it
+	mountInherited bool
+}
+
+// SetDefaultMount replaces defaults.mount, moving the blocks that inherited
+// it along. Blocks with an explicit mount keep theirs.
+func (c *Config) SetDefaultMount(mount string) {
+	c.Defaults.Mount = mount
+	for name, block := range c.Secrets {
+		if block.mountInherited {
+			block.Mount = mount
+			c.Secrets[name] = block
+		}
+	}
+}
+
+// DependsOn returns the key the value is computed from: the from key of a
+// bcrypt(), argon2() or pbkdf2() hash, or the private key of an ssh_keygen()
+// public key or a tls_cert() certificate. It returns "" for values resolved
+// on their own.
+func (v Value) DependsOn() string {
+	switch v.Type {
+	case ValueTypeBcrypt:
+		if v.Bcrypt != nil {
+			return v.Bcrypt.FromKey
+		}
+	case ValueTypeArgon2:
+		if v.Argon2 != nil {
+			return v.Argon2.FromKey
+		}
+	case ValueTypePbkdf2:
+		if v.Pbkdf2 != nil {
+			return v.Pbkdf2.FromKey
+		}
+	case ValueTypeSSHPublicKey:
+		if v.SSHKey != nil {
+			return v.SSHKey.FromKey
+		}
+	case ValueTypeTLSCert:
+		if v.TLSCert != nil {
+			return v.TLSCert.FromKey
+		}
+	}
+	return ""
+}
+
+// expireAfter returns the value's expire_after, looking through hash().
+func (v Value) expireAfter() time.Duration {
+	if v.Inner != nil {
+		return v.Inner.ExpireAfter
+	}
+	return v.ExpireAfter
+}
+
+// ExpireAfter returns the generate() expire_after of the block's content,
+// or zero if no value sets one. Parsing ensures all values agree.
+func (s *SecretBlock) ExpireAfter() time.Duration {
+	for _, v := range s.Content {
+		if d := v.expireAfter(); d > 0 {
+			return d
+		}
+	}
+	return 0
 }
 
 // IsEnabled returns true if this secret block should be processed.
-// Defaults to true if Enabled is not set.
+// Defaults to true if Enabled is not set. Blocks from a parsed config
+// already have defaults.enabled applied.
 func (s *SecretBlock) IsEnabled() bool {
 	if s.Enabled == nil {
 		return true
@@ -230,6 +503,49 @@ const (
 	ValueTypeBcrypt   ValueType = "bcrypt"
 	ValueTypeArgon2   ValueType = "argon2"
 	ValueTypePbkdf2   ValueType = "pbkdf2"
+	ValueTypeUUID     ValueType = "uuid"
+	ValueTypeHash     ValueType = "hash"
+	ValueTypeEnvAll   ValueType = "env_all"
+	ValueTypeMapFrom  ValueType = "map_from"
+
+	// ValueTypeSSHKey is the private key of an ssh_keygen() keypair and
+	// ValueTypeSSHPublicKey the public key derived from it.
+	ValueTypeSSHKey       ValueType = "ssh_key"
+	ValueTypeSSHPublicKey ValueType = "ssh_public_key"
+
+	// ValueTypeTLSKey is the private key of a tls_cert() pair and
+	// ValueTypeTLSCert the certificate issued for it.
+	ValueTypeTLSKey  ValueType = "tls_key"
+	ValueTypeTLSCert ValueType = "tls_cert"
+)
+
+// BinaryBase64 stores command() output that isn't valid UTF-8 base64-encoded.
+const BinaryBase64 = "base64"
+
+// JSON re-encodings of raw() content, set by its minify and pretty options.
+const (
+	JSONFormatMinify = "minify"
+	JSONFormatPretty = "pretty"
+)
+
+// Transform is an encoding step applied to a resolved value.
+type Transform string
+
+// Transform constants define the supported transforms.
+const (
+	TransformBase64Encode Transform = "base64encode"
+	TransformBase64Decode Transform = "base64decode"
+)
+
+// WriteType is the JSON type a json() or yaml() value is written to Vault as.
+type WriteType string
+
+// WriteType constants define the types accepted by the as option. Values
+// are written as strings unless a number or bool is requested.
+const (
+	WriteTypeString WriteType = "string"
+	WriteTypeNumber WriteType = "number"
+	WriteTypeBool   WriteType = "bool"
 )
 
 // Value represents a secret value which can be static, generated, fetched, or from a command.
@@ -240,27 +556,92 @@ type Value struct {
 	// Strategy overrides the default strategy for this value type
 	Strategy Strategy
 
+	// Pipe is an optional shell command the resolved value is piped through
+	Pipe string
+
+	// Transforms are applied in order to the resolved (and piped) value
+	Transforms []Transform
+
 	// Static holds the value for static types
 	Static string
 
 	// Generate holds the password policy for generated values
 	Generate *PasswordPolicy
 
+	// PolicyName references a named policy from defaults for generated values
+	PolicyName string
+
+	// Passphrase holds the passphrase policy when generate() uses mode = "passphrase"
+	Passphrase *PassphrasePolicy
+
+	// ExpireAfter is the KV v2 delete_version_after set on the secret when a
+	// generated value is written, so Vault deletes the version after it.
+	// It applies to the whole secret version, not just this key.
+	ExpireAfter time.Duration
+
 	// URL is the source URL for json/yaml/raw types
 	URL string
 
+	// MaxSize is the maximum content size in bytes for raw type (0 = default)
+	MaxSize int64
+
+	// JSONFormat re-encodes raw() content as JSON: JSONFormatMinify or
+	// JSONFormatPretty ("" = stored verbatim)
+	JSONFormat string
+
 	// Query is the jq/yq path for json/yaml types
 	Query string
 
+	// As is the JSON type the extracted value is written as for json/yaml
+	// types ("" = string). The document must hold a value of that type.
+	As WriteType
+
 	// VaultPath is the source path for vault type
 	VaultPath string
 
 	// VaultKey is the source key for vault type
 	VaultKey string
 
+	// VaultVersion is the KV v2 version read for vault type, 0 for the
+	// latest
+	VaultVersion int
+
 	// Command is the shell command for command type
 	Command string
 
+	// Timeout is the maximum run time of the command for command type
+	// (0 = the run's default, if any)
+	Timeout time.Duration
+
+	// Stdin is resolved first and written to the command's standard input
+	// for command type, keeping it off the command line
+	Stdin *Value
+
+	// Env holds extra environment variables for the command for command type
+	Env map[string]string
+
+	// NormalizeNewlines converts CRLF line endings in the output to LF for
+	// command type
+	NormalizeNewlines bool
+
+	// Binary is how output that isn't valid UTF-8 is stored for command
+	// type: "" keeps it as is, BinaryBase64 encodes it
+	Binary string
+
+	// Prefix is the environment variable prefix for env_all type. The value
+	// expands into one key per matching variable when the block is processed.
+	Prefix string
+
+	// Filter is the glob the keys of a map_from document must match. The
+	// value expands into one key per matching key when the block is processed.
+	Filter string
+
+	// SSHKey holds the keypair options for ssh_key and ssh_public_key types
+	SSHKey *SSHKeyConfig
+
+	// TLSCert holds the certificate options for tls_key and tls_cert types
+	TLSCert *TLSCertConfig
+
 	// Bcrypt holds the bcrypt hashing configuration
 	Bcrypt *BcryptConfig
 
@@ -269,4 +650,10 @@ type Value struct {
 
 	// Pbkdf2 holds the PBKDF2 hashing configuration
 	Pbkdf2 *Pbkdf2Config
+
+	// HashAlgorithm is the hash applied by hash(): bcrypt, argon2, or pbkdf2
+	HashAlgorithm ValueType
+
+	// Inner is the value hashed by hash()
+	Inner *Value
 }
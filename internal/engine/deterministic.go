@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// deterministicSalt separates the derived streams from any other use of
+// the seed, and versions the derivation.
+const deterministicSalt = "vsg dev-deterministic v1"
+
+// deterministicSeedKey is the context key of the --dev-deterministic seed.
+type deterministicSeedKey struct{}
+
+// valuePathKey is the context key of the path and key a value is resolved
+// for, which deterministic generation mixes into the seed.
+type valuePathKey struct{}
+
+// withDeterministicSeed returns ctx carrying seed, which makes generate()
+// derive values from it instead of generating them randomly. INSECURE:
+// anyone with the seed can recompute every such value. It is meant for
+// throwaway dev environments only.
+func withDeterministicSeed(ctx context.Context, seed string) context.Context {
+	if seed == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, deterministicSeedKey{}, seed)
+}
+
+// withValuePath returns ctx recording that values are resolved for key of
+// the secret at fullPath (mount/path).
+func withValuePath(ctx context.Context, fullPath, key string) context.Context {
+	if ctx.Value(deterministicSeedKey{}) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, valuePathKey{}, fullPath+"\x00"+key)
+}
+
+// deterministicRandom returns the stream a generate() value draws from in
+// deterministic mode: HKDF-SHA256 of the seed, with the value's path and
+// key as info, so every key gets its own stable stream. It returns nil
+// when ctx carries no seed.
+func deterministicRandom(ctx context.Context) io.Reader {
+	seed, ok := ctx.Value(deterministicSeedKey{}).(string)
+	if !ok {
+		return nil
+	}
+	path, _ := ctx.Value(valuePathKey{}).(string)
+	return hkdf.New(sha256.New, []byte(seed), []byte(deterministicSalt), []byte(path))
+}
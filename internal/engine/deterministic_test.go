@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
+)
+
+func TestResolver_ResolveGenerateDeterministic(t *testing.T) {
+	// Each run gets its own resolver, as separate vsg invocations would
+	resolve := func(seed, path, key string, val config.Value) string {
+		t.Helper()
+		resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+		ctx := withValuePath(withDeterministicSeed(context.Background(), seed), path, key)
+		result, err := resolver.Resolve(ctx, val, "", false, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Source != SourceGenerated {
+			t.Fatalf("Source = %s, want %s", result.Source, SourceGenerated)
+		}
+		return result.Value
+	}
+
+	password := config.Value{Type: config.ValueTypeGenerate, Generate: &config.PasswordPolicy{Length: 40, Digits: 8, Symbols: 4}}
+	passphrase := config.Value{Type: config.ValueTypeGenerate, Passphrase: &config.PassphrasePolicy{Words: 6, Separator: "-"}}
+
+	for name, val := range map[string]config.Value{"password": password, "passphrase": passphrase} {
+		t.Run(name, func(t *testing.T) {
+			first := resolve("dev-seed", "secret/app", "token", val)
+			if again := resolve("dev-seed", "secret/app", "token", val); again != first {
+				t.Errorf("same seed, path and key gave %q, then %q", first, again)
+			}
+			if other := resolve("dev-seed", "secret/app", "other", val); other == first {
+				t.Errorf("another key gave the same value %q", other)
+			}
+			if other := resolve("dev-seed", "secret/worker", "token", val); other == first {
+				t.Errorf("another path gave the same value %q", other)
+			}
+			if other := resolve("other-seed", "secret/app", "token", val); other == first {
+				t.Errorf("another seed gave the same value %q", other)
+			}
+
+			// Without a seed, values stay random
+			if resolve("", "secret/app", "token", val) == resolve("", "secret/app", "token", val) {
+				t.Error("expected random values without a seed")
+			}
+		})
+	}
+
+	// The derived password still follows its policy
+	value := resolve("dev-seed", "secret/app", "token", password)
+	if len(value) != 40 {
+		t.Errorf("length = %d, want 40", len(value))
+	}
+}
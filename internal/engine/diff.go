@@ -3,8 +3,12 @@ package engine
 import (
 	"encoding/json"
 	"fmt"
+	"path"
+	"slices"
 	"sort"
 	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
 // ChangeType represents the type of change.
@@ -21,22 +25,41 @@ const (
 
 // SecretChange represents a change to a single secret key.
 type SecretChange struct {
-	Key       string      `json:"key"`
-	Change    ChangeType  `json:"change"`
-	OldValue  string      `json:"-"` // Never expose in JSON
-	NewValue  string      `json:"-"` // Never expose in JSON
-	Source    ValueSource `json:"source,omitempty"`
-	OldMasked string      `json:"old_value,omitempty"`
-	NewMasked string      `json:"new_value,omitempty"`
+	Key       string      `json:"key" yaml:"key"`
+	Change    ChangeType  `json:"change" yaml:"change"`
+	OldValue  string      `json:"-" yaml:"-"` // Never expose in JSON or YAML
+	NewValue  string      `json:"-" yaml:"-"` // Never expose in JSON or YAML
+	Source    ValueSource `json:"source,omitempty" yaml:"source,omitempty"`
+	OldMasked string      `json:"old_value,omitempty" yaml:"old_value,omitempty"` // Set by ToJSON and ToYAML, in the diff's mask mode
+	NewMasked string      `json:"new_value,omitempty" yaml:"new_value,omitempty"`
+	Ignored   bool        `json:"ignored,omitempty" yaml:"ignored,omitempty"` // Unmanaged key listed in ignore_keys or the ignore file
 }
 
 // BlockDiff represents changes to a secret block.
 type BlockDiff struct {
-	Name    string         `json:"name"`
-	Mount   string         `json:"mount"`
-	Path    string         `json:"path"`
-	Prune   bool           `json:"prune,omitempty"`
-	Changes []SecretChange `json:"changes"`
+	Name         string         `json:"name" yaml:"name"`
+	Mount        string         `json:"mount" yaml:"mount"`
+	Path         string         `json:"path" yaml:"path"`
+	Prune        bool           `json:"prune,omitempty" yaml:"prune,omitempty"`
+	PruneSkipped bool           `json:"prune_skipped,omitempty" yaml:"prune_skipped,omitempty"` // Prune disabled because keys failed to resolve
+	Replace      bool           `json:"replace,omitempty" yaml:"replace,omitempty"`             // A strategy=replace key changed, so the secret is replaced
+	Changes      []SecretChange `json:"changes" yaml:"changes"`
+
+	// NextVersion is the KV v2 version that writing the block creates: the
+	// current version plus one. It's zero on KV v1 and when nothing changes.
+	NextVersion int `json:"next_version,omitempty" yaml:"next_version,omitempty"`
+
+	// Metadata is the custom metadata to write, set only when it differs
+	// from the metadata currently in Vault
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	// readVersion is the KV v2 version the plan was computed from; writes
+	// use it for check-and-set so a concurrent change isn't overwritten
+	readVersion int
+
+	// stringKeys are the keys stored in Vault as JSON strings, so typed
+	// values (json() and yaml() with as) still stored as strings are rewritten
+	stringKeys map[string]bool
 }
 
 // FullPath returns the complete Vault path as mount/path.
@@ -49,12 +72,22 @@ func (b *BlockDiff) FullPath() string {
 
 // Diff represents all changes across all blocks.
 type Diff struct {
-	Blocks []BlockDiff `json:"blocks"`
+	Blocks []BlockDiff `json:"blocks" yaml:"blocks"`
+
+	// AlwaysMask are glob patterns of keys whose values are shown as FullMask
+	AlwaysMask []string `json:"-" yaml:"-"`
+
+	// Mask is how values are masked when the diff is printed; empty means
+	// MaskPartial
+	Mask MaskMode `json:"-" yaml:"-"`
 }
 
 // HasChanges returns true if there are any changes to apply.
 func (d *Diff) HasChanges() bool {
 	for _, block := range d.Blocks {
+		if block.Metadata != nil {
+			return true
+		}
 		for _, change := range block.Changes {
 			if change.Change == ChangeAdd || change.Change == ChangeUpdate || change.Change == ChangeDelete {
 				return true
@@ -67,19 +100,30 @@ func (d *Diff) HasChanges() bool {
 // Summary returns a summary of changes.
 func (d *Diff) Summary() (adds, updates, deletes, unmanaged, unchanged int) {
 	for _, block := range d.Blocks {
-		for _, change := range block.Changes {
-			switch change.Change {
-			case ChangeAdd:
-				adds++
-			case ChangeUpdate:
-				updates++
-			case ChangeDelete:
-				deletes++
-			case ChangeUnmanaged:
-				unmanaged++
-			case ChangeNone:
-				unchanged++
-			}
+		a, u, del, um, uc := block.Summary()
+		adds += a
+		updates += u
+		deletes += del
+		unmanaged += um
+		unchanged += uc
+	}
+	return
+}
+
+// Summary returns a summary of the block's changes.
+func (b *BlockDiff) Summary() (adds, updates, deletes, unmanaged, unchanged int) {
+	for _, change := range b.Changes {
+		switch change.Change {
+		case ChangeAdd:
+			adds++
+		case ChangeUpdate:
+			updates++
+		case ChangeDelete:
+			deletes++
+		case ChangeUnmanaged:
+			unmanaged++
+		case ChangeNone:
+			unchanged++
 		}
 	}
 	return
@@ -87,7 +131,8 @@ func (d *Diff) Summary() (adds, updates, deletes, unmanaged, unchanged int) {
 
 // ComputeDiff computes the diff between current and desired state.
 // If prune is true, unmanaged keys are marked for deletion instead of warning.
-func ComputeDiff(current, desired map[string]string, sources map[string]ValueSource, prune bool) []SecretChange {
+// Unmanaged keys in ignored are always kept and marked as ignored.
+func ComputeDiff(current, desired map[string]string, sources map[string]ValueSource, prune bool, ignored map[string]bool) []SecretChange {
 	var changes []SecretChange
 	seen := make(map[string]bool)
 
@@ -99,21 +144,18 @@ func ComputeDiff(current, desired map[string]string, sources map[string]ValueSou
 		oldValue, exists := current[key]
 		if !exists {
 			changes = append(changes, SecretChange{
-				Key:       key,
-				Change:    ChangeAdd,
-				NewValue:  newValue,
-				Source:    source,
-				NewMasked: maskValue(newValue),
+				Key:      key,
+				Change:   ChangeAdd,
+				NewValue: newValue,
+				Source:   source,
 			})
 		} else if oldValue != newValue {
 			changes = append(changes, SecretChange{
-				Key:       key,
-				Change:    ChangeUpdate,
-				OldValue:  oldValue,
-				NewValue:  newValue,
-				Source:    source,
-				OldMasked: maskValue(oldValue),
-				NewMasked: maskValue(newValue),
+				Key:      key,
+				Change:   ChangeUpdate,
+				OldValue: oldValue,
+				NewValue: newValue,
+				Source:   source,
 			})
 		} else {
 			changes = append(changes, SecretChange{
@@ -130,14 +172,14 @@ func ComputeDiff(current, desired map[string]string, sources map[string]ValueSou
 	for key, oldValue := range current {
 		if !seen[key] {
 			changeType := ChangeUnmanaged
-			if prune {
+			if prune && !ignored[key] {
 				changeType = ChangeDelete
 			}
 			changes = append(changes, SecretChange{
-				Key:       key,
-				Change:    changeType,
-				OldValue:  oldValue,
-				OldMasked: maskValue(oldValue),
+				Key:      key,
+				Change:   changeType,
+				OldValue: oldValue,
+				Ignored:  ignored[key],
 			})
 		}
 	}
@@ -150,16 +192,87 @@ func ComputeDiff(current, desired map[string]string, sources map[string]ValueSou
 	return changes
 }
 
-// maskValue masks a secret value for display.
-func maskValue(value string) string {
+// FullMask is shown instead of the value of keys matching an always_mask pattern.
+const FullMask = "********"
+
+// AlwaysMasked reports whether key matches one of the always_mask glob patterns.
+func AlwaysMasked(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// DisplayValue returns value as it should be shown for key: FullMask if the
+// key matches an always_mask pattern, otherwise as is with showValues and
+// masked by MaskValue without.
+func DisplayValue(key, value string, showValues bool, alwaysMask []string) string {
+	if AlwaysMasked(alwaysMask, key) {
+		return FullMask
+	}
+	if showValues {
+		return value
+	}
+	return MaskValue(value, MaskPartial)
+}
+
+// mask returns the value to show for key, masked in the diff's mode.
+func (d *Diff) mask(key, value string) string {
+	if AlwaysMasked(d.AlwaysMask, key) {
+		return FullMask
+	}
+	return MaskValue(value, d.Mask)
+}
+
+// MaskMode is how MaskValue hides a secret value.
+type MaskMode string
+
+// MaskMode constants define the supported masking modes.
+const (
+	MaskPartial    MaskMode = "partial"     // First and last two characters, e.g. pa*******23
+	MaskFull       MaskMode = "full"        // FullMask, whatever the value
+	MaskLengthOnly MaskMode = "length-only" // Only the length, e.g. ***** (11 chars)
+)
+
+// ParseMaskMode parses a --mask flag value.
+func ParseMaskMode(s string) (MaskMode, error) {
+	switch mode := MaskMode(s); mode {
+	case MaskPartial, MaskFull, MaskLengthOnly:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown mask mode %q (use 'partial', 'full' or 'length-only')", s)
+	}
+}
+
+// MaskValue masks a secret value for display. MaskPartial, the default for
+// an empty mode, keeps the first and last two characters of values longer
+// than four characters.
+func MaskValue(value string, mode MaskMode) string {
+	switch mode {
+	case MaskFull:
+		return FullMask
+	case MaskLengthOnly:
+		return fmt.Sprintf("***** (%d chars)", len(value))
+	}
 	if len(value) <= 4 {
 		return strings.Repeat("*", len(value))
 	}
 	return value[:2] + strings.Repeat("*", len(value)-4) + value[len(value)-2:]
 }
 
+// FormatOptions controls what FormatDiff shows.
+type FormatOptions struct {
+	// ShowUnchanged lists unchanged and ignored keys along with the changes
+	ShowUnchanged bool
+
+	// NoSummary leaves out the trailing summary line
+	NoSummary bool
+}
+
 // FormatDiff formats the diff for human-readable output.
-func FormatDiff(diff *Diff) string {
+func FormatDiff(diff *Diff, opts FormatOptions) string {
 	var sb strings.Builder
 
 	for _, block := range diff.Blocks {
@@ -167,70 +280,163 @@ func FormatDiff(diff *Diff) string {
 		if block.Prune {
 			header += " [prune]"
 		}
+		if block.PruneSkipped {
+			header += " [prune skipped: errors]"
+		}
+		if block.Replace {
+			header += " [replace]"
+		}
+		if block.NextVersion > 0 {
+			header += fmt.Sprintf(" [version %d]", block.NextVersion)
+		}
 		sb.WriteString(header + " ===\n")
 
 		for _, change := range block.Changes {
 			switch change.Change {
 			case ChangeAdd:
-				sb.WriteString(fmt.Sprintf("  + %s = %s [%s]\n", change.Key, change.NewMasked, change.Source))
+				sb.WriteString(fmt.Sprintf("  + %s = %s [%s]\n", change.Key, diff.mask(change.Key, change.NewValue), change.Source))
 			case ChangeUpdate:
-				sb.WriteString(fmt.Sprintf("  ~ %s: %s -> %s [%s]\n", change.Key, change.OldMasked, change.NewMasked, change.Source))
+				sb.WriteString(fmt.Sprintf("  ~ %s: %s -> %s [%s]\n", change.Key, diff.mask(change.Key, change.OldValue), diff.mask(change.Key, change.NewValue), change.Source))
 			case ChangeDelete:
-				sb.WriteString(fmt.Sprintf("  - %s = %s [pruned]\n", change.Key, change.OldMasked))
+				sb.WriteString(fmt.Sprintf("  - %s = %s [pruned]\n", change.Key, diff.mask(change.Key, change.OldValue)))
 			case ChangeUnmanaged:
-				sb.WriteString(fmt.Sprintf("  ? %s = %s [unmanaged]\n", change.Key, change.OldMasked))
+				if change.Ignored {
+					if opts.ShowUnchanged {
+						sb.WriteString(fmt.Sprintf("    %s = %s [ignored]\n", change.Key, diff.mask(change.Key, change.OldValue)))
+					}
+					continue
+				}
+				sb.WriteString(fmt.Sprintf("  ? %s = %s [unmanaged]\n", change.Key, diff.mask(change.Key, change.OldValue)))
 			case ChangeNone:
-				// Don't show unchanged in normal output
+				if opts.ShowUnchanged {
+					sb.WriteString(fmt.Sprintf("    %s = %s [%s]\n", change.Key, diff.mask(change.Key, change.OldValue), change.Source))
+				}
 			}
 		}
+
+		if block.Metadata != nil {
+			sb.WriteString(fmt.Sprintf("  ~ custom_metadata: %s\n", formatMetadata(block.Metadata)))
+		}
 	}
 
-	adds, updates, deletes, unmanaged, unchanged := diff.Summary()
-	sb.WriteString(fmt.Sprintf("\nSummary: %d to add, %d to update, %d to delete, %d unmanaged, %d unchanged\n",
-		adds, updates, deletes, unmanaged, unchanged))
+	if !opts.NoSummary {
+		adds, updates, deletes, unmanaged, unchanged := diff.Summary()
+		sb.WriteString(fmt.Sprintf("\nSummary: %d to add, %d to update, %d to delete, %d unmanaged, %d unchanged\n",
+			adds, updates, deletes, unmanaged, unchanged))
+	}
 
 	return sb.String()
 }
 
-// FormatDiffVerbose formats the diff with unchanged items shown.
-func FormatDiffVerbose(diff *Diff) string {
+// FormatDiffCompact formats the diff as one line per block with its counts
+// of added, updated and deleted keys, such as "prod-app: +2 ~1 -0", for
+// scanning many blocks at once. The summary line follows unless
+// opts.NoSummary is set.
+func FormatDiffCompact(diff *Diff, opts FormatOptions) string {
 	var sb strings.Builder
 
 	for _, block := range diff.Blocks {
-		header := fmt.Sprintf("\n=== %s (%s)", block.Name, block.FullPath())
-		if block.Prune {
-			header += " [prune]"
-		}
-		sb.WriteString(header + " ===\n")
+		adds, updates, deletes, _, _ := block.Summary()
+		sb.WriteString(fmt.Sprintf("%s: +%d ~%d -%d\n", block.Name, adds, updates, deletes))
+	}
+
+	if !opts.NoSummary {
+		adds, updates, deletes, unmanaged, unchanged := diff.Summary()
+		sb.WriteString(fmt.Sprintf("\nSummary: %d to add, %d to update, %d to delete, %d unmanaged, %d unchanged\n",
+			adds, updates, deletes, unmanaged, unchanged))
+	}
+
+	return sb.String()
+}
+
+// FormatDiffPatch formats the diff as a unified diff for code review: a
+// "--- a/" and "+++ b/" header per secret path, then "-" lines with the old
+// and "+" lines with the new masked values. Only added, updated and
+// deleted keys are listed; blocks without them are left out.
+func FormatDiffPatch(diff *Diff) string {
+	var sb strings.Builder
 
+	for _, block := range diff.Blocks {
+		var lines []string
 		for _, change := range block.Changes {
 			switch change.Change {
 			case ChangeAdd:
-				sb.WriteString(fmt.Sprintf("  + %s = %s [%s]\n", change.Key, change.NewMasked, change.Source))
+				lines = append(lines, fmt.Sprintf("+%s = %s", change.Key, diff.mask(change.Key, change.NewValue)))
 			case ChangeUpdate:
-				sb.WriteString(fmt.Sprintf("  ~ %s: %s -> %s [%s]\n", change.Key, change.OldMasked, change.NewMasked, change.Source))
+				lines = append(lines,
+					fmt.Sprintf("-%s = %s", change.Key, diff.mask(change.Key, change.OldValue)),
+					fmt.Sprintf("+%s = %s", change.Key, diff.mask(change.Key, change.NewValue)))
 			case ChangeDelete:
-				sb.WriteString(fmt.Sprintf("  - %s = %s [pruned]\n", change.Key, change.OldMasked))
-			case ChangeUnmanaged:
-				sb.WriteString(fmt.Sprintf("  ? %s = %s [unmanaged]\n", change.Key, change.OldMasked))
-			case ChangeNone:
-				sb.WriteString(fmt.Sprintf("    %s = %s [%s]\n", change.Key, change.OldMasked, change.Source))
+				lines = append(lines, fmt.Sprintf("-%s = %s", change.Key, diff.mask(change.Key, change.OldValue)))
 			}
 		}
-	}
+		if len(lines) == 0 {
+			continue
+		}
 
-	adds, updates, deletes, unmanaged, unchanged := diff.Summary()
-	sb.WriteString(fmt.Sprintf("\nSummary: %d to add, %d to update, %d to delete, %d unmanaged, %d unchanged\n",
-		adds, updates, deletes, unmanaged, unchanged))
+		path := block.FullPath()
+		sb.WriteString(fmt.Sprintf("--- a/%s\n+++ b/%s\n", path, path))
+		for _, line := range lines {
+			sb.WriteString(line + "\n")
+		}
+	}
 
 	return sb.String()
 }
 
+// formatMetadata renders custom metadata as sorted key=value pairs.
+func formatMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + metadata[k]
+	}
+	return strings.Join(pairs, ", ")
+}
+
 // ToJSON converts the diff to JSON format.
 func (d *Diff) ToJSON() (string, error) {
-	data, err := json.MarshalIndent(d, "", "  ")
+	data, err := json.MarshalIndent(d.masked(), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ToYAML converts the diff to YAML format, with the same fields and
+// masking as ToJSON.
+func (d *Diff) ToYAML() (string, error) {
+	data, err := yaml.Marshal(d.masked())
 	if err != nil {
 		return "", err
 	}
 	return string(data), nil
 }
+
+// masked returns a copy of the diff with the old and new values of added,
+// updated, deleted and unmanaged keys masked, for the structured output
+// formats.
+func (d *Diff) masked() Diff {
+	masked := Diff{Blocks: make([]BlockDiff, len(d.Blocks))}
+	for i, block := range d.Blocks {
+		block.Changes = slices.Clone(block.Changes)
+		for j, change := range block.Changes {
+			switch change.Change {
+			case ChangeAdd:
+				block.Changes[j].NewMasked = d.mask(change.Key, change.NewValue)
+			case ChangeUpdate:
+				block.Changes[j].OldMasked = d.mask(change.Key, change.OldValue)
+				block.Changes[j].NewMasked = d.mask(change.Key, change.NewValue)
+			case ChangeDelete, ChangeUnmanaged:
+				block.Changes[j].OldMasked = d.mask(change.Key, change.OldValue)
+			}
+		}
+		masked.Blocks[i] = block
+	}
+	return masked
+}
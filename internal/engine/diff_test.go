@@ -1,7 +1,11 @@
 package engine
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestComputeDiff_AddNew(t *testing.T) {
@@ -15,7 +19,7 @@ func TestComputeDiff_AddNew(t *testing.T) {
 		"key2": SourceGenerated,
 	}
 
-	changes := ComputeDiff(current, desired, sources, false)
+	changes := ComputeDiff(current, desired, sources, false, nil)
 
 	if len(changes) != 2 {
 		t.Fatalf("expected 2 changes, got %d", len(changes))
@@ -39,7 +43,7 @@ func TestComputeDiff_Update(t *testing.T) {
 		"key1": SourceJSON,
 	}
 
-	changes := ComputeDiff(current, desired, sources, false)
+	changes := ComputeDiff(current, desired, sources, false, nil)
 
 	if len(changes) != 1 {
 		t.Fatalf("expected 1 change, got %d", len(changes))
@@ -68,7 +72,7 @@ func TestComputeDiff_Unmanaged(t *testing.T) {
 		"key1": SourceStatic,
 	}
 
-	changes := ComputeDiff(current, desired, sources, false)
+	changes := ComputeDiff(current, desired, sources, false, nil)
 
 	if len(changes) != 2 {
 		t.Fatalf("expected 2 changes, got %d", len(changes))
@@ -108,7 +112,7 @@ func TestComputeDiff_Prune(t *testing.T) {
 	}
 
 	// With prune=true, unmanaged keys become deletes
-	changes := ComputeDiff(current, desired, sources, true)
+	changes := ComputeDiff(current, desired, sources, true, nil)
 
 	if len(changes) != 2 {
 		t.Fatalf("expected 2 changes, got %d", len(changes))
@@ -135,6 +139,40 @@ func TestComputeDiff_Prune(t *testing.T) {
 	}
 }
 
+func TestComputeDiff_PruneIgnored(t *testing.T) {
+	current := map[string]string{
+		"key1":     "value1",
+		"external": "managed-elsewhere",
+		"stale":    "old",
+	}
+	desired := map[string]string{
+		"key1": "value1",
+	}
+	sources := map[string]ValueSource{
+		"key1": SourceStatic,
+	}
+	ignored := map[string]bool{"external": true}
+
+	changes := ComputeDiff(current, desired, sources, true, ignored)
+
+	byKey := make(map[string]SecretChange)
+	for _, change := range changes {
+		byKey[change.Key] = change
+	}
+
+	if c := byKey["external"]; c.Change != ChangeUnmanaged || !c.Ignored {
+		t.Errorf("expected external to be kept as ignored, got %s (ignored=%v)", c.Change, c.Ignored)
+	}
+	if c := byKey["stale"]; c.Change != ChangeDelete || c.Ignored {
+		t.Errorf("expected stale to be pruned, got %s (ignored=%v)", c.Change, c.Ignored)
+	}
+
+	out := FormatDiff(&Diff{Blocks: []BlockDiff{{Name: "app", Changes: changes}}}, FormatOptions{})
+	if strings.Contains(out, "external") {
+		t.Errorf("expected ignored key to be hidden from diff output:\n%s", out)
+	}
+}
+
 func TestComputeDiff_NoChange(t *testing.T) {
 	current := map[string]string{
 		"key1": "value1",
@@ -146,7 +184,7 @@ func TestComputeDiff_NoChange(t *testing.T) {
 		"key1": SourceStatic,
 	}
 
-	changes := ComputeDiff(current, desired, sources, false)
+	changes := ComputeDiff(current, desired, sources, false, nil)
 
 	if len(changes) != 1 {
 		t.Fatalf("expected 1 change, got %d", len(changes))
@@ -264,27 +302,78 @@ func TestDiff_Summary(t *testing.T) {
 func TestMaskValue(t *testing.T) {
 	tests := []struct {
 		value    string
+		mode     MaskMode
 		expected string
 	}{
-		{"a", "*"},
-		{"ab", "**"},
-		{"abc", "***"},
-		{"abcd", "****"},
-		{"abcde", "ab*de"},
-		{"password123", "pa*******23"}, // 11 chars: 2 + 7 stars + 2
-		{"secret", "se**et"},           // 6 chars: 2 + 2 stars + 2
+		{"a", MaskPartial, "*"},
+		{"ab", MaskPartial, "**"},
+		{"abc", MaskPartial, "***"},
+		{"abcd", MaskPartial, "****"},
+		{"abcde", MaskPartial, "ab*de"},
+		{"password123", MaskPartial, "pa*******23"}, // 11 chars: 2 + 7 stars + 2
+		{"secret", MaskPartial, "se**et"},           // 6 chars: 2 + 2 stars + 2
+		{"secret", "", "se**et"},                    // partial is the default
+		{"ab", MaskFull, FullMask},
+		{"password123", MaskFull, FullMask},
+		{"password1234", MaskLengthOnly, "***** (12 chars)"},
+		{"", MaskLengthOnly, "***** (0 chars)"},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.value, func(t *testing.T) {
-			result := maskValue(tt.value)
+		t.Run(fmt.Sprintf("%s/%s", tt.value, tt.mode), func(t *testing.T) {
+			result := MaskValue(tt.value, tt.mode)
 			if result != tt.expected {
-				t.Errorf("maskValue(%q) = %q, want %q", tt.value, result, tt.expected)
+				t.Errorf("MaskValue(%q, %q) = %q, want %q", tt.value, tt.mode, result, tt.expected)
 			}
 		})
 	}
 }
 
+func TestParseMaskMode(t *testing.T) {
+	for _, s := range []string{"partial", "full", "length-only"} {
+		if mode, err := ParseMaskMode(s); err != nil || string(mode) != s {
+			t.Errorf("ParseMaskMode(%q) = %q, %v", s, mode, err)
+		}
+	}
+	if _, err := ParseMaskMode("none"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestFormatDiff_MaskMode(t *testing.T) {
+	diff := &Diff{
+		Mask:       MaskLengthOnly,
+		AlwaysMask: []string{"root_*"},
+		Blocks: []BlockDiff{
+			{
+				Name: "main",
+				Path: "kv/prod",
+				Changes: []SecretChange{
+					{Key: "api_key", Change: ChangeUpdate, OldValue: "oldsecret", NewValue: "password1234", Source: SourceStatic},
+					{Key: "root_token", Change: ChangeAdd, NewValue: "hvs.abc", Source: SourceStatic},
+				},
+			},
+		},
+	}
+
+	output := FormatDiff(diff, FormatOptions{})
+	if !strings.Contains(output, "~ api_key: ***** (9 chars) -> ***** (12 chars)") {
+		t.Errorf("expected lengths only:\n%s", output)
+	}
+	if !strings.Contains(output, "+ root_token = "+FullMask) {
+		t.Errorf("expected always_mask to win over the mode:\n%s", output)
+	}
+
+	diff.Mask = MaskFull
+	out, err := diff.ToJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := strings.Count(out, `": "`+FullMask+`"`); n != 3 {
+		t.Errorf("expected 3 fully masked values, got %d:\n%s", n, out)
+	}
+}
+
 func TestFormatDiff(t *testing.T) {
 	diff := &Diff{
 		Blocks: []BlockDiff{
@@ -292,15 +381,15 @@ func TestFormatDiff(t *testing.T) {
 				Name: "main",
 				Path: "kv/prod",
 				Changes: []SecretChange{
-					{Key: "db/password", Change: ChangeAdd, NewMasked: "se****23", Source: SourceGenerated},
-					{Key: "db/host", Change: ChangeUpdate, OldMasked: "ol****ue", NewMasked: "ne****ue", Source: SourceJSON},
-					{Key: "old_key", Change: ChangeDelete, OldMasked: "de****ed"},
+					{Key: "db/password", Change: ChangeAdd, NewValue: "secret23", Source: SourceGenerated},
+					{Key: "db/host", Change: ChangeUpdate, OldValue: "oldvalue", NewValue: "newvalue", Source: SourceJSON},
+					{Key: "old_key", Change: ChangeDelete, OldValue: "defeated"},
 				},
 			},
 		},
 	}
 
-	output := FormatDiff(diff)
+	output := FormatDiff(diff, FormatOptions{})
 
 	if output == "" {
 		t.Error("expected non-empty output")
@@ -331,7 +420,7 @@ func TestDiff_ToJSON(t *testing.T) {
 				Name: "test",
 				Path: "kv/test",
 				Changes: []SecretChange{
-					{Key: "key1", Change: ChangeAdd, Source: SourceStatic, NewMasked: "va**e1"},
+					{Key: "key1", Change: ChangeAdd, Source: SourceStatic, NewValue: "value1"},
 				},
 			},
 		},
@@ -352,6 +441,122 @@ func TestDiff_ToJSON(t *testing.T) {
 	}
 }
 
+func TestDiff_ToYAML(t *testing.T) {
+	diff := &Diff{
+		Blocks: []BlockDiff{
+			{
+				Name:  "test",
+				Mount: "kv",
+				Path:  "test",
+				Changes: []SecretChange{
+					{Key: "key1", Change: ChangeUpdate, Source: SourceStatic, OldValue: "oldsecret", NewValue: "newsecret"},
+					{Key: "root_token", Change: ChangeAdd, Source: SourceStatic, NewValue: "hvs.abc"},
+				},
+			},
+		},
+		AlwaysMask: []string{"root_*"},
+	}
+
+	out, err := diff.ToYAML()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var parsed Diff
+	if err := yaml.Unmarshal([]byte(out), &parsed); err != nil {
+		t.Fatalf("output is not valid YAML: %v\n%s", err, out)
+	}
+
+	if len(parsed.Blocks) != 1 || len(parsed.Blocks[0].Changes) != 2 {
+		t.Fatalf("unexpected blocks: %+v", parsed.Blocks)
+	}
+	block := parsed.Blocks[0]
+	if block.Name != "test" || block.Mount != "kv" || block.Path != "test" {
+		t.Errorf("unexpected block: %+v", block)
+	}
+
+	key1 := block.Changes[0]
+	if key1.Change != ChangeUpdate || key1.OldMasked != "ol*****et" || key1.NewMasked != "ne*****et" {
+		t.Errorf("unexpected key1 change: %+v", key1)
+	}
+	if block.Changes[1].NewMasked != FullMask {
+		t.Errorf("root_token new_value = %q, want %q", block.Changes[1].NewMasked, FullMask)
+	}
+
+	for _, raw := range []string{"oldsecret", "newsecret", "hvs.abc"} {
+		if strings.Contains(out, raw) {
+			t.Errorf("YAML output contains raw value %q:\n%s", raw, out)
+		}
+	}
+}
+
+func TestDisplayValue(t *testing.T) {
+	alwaysMask := []string{"*_private_key", "root_*"}
+
+	tests := []struct {
+		key        string
+		value      string
+		showValues bool
+		expected   string
+	}{
+		{"tls_private_key", "-----BEGIN KEY-----", true, FullMask},
+		{"tls_private_key", "-----BEGIN KEY-----", false, FullMask},
+		{"root_token", "hvs.abc", true, FullMask},
+		{"db_password", "hunter22", true, "hunter22"},
+		{"db_password", "hunter22", false, "hu****22"},
+		{"private_key_id", "abc123", true, "abc123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/show=%v", tt.key, tt.showValues), func(t *testing.T) {
+			if got := DisplayValue(tt.key, tt.value, tt.showValues, alwaysMask); got != tt.expected {
+				t.Errorf("DisplayValue(%q) = %q, want %q", tt.key, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatDiff_AlwaysMask(t *testing.T) {
+	diff := &Diff{
+		AlwaysMask: []string{"*_private_key"},
+		Blocks: []BlockDiff{
+			{
+				Name: "main",
+				Path: "kv/prod",
+				Changes: []SecretChange{
+					{Key: "ssh_private_key", Change: ChangeUpdate, OldValue: "--priv--", NewValue: "--priv--", Source: SourceRaw},
+					{Key: "db_host", Change: ChangeAdd, NewValue: "db.local", Source: SourceJSON},
+				},
+			},
+		},
+	}
+
+	for name, output := range map[string]string{
+		"text":    FormatDiff(diff, FormatOptions{}),
+		"verbose": FormatDiff(diff, FormatOptions{ShowUnchanged: true}),
+	} {
+		if !strings.Contains(output, "~ ssh_private_key: "+FullMask+" -> "+FullMask) {
+			t.Errorf("%s: expected ssh_private_key to be fully masked:\n%s", name, output)
+		}
+		if !strings.Contains(output, "+ db_host = db****al") {
+			t.Errorf("%s: expected db_host to keep its partial mask:\n%s", name, output)
+		}
+	}
+
+	out, err := diff.ToJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(out, "--****--") || !strings.Contains(out, `"new_value": "db****al"`) {
+		t.Errorf("unexpected JSON masking:\n%s", out)
+	}
+
+	// ToJSON must not modify the diff itself
+	if diff.Blocks[0].Changes[0].NewMasked != "" {
+		t.Error("ToJSON modified the diff")
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsHelper(s, substr))
 }
@@ -364,3 +569,141 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestFormatDiff_Options(t *testing.T) {
+	diff := &Diff{
+		Blocks: []BlockDiff{
+			{
+				Name: "main",
+				Path: "kv/prod",
+				Changes: []SecretChange{
+					{Key: "api_key", Change: ChangeAdd, NewValue: "new-key1", Source: SourceGenerated},
+					{Key: "db_host", Change: ChangeNone, OldValue: "db.local", NewValue: "db.local", Source: SourceJSON},
+					{Key: "legacy", Change: ChangeUnmanaged, OldValue: "legacy01"},
+					{Key: "owner", Change: ChangeUnmanaged, OldValue: "platform", Ignored: true},
+				},
+			},
+		},
+	}
+
+	const (
+		added     = "  + api_key = ne****y1 [generated]\n"
+		unmanaged = "  ? legacy = le****01 [unmanaged]\n"
+		unchanged = "    db_host = db****al [json]\n"
+		ignored   = "    owner = pl****rm [ignored]\n"
+		summary   = "\nSummary: 1 to add, 0 to update, 0 to delete, 2 unmanaged, 1 unchanged\n"
+	)
+
+	tests := []struct {
+		name    string
+		opts    FormatOptions
+		want    []string
+		notWant []string
+	}{
+		{"default", FormatOptions{}, []string{added, unmanaged, summary}, []string{unchanged, ignored}},
+		{"show unchanged", FormatOptions{ShowUnchanged: true}, []string{added, unmanaged, unchanged, ignored, summary}, nil},
+		{"no summary", FormatOptions{NoSummary: true}, []string{added, unmanaged}, []string{unchanged, ignored, "Summary:"}},
+		{"show unchanged without summary", FormatOptions{ShowUnchanged: true, NoSummary: true}, []string{added, unmanaged, unchanged, ignored}, []string{"Summary:"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := FormatDiff(diff, tt.opts)
+			for _, s := range tt.want {
+				if !strings.Contains(output, s) {
+					t.Errorf("expected output to contain %q:\n%s", s, output)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(output, s) {
+					t.Errorf("expected output not to contain %q:\n%s", s, output)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatDiffCompact(t *testing.T) {
+	diff := &Diff{
+		Blocks: []BlockDiff{
+			{
+				Name: "prod-app",
+				Changes: []SecretChange{
+					{Key: "api_key", Change: ChangeAdd, NewValue: "new-key1"},
+					{Key: "db_pass", Change: ChangeAdd, NewValue: "new-pass"},
+					{Key: "db_host", Change: ChangeUpdate, OldValue: "old-host", NewValue: "new-host"},
+					{Key: "region", Change: ChangeNone, OldValue: "eu-west-1", NewValue: "eu-west-1"},
+				},
+			},
+			{
+				Name: "prod-db",
+				Changes: []SecretChange{
+					{Key: "legacy", Change: ChangeDelete, OldValue: "legacy01"},
+					{Key: "owner", Change: ChangeUnmanaged, OldValue: "platform"},
+				},
+			},
+			{Name: "prod-empty"},
+		},
+	}
+
+	expected := "prod-app: +2 ~1 -0\n" +
+		"prod-db: +0 ~0 -1\n" +
+		"prod-empty: +0 ~0 -0\n"
+
+	if got := FormatDiffCompact(diff, FormatOptions{NoSummary: true}); got != expected {
+		t.Errorf("FormatDiffCompact() =\n%s\nwant:\n%s", got, expected)
+	}
+
+	got := FormatDiffCompact(diff, FormatOptions{})
+	if !strings.HasPrefix(got, expected) || !strings.HasSuffix(got, "\nSummary: 2 to add, 1 to update, 1 to delete, 1 unmanaged, 1 unchanged\n") {
+		t.Errorf("unexpected output with summary:\n%s", got)
+	}
+	if strings.Contains(got, "new-key1") || strings.Contains(got, "api_key") {
+		t.Errorf("expected no per-key detail:\n%s", got)
+	}
+}
+
+func TestFormatDiffPatch(t *testing.T) {
+	diff := &Diff{
+		AlwaysMask: []string{"*_private_key"},
+		Blocks: []BlockDiff{
+			{
+				Name:  "main",
+				Mount: "kv",
+				Path:  "prod",
+				Changes: []SecretChange{
+					{Key: "db/password", Change: ChangeAdd, NewValue: "secret23", Source: SourceGenerated},
+					{Key: "db/host", Change: ChangeUpdate, OldValue: "oldvalue", NewValue: "newvalue", Source: SourceJSON},
+					{Key: "old_key", Change: ChangeDelete, OldValue: "defeated"},
+					{Key: "ssh_private_key", Change: ChangeAdd, NewValue: "--priv--", Source: SourceRaw},
+					{Key: "region", Change: ChangeNone, OldValue: "eu-west-1", NewValue: "eu-west-1"},
+					{Key: "legacy", Change: ChangeUnmanaged, OldValue: "legacy01"},
+				},
+			},
+			{
+				Name:  "unchanged",
+				Mount: "kv",
+				Path:  "dev",
+				Changes: []SecretChange{
+					{Key: "region", Change: ChangeNone, OldValue: "eu-west-1", NewValue: "eu-west-1"},
+				},
+			},
+		},
+	}
+
+	expected := "--- a/kv/prod\n" +
+		"+++ b/kv/prod\n" +
+		"+db/password = se****23\n" +
+		"-db/host = ol****ue\n" +
+		"+db/host = ne****ue\n" +
+		"-old_key = de****ed\n" +
+		"+ssh_private_key = " + FullMask + "\n"
+
+	if got := FormatDiffPatch(diff); got != expected {
+		t.Errorf("FormatDiffPatch() =\n%s\nwant:\n%s", got, expected)
+	}
+
+	if got := FormatDiffPatch(&Diff{}); got != "" {
+		t.Errorf("expected no output for an empty diff, got %q", got)
+	}
+}
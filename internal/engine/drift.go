@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DriftStatus classifies a block in a drift report.
+type DriftStatus string
+
+// DriftStatus constants, from the most to the least severe. A block gets
+// the first that applies.
+const (
+	DriftFailed    DriftStatus = "failed"    // The block couldn't be fully planned
+	DriftPending   DriftStatus = "pending"   // Keys or metadata to write
+	DriftUnmanaged DriftStatus = "unmanaged" // Keys in Vault the config doesn't manage
+	DriftInSync    DriftStatus = "in_sync"
+)
+
+// BlockDrift is one block of a drift report.
+type BlockDrift struct {
+	Name   string      `json:"name"`
+	Path   string      `json:"path"`
+	Status DriftStatus `json:"status"`
+
+	// Pending is the number of keys to add, update or delete
+	Pending int `json:"pending,omitempty"`
+
+	// Metadata is set when the custom metadata differs from the config
+	Metadata bool `json:"metadata,omitempty"`
+
+	// Unmanaged lists the keys in Vault that the config doesn't manage,
+	// without those ignored on purpose
+	Unmanaged []string `json:"unmanaged,omitempty"`
+
+	// Errors are the block's errors, without the block name
+	Errors []string `json:"errors,omitempty"`
+}
+
+// DriftReport summarizes a plan at the block level for monitoring: which
+// blocks have changes pending, which hold unmanaged keys, and which failed.
+// It carries no values, masked or not.
+type DriftReport struct {
+	Blocks []BlockDrift `json:"blocks"`
+}
+
+// NewDriftReport builds the drift report of a plan's result, with the
+// blocks in the diff's order.
+func NewDriftReport(result *Result) *DriftReport {
+	errors := make(map[string][]string)
+	for _, e := range result.Errors {
+		blocks := e.Blocks()
+		msg := e.Error()
+		// An error of several blocks keeps their names
+		if len(blocks) == 1 {
+			msg = strings.TrimPrefix(msg, e.Block+": ")
+			msg = strings.TrimPrefix(msg, e.Block+"/")
+		}
+		for _, name := range blocks {
+			errors[name] = append(errors[name], msg)
+		}
+	}
+
+	report := &DriftReport{Blocks: make([]BlockDrift, 0, len(result.Diff.Blocks))}
+	for _, block := range result.Diff.Blocks {
+		drift := BlockDrift{
+			Name:     block.Name,
+			Path:     block.FullPath(),
+			Metadata: block.Metadata != nil,
+			Errors:   errors[block.Name],
+		}
+		for _, change := range block.Changes {
+			switch change.Change {
+			case ChangeAdd, ChangeUpdate, ChangeDelete:
+				drift.Pending++
+			case ChangeUnmanaged:
+				if !change.Ignored {
+					drift.Unmanaged = append(drift.Unmanaged, change.Key)
+				}
+			}
+		}
+
+		switch {
+		case len(drift.Errors) > 0:
+			drift.Status = DriftFailed
+		case drift.Pending > 0 || drift.Metadata:
+			drift.Status = DriftPending
+		case len(drift.Unmanaged) > 0:
+			drift.Status = DriftUnmanaged
+		default:
+			drift.Status = DriftInSync
+		}
+		report.Blocks = append(report.Blocks, drift)
+	}
+	return report
+}
+
+// Count returns the number of blocks with the given status.
+func (r *DriftReport) Count(status DriftStatus) int {
+	n := 0
+	for _, block := range r.Blocks {
+		if block.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// HasDrift reports whether any block has changes pending or unmanaged
+// keys. Failed blocks don't count, as their drift is unknown.
+func (r *DriftReport) HasDrift() bool {
+	for _, block := range r.Blocks {
+		if block.Pending > 0 || block.Metadata || len(block.Unmanaged) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ToJSON converts the drift report to JSON, with every block and a
+// summary of the counts per status.
+func (r *DriftReport) ToJSON() (string, error) {
+	data, err := json.MarshalIndent(struct {
+		Drift   bool                `json:"drift"`
+		Summary map[DriftStatus]int `json:"summary"`
+		Blocks  []BlockDrift        `json:"blocks"`
+	}{
+		Drift: r.HasDrift(),
+		Summary: map[DriftStatus]int{
+			DriftFailed:    r.Count(DriftFailed),
+			DriftPending:   r.Count(DriftPending),
+			DriftUnmanaged: r.Count(DriftUnmanaged),
+			DriftInSync:    r.Count(DriftInSync),
+		},
+		Blocks: r.Blocks,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// FormatDriftReport formats the report summary first: one line of counts,
+// then a line per block that isn't in sync, such as
+// "prod-app (secret/prod/app): 3 pending; unmanaged: legacy_key".
+func FormatDriftReport(r *DriftReport) string {
+	var sb strings.Builder
+
+	failed := r.Count(DriftFailed)
+	drifted := r.Count(DriftPending) + r.Count(DriftUnmanaged)
+	if drifted == 0 && failed == 0 {
+		fmt.Fprintf(&sb, "No drift: %d blocks in sync\n", len(r.Blocks))
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "Drift: %d of %d blocks (%d pending, %d unmanaged, %d failed)\n",
+		drifted, len(r.Blocks), r.Count(DriftPending), r.Count(DriftUnmanaged), failed)
+
+	for _, block := range r.Blocks {
+		if block.Status == DriftInSync {
+			continue
+		}
+
+		var parts []string
+		if len(block.Errors) > 0 {
+			parts = append(parts, "failed: "+strings.Join(block.Errors, "; "))
+		}
+		if block.Pending > 0 {
+			parts = append(parts, fmt.Sprintf("%d pending", block.Pending))
+		}
+		if block.Metadata {
+			parts = append(parts, "metadata pending")
+		}
+		if len(block.Unmanaged) > 0 {
+			parts = append(parts, "unmanaged: "+strings.Join(block.Unmanaged, ", "))
+		}
+		fmt.Fprintf(&sb, "  %s (%s): %s\n", block.Name, block.Path, strings.Join(parts, "; "))
+	}
+
+	return sb.String()
+}
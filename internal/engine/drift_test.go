@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// driftResult is a plan result with a block of each drift status.
+func driftResult() *Result {
+	return &Result{
+		Diff: &Diff{Blocks: []BlockDiff{
+			{Name: "app", Mount: "secret", Path: "app", Changes: []SecretChange{
+				{Key: "password", Change: ChangeUpdate, OldValue: "s3cr3t-old", NewValue: "s3cr3t-new"},
+				{Key: "token", Change: ChangeAdd, NewValue: "s3cr3t-token"},
+				{Key: "legacy", Change: ChangeUnmanaged, OldValue: "s3cr3t-legacy"},
+			}},
+			{Name: "db", Mount: "secret", Path: "db", Changes: []SecretChange{
+				{Key: "password", Change: ChangeNone},
+				{Key: "old_user", Change: ChangeUnmanaged, OldValue: "s3cr3t-user"},
+				{Key: "kept", Change: ChangeUnmanaged, Ignored: true},
+			}},
+			{Name: "meta", Mount: "secret", Path: "meta", Metadata: map[string]string{"owner": "platform"}, Changes: []SecretChange{
+				{Key: "key", Change: ChangeNone},
+			}},
+			{Name: "s3", Mount: "secret", Path: "s3", Changes: []SecretChange{
+				{Key: "static", Change: ChangeNone},
+			}},
+			{Name: "web", Mount: "secret", Path: "web", Changes: []SecretChange{
+				{Key: "key", Change: ChangeNone},
+				{Key: "ignored", Change: ChangeUnmanaged, Ignored: true},
+			}},
+		}},
+		Errors: []BlockError{
+			{Block: "s3", Key: "db_host", Err: &FetchError{URL: "s3://bucket/state.json", Err: errors.New("NoSuchKey")}},
+		},
+	}
+}
+
+func TestNewDriftReport(t *testing.T) {
+	report := NewDriftReport(driftResult())
+
+	expected := map[string]DriftStatus{
+		"app":  DriftPending,
+		"db":   DriftUnmanaged,
+		"meta": DriftPending,
+		"s3":   DriftFailed,
+		"web":  DriftInSync,
+	}
+	if len(report.Blocks) != len(expected) {
+		t.Fatalf("expected %d blocks, got %d", len(expected), len(report.Blocks))
+	}
+	for _, block := range report.Blocks {
+		if block.Status != expected[block.Name] {
+			t.Errorf("%s: status = %s, want %s", block.Name, block.Status, expected[block.Name])
+		}
+	}
+
+	app := report.Blocks[0]
+	if app.Pending != 2 || !slices.Equal(app.Unmanaged, []string{"legacy"}) || app.Path != "secret/app" {
+		t.Errorf("unexpected app drift: %+v", app)
+	}
+	if db := report.Blocks[1]; !slices.Equal(db.Unmanaged, []string{"old_user"}) {
+		t.Errorf("expected the ignored key to be left out, got %v", db.Unmanaged)
+	}
+	if !report.Blocks[2].Metadata {
+		t.Error("expected metadata to be pending")
+	}
+	if s3 := report.Blocks[3]; !slices.Equal(s3.Errors, []string{"db_host: fetching s3://bucket/state.json: NoSuchKey"}) {
+		t.Errorf("unexpected errors: %q", s3.Errors)
+	}
+	if !report.HasDrift() {
+		t.Error("expected drift")
+	}
+}
+
+func TestDriftReport_HasDrift(t *testing.T) {
+	inSync := &Result{Diff: &Diff{Blocks: []BlockDiff{
+		{Name: "web", Changes: []SecretChange{
+			{Key: "key", Change: ChangeNone},
+			{Key: "ignored", Change: ChangeUnmanaged, Ignored: true},
+		}},
+	}}}
+	if NewDriftReport(inSync).HasDrift() {
+		t.Error("expected no drift for unchanged and ignored keys")
+	}
+
+	// A failed block's drift is unknown, so it isn't drift
+	failed := &Result{
+		Diff:   &Diff{Blocks: []BlockDiff{{Name: "s3"}}},
+		Errors: []BlockError{{Block: "s3", Err: errors.New("reading current secrets: permission denied")}},
+	}
+	report := NewDriftReport(failed)
+	if report.HasDrift() || report.Blocks[0].Status != DriftFailed {
+		t.Errorf("expected a failed block without drift, got %+v", report.Blocks[0])
+	}
+}
+
+func TestFormatDriftReport(t *testing.T) {
+	output := FormatDriftReport(NewDriftReport(driftResult()))
+	expected := `Drift: 3 of 5 blocks (2 pending, 1 unmanaged, 1 failed)
+  app (secret/app): 2 pending; unmanaged: legacy
+  db (secret/db): unmanaged: old_user
+  meta (secret/meta): metadata pending
+  s3 (secret/s3): failed: db_host: fetching s3://bucket/state.json: NoSuchKey
+`
+	if output != expected {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", output, expected)
+	}
+
+	inSync := &Result{Diff: &Diff{Blocks: []BlockDiff{{Name: "web"}, {Name: "db"}}}}
+	if output := FormatDriftReport(NewDriftReport(inSync)); output != "No drift: 2 blocks in sync\n" {
+		t.Errorf("unexpected output: %q", output)
+	}
+}
+
+func TestDriftReport_ToJSON(t *testing.T) {
+	output, err := NewDriftReport(driftResult()).ToJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(output, "s3cr3t") {
+		t.Errorf("expected no values in the report:\n%s", output)
+	}
+
+	var parsed struct {
+		Drift   bool           `json:"drift"`
+		Summary map[string]int `json:"summary"`
+		Blocks  []BlockDrift   `json:"blocks"`
+	}
+	if err := json.Unmarshal([]byte(output), &parsed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !parsed.Drift || parsed.Summary["pending"] != 2 || parsed.Summary["in_sync"] != 1 || len(parsed.Blocks) != 5 {
+		t.Errorf("unexpected report: %+v", parsed)
+	}
+}
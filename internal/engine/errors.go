@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+)
+
+// The error types below tell apart why a block failed, so callers can use
+// errors.As to choose an exit code. Their messages are those of the errors
+// they replace.
+
+// FetchError is returned when a json(), yaml(), or raw() source can't be
+// fetched, so the keys failing on the same source can be told apart.
+type FetchError struct {
+	URL string
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("fetching %s: %v", e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// VaultError is returned when reading or writing a block's secret in Vault
+// fails. Op describes what was being done, e.g. "reading current secrets".
+type VaultError struct {
+	Op  string
+	Err error
+}
+
+func (e *VaultError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *VaultError) Unwrap() error {
+	return e.Err
+}
+
+// ResolveError is returned when a key's value can't be resolved, e.g. a
+// failing command() or a policy that can't generate. It wraps a FetchError
+// when the value's source couldn't be fetched.
+type ResolveError struct {
+	Type config.ValueType
+	Err  error
+}
+
+func (e *ResolveError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
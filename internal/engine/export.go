@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+)
+
+// ResolveBlocks resolves the desired values of the blocks selected by opts
+// without reading or writing Vault, as if none of the secrets existed yet:
+// generated values are freshly generated and strategies never keep an
+// existing value. The result maps block name to key to value.
+//
+// vault() values need the resolver to have a VaultReader and fail with
+// ErrNoVaultReader otherwise. A block with any error is left out of the result.
+func ResolveBlocks(ctx context.Context, resolver *Resolver, cfg *config.Config, opts Options) (map[string]map[string]string, []BlockError) {
+	resolver.commandTimeout = opts.CommandTimeout
+
+	names := make([]string, 0, len(cfg.Secrets))
+	for name, block := range cfg.Secrets {
+		if shouldProcessBlock(block, opts) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	values := make(map[string]map[string]string, len(names))
+	var errors []BlockError
+	for _, name := range names {
+		resolved, blockErrors := resolveBlock(ctx, resolver, name, cfg.Secrets[name].Content)
+		if len(blockErrors) > 0 {
+			errors = append(errors, blockErrors...)
+			continue
+		}
+		values[name] = resolved
+	}
+
+	return values, errors
+}
+
+// resolveBlock resolves every key of one block's content in dependency order.
+func resolveBlock(ctx context.Context, resolver *Resolver, name string, content map[string]config.Value) (map[string]string, []BlockError) {
+	content, _, err := expandEnvAll(content, os.Environ())
+	if err != nil {
+		return nil, []BlockError{{Block: name, Err: err}}
+	}
+	content, err = expandMapFrom(ctx, resolver, content)
+	if err != nil {
+		return nil, []BlockError{{Block: name, Err: err}}
+	}
+
+	resolved := make(map[string]string, len(content))
+	var errors []BlockError
+	for _, key := range buildDependencyOrder(content) {
+		value := content[key]
+
+		var result *ResolveResult
+		if fromKey := DependsOn(value); fromKey != "" {
+			sourceValue, ok := resolved[fromKey]
+			if !ok {
+				errors = append(errors, BlockError{Block: name, Key: key, Err: &ResolveError{Type: value.Type, Err: fmt.Errorf("source key %q not found", fromKey)}})
+				continue
+			}
+			result, err = resolver.ResolveFrom(ctx, value, sourceValue, "", false, false)
+		} else {
+			result, err = resolver.Resolve(ctx, value, "", false, false)
+		}
+		if err != nil {
+			errors = append(errors, BlockError{Block: name, Key: key, Err: &ResolveError{Type: value.Type, Err: err}})
+			continue
+		}
+
+		resolved[key] = result.Value
+	}
+
+	return resolved, errors
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
 	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
@@ -275,3 +276,60 @@ func TestIntegration_ReconcileMultipleBlocks(t *testing.T) {
 	kv.Destroy(ctx, "vsg-multi-test-1")
 	kv.Destroy(ctx, "vsg-multi-test-2")
 }
+
+func TestIntegration_ReconcileExpireAfter(t *testing.T) {
+	vaultClient := skipIfNoVault(t)
+	ctx := context.Background()
+
+	defaults := config.Defaults{
+		Mount:    "kv",
+		Strategy: config.DefaultStrategyDefaults(),
+		Generate: config.DefaultPasswordPolicy(),
+	}
+	engine := NewEngine(vaultClient, fetcher.NewRegistry(), defaults, nil)
+
+	cfg := &config.Config{
+		Defaults: defaults,
+		Secrets: map[string]config.SecretBlock{
+			"expire-test": {
+				Name:    "expire-test",
+				Mount:   "kv",
+				Path:    "vsg-expire-test",
+				Version: 2,
+				Content: map[string]config.Value{
+					"token": {
+						Type:        config.ValueTypeGenerate,
+						ExpireAfter: time.Hour,
+					},
+				},
+			},
+		},
+	}
+
+	kv, _ := vault.NewKVClient(vaultClient, "kv", vault.KVVersion2)
+	//nolint:errcheck // Best effort cleanup
+	defer kv.Destroy(ctx, "vsg-expire-test")
+
+	result, err := engine.Reconcile(ctx, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected block errors: %v", result.Errors)
+	}
+
+	secret, err := vaultClient.Logical().ReadWithContext(ctx, "kv/metadata/vsg-expire-test")
+	if err != nil || secret == nil {
+		t.Fatalf("reading metadata: %v", err)
+	}
+	if got := secret.Data["delete_version_after"]; got != "1h0m0s" {
+		t.Errorf("delete_version_after = %v, want 1h0m0s", got)
+	}
+
+	// The version written by the reconcile is scheduled for deletion
+	versions, _ := secret.Data["versions"].(map[string]interface{})
+	first, _ := versions["1"].(map[string]interface{})
+	if deletionTime, _ := first["deletion_time"].(string); deletionTime == "" {
+		t.Errorf("expected version 1 to have a deletion_time, got %v", first)
+	}
+}
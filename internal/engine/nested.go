@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keySeparator separates path segments in content keys when nested_keys is enabled.
+const keySeparator = "/"
+
+// flattenKeys converts nested objects into flat keys joined by "/".
+// For example {"db": {"password": "x"}} becomes {"db/password": "x"}.
+// Non-object values are kept as-is.
+func flattenKeys(data map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{}, len(data))
+	flattenInto(flat, "", data)
+	return flat
+}
+
+func flattenInto(flat map[string]interface{}, prefix string, data map[string]interface{}) {
+	for k, v := range data {
+		key := k
+		if prefix != "" {
+			key = prefix + keySeparator + k
+		}
+
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenInto(flat, key, nested)
+			continue
+		}
+		flat[key] = v
+	}
+}
+
+// nestKeys converts flat keys containing "/" into nested objects.
+// For example {"db/password": "x"} becomes {"db": {"password": "x"}}.
+// It returns an error if a key is used both as a value and as a parent,
+// e.g. "db" and "db/password" in the same block.
+func nestKeys(data map[string]interface{}) (map[string]interface{}, error) {
+	// Process keys in sorted order so conflicts are reported deterministically
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	nested := make(map[string]interface{})
+	for _, key := range keys {
+		parts := strings.Split(key, keySeparator)
+		for _, part := range parts {
+			if part == "" {
+				return nil, fmt.Errorf("key %q has an empty path segment", key)
+			}
+		}
+
+		node := nested
+		for i, part := range parts[:len(parts)-1] {
+			child, exists := node[part]
+			if !exists {
+				m := make(map[string]interface{})
+				node[part] = m
+				node = m
+				continue
+			}
+			m, ok := child.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("key %q conflicts with key %q", key, strings.Join(parts[:i+1], keySeparator))
+			}
+			node = m
+		}
+
+		leaf := parts[len(parts)-1]
+		if _, exists := node[leaf]; exists {
+			return nil, fmt.Errorf("key %q conflicts with nested keys under it", key)
+		}
+		node[leaf] = data[key]
+	}
+
+	return nested, nil
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNestKeys(t *testing.T) {
+	flat := map[string]interface{}{
+		"db/password": "secret",
+		"db/user":     "admin",
+		"api_key":     "key",
+	}
+
+	nested, err := nestKeys(flat)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"db": map[string]interface{}{
+			"password": "secret",
+			"user":     "admin",
+		},
+		"api_key": "key",
+	}
+	if !reflect.DeepEqual(nested, expected) {
+		t.Errorf("expected %v, got %v", expected, nested)
+	}
+}
+
+func TestNestKeys_Conflict(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{
+			name: "value and parent",
+			data: map[string]interface{}{"db": "x", "db/password": "y"},
+		},
+		{
+			name: "empty segment",
+			data: map[string]interface{}{"db//password": "y"},
+		},
+		{
+			name: "trailing slash",
+			data: map[string]interface{}{"db/": "y"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := nestKeys(tt.data); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestFlattenKeys(t *testing.T) {
+	nested := map[string]interface{}{
+		"db": map[string]interface{}{
+			"password": "secret",
+			"replica": map[string]interface{}{
+				"host": "db-2",
+			},
+		},
+		"api_key": "key",
+	}
+
+	expected := map[string]interface{}{
+		"db/password":     "secret",
+		"db/replica/host": "db-2",
+		"api_key":         "key",
+	}
+	if flat := flattenKeys(nested); !reflect.DeepEqual(flat, expected) {
+		t.Errorf("expected %v, got %v", expected, flat)
+	}
+}
+
+func TestNestedKeys_RoundTrip(t *testing.T) {
+	flat := map[string]interface{}{
+		"db/password": "secret",
+		"db/user":     "admin",
+		"plain":       "value",
+	}
+
+	nested, err := nestKeys(flat)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := nested["db/password"]; ok {
+		t.Error("expected db/password to be nested, found flat key")
+	}
+
+	if back := flattenKeys(nested); !reflect.DeepEqual(back, flat) {
+		t.Errorf("round trip mismatch: expected %v, got %v", flat, back)
+	}
+
+	// Without nesting, a flat key with a slash is preserved as-is
+	if back := flattenKeys(flat); !reflect.DeepEqual(back, flat) {
+		t.Errorf("flat data changed by flatten: got %v", back)
+	}
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+)
+
+// prefetch fetches the sources of the named blocks' json(), yaml() and raw()
+// values into the fetcher cache, up to concurrency at once, so the blocks
+// don't pay the fetch latency one key at a time. Each distinct URL is
+// fetched once. Failures aren't cached: they are left for the keys using
+// the URL to report when they are resolved.
+func (e *Engine) prefetch(ctx context.Context, cfg *config.Config, names []string, concurrency int) {
+	urls := make(map[string]bool)
+	for _, name := range names {
+		for _, val := range cfg.Secrets[name].Content {
+			collectSourceURLs(val, urls)
+		}
+	}
+
+	sorted := make([]string, 0, len(urls))
+	for url := range urls {
+		sorted = append(sorted, url)
+	}
+	sort.Strings(sorted)
+
+	e.logger.Debug("prefetching sources", "count", len(sorted), "concurrency", concurrency)
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, url := range sorted {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(url string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := e.resolver.fetchers.Fetch(ctx, url); err != nil {
+				e.logger.Debug("prefetch failed", "url", url, "error", err)
+			}
+		}(url)
+	}
+	wg.Wait()
+}
+
+// collectSourceURLs adds the URLs fetched by val, and by the values it
+// wraps, to urls.
+func collectSourceURLs(val config.Value, urls map[string]bool) {
+	switch val.Type {
+	case config.ValueTypeJSON, config.ValueTypeYAML, config.ValueTypeRaw, config.ValueTypeMapFrom:
+		if val.URL != "" {
+			urls[val.URL] = true
+		}
+	}
+	if val.Stdin != nil {
+		collectSourceURLs(*val.Stdin, urls)
+	}
+	if val.Inner != nil {
+		collectSourceURLs(*val.Inner, urls)
+	}
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
+)
+
+func TestPlan_ParallelFetch(t *testing.T) {
+	var mu sync.Mutex
+	fetches := make(map[string]int)
+	registry := fetcher.NewRegistry()
+	registry.Register(&mockFetcherImpl{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			mu.Lock()
+			fetches[uri]++
+			mu.Unlock()
+			if strings.Contains(uri, "missing") {
+				return nil, errors.New("not found")
+			}
+			return []byte(`{"host": "db.internal", "port": 5432}`), nil
+		},
+	})
+
+	// No secret exists yet
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	e := NewEngine(client, registry, config.Defaults{
+		Generate: config.DefaultPasswordPolicy(),
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	db := "s3://bucket/db.json"
+	cache := "s3://bucket/cache.json"
+	secrets := make(map[string]config.SecretBlock)
+	for _, name := range []string{"api", "worker", "cron", "admin"} {
+		secrets[name] = config.SecretBlock{Name: name, Mount: "secret", Path: name, Version: 2, Content: map[string]config.Value{
+			"db_host":    {Type: config.ValueTypeJSON, URL: db, Query: ".host"},
+			"db_port":    {Type: config.ValueTypeJSON, URL: db, Query: ".port"},
+			"cache_host": {Type: config.ValueTypeJSON, URL: cache, Query: ".host"},
+		}}
+	}
+	secrets["api"].Content["extra"] = config.Value{Type: config.ValueTypeRaw, URL: "s3://bucket/missing.txt"}
+
+	result, err := e.Plan(context.Background(), &config.Config{Secrets: secrets}, Options{
+		Concurrency:   4,
+		ParallelFetch: 4,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, url := range []string{db, cache} {
+		if fetches[url] != 1 {
+			t.Errorf("%s fetched %d times, want 1", url, fetches[url])
+		}
+	}
+
+	// The failed prefetch is reported by its own key only
+	if len(result.Errors) != 1 || result.Errors[0].Block != "api" || result.Errors[0].Key != "extra" {
+		t.Errorf("errors = %v, want only api/extra", result.Errors)
+	}
+}
@@ -1,10 +1,19 @@
 package engine
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
 	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
@@ -16,21 +25,69 @@ type Engine struct {
 	vaultClient *vault.Client
 	resolver    *Resolver
 	logger      *slog.Logger
+
+	// maxVersions caches the max_versions of each KV v2 mount, read once
+	// per run for the version retention log
+	maxVersions sync.Map
 }
 
 // Options configures the engine behavior.
 type Options struct {
 	DryRun  bool
 	Force   bool     // Force regeneration of generated secrets
-	Target  []string // Target specific secrets by label (empty = all)
-	Exclude []string // Exclude secrets by label
+	Target  []string // Target specific secrets by label or glob (empty = all)
+	Exclude []string // Exclude secrets by label or glob
+
+	// CheckCapabilities verifies the token can read and write every targeted
+	// path before any secret is processed
+	CheckCapabilities bool
+
+	// CheckAndSet makes KV v2 writes check-and-set against the version read
+	// while planning, so a secret changed in between isn't overwritten
+	CheckAndSet bool
+
+	// Concurrency is the maximum number of blocks processed at once
+	// (values below 1 process blocks sequentially)
+	Concurrency int
+
+	// CommandTimeout is the maximum run time of command() values without a
+	// timeout of their own (0 = no limit)
+	CommandTimeout time.Duration
+
+	// ParallelFetch is the maximum number of json(), yaml() and raw()
+	// sources fetched at once before any block is processed (0 = no
+	// prefetch, sources are fetched as keys are resolved)
+	ParallelFetch int
+
+	// DevDeterministicSeed, when set, derives generate() values from the
+	// seed and their mount, path and key instead of generating them
+	// randomly. INSECURE: for throwaway dev environments only.
+	DevDeterministicSeed string
 }
 
+// ErrMissingCapabilities is returned by Reconcile when the capability
+// pre-flight check finds paths the token cannot read or write.
+var ErrMissingCapabilities = errors.New("missing vault capabilities")
+
 // Result contains the outcome of a reconciliation.
 type Result struct {
 	Diff    *Diff
 	Errors  []BlockError
 	Applied bool
+
+	// Writes records, by block name, what applying each block with changes
+	// wrote to Vault. A block missing from it was not written at all.
+	Writes map[string]BlockWrite
+}
+
+// BlockWrite records what applying a block wrote to Vault. A step that
+// failed after an earlier one succeeded leaves the earlier one set.
+type BlockWrite struct {
+	// Data is set when the keys were written, creating a new version
+	Data bool
+
+	// Metadata is set when the custom metadata was written
+	Metadata bool
 }
 
 // BlockError represents an error in processing a block.
@@ -38,22 +95,74 @@ type BlockError struct {
 	Block string
 	Key   string
 	Err   error
+
+	// Keys lists every key that failed because of the same source, in
+	// any block, sorted, when there are several. Block and Key are then
+	// the first one's.
+	Keys []BlockKey
+}
+
+// BlockKey is a key of a secret block.
+type BlockKey struct {
+	Block string
+	Key   string
+}
+
+func (k BlockKey) String() string {
+	return k.Block + "/" + k.Key
 }
 
 func (e BlockError) Error() string {
+	if len(e.Keys) > 1 {
+		// Keys of the same block share the block name, e.g. app/{a,b}
+		var parts []string
+		for i := 0; i < len(e.Keys); {
+			j := i + 1
+			for j < len(e.Keys) && e.Keys[j].Block == e.Keys[i].Block {
+				j++
+			}
+			if j-i == 1 {
+				parts = append(parts, e.Keys[i].String())
+			} else {
+				keys := make([]string, 0, j-i)
+				for _, k := range e.Keys[i:j] {
+					keys = append(keys, k.Key)
+				}
+				parts = append(parts, fmt.Sprintf("%s/{%s}", e.Keys[i].Block, strings.Join(keys, ",")))
+			}
+			i = j
+		}
+		return fmt.Sprintf("%s: %v", strings.Join(parts, ", "), e.Err)
+	}
 	if e.Key != "" {
 		return fmt.Sprintf("%s/%s: %v", e.Block, e.Key, e.Err)
 	}
 	return fmt.Sprintf("%s: %v", e.Block, e.Err)
 }
 
+// Blocks returns the names of the blocks the error affects, sorted: the
+// block, or each block of Keys.
+func (e BlockError) Blocks() []string {
+	if len(e.Keys) == 0 {
+		return []string{e.Block}
+	}
+	var blocks []string
+	for _, k := range e.Keys {
+		if len(blocks) == 0 || blocks[len(blocks)-1] != k.Block {
+			blocks = append(blocks, k.Block)
+		}
+	}
+	return blocks
+}
+
 // vaultSecretReader implements VaultReader using the vault client.
 type vaultSecretReader struct {
 	client *vault.Client
 }
 
-// ReadSecret reads a secret from Vault.
-func (r *vaultSecretReader) ReadSecret(ctx context.Context, path, key string) (string, error) {
+// ReadSecret reads a key of a secret from Vault, at the given KV v2 version
+// or, for 0, the latest.
+func (r *vaultSecretReader) ReadSecret(ctx context.Context, path, key string, version int) (string, error) {
 	mount, subpath := parsePath(path)
 
 	kv, err := vault.NewKVClient(r.client, mount, vault.KVVersionAuto)
@@ -61,12 +170,20 @@ func (r *vaultSecretReader) ReadSecret(ctx context.Context, path, key string) (s
 		return "", fmt.Errorf("creating KV client: %w", err)
 	}
 
-	data, err := kv.Read(ctx, subpath)
+	var data map[string]interface{}
+	if version > 0 {
+		data, err = kv.ReadAtVersion(ctx, subpath, version)
+	} else {
+		data, err = kv.Read(ctx, subpath)
+	}
 	if err != nil {
 		return "", fmt.Errorf("reading secret: %w", err)
 	}
 
 	if data == nil {
+		if version > 0 {
+			return "", fmt.Errorf("version %d of secret %s not found or deleted", version, path)
+		}
 		return "", fmt.Errorf("secret not found: %s", path)
 	}
 
@@ -78,6 +195,12 @@ func (r *vaultSecretReader) ReadSecret(ctx context.Context, path, key string) (s
 	return fmt.Sprintf("%v", val), nil
 }
 
+// NewVaultReader returns a VaultReader that reads keys through the vault
+// client, detecting the KV version of each mount.
+func NewVaultReader(client *vault.Client) VaultReader {
+	return &vaultSecretReader{client: client}
+}
+
 // NewEngine creates a new reconciliation engine.
 func NewEngine(vaultClient *vault.Client, fetchers *fetcher.Registry, defaults config.Defaults, logger *slog.Logger) *Engine {
 	if logger == nil {
@@ -85,11 +208,14 @@ func NewEngine(vaultClient *vault.Client, fetchers *fetcher.Registry, defaults c
 	}
 
 	// Create vault reader for vault() function
-	vaultReader := &vaultSecretReader{client: vaultClient}
+	vaultReader := NewVaultReader(vaultClient)
+
+	resolver := NewResolver(fetchers, vaultReader, defaults.Generate, defaults.Strategy)
+	resolver.SetPolicies(defaults.Policies)
 
 	return &Engine{
 		vaultClient: vaultClient,
-		resolver:    NewResolver(fetchers, vaultReader, defaults.Generate, defaults.Strategy),
+		resolver:    resolver,
 		logger:      logger,
 	}
 }
@@ -106,54 +232,116 @@ func NewEngine(vaultClient *vault.Client, fetchers *fetcher.Registry, defaults c
 // | true           | --exclude this  | Skip   |
 // | false          | none            | Skip   |
 // | false          | --target this   | Run    |
+// | false          | --target glob*  | Skip   |
 // | false          | --exclude this  | Skip   |
+//
+// A block that doesn't set enabled takes defaults.enabled from the config.
+// Targets and excludes are labels or glob patterns (see MatchLabel), and an
+// exclude wins over a target matching the same block.
 func shouldProcessBlock(block config.SecretBlock, opts Options) bool {
 	name := block.Name
 
 	// Check if explicitly excluded
-	for _, excluded := range opts.Exclude {
-		if excluded == name {
-			return false
-		}
+	if MatchLabel(opts.Exclude, name) {
+		return false
 	}
 
-	// If targets are specified, check if this block is targeted
+	// If targets are specified, check if this block is targeted. Only a
+	// target naming the block exactly runs it if enabled=false; a glob
+	// such as * would otherwise switch on every disabled block.
 	if len(opts.Target) > 0 {
-		for _, target := range opts.Target {
-			if target == name {
-				// Explicitly targeted - run even if enabled=false
-				return true
-			}
+		if slices.Contains(opts.Target, name) {
+			return true
 		}
-		// Not in target list
-		return false
+		return block.IsEnabled() && MatchLabel(opts.Target, name)
 	}
 
-	// No target filter - use enabled state (default: true)
+	// No target filter - use enabled state (default: defaults.enabled)
 	return block.IsEnabled()
 }
 
+// MatchLabel reports whether the block label name matches one of patterns,
+// either exactly or as a path.Match glob pattern (prod-*). The exact match
+// comes first, so labels such as app[billing] match themselves. A malformed
+// pattern matches nothing; ValidateLabels reports it.
+func MatchLabel(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if pattern == name {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateLabels returns a config error for the first of patterns that is
+// not a valid path.Match pattern, such as prod-[ with no closing bracket.
+func ValidateLabels(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return &config.ConfigError{Err: fmt.Errorf("invalid label pattern %q: %w", pattern, err)}
+		}
+	}
+	return nil
+}
+
 // Reconcile processes the configuration and syncs secrets to Vault.
 func (e *Engine) Reconcile(ctx context.Context, cfg *config.Config, opts Options) (*Result, error) {
-	result := &Result{
-		Diff: &Diff{},
+	if err := ValidateLabels(slices.Concat(opts.Target, opts.Exclude)); err != nil {
+		return nil, err
 	}
 
-	for name, block := range cfg.Secrets {
-		// Apply filtering
-		if !shouldProcessBlock(block, opts) {
-			e.logger.Debug("skipping block", "name", name, "enabled", block.IsEnabled())
-			continue
+	if opts.CheckCapabilities {
+		if err := e.checkCapabilities(ctx, cfg, opts); err != nil {
+			return nil, err
 		}
+	}
+
+	e.resolver.commandTimeout = opts.CommandTimeout
+	ctx = withDeterministicSeed(ctx, opts.DevDeterministicSeed)
+
+	result := &Result{
+		Diff: &Diff{AlwaysMask: cfg.Redact.AlwaysMask},
+	}
+
+	names := e.targetBlocks(cfg, opts)
+	// Prefetched content is only kept by the fetch cache
+	if opts.ParallelFetch > 0 && e.resolver.fetchers.CacheEnabled() {
+		e.prefetch(ctx, cfg, names, opts.ParallelFetch)
+	}
+
+	diffs := make([]BlockDiff, len(names))
+	blockErrors := make([][]BlockError, len(names))
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-		blockDiff, errors := e.processBlock(ctx, name, block, opts)
-		result.Diff.Blocks = append(result.Diff.Blocks, blockDiff)
-		result.Errors = append(result.Errors, errors...)
+	// Process blocks on a bounded worker pool. Each worker writes only its own
+	// slot, so results keep the sorted block order without extra locking.
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			diffs[i], blockErrors[i] = e.processBlock(ctx, name, cfg.Secrets[name], opts)
+		}(i, name)
 	}
+	wg.Wait()
+
+	result.Diff.Blocks = diffs
+	result.Errors = groupSourceErrors(slices.Concat(blockErrors...))
 
 	// Apply changes if not dry-run
 	if !opts.DryRun && result.Diff.HasChanges() {
-		applyErrors := e.applyChanges(ctx, cfg, result.Diff)
+		writes, applyErrors := e.applyChanges(ctx, cfg, result.Diff, opts)
+		result.Writes = writes
 		result.Errors = append(result.Errors, applyErrors...)
 		result.Applied = len(applyErrors) == 0
 	}
@@ -161,6 +349,51 @@ func (e *Engine) Reconcile(ctx context.Context, cfg *config.Config, opts Options
 	return result, nil
 }
 
+// targetBlocks returns the names of the blocks to process, sorted by name.
+func (e *Engine) targetBlocks(cfg *config.Config, opts Options) []string {
+	names := make([]string, 0, len(cfg.Secrets))
+	for name, block := range cfg.Secrets {
+		if !shouldProcessBlock(block, opts) {
+			e.logger.Debug("skipping block", "name", name, "enabled", block.IsEnabled())
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkCapabilities verifies the token holds the capabilities needed for each
+// targeted block, reporting every missing capability in a single error.
+func (e *Engine) checkCapabilities(ctx context.Context, cfg *config.Config, opts Options) error {
+	names := e.targetBlocks(cfg, opts)
+
+	var problems []string
+	for _, name := range names {
+		block := cfg.Secrets[name]
+
+		kv, err := vault.NewKVClient(e.vaultClient, block.Mount, vault.KVVersion(block.Version))
+		if err != nil {
+			return fmt.Errorf("%s: creating KV client: %w", name, err)
+		}
+
+		missing, err := kv.MissingCapabilities(ctx, block.Path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("%s (%s): missing %s", name, block.FullPath(), strings.Join(missing, ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w:\n  - %s", ErrMissingCapabilities, strings.Join(problems, "\n  - "))
+	}
+
+	e.logger.Debug("capability check passed", "blocks", len(names))
+	return nil
+}
+
 // processBlock processes a single secret block.
 func (e *Engine) processBlock(ctx context.Context, name string, block config.SecretBlock, opts Options) (BlockDiff, []BlockError) {
 	blockDiff := BlockDiff{
@@ -177,63 +410,174 @@ func (e *Engine) processBlock(ctx context.Context, name string, block config.Sec
 	version := vault.KVVersion(block.Version)
 	kv, err := vault.NewKVClient(e.vaultClient, block.Mount, version)
 	if err != nil {
-		errors = append(errors, BlockError{Block: name, Err: fmt.Errorf("creating KV client: %w", err)})
+		errors = append(errors, BlockError{Block: name, Err: &VaultError{Op: "creating KV client", Err: err}})
 		return blockDiff, errors
 	}
 
 	// Read current secrets from Vault using path directly
-	current, err := kv.Read(ctx, block.Path)
+	current, readVersion, err := kv.ReadVersion(ctx, block.Path)
 	if err != nil {
-		errors = append(errors, BlockError{Block: name, Err: fmt.Errorf("reading current secrets: %w", err)})
+		errors = append(errors, BlockError{Block: name, Err: &VaultError{Op: "reading current secrets", Err: err}})
 		return blockDiff, errors
 	}
+	blockDiff.readVersion = readVersion
+
+	if len(block.Metadata) > 0 {
+		currentMetadata, err := kv.ReadMetadata(ctx, block.Path)
+		if err != nil {
+			errors = append(errors, BlockError{Block: name, Err: &VaultError{Op: "reading current metadata", Err: err}})
+			return blockDiff, errors
+		}
+		if !maps.Equal(currentMetadata, block.Metadata) {
+			blockDiff.Metadata = block.Metadata
+		}
+	}
 	if current == nil {
 		current = make(map[string]interface{})
 	}
+	if block.NestedKeys {
+		current = flattenKeys(current)
+	}
 
 	// Convert current to string map
 	currentStrings := make(map[string]string)
+	blockDiff.stringKeys = make(map[string]bool)
 	for k, v := range current {
 		currentStrings[k] = fmt.Sprintf("%v", v)
+		if _, ok := v.(string); ok {
+			blockDiff.stringKeys[k] = true
+		}
+	}
+
+	// Expand env_all() into one key per matching environment variable
+	content, unmatched, err := expandEnvAll(block.Content, os.Environ())
+	if err != nil {
+		errors = append(errors, BlockError{Block: name, Err: err})
+		return blockDiff, errors
+	}
+	for _, key := range unmatched {
+		e.logger.Warn("env_all() matched no environment variables", "block", name, "key", key, "prefix", block.Content[key].Prefix)
+	}
+
+	// Expand map_from() into one key per key of the fetched document
+	content, err = expandMapFrom(ctx, e.resolver, content)
+	if err != nil {
+		errors = append(errors, BlockError{Block: name, Err: err})
+		return blockDiff, errors
+	}
+	block.Content = content
+
+	// The config checks its own keys; this catches conflicts among the
+	// keys env_all() and map_from() expand to before anything is planned
+	if block.NestedKeys {
+		keys := make(map[string]interface{}, len(content))
+		for key := range content {
+			keys[key] = nil
+		}
+		if _, err := nestKeys(keys); err != nil {
+			errors = append(errors, BlockError{Block: name, Err: fmt.Errorf("nesting keys: %w", err)})
+			return blockDiff, errors
+		}
+	}
+
+	blockDiff, errors = e.planBlock(ctx, blockDiff, block, currentStrings, opts)
+	if kv.Version() == vault.KVVersion2 {
+		if adds, updates, deletes, _, _ := blockDiff.Summary(); adds+updates+deletes > 0 {
+			blockDiff.NextVersion = blockDiff.readVersion + 1
+		}
+		e.logVersionRetention(ctx, kv, name, &blockDiff)
+	}
+	return blockDiff, errors
+}
+
+// logVersionRetention logs, at debug level, when writing a block makes
+// Vault prune the oldest version of the secret because the mount keeps
+// only max_versions. Frequent applies then churn through the history.
+func (e *Engine) logVersionRetention(ctx context.Context, kv *vault.KVClient, name string, blockDiff *BlockDiff) {
+	if !e.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	adds, updates, deletes, _, _ := blockDiff.Summary()
+	if adds+updates+deletes == 0 {
+		return
+	}
+
+	maxVersions, err := e.mountMaxVersions(ctx, kv)
+	if err != nil {
+		e.logger.Debug("can't read mount max_versions", "block", name, "mount", kv.Mount(), "error", err)
+		return
+	}
+	if blockDiff.readVersion < maxVersions {
+		return
 	}
+	e.logger.Debug("writing prunes the oldest version: the mount keeps only max_versions",
+		"block", name, "mount", kv.Mount(), "max_versions", maxVersions, "current_version", blockDiff.readVersion)
+}
+
+// mountMaxVersions returns the max_versions of kv's mount, read once per
+// engine.
+func (e *Engine) mountMaxVersions(ctx context.Context, kv *vault.KVClient) (int, error) {
+	if cached, ok := e.maxVersions.Load(kv.Mount()); ok {
+		return cached.(int), nil
+	}
+	maxVersions, err := kv.MaxVersions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	e.maxVersions.Store(kv.Mount(), maxVersions)
+	return maxVersions, nil
+}
+
+// planBlock resolves desired values for a block and computes its diff
+// against the current Vault state.
+func (e *Engine) planBlock(ctx context.Context, blockDiff BlockDiff, block config.SecretBlock, currentStrings map[string]string, opts Options) (BlockDiff, []BlockError) {
+	name := blockDiff.Name
+	var errors []BlockError
 
 	// Resolve desired values from Content (v2.0 structure)
-	// Use dependency ordering: non-hash keys first, then hash keys
+	// Use dependency ordering: keys after the keys they are computed from
 	desired := make(map[string]string)
 	sources := make(map[string]ValueSource)
 	resolvedValues := make(map[string]string) // Track resolved values for hash references
+	replaceKeys := make(map[string]bool)      // Keys whose change replaces the secret
 
 	// Build resolution order
 	keyOrder := buildDependencyOrder(block.Content)
 
+	// A block with force = true regenerates on every run, with or without --force
+	force := opts.Force || block.Force
+
 	for _, key := range keyOrder {
 		value := block.Content[key]
-		existingValue := currentStrings[key]
+		existingValue, exists := currentStrings[key]
+		keyCtx := withValuePath(ctx, block.FullPath(), key)
 
 		var resolved *ResolveResult
 		var err error
 
-		if IsHashType(value.Type) {
-			// Hash types need the source value from resolvedValues
-			fromKey := GetHashFromKey(value)
+		if fromKey := DependsOn(value); fromKey != "" {
+			// Hash types and public keys need the source value from resolvedValues
 			sourceValue, ok := resolvedValues[fromKey]
 			if !ok {
-				errors = append(errors, BlockError{Block: name, Key: key, Err: fmt.Errorf("hash source key %q not found", fromKey)})
+				errors = append(errors, BlockError{Block: name, Key: key, Err: &ResolveError{Type: value.Type, Err: fmt.Errorf("source key %q not found", fromKey)}})
 				continue
 			}
-			resolved, err = e.resolver.ResolveHash(value, sourceValue, existingValue, opts.Force)
+			resolved, err = e.resolver.ResolveFrom(keyCtx, value, sourceValue, existingValue, exists, force)
 		} else {
-			resolved, err = e.resolver.Resolve(ctx, value, existingValue, opts.Force)
+			resolved, err = e.resolver.Resolve(keyCtx, value, existingValue, exists, force)
 		}
 
 		if err != nil {
-			errors = append(errors, BlockError{Block: name, Key: key, Err: err})
+			errors = append(errors, BlockError{Block: name, Key: key, Err: &ResolveError{Type: value.Type, Err: err}})
 			continue
 		}
 
 		desired[key] = resolved.Value
 		sources[key] = resolved.Source
 		resolvedValues[key] = resolved.Value // Track for hash references
+		if resolved.Strategy == config.StrategyReplace {
+			replaceKeys[key] = true
+		}
 
 		// Warn about stale hashes that won't be updated due to create strategy
 		if resolved.StaleHash {
@@ -254,13 +598,74 @@ func (e *Engine) processBlock(ctx context.Context, name string, block config.Sec
 		)
 	}
 
+	// Load externally managed keys that should be left alone
+	ignored := make(map[string]bool, len(block.IgnoreKeys))
+	for _, key := range block.IgnoreKeys {
+		ignored[key] = true
+	}
+	if block.IgnoreKeysFile != "" {
+		data, err := e.resolver.fetchers.Fetch(ctx, block.IgnoreKeysFile)
+		if err != nil {
+			errors = append(errors, BlockError{Block: name, Err: fmt.Errorf("loading ignore_keys_file: %w", &FetchError{URL: block.IgnoreKeysFile, Err: err})})
+		} else {
+			maps.Copy(ignored, parseKeyList(data))
+		}
+	}
+
+	// Never prune a block with unresolved keys: a transient source failure
+	// would otherwise delete keys that simply failed to resolve this run.
+	prune := block.Prune
+	if prune && len(errors) > 0 {
+		prune = false
+		blockDiff.Prune = false
+		blockDiff.PruneSkipped = true
+		e.logger.Warn("skipping prune because some keys failed to resolve",
+			"block", name,
+			"failed", len(errors),
+		)
+	}
+
 	// Compute diff with prune option
-	blockDiff.Changes = ComputeDiff(currentStrings, desired, sources, block.Prune)
+	blockDiff.Changes = ComputeDiff(currentStrings, desired, sources, prune, ignored)
+
+	// A typed value stored as a string is written again with its type
+	for i, change := range blockDiff.Changes {
+		if change.Change == ChangeNone && block.Content[change.Key].As != "" && blockDiff.stringKeys[change.Key] {
+			blockDiff.Changes[i].Change = ChangeUpdate
+		}
+	}
+
+	// A changed strategy=replace key replaces the whole secret, dropping
+	// keys not in the config as prune would. Like prune, it's skipped when
+	// keys failed to resolve, since they would be dropped too.
+	for _, change := range blockDiff.Changes {
+		if !replaceKeys[change.Key] || (change.Change != ChangeAdd && change.Change != ChangeUpdate) {
+			continue
+		}
+		if len(errors) > 0 {
+			e.logger.Warn("skipping replace because some keys failed to resolve",
+				"block", name,
+				"key", change.Key,
+				"failed", len(errors),
+			)
+			break
+		}
+		blockDiff.Replace = true
+		for i, c := range blockDiff.Changes {
+			if c.Change == ChangeUnmanaged && !c.Ignored {
+				blockDiff.Changes[i].Change = ChangeDelete
+			}
+		}
+		break
+	}
 
 	// Log warnings/info for unmanaged/deleted keys
 	for _, change := range blockDiff.Changes {
 		switch change.Change {
 		case ChangeUnmanaged:
+			if change.Ignored {
+				continue
+			}
 			e.logger.Warn("unmanaged key in Vault",
 				"block", name,
 				"key", change.Key,
@@ -277,9 +682,49 @@ func (e *Engine) processBlock(ctx context.Context, name string, block config.Sec
 	return blockDiff, errors
 }
 
-// applyChanges writes the changes to Vault.
-func (e *Engine) applyChanges(ctx context.Context, cfg *config.Config, diff *Diff) []BlockError {
+// groupSourceErrors merges the key errors caused by the same failed
+// source, in any block, into one error listing the keys, in place of the
+// first, so a source failure is reported once rather than once per key
+// using it.
+func groupSourceErrors(errs []BlockError) []BlockError {
+	grouped := make([]BlockError, 0, len(errs))
+	bySource := make(map[string]int) // URL -> index in grouped
+	for _, e := range errs {
+		var srcErr *FetchError
+		if e.Key == "" || !errors.As(e.Err, &srcErr) {
+			grouped = append(grouped, e)
+			continue
+		}
+
+		if i, ok := bySource[srcErr.URL]; ok {
+			if grouped[i].Keys == nil {
+				grouped[i].Keys = []BlockKey{{Block: grouped[i].Block, Key: grouped[i].Key}}
+			}
+			grouped[i].Keys = append(grouped[i].Keys, BlockKey{Block: e.Block, Key: e.Key})
+			grouped[i].Err = srcErr
+			continue
+		}
+		bySource[srcErr.URL] = len(grouped)
+		grouped = append(grouped, e)
+	}
+
+	for i := range grouped {
+		if keys := grouped[i].Keys; keys != nil {
+			slices.SortFunc(keys, func(a, b BlockKey) int {
+				return cmp.Or(cmp.Compare(a.Block, b.Block), cmp.Compare(a.Key, b.Key))
+			})
+			grouped[i].Block = keys[0].Block
+			grouped[i].Key = keys[0].Key
+		}
+	}
+	return grouped
+}
+
+// applyChanges writes the changes to Vault, returning what was written for
+// each block.
+func (e *Engine) applyChanges(ctx context.Context, cfg *config.Config, diff *Diff, opts Options) (map[string]BlockWrite, []BlockError) {
 	var errors []BlockError
+	writes := make(map[string]BlockWrite)
 
 	for _, blockDiff := range diff.Blocks {
 		// Skip if no changes to apply
@@ -290,7 +735,7 @@ func (e *Engine) applyChanges(ctx context.Context, cfg *config.Config, diff *Dif
 				break
 			}
 		}
-		if !hasChanges {
+		if !hasChanges && blockDiff.Metadata == nil {
 			continue
 		}
 
@@ -314,16 +759,22 @@ func (e *Engine) applyChanges(ctx context.Context, cfg *config.Config, diff *Dif
 
 		kv, err := vault.NewKVClient(e.vaultClient, block.Mount, version)
 		if err != nil {
-			errors = append(errors, BlockError{Block: blockDiff.Name, Err: fmt.Errorf("creating KV client: %w", err)})
+			errors = append(errors, BlockError{Block: blockDiff.Name, Err: &VaultError{Op: "creating KV client", Err: err}})
 			continue
 		}
 
 		// Build the data to write
 		data := make(map[string]interface{})
+		var typeErrors []BlockError
 		for _, change := range blockDiff.Changes {
 			switch change.Change {
 			case ChangeAdd, ChangeUpdate, ChangeNone:
-				data[change.Key] = change.NewValue
+				value, err := typedValue(change.NewValue, block.Content[change.Key].As)
+				if err != nil {
+					typeErrors = append(typeErrors, BlockError{Block: blockDiff.Name, Key: change.Key, Err: err})
+					continue
+				}
+				data[change.Key] = value
 			case ChangeUnmanaged:
 				// Keep unmanaged keys (prune is false)
 				data[change.Key] = change.OldValue
@@ -332,53 +783,239 @@ func (e *Engine) applyChanges(ctx context.Context, cfg *config.Config, diff *Dif
 				// Key is intentionally omitted from data
 			}
 		}
+		if len(typeErrors) > 0 {
+			// Writing the rest would drop the keys that failed
+			errors = append(errors, typeErrors...)
+			continue
+		}
+
+		if block.NestedKeys {
+			data, err = nestKeys(data)
+			if err != nil {
+				errors = append(errors, BlockError{Block: blockDiff.Name, Err: fmt.Errorf("nesting keys: %w", err)})
+				continue
+			}
+		}
+
+		// delete_version_after only applies to versions written after it is
+		// set, so it goes ahead of the data
+		if expireAfter := block.ExpireAfter(); hasChanges && expireAfter > 0 {
+			e.logger.Info("setting delete_version_after",
+				"block", blockDiff.Name,
+				"mount", block.Mount,
+				"path", block.Path,
+				"expire_after", expireAfter,
+			)
+
+			if err := kv.SetDeleteVersionAfter(ctx, block.Path, expireAfter); err != nil {
+				errors = append(errors, BlockError{Block: blockDiff.Name, Err: &VaultError{Op: "setting expire_after", Err: err}})
+				continue
+			}
+		}
 
 		// Write to Vault
-		e.logger.Info("writing secrets to vault",
-			"block", blockDiff.Name,
-			"mount", block.Mount,
-			"path", block.Path,
-			"keys", len(data),
-			"prune", blockDiff.Prune,
-		)
+		if hasChanges {
+			e.logger.Info("writing secrets to vault",
+				"block", blockDiff.Name,
+				"mount", block.Mount,
+				"path", block.Path,
+				"keys", len(data),
+				"prune", blockDiff.Prune,
+			)
+
+			if opts.CheckAndSet {
+				err = kv.WriteCAS(ctx, block.Path, data, blockDiff.readVersion)
+			} else {
+				err = kv.Write(ctx, block.Path, data)
+			}
+			if err != nil {
+				errors = append(errors, BlockError{Block: blockDiff.Name, Err: writeError(err)})
+				continue
+			}
+			writes[blockDiff.Name] = BlockWrite{Data: true}
+
+			// The replaced version is soft-deleted once the new one is in
+			// place, so the secret is never left without a readable version
+			if blockDiff.Replace && kv.Version() == vault.KVVersion2 && blockDiff.readVersion > 0 {
+				e.logger.Info("deleting replaced version",
+					"block", blockDiff.Name,
+					"mount", block.Mount,
+					"path", block.Path,
+					"version", blockDiff.readVersion,
+				)
+
+				if err := kv.DeleteVersions(ctx, block.Path, []int{blockDiff.readVersion}); err != nil {
+					errors = append(errors, BlockError{Block: blockDiff.Name, Err: &VaultError{Op: "deleting replaced version", Err: err}})
+					continue
+				}
+			}
+		}
+
+		// Custom metadata goes after the data so a new secret exists first
+		if blockDiff.Metadata != nil {
+			e.logger.Info("writing custom metadata to vault",
+				"block", blockDiff.Name,
+				"mount", block.Mount,
+				"path", block.Path,
+			)
 
-		if err := kv.Write(ctx, block.Path, data); err != nil {
-			errors = append(errors, BlockError{Block: blockDiff.Name, Err: fmt.Errorf("writing to vault: %w", err)})
+			if err := kv.WriteMetadata(ctx, block.Path, blockDiff.Metadata); err != nil {
+				errors = append(errors, BlockError{Block: blockDiff.Name, Err: &VaultError{Op: "writing metadata", Err: err}})
+				continue
+			}
+			write := writes[blockDiff.Name]
+			write.Metadata = true
+			writes[blockDiff.Name] = write
 		}
 	}
 
-	return errors
+	return writes, errors
 }
 
-// buildDependencyOrder returns keys in resolution order.
-// Non-hash keys come first, then hash keys in topological order.
-func buildDependencyOrder(content map[string]config.Value) []string {
-	var nonHashKeys []string
-	hashDeps := make(map[string]string) // key -> from_key dependency
+// writeError wraps a failed write, calling out a check-and-set conflict so it
+// isn't mistaken for a generic Vault failure.
+func writeError(err error) error {
+	if errors.Is(err, vault.ErrCASMismatch) {
+		return &VaultError{Op: "secret changed underneath us, re-run to plan against the new version", Err: err}
+	}
+	return &VaultError{Op: "writing to vault", Err: err}
+}
 
+// expandEnvAll replaces env_all() values with one static value per
+// environment variable (in KEY=value form) that has the prefix. The prefix is
+// stripped from the key, and the value's options carry over to every key.
+// A captured key that is already defined elsewhere in the block is an error.
+// It also returns the env_all() keys that matched no variables.
+func expandEnvAll(content map[string]config.Value, environ []string) (map[string]config.Value, []string, error) {
+	expanded := make(map[string]config.Value, len(content))
+	var envAll []string
 	for key, val := range content {
-		if IsHashType(val.Type) {
-			fromKey := GetHashFromKey(val)
-			hashDeps[key] = fromKey
-		} else {
-			nonHashKeys = append(nonHashKeys, key)
+		if val.Type == config.ValueTypeEnvAll {
+			envAll = append(envAll, key)
+			continue
 		}
+		expanded[key] = val
 	}
+	sort.Strings(envAll)
+
+	// Sorted so that collision errors are deterministic
+	environ = slices.Sorted(slices.Values(environ))
 
-	// Build ordered list: non-hash keys first
+	var unmatched []string
+	for _, setName := range envAll {
+		val := content[setName]
+		matched := false
+		for _, kv := range environ {
+			name, value, ok := strings.Cut(kv, "=")
+			if !ok || !strings.HasPrefix(name, val.Prefix) || name == val.Prefix {
+				continue
+			}
+			key := strings.TrimPrefix(name, val.Prefix)
+			if _, exists := expanded[key]; exists {
+				return nil, nil, fmt.Errorf("env_all(%q): key %q from %s is already defined", val.Prefix, key, name)
+			}
+			matched = true
+			expanded[key] = config.Value{
+				Type:       config.ValueTypeStatic,
+				Static:     value,
+				Strategy:   val.Strategy,
+				Pipe:       val.Pipe,
+				Transforms: val.Transforms,
+			}
+		}
+		if !matched {
+			unmatched = append(unmatched, setName)
+		}
+	}
+
+	return expanded, unmatched, nil
+}
+
+// expandMapFrom replaces map_from() values with one static value per
+// matching key of the fetched document, carrying over the value's options
+// like expandEnvAll. A key that is already defined elsewhere in the block is
+// an error.
+func expandMapFrom(ctx context.Context, resolver *Resolver, content map[string]config.Value) (map[string]config.Value, error) {
+	expanded := make(map[string]config.Value, len(content))
+	var mapFrom []string
+	for key, val := range content {
+		if val.Type == config.ValueTypeMapFrom {
+			mapFrom = append(mapFrom, key)
+			continue
+		}
+		expanded[key] = val
+	}
+	if len(mapFrom) == 0 {
+		return content, nil
+	}
+	sort.Strings(mapFrom)
+
+	for _, setName := range mapFrom {
+		val := content[setName]
+		entries, err := resolver.mapFrom(ctx, val)
+		if err != nil {
+			return nil, fmt.Errorf("map_from(%q): %w", val.URL, err)
+		}
+		for _, key := range slices.Sorted(maps.Keys(entries)) {
+			if _, exists := expanded[key]; exists {
+				return nil, fmt.Errorf("map_from(%q): key %q is already defined", val.URL, key)
+			}
+			expanded[key] = config.Value{
+				Type:       config.ValueTypeStatic,
+				Static:     entries[key],
+				Strategy:   val.Strategy,
+				Pipe:       val.Pipe,
+				Transforms: val.Transforms,
+			}
+		}
+	}
+
+	return expanded, nil
+}
+
+// buildDependencyOrder returns keys in resolution order: every key comes
+// after the key it is computed from (see DependsOn), so chains such as a hash
+// of an ssh_keygen() public key resolve in order. Keys are visited in sorted
+// order to keep the result deterministic. Cycles are rejected at config load.
+func buildDependencyOrder(content map[string]config.Value) []string {
 	order := make([]string, 0, len(content))
-	order = append(order, nonHashKeys...)
+	visited := make(map[string]bool, len(content))
 
-	// Add hash keys in dependency order
-	// Since we only allow single-level dependencies (hash can only depend on non-hash),
-	// we can add all hash keys after non-hash keys
-	for key := range hashDeps {
+	var visit func(key string)
+	visit = func(key string) {
+		if visited[key] {
+			return
+		}
+		visited[key] = true
+		if fromKey := DependsOn(content[key]); fromKey != "" {
+			if _, ok := content[fromKey]; ok {
+				visit(fromKey)
+			}
+		}
 		order = append(order, key)
 	}
 
+	for _, key := range slices.Sorted(maps.Keys(content)) {
+		visit(key)
+	}
+
 	return order
 }
 
+// parseKeyList parses a newline-delimited list of keys.
+// Blank lines and lines starting with # are skipped.
+func parseKeyList(data []byte) map[string]bool {
+	keys := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys[line] = true
+	}
+	return keys
+}
+
 // parsePath splits a path like "secret/myapp" into mount "secret" and subpath "myapp".
 func parsePath(path string) (mount, subpath string) {
 	path = strings.Trim(path, "/")
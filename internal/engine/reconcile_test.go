@@ -1,9 +1,32 @@
 package engine
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
 
 	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/generator"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/vault"
 )
 
 func TestParsePath(t *testing.T) {
@@ -166,6 +189,80 @@ func TestShouldProcessBlock(t *testing.T) {
 			opts:     Options{Exclude: []string{"foo", "test", "bar"}},
 			expected: false,
 		},
+
+		// Glob patterns
+		{
+			name:     "enabled=true, --target prod-*",
+			block:    config.SecretBlock{Name: "prod-app", Enabled: &trueVal},
+			opts:     Options{Target: []string{"prod-*"}},
+			expected: true,
+		},
+		{
+			name:     "enabled=false, --target prod-* (glob doesn't override)",
+			block:    config.SecretBlock{Name: "prod-db", Enabled: &falseVal},
+			opts:     Options{Target: []string{"prod-*"}},
+			expected: false,
+		},
+		{
+			name:     "enabled=false, --target prod-*,prod-db (exact overrides)",
+			block:    config.SecretBlock{Name: "prod-db", Enabled: &falseVal},
+			opts:     Options{Target: []string{"prod-*", "prod-db"}},
+			expected: true,
+		},
+		{
+			name:     "enabled=true, --target prod-* no match",
+			block:    config.SecretBlock{Name: "dev-app", Enabled: &trueVal},
+			opts:     Options{Target: []string{"prod-*"}},
+			expected: false,
+		},
+		{
+			name:     "enabled=true, --target prod-?b no match",
+			block:    config.SecretBlock{Name: "prod-cache", Enabled: &trueVal},
+			opts:     Options{Target: []string{"prod-?b"}},
+			expected: false,
+		},
+		{
+			name:     "enabled=false, --target * skips disabled",
+			block:    config.SecretBlock{Name: "test", Enabled: &falseVal},
+			opts:     Options{Target: []string{"*"}},
+			expected: false,
+		},
+		{
+			name:     "enabled=true, --target * matches all",
+			block:    config.SecretBlock{Name: "test", Enabled: &trueVal},
+			opts:     Options{Target: []string{"*"}},
+			expected: true,
+		},
+		{
+			name:     "enabled=true, --exclude * matches all",
+			block:    config.SecretBlock{Name: "test", Enabled: &trueVal},
+			opts:     Options{Exclude: []string{"*"}},
+			expected: false,
+		},
+		{
+			name:     "enabled=true, --target prod-*, --exclude *-db",
+			block:    config.SecretBlock{Name: "prod-db", Enabled: &trueVal},
+			opts:     Options{Target: []string{"prod-*"}, Exclude: []string{"*-db"}},
+			expected: false, // exclude takes precedence
+		},
+		{
+			name:     "enabled=true, --target prod-*, --exclude *-db, other block",
+			block:    config.SecretBlock{Name: "prod-app", Enabled: &trueVal},
+			opts:     Options{Target: []string{"prod-*"}, Exclude: []string{"*-db"}},
+			expected: true,
+		},
+		{
+			name:     "enabled=true, --target label with brackets",
+			block:    config.SecretBlock{Name: "app[billing]", Enabled: &trueVal},
+			opts:     Options{Target: []string{"app[billing]"}},
+			expected: true,
+		},
+		{
+			name:     "enabled=true, --target app[*] glob",
+			block:    config.SecretBlock{Name: "app[billing]", Enabled: &trueVal},
+			opts:     Options{Target: []string{`app\[*`}},
+			expected: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -177,3 +274,1791 @@ func TestShouldProcessBlock(t *testing.T) {
 		})
 	}
 }
+
+func TestShouldProcessBlock_DefaultsEnabledFalse(t *testing.T) {
+	hcl := `
+defaults {
+  enabled = false
+}
+
+secret "opted-in" {
+  path    = "opted-in"
+  enabled = true
+  content { key = "value" }
+}
+
+secret "unset" {
+  path = "unset"
+  content { key = "value" }
+}
+`
+	cfg, err := config.ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("parsing config: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		block    string
+		opts     Options
+		expected bool
+	}{
+		{"unset, no filters", "unset", Options{}, false},
+		{"unset, --target this", "unset", Options{Target: []string{"unset"}}, true},
+		{"unset, --target glob", "unset", Options{Target: []string{"*"}}, false},
+		{"opted in, no filters", "opted-in", Options{}, true},
+		{"opted in, --exclude this", "opted-in", Options{Exclude: []string{"opted-in"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldProcessBlock(cfg.Secrets[tt.block], tt.opts); got != tt.expected {
+				t.Errorf("shouldProcessBlock() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	if err := ValidateLabels([]string{"app", "prod-*", `app\[billing\]`, "app[billing]"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err := ValidateLabels([]string{"app", "prod-["})
+	var configErr *config.ConfigError
+	if !errors.As(err, &configErr) || !errors.Is(err, path.ErrBadPattern) {
+		t.Fatalf("expected a config error wrapping ErrBadPattern, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"prod-["`) {
+		t.Errorf("expected the pattern in the error, got %q", err.Error())
+	}
+
+	e := &Engine{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	if _, err := e.Reconcile(context.Background(), &config.Config{}, Options{Exclude: []string{"a[b"}}); !errors.As(err, &configErr) {
+		t.Errorf("expected Reconcile to return a config error, got %v", err)
+	}
+}
+
+func TestPlanBlock_PruneSkippedOnResolveFailure(t *testing.T) {
+	registry := fetcher.NewRegistry()
+	registry.Register(&mockFetcherImpl{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			return nil, errors.New("s3 unavailable")
+		},
+	})
+
+	e := &Engine{
+		resolver: NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults()),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	block := config.SecretBlock{
+		Name:  "app",
+		Mount: "secret",
+		Path:  "app",
+		Prune: true,
+		Content: map[string]config.Value{
+			"static":  {Type: config.ValueTypeStatic, Static: "value"},
+			"db_host": {Type: config.ValueTypeJSON, URL: "s3://bucket/state.json", Query: ".host"},
+		},
+	}
+	current := map[string]string{
+		"static":  "value",
+		"db_host": "db.example.com",
+		"legacy":  "old",
+	}
+
+	blockDiff, errs := e.planBlock(context.Background(), BlockDiff{Name: "app", Prune: true}, block, current, Options{})
+
+	if len(errs) != 1 || errs[0].Key != "db_host" {
+		t.Fatalf("expected one error for db_host, got %v", errs)
+	}
+	if blockDiff.Prune || !blockDiff.PruneSkipped {
+		t.Errorf("expected prune to be skipped, got prune=%v skipped=%v", blockDiff.Prune, blockDiff.PruneSkipped)
+	}
+
+	for _, change := range blockDiff.Changes {
+		if change.Change == ChangeDelete {
+			t.Errorf("expected no deletions when keys failed, got delete for %q", change.Key)
+		}
+	}
+}
+
+func TestPlanBlock_PruneWithoutFailures(t *testing.T) {
+	e := &Engine{
+		resolver: NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults()),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	block := config.SecretBlock{
+		Name:  "app",
+		Prune: true,
+		Content: map[string]config.Value{
+			"static": {Type: config.ValueTypeStatic, Static: "value"},
+		},
+	}
+	current := map[string]string{"static": "value", "legacy": "old"}
+
+	blockDiff, errs := e.planBlock(context.Background(), BlockDiff{Name: "app", Prune: true}, block, current, Options{})
+
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if blockDiff.PruneSkipped {
+		t.Error("expected prune not to be skipped")
+	}
+
+	deleted := false
+	for _, change := range blockDiff.Changes {
+		if change.Key == "legacy" && change.Change == ChangeDelete {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Error("expected legacy key to be pruned")
+	}
+}
+
+func TestPlanBlock_Replace(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     map[string]string
+		fail        bool
+		wantReplace bool
+	}{
+		{"changed value", map[string]string{"token": "old", "legacy": "x"}, false, true},
+		{"new key", map[string]string{"legacy": "x"}, false, true},
+		{"unchanged value", map[string]string{"token": "new", "legacy": "x"}, false, false},
+		{"resolve failure", map[string]string{"token": "old", "legacy": "x"}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := fetcher.NewRegistry()
+			registry.Register(&mockFetcherImpl{
+				supports: func(uri string) bool { return true },
+				fetch: func(ctx context.Context, uri string) ([]byte, error) {
+					return nil, errors.New("s3 unavailable")
+				},
+			})
+			e := &Engine{
+				resolver: NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults()),
+				logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			content := map[string]config.Value{
+				"token": {Type: config.ValueTypeStatic, Static: "new", Strategy: config.StrategyReplace},
+			}
+			if tt.fail {
+				content["db_host"] = config.Value{Type: config.ValueTypeJSON, URL: "s3://bucket/state.json", Query: ".host"}
+			}
+			block := config.SecretBlock{Name: "app", Content: content}
+
+			blockDiff, _ := e.planBlock(context.Background(), BlockDiff{Name: "app"}, block, tt.current, Options{})
+
+			if blockDiff.Replace != tt.wantReplace {
+				t.Errorf("Replace = %v, want %v", blockDiff.Replace, tt.wantReplace)
+			}
+			for _, change := range blockDiff.Changes {
+				if change.Key != "legacy" {
+					continue
+				}
+				want := ChangeUnmanaged
+				if tt.wantReplace {
+					want = ChangeDelete
+				}
+				if change.Change != want {
+					t.Errorf("legacy: expected %s, got %s", want, change.Change)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcile_Replace(t *testing.T) {
+	var mu sync.Mutex
+	var written map[string]interface{}
+	var deleted []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet:
+			_, _ = w.Write([]byte(`{"data":{"data":{"token":"old","legacy":"x"},"metadata":{"version":3}}}`))
+		case strings.HasPrefix(r.URL.Path, "/v1/secret/delete/"):
+			var body struct {
+				Versions []interface{} `json:"versions"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			deleted = body.Versions
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			var body struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			written = body.Data
+			_, _ = w.Write([]byte(`{"data":{"version":4}}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	e := NewEngine(client, fetcher.NewRegistry(), config.Defaults{
+		Generate: config.DefaultPasswordPolicy(),
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	cfg := &config.Config{
+		Secrets: map[string]config.SecretBlock{
+			"app": {Name: "app", Mount: "secret", Path: "app", Version: 2, Content: map[string]config.Value{
+				"token": {Type: config.ValueTypeStatic, Static: "new", Strategy: config.StrategyReplace},
+			}},
+		},
+	}
+
+	result, err := e.Reconcile(context.Background(), cfg, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected block errors: %v", result.Errors)
+	}
+
+	if len(written) != 1 || written["token"] != "new" {
+		t.Errorf("expected only the managed key to be written, got %v", written)
+	}
+	if len(deleted) != 1 || deleted[0] != float64(3) {
+		t.Errorf("expected the replaced version 3 to be deleted, got %v", deleted)
+	}
+}
+
+func TestReconcile_Writes(t *testing.T) {
+	tests := []struct {
+		name       string
+		nested     bool
+		content    map[string]config.Value
+		failDelete bool
+		want       BlockWrite
+		wantWrite  bool
+	}{
+		{
+			name: "written",
+			content: map[string]config.Value{
+				"token": {Type: config.ValueTypeStatic, Static: "new", Strategy: config.StrategyReplace},
+			},
+			want:      BlockWrite{Data: true},
+			wantWrite: true,
+		},
+		{
+			name:       "deleting replaced version fails",
+			failDelete: true,
+			content: map[string]config.Value{
+				"token": {Type: config.ValueTypeStatic, Static: "new", Strategy: config.StrategyReplace},
+			},
+			want:      BlockWrite{Data: true},
+			wantWrite: true,
+		},
+		{
+			name:   "nesting conflict found while planning",
+			nested: true,
+			content: map[string]config.Value{
+				"a":   {Type: config.ValueTypeStatic, Static: "x"},
+				"a/b": {Type: config.ValueTypeStatic, Static: "y"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			writes := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case r.Method == http.MethodGet:
+					_, _ = w.Write([]byte(`{"data":{"data":{"token":"old"},"metadata":{"version":3}}}`))
+				case strings.HasPrefix(r.URL.Path, "/v1/secret/delete/") && tt.failDelete:
+					http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+				case strings.HasPrefix(r.URL.Path, "/v1/secret/delete/"):
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					writes++
+					_, _ = w.Write([]byte(`{"data":{"version":4}}`))
+				}
+			}))
+			defer server.Close()
+
+			client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+			if err != nil {
+				t.Fatalf("creating client: %v", err)
+			}
+
+			e := NewEngine(client, fetcher.NewRegistry(), config.Defaults{
+				Generate: config.DefaultPasswordPolicy(),
+				Strategy: config.DefaultStrategyDefaults(),
+			}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			cfg := &config.Config{
+				Secrets: map[string]config.SecretBlock{
+					"app": {Name: "app", Mount: "secret", Path: "app", Version: 2, NestedKeys: tt.nested, Content: tt.content},
+				},
+			}
+
+			result, err := e.Reconcile(context.Background(), cfg, Options{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			write, ok := result.Writes["app"]
+			if ok != tt.wantWrite || write != tt.want {
+				t.Errorf("Writes[app] = %+v (%v), want %+v (%v)", write, ok, tt.want, tt.wantWrite)
+			}
+			if (writes > 0) != tt.want.Data {
+				t.Errorf("expected data written = %v, got %d writes", tt.want.Data, writes)
+			}
+			if tt.failDelete && len(result.Errors) != 1 {
+				t.Errorf("expected the delete error, got %v", result.Errors)
+			}
+			if tt.nested && (len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error(), `nesting keys: key "a/b" conflicts with key "a"`)) {
+				t.Errorf("expected the nesting conflict, got %v", result.Errors)
+			}
+		})
+	}
+}
+
+func TestPlanBlock_BlockForce(t *testing.T) {
+	e := &Engine{
+		resolver: NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults()),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	content := map[string]config.Value{
+		"token": {Type: config.ValueTypeGenerate},
+	}
+	current := map[string]string{"token": "existing-token-value"}
+
+	tests := []struct {
+		name       string
+		blockForce bool
+		optsForce  bool
+		want       ChangeType
+	}{
+		{"neither", false, false, ChangeNone},
+		{"block force", true, false, ChangeUpdate},
+		{"cli force", false, true, ChangeUpdate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := config.SecretBlock{Name: "app", Force: tt.blockForce, Content: content}
+			blockDiff, errs := e.planBlock(context.Background(), BlockDiff{Name: "app"}, block, current, Options{Force: tt.optsForce})
+			if len(errs) != 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if got := blockDiff.Changes[0].Change; got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPlanBlock_IgnoreKeysFile(t *testing.T) {
+	ignoreFile := filepath.Join(t.TempDir(), "ignore.txt")
+	content := "# managed by the platform team\nexternal_token\n\n  rotated_by_lambda  \n"
+	if err := os.WriteFile(ignoreFile, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing ignore file: %v", err)
+	}
+
+	registry := fetcher.NewRegistry()
+	registry.Register(fetcher.NewLocalFetcher())
+
+	e := &Engine{
+		resolver: NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults()),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	block := config.SecretBlock{
+		Name:           "app",
+		Prune:          true,
+		IgnoreKeysFile: "file://" + ignoreFile,
+		Content: map[string]config.Value{
+			"static": {Type: config.ValueTypeStatic, Static: "value"},
+		},
+	}
+	current := map[string]string{
+		"static":            "value",
+		"external_token":    "abc",
+		"rotated_by_lambda": "def",
+		"legacy":            "old",
+	}
+
+	blockDiff, errs := e.planBlock(context.Background(), BlockDiff{Name: "app", Prune: true}, block, current, Options{})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	for _, change := range blockDiff.Changes {
+		switch change.Key {
+		case "external_token", "rotated_by_lambda":
+			if change.Change != ChangeUnmanaged || !change.Ignored {
+				t.Errorf("expected %s to be ignored, got %s", change.Key, change.Change)
+			}
+		case "legacy":
+			if change.Change != ChangeDelete {
+				t.Errorf("expected legacy to be pruned, got %s", change.Change)
+			}
+		}
+	}
+}
+
+func TestPlanBlock_IgnoreKeysFileMissing(t *testing.T) {
+	registry := fetcher.NewRegistry()
+	registry.Register(fetcher.NewLocalFetcher())
+
+	e := &Engine{
+		resolver: NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults()),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	block := config.SecretBlock{
+		Name:           "app",
+		Prune:          true,
+		IgnoreKeysFile: "file://" + filepath.Join(t.TempDir(), "missing.txt"),
+		Content: map[string]config.Value{
+			"static": {Type: config.ValueTypeStatic, Static: "value"},
+		},
+	}
+	current := map[string]string{"static": "value", "external_token": "abc"}
+
+	blockDiff, errs := e.planBlock(context.Background(), BlockDiff{Name: "app", Prune: true}, block, current, Options{})
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+	var fetchErr *FetchError
+	if !errors.As(errs[0].Err, &fetchErr) {
+		t.Errorf("expected a FetchError, got %v", errs[0].Err)
+	}
+
+	// Without the ignore list nothing may be pruned
+	for _, change := range blockDiff.Changes {
+		if change.Change == ChangeDelete {
+			t.Errorf("expected no deletions, got delete for %q", change.Key)
+		}
+	}
+}
+
+func TestReconcile_CheckCapabilities(t *testing.T) {
+	// Fake Vault granting read-only access to app and full access to db
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/capabilities-self" {
+			t.Errorf("unexpected request to %s before capability check failed", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+
+		var body struct {
+			Path string `json:"path"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		caps := []string{"create", "read", "update"}
+		if body.Path == "secret/data/app" {
+			caps = []string{"read"}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"capabilities": caps, body.Path: caps},
+		})
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	e := NewEngine(client, fetcher.NewRegistry(), config.Defaults{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	cfg := &config.Config{
+		Secrets: map[string]config.SecretBlock{
+			"app": {Name: "app", Mount: "secret", Path: "app", Version: 2, Content: map[string]config.Value{"a": {Type: config.ValueTypeStatic, Static: "x"}}},
+			"db":  {Name: "db", Mount: "secret", Path: "db", Version: 2, Content: map[string]config.Value{"b": {Type: config.ValueTypeStatic, Static: "y"}}},
+		},
+	}
+
+	_, err = e.Reconcile(context.Background(), cfg, Options{CheckCapabilities: true})
+	if !errors.Is(err, ErrMissingCapabilities) {
+		t.Fatalf("expected ErrMissingCapabilities, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "app (secret/app): missing create, update") {
+		t.Errorf("expected missing capabilities for app in error, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "db (") {
+		t.Errorf("db has all capabilities and should not be reported, got: %v", err)
+	}
+}
+
+func TestReconcile_Concurrency(t *testing.T) {
+	const blocks = 20
+	const concurrency = 5
+
+	// Fake Vault with slow reads that tracks how many run at once
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		// Every secret is missing
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":[]}`))
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	e := NewEngine(client, fetcher.NewRegistry(), config.Defaults{
+		Generate: config.DefaultPasswordPolicy(),
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	cfg := &config.Config{Secrets: make(map[string]config.SecretBlock)}
+	for i := 0; i < blocks; i++ {
+		name := fmt.Sprintf("block-%02d", i)
+		cfg.Secrets[name] = config.SecretBlock{
+			Name:    name,
+			Mount:   "secret",
+			Path:    name,
+			Version: 2,
+			Content: map[string]config.Value{"key": {Type: config.ValueTypeStatic, Static: name}},
+		}
+	}
+
+	start := time.Now()
+	result, err := e.Reconcile(context.Background(), cfg, Options{DryRun: true, Concurrency: concurrency})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected block errors: %v", result.Errors)
+	}
+	if len(result.Diff.Blocks) != blocks {
+		t.Fatalf("expected %d blocks, got %d", blocks, len(result.Diff.Blocks))
+	}
+
+	names := make([]string, len(result.Diff.Blocks))
+	for i, b := range result.Diff.Blocks {
+		names[i] = b.Name
+		if len(b.Changes) != 1 || b.Changes[0].Change != ChangeAdd || b.Changes[0].NewValue != b.Name {
+			t.Errorf("block %s: unexpected changes %+v", b.Name, b.Changes)
+		}
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("expected blocks sorted by name, got %v", names)
+	}
+
+	if maxInFlight < 2 || maxInFlight > concurrency {
+		t.Errorf("expected between 2 and %d concurrent reads, got %d", concurrency, maxInFlight)
+	}
+	if sequential := blocks * 20 * time.Millisecond; elapsed >= sequential {
+		t.Errorf("expected concurrent run to beat sequential %v, took %v", sequential, elapsed)
+	}
+}
+
+func TestReconcile_WriteWithoutCheckAndSet(t *testing.T) {
+	var gotOptions interface{}
+	var writes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"data":{"data":{"a":"old"},"metadata":{"version":3}}}`))
+			return
+		}
+
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotOptions = body["options"]
+		writes++
+		_, _ = w.Write([]byte(`{"data":{"version":4}}`))
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	e := NewEngine(client, fetcher.NewRegistry(), config.Defaults{
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	cfg := &config.Config{
+		Secrets: map[string]config.SecretBlock{
+			"app": {Name: "app", Mount: "secret", Path: "app", Version: 2, Content: map[string]config.Value{"a": {Type: config.ValueTypeStatic, Static: "new"}}},
+		},
+	}
+
+	result, err := e.Reconcile(context.Background(), cfg, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected block errors: %v", result.Errors)
+	}
+	if writes != 1 || gotOptions != nil {
+		t.Errorf("expected a plain write without options, got %d writes, options %v", writes, gotOptions)
+	}
+}
+
+func TestReconcile_WriteUsesCheckAndSet(t *testing.T) {
+	var gotCAS interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"data":{"data":{"a":"old"},"metadata":{"version":3}}}`))
+			return
+		}
+
+		// Another writer bumped the version after our read
+		var body struct {
+			Options map[string]interface{} `json:"options"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotCAS = body.Options["cas"]
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	e := NewEngine(client, fetcher.NewRegistry(), config.Defaults{
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	cfg := &config.Config{
+		Secrets: map[string]config.SecretBlock{
+			"app": {Name: "app", Mount: "secret", Path: "app", Version: 2, Content: map[string]config.Value{"a": {Type: config.ValueTypeStatic, Static: "new"}}},
+		},
+	}
+
+	result, err := e.Reconcile(context.Background(), cfg, Options{CheckAndSet: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotCAS != float64(3) {
+		t.Errorf("expected cas=3 in write options, got %v", gotCAS)
+	}
+	if len(result.Errors) != 1 {
+		t.Fatalf("expected 1 block error, got %v", result.Errors)
+	}
+	if !errors.Is(result.Errors[0].Err, vault.ErrCASMismatch) {
+		t.Errorf("expected ErrCASMismatch, got: %v", result.Errors[0].Err)
+	}
+	if !strings.Contains(result.Errors[0].Error(), "changed underneath us") {
+		t.Errorf("expected conflict to be called out, got: %v", result.Errors[0])
+	}
+}
+
+func TestReconcile_LogsVersionRetention(t *testing.T) {
+	var configReads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/secret/config":
+			configReads.Add(1)
+			_, _ = w.Write([]byte(`{"data":{"max_versions":5,"cas_required":false}}`))
+		case "/v1/secret/data/busy":
+			_, _ = w.Write([]byte(`{"data":{"data":{"a":"old"},"metadata":{"version":5}}}`))
+		case "/v1/secret/data/quiet":
+			_, _ = w.Write([]byte(`{"data":{"data":{"a":"old"},"metadata":{"version":2}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	var logs bytes.Buffer
+	e := NewEngine(client, fetcher.NewRegistry(), config.Defaults{
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	content := map[string]config.Value{"a": {Type: config.ValueTypeStatic, Static: "new"}}
+	cfg := &config.Config{
+		Secrets: map[string]config.SecretBlock{
+			"busy":  {Name: "busy", Mount: "secret", Path: "busy", Version: 2, Content: content},
+			"quiet": {Name: "quiet", Mount: "secret", Path: "quiet", Version: 2, Content: content},
+		},
+	}
+
+	result, err := e.Reconcile(context.Background(), cfg, Options{DryRun: true})
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v %v", err, result.Errors)
+	}
+
+	var retention []string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, "prunes the oldest version") {
+			retention = append(retention, line)
+		}
+	}
+	if len(retention) != 1 || !strings.Contains(retention[0], "block=busy") || !strings.Contains(retention[0], "max_versions=5") {
+		t.Errorf("expected one retention log for busy, got %q", retention)
+	}
+	if n := configReads.Load(); n != 1 {
+		t.Errorf("expected the mount config to be read once, got %d", n)
+	}
+}
+
+func TestReconcile_NextVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/secret/data/changed":
+			_, _ = w.Write([]byte(`{"data":{"data":{"a":"old"},"metadata":{"version":7}}}`))
+		case "/v1/secret/data/unchanged":
+			_, _ = w.Write([]byte(`{"data":{"data":{"a":"new"},"metadata":{"version":3}}}`))
+		case "/v1/kv1/legacy":
+			_, _ = w.Write([]byte(`{"data":{"a":"old"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	e := NewEngine(client, fetcher.NewRegistry(), config.Defaults{
+		Strategy: config.DefaultStrategyDefaults(),
+	}, nil)
+
+	content := map[string]config.Value{"a": {Type: config.ValueTypeStatic, Static: "new"}}
+	cfg := &config.Config{
+		Secrets: map[string]config.SecretBlock{
+			"changed":   {Name: "changed", Mount: "secret", Path: "changed", Version: 2, Content: content},
+			"unchanged": {Name: "unchanged", Mount: "secret", Path: "unchanged", Version: 2, Content: content},
+			"new":       {Name: "new", Mount: "secret", Path: "new", Version: 2, Content: content},
+			"legacy":    {Name: "legacy", Mount: "kv1", Path: "legacy", Version: 1, Content: content},
+		},
+	}
+
+	result, err := e.Reconcile(context.Background(), cfg, Options{DryRun: true})
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v %v", err, result.Errors)
+	}
+
+	expected := map[string]int{"changed": 8, "unchanged": 0, "new": 1, "legacy": 0}
+	for _, block := range result.Diff.Blocks {
+		if block.NextVersion != expected[block.Name] {
+			t.Errorf("%s: NextVersion = %d, want %d", block.Name, block.NextVersion, expected[block.Name])
+		}
+	}
+
+	out := FormatDiff(result.Diff, FormatOptions{})
+	if !strings.Contains(out, "=== changed (secret/changed) [version 8] ===") {
+		t.Errorf("expected the next version in the block header:\n%s", out)
+	}
+	if strings.Contains(out, "legacy (kv1/legacy) [version") {
+		t.Errorf("expected no version for a KV v1 block:\n%s", out)
+	}
+}
+
+func TestReconcile_ExpireAfterSetBeforeWrite(t *testing.T) {
+	var writes []string
+	var deleteVersionAfter interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+
+		writes = append(writes, r.URL.Path)
+		if r.URL.Path == "/v1/secret/metadata/tokens" {
+			var body map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			deleteVersionAfter = body["delete_version_after"]
+			if _, ok := body["custom_metadata"]; ok {
+				t.Error("setting delete_version_after should leave custom metadata alone")
+			}
+		}
+		_, _ = w.Write([]byte(`{"data":{"version":1}}`))
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	e := NewEngine(client, fetcher.NewRegistry(), config.Defaults{
+		Generate: config.DefaultPasswordPolicy(),
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	cfg := &config.Config{
+		Secrets: map[string]config.SecretBlock{
+			"tokens": {Name: "tokens", Mount: "secret", Path: "tokens", Version: 2, Content: map[string]config.Value{
+				"token": {Type: config.ValueTypeGenerate, ExpireAfter: 24 * time.Hour},
+			}},
+		},
+	}
+
+	result, err := e.Reconcile(context.Background(), cfg, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected block errors: %v", result.Errors)
+	}
+
+	// New versions only pick up delete_version_after once it's set
+	expected := []string{"/v1/secret/metadata/tokens", "/v1/secret/data/tokens"}
+	if !slices.Equal(writes, expected) {
+		t.Errorf("writes = %v, want %v", writes, expected)
+	}
+	if deleteVersionAfter != "24h0m0s" {
+		t.Errorf("delete_version_after = %v, want 24h0m0s", deleteVersionAfter)
+	}
+}
+
+func TestReconcile_TypedWrite(t *testing.T) {
+	registry := fetcher.NewRegistry()
+	registry.Register(&mockFetcherImpl{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			return []byte("port: 5432\ndebug: true\nhost: db.internal\n"), nil
+		},
+	})
+
+	// port is stored as a string, so it's rewritten as a number although
+	// its text is unchanged
+	var written map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"data":{"data":{"port":"5432","host":"db.internal"},"metadata":{"version":1}}}`))
+			return
+		}
+		var body struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		_ = decoder.Decode(&body)
+		written = body.Data
+		_, _ = w.Write([]byte(`{"data":{"version":2}}`))
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	e := NewEngine(client, registry, config.Defaults{
+		Generate: config.DefaultPasswordPolicy(),
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	url := "s3://bucket/app.yaml"
+	cfg := &config.Config{
+		Secrets: map[string]config.SecretBlock{
+			"app": {Name: "app", Mount: "secret", Path: "app", Version: 2, Content: map[string]config.Value{
+				"port":  {Type: config.ValueTypeYAML, URL: url, Query: ".port", As: config.WriteTypeNumber},
+				"debug": {Type: config.ValueTypeYAML, URL: url, Query: ".debug", As: config.WriteTypeBool},
+				"host":  {Type: config.ValueTypeYAML, URL: url, Query: ".host"},
+			}},
+		},
+	}
+
+	result, err := e.Reconcile(context.Background(), cfg, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected block errors: %v", result.Errors)
+	}
+
+	for _, change := range result.Diff.Blocks[0].Changes {
+		want := map[string]ChangeType{"port": ChangeUpdate, "debug": ChangeAdd, "host": ChangeNone}[change.Key]
+		if change.Change != want {
+			t.Errorf("%s: expected %s, got %s", change.Key, want, change.Change)
+		}
+	}
+
+	if written["port"] != json.Number("5432") {
+		t.Errorf("port = %#v, want the number 5432", written["port"])
+	}
+	if written["debug"] != true {
+		t.Errorf("debug = %#v, want true", written["debug"])
+	}
+	if written["host"] != "db.internal" {
+		t.Errorf("host = %#v, want a string", written["host"])
+	}
+}
+
+func TestReconcile_TypedWriteKeptValue(t *testing.T) {
+	registry := fetcher.NewRegistry()
+	registry.Register(&mockFetcherImpl{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			return []byte("port: 5432\ndebug: true\n"), nil
+		},
+	})
+
+	// port is kept under create, but what Vault holds isn't a number
+	writes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"data":{"data":{"port":"n/a"},"metadata":{"version":1}}}`))
+			return
+		}
+		writes++
+		_, _ = w.Write([]byte(`{"data":{"version":2}}`))
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	e := NewEngine(client, registry, config.Defaults{
+		Generate: config.DefaultPasswordPolicy(),
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	url := "s3://bucket/app.yaml"
+	cfg := &config.Config{
+		Secrets: map[string]config.SecretBlock{
+			"app": {Name: "app", Mount: "secret", Path: "app", Version: 2, Content: map[string]config.Value{
+				"port":  {Type: config.ValueTypeYAML, URL: url, Query: ".port", As: config.WriteTypeNumber, Strategy: config.StrategyCreate},
+				"debug": {Type: config.ValueTypeYAML, URL: url, Query: ".debug", As: config.WriteTypeBool},
+			}},
+		},
+	}
+
+	result, err := e.Reconcile(context.Background(), cfg, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Key != "port" || !strings.Contains(result.Errors[0].Error(), `value "n/a" is not a number`) {
+		t.Fatalf("expected a port error, got %v", result.Errors)
+	}
+	if writes != 0 {
+		t.Errorf("expected the block not to be written, got %d writes", writes)
+	}
+}
+
+func TestReconcile_CustomMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     string
+		expectWrite bool
+	}{
+		{"unchanged", `{"owner":"platform","ticket":"OPS-1"}`, false},
+		{"changed", `{"owner":"someone-else"}`, true},
+		{"missing", `null`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var metadataWrites []map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/v1/secret/data/app":
+					_, _ = w.Write([]byte(`{"data":{"data":{"key":"value"},"metadata":{"version":1}}}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/v1/secret/metadata/app":
+					_, _ = w.Write([]byte(`{"data":{"custom_metadata":` + tt.current + `}}`))
+				case r.URL.Path == "/v1/secret/metadata/app":
+					var body map[string]interface{}
+					_ = json.NewDecoder(r.Body).Decode(&body)
+					mu.Lock()
+					metadataWrites = append(metadataWrites, body)
+					mu.Unlock()
+				default:
+					t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer server.Close()
+
+			client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+			if err != nil {
+				t.Fatalf("creating client: %v", err)
+			}
+
+			e := NewEngine(client, fetcher.NewRegistry(), config.Defaults{
+				Strategy: config.DefaultStrategyDefaults(),
+			}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			cfg := &config.Config{
+				Secrets: map[string]config.SecretBlock{
+					"app": {
+						Name:     "app",
+						Mount:    "secret",
+						Path:     "app",
+						Version:  2,
+						Content:  map[string]config.Value{"key": {Type: config.ValueTypeStatic, Static: "value"}},
+						Metadata: map[string]string{"owner": "platform", "ticket": "OPS-1"},
+					},
+				},
+			}
+
+			result, err := e.Reconcile(context.Background(), cfg, Options{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(result.Errors) != 0 {
+				t.Fatalf("unexpected block errors: %v", result.Errors)
+			}
+
+			if result.Diff.HasChanges() != tt.expectWrite {
+				t.Errorf("HasChanges() = %v, want %v", result.Diff.HasChanges(), tt.expectWrite)
+			}
+
+			if !tt.expectWrite {
+				if len(metadataWrites) != 0 {
+					t.Errorf("expected no metadata write, got %v", metadataWrites)
+				}
+				return
+			}
+
+			if len(metadataWrites) != 1 {
+				t.Fatalf("expected 1 metadata write, got %d", len(metadataWrites))
+			}
+			written, _ := metadataWrites[0]["custom_metadata"].(map[string]interface{})
+			if written["owner"] != "platform" || written["ticket"] != "OPS-1" {
+				t.Errorf("unexpected custom_metadata written: %v", metadataWrites[0])
+			}
+			if !strings.Contains(FormatDiff(result.Diff, FormatOptions{}), "~ custom_metadata: owner=platform, ticket=OPS-1") {
+				t.Errorf("expected metadata change in diff output:\n%s", FormatDiff(result.Diff, FormatOptions{}))
+			}
+		})
+	}
+}
+
+func TestExpandEnvAll(t *testing.T) {
+	environ := []string{
+		"APP_DB_HOST=db.internal",
+		"APP_DB_PORT=5432",
+		"APP_=ignored",
+		"OTHER_TOKEN=abc",
+		"SVC_DB_HOST=svc.internal",
+	}
+
+	t.Run("strips prefix and carries options", func(t *testing.T) {
+		content := map[string]config.Value{
+			"static": {Type: config.ValueTypeStatic, Static: "keep"},
+			"app":    {Type: config.ValueTypeEnvAll, Prefix: "APP_", Strategy: config.StrategyCreate},
+			"none":   {Type: config.ValueTypeEnvAll, Prefix: "MISSING_"},
+		}
+
+		expanded, unmatched, err := expandEnvAll(content, environ)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(expanded) != 3 {
+			t.Errorf("expected static, DB_HOST and DB_PORT, got %v", expanded)
+		}
+		if _, ok := expanded["app"]; ok {
+			t.Error("the env_all() attribute name should not become a key")
+		}
+		host := expanded["DB_HOST"]
+		if host.Type != config.ValueTypeStatic || host.Static != "db.internal" || host.Strategy != config.StrategyCreate {
+			t.Errorf("unexpected DB_HOST value %+v", host)
+		}
+		if expanded["DB_PORT"].Static != "5432" {
+			t.Errorf("unexpected DB_PORT value %+v", expanded["DB_PORT"])
+		}
+		if len(unmatched) != 1 || unmatched[0] != "none" {
+			t.Errorf("expected [none] unmatched, got %v", unmatched)
+		}
+	})
+
+	t.Run("collides with explicit key", func(t *testing.T) {
+		content := map[string]config.Value{
+			"DB_HOST": {Type: config.ValueTypeStatic, Static: "explicit"},
+			"app":     {Type: config.ValueTypeEnvAll, Prefix: "APP_"},
+		}
+		_, _, err := expandEnvAll(content, environ)
+		if err == nil || !strings.Contains(err.Error(), `key "DB_HOST" from APP_DB_HOST is already defined`) {
+			t.Errorf("expected collision error, got: %v", err)
+		}
+	})
+
+	t.Run("collides across prefixes", func(t *testing.T) {
+		content := map[string]config.Value{
+			"app": {Type: config.ValueTypeEnvAll, Prefix: "APP_"},
+			"svc": {Type: config.ValueTypeEnvAll, Prefix: "SVC_"},
+		}
+		_, _, err := expandEnvAll(content, environ)
+		if err == nil || !strings.Contains(err.Error(), `key "DB_HOST" from SVC_DB_HOST is already defined`) {
+			t.Errorf("expected collision error, got: %v", err)
+		}
+	})
+}
+
+func TestExpandMapFrom(t *testing.T) {
+	dir := t.TempDir()
+	doc := `{"db_host": "db.internal", "db_port": 5432, "db_opts": {"ssl": true}, "api_key": "abc"}`
+	if err := os.WriteFile(filepath.Join(dir, "outputs.json"), []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	url := "file://" + filepath.Join(dir, "outputs.json")
+
+	registry := fetcher.NewRegistry()
+	registry.Register(fetcher.NewLocalFetcher())
+	resolver := NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+
+	t.Run("filters keys and encodes objects", func(t *testing.T) {
+		content := map[string]config.Value{
+			"static": {Type: config.ValueTypeStatic, Static: "keep"},
+			"db":     {Type: config.ValueTypeMapFrom, URL: url, Filter: "db_*", Strategy: config.StrategyCreate},
+		}
+
+		expanded, err := expandMapFrom(context.Background(), resolver, content)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := map[string]string{
+			"static":  "keep",
+			"db_host": "db.internal",
+			"db_port": "5432",
+			"db_opts": `{"ssl":true}`,
+		}
+		if len(expanded) != len(want) {
+			t.Errorf("expected keys %v, got %v", want, expanded)
+		}
+		for key, value := range want {
+			if got := expanded[key]; got.Type != config.ValueTypeStatic || got.Static != value {
+				t.Errorf("%s: expected static %q, got %+v", key, value, got)
+			}
+		}
+		if expanded["db_host"].Strategy != config.StrategyCreate {
+			t.Errorf("expected the strategy to carry over, got %+v", expanded["db_host"])
+		}
+	})
+
+	t.Run("collides with explicit key", func(t *testing.T) {
+		content := map[string]config.Value{
+			"api_key": {Type: config.ValueTypeStatic, Static: "explicit"},
+			"all":     {Type: config.ValueTypeMapFrom, URL: url},
+		}
+		_, err := expandMapFrom(context.Background(), resolver, content)
+		if err == nil || !strings.Contains(err.Error(), `key "api_key" is already defined`) {
+			t.Errorf("expected collision error, got: %v", err)
+		}
+	})
+
+	t.Run("not an object", func(t *testing.T) {
+		list := filepath.Join(dir, "list.json")
+		if err := os.WriteFile(list, []byte(`["a", "b"]`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		content := map[string]config.Value{
+			"all": {Type: config.ValueTypeMapFrom, URL: "file://" + list},
+		}
+		_, err := expandMapFrom(context.Background(), resolver, content)
+		if err == nil || !strings.Contains(err.Error(), "is an array, not an object") {
+			t.Errorf("expected type error, got: %v", err)
+		}
+	})
+}
+
+func TestReconcile_EnvAll(t *testing.T) {
+	t.Setenv("VSG_TEST_APP_DB_HOST", "db.internal")
+	t.Setenv("VSG_TEST_APP_DB_PASSWORD", "hunter2")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"data":{"DB_HOST":"db.internal"},"metadata":{"version":1}}}`))
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	e := NewEngine(client, fetcher.NewRegistry(), config.Defaults{
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	cfg := &config.Config{
+		Secrets: map[string]config.SecretBlock{
+			"app": {Name: "app", Mount: "secret", Path: "app", Version: 2, Content: map[string]config.Value{
+				"env": {Type: config.ValueTypeEnvAll, Prefix: "VSG_TEST_APP_"},
+			}},
+		},
+	}
+
+	result, err := e.Reconcile(context.Background(), cfg, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected block errors: %v", result.Errors)
+	}
+
+	changes := make(map[string]SecretChange)
+	for _, c := range result.Diff.Blocks[0].Changes {
+		changes[c.Key] = c
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected DB_HOST and DB_PASSWORD, got %v", result.Diff.Blocks[0].Changes)
+	}
+	if changes["DB_HOST"].Change != ChangeNone {
+		t.Errorf("DB_HOST: expected no change, got %s", changes["DB_HOST"].Change)
+	}
+	if c := changes["DB_PASSWORD"]; c.Change != ChangeAdd || c.NewValue != "hunter2" {
+		t.Errorf("DB_PASSWORD: expected add of hunter2, got %+v", c)
+	}
+}
+
+func TestPlanBlock_SSHKeygen(t *testing.T) {
+	e := &Engine{
+		resolver: NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults()),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	block := config.SecretBlock{
+		Name: "deploy",
+		Content: map[string]config.Value{
+			"deploy_key":     {Type: config.ValueTypeSSHKey, SSHKey: &config.SSHKeyConfig{Type: config.SSHKeyTypeEd25519}},
+			"deploy_key_pub": {Type: config.ValueTypeSSHPublicKey, SSHKey: &config.SSHKeyConfig{Type: config.SSHKeyTypeEd25519, FromKey: "deploy_key"}},
+		},
+	}
+
+	// A new keypair: the public key belongs to the generated private key
+	blockDiff, errs := e.planBlock(context.Background(), BlockDiff{Name: "deploy"}, block, map[string]string{}, Options{})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	desired := make(map[string]string)
+	for _, change := range blockDiff.Changes {
+		if change.Change != ChangeAdd {
+			t.Errorf("%s: expected add, got %s", change.Key, change.Change)
+		}
+		desired[change.Key] = change.NewValue
+	}
+
+	privateKey := desired["deploy_key"]
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		t.Fatalf("parsing generated private key: %v", err)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(desired["deploy_key_pub"]))
+	if err != nil {
+		t.Fatalf("parsing generated public key: %v", err)
+	}
+	if !bytes.Equal(publicKey.Marshal(), signer.PublicKey().Marshal()) {
+		t.Error("public key doesn't match the private key")
+	}
+
+	// The private key shows up masked only
+	diffText := FormatDiff(&Diff{Blocks: []BlockDiff{blockDiff}}, FormatOptions{})
+	if body := strings.Split(privateKey, "\n")[1]; strings.Contains(diffText, body[2:len(body)-2]) {
+		t.Error("private key leaked into diff output")
+	}
+
+	// Under create the existing keypair is kept, and a lost public key is
+	// derived from it again
+	current := map[string]string{"deploy_key": privateKey}
+	blockDiff, errs = e.planBlock(context.Background(), BlockDiff{Name: "deploy"}, block, current, Options{})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	for _, change := range blockDiff.Changes {
+		switch change.Key {
+		case "deploy_key":
+			if change.Change != ChangeNone {
+				t.Errorf("expected the existing private key to be kept, got %s", change.Change)
+			}
+		case "deploy_key_pub":
+			if change.Change != ChangeAdd || change.NewValue != desired["deploy_key_pub"] {
+				t.Errorf("expected the public key of the existing private key, got %s %q", change.Change, change.NewValue)
+			}
+		}
+	}
+}
+
+func TestBuildDependencyOrder_Chain(t *testing.T) {
+	content := map[string]config.Value{
+		"a_hash":     {Type: config.ValueTypeBcrypt, Bcrypt: &config.BcryptConfig{FromKey: "deploy_pub"}},
+		"deploy_pub": {Type: config.ValueTypeSSHPublicKey, SSHKey: &config.SSHKeyConfig{Type: config.SSHKeyTypeEd25519, FromKey: "deploy_key"}},
+		"deploy_key": {Type: config.ValueTypeSSHKey, SSHKey: &config.SSHKeyConfig{Type: config.SSHKeyTypeEd25519}},
+		"password":   {Type: config.ValueTypeGenerate},
+	}
+
+	order := buildDependencyOrder(content)
+	expected := []string{"deploy_key", "deploy_pub", "a_hash", "password"}
+	if !slices.Equal(order, expected) {
+		t.Errorf("order = %v, want %v", order, expected)
+	}
+}
+
+func TestPlanBlock_DependencyChain(t *testing.T) {
+	e := &Engine{
+		resolver: NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults()),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	// A pbkdf2() hash of an ssh_keygen() public key: two levels deep
+	block := config.SecretBlock{
+		Name: "deploy",
+		Content: map[string]config.Value{
+			"deploy_key":      {Type: config.ValueTypeSSHKey, SSHKey: &config.SSHKeyConfig{Type: config.SSHKeyTypeEd25519}},
+			"deploy_key_pub":  {Type: config.ValueTypeSSHPublicKey, SSHKey: &config.SSHKeyConfig{Type: config.SSHKeyTypeEd25519, FromKey: "deploy_key"}},
+			"deploy_key_hash": {Type: config.ValueTypePbkdf2, Pbkdf2: &config.Pbkdf2Config{FromKey: "deploy_key_pub", Iterations: 1000}},
+		},
+	}
+
+	blockDiff, errs := e.planBlock(context.Background(), BlockDiff{Name: "deploy"}, block, map[string]string{}, Options{})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	desired := make(map[string]string)
+	for _, change := range blockDiff.Changes {
+		desired[change.Key] = change.NewValue
+	}
+	if desired["deploy_key_pub"] == "" || !generator.VerifyPbkdf2(desired["deploy_key_hash"], desired["deploy_key_pub"]) {
+		t.Errorf("hash %q doesn't match the public key %q", desired["deploy_key_hash"], desired["deploy_key_pub"])
+	}
+}
+
+// mapVaultReader reads secrets from a map keyed by path and key.
+type mapVaultReader map[string]map[string]string
+
+func (m mapVaultReader) ReadSecret(ctx context.Context, path, key string, version int) (string, error) {
+	value, ok := m[path][key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found at %s", key, path)
+	}
+	return value, nil
+}
+
+func TestPlanBlock_TLSCert(t *testing.T) {
+	caKey, err := generator.TLSKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := generator.TLSCert(caKey, config.TLSCertConfig{CommonName: "Internal CA", TTL: time.Hour, IsCA: true}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := mapVaultReader{"secret/ca": {"ca.crt": caCert, "ca.key": caKey}}
+
+	e := &Engine{
+		resolver: NewResolver(fetcher.NewRegistry(), reader, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults()),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	tlsConfig := config.TLSCertConfig{
+		CommonName: "api.internal",
+		SANs:       []string{"api.internal", "10.0.0.1"},
+		TTL:        30 * 24 * time.Hour,
+		Issuer:     "secret/ca",
+		IssuerName: "ca",
+	}
+	certConfig := tlsConfig
+	certConfig.FromKey = "tls.key"
+	block := config.SecretBlock{
+		Name: "ingress",
+		Content: map[string]config.Value{
+			"tls.key": {Type: config.ValueTypeTLSKey, TLSCert: &tlsConfig},
+			"tls.crt": {Type: config.ValueTypeTLSCert, TLSCert: &certConfig},
+		},
+	}
+
+	blockDiff, errs := e.planBlock(context.Background(), BlockDiff{Name: "ingress"}, block, map[string]string{}, Options{})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	desired := make(map[string]string)
+	for _, change := range blockDiff.Changes {
+		desired[change.Key] = change.NewValue
+	}
+
+	cert, err := generator.ParseCertificate(desired["tls.crt"])
+	if err != nil {
+		t.Fatalf("parsing issued certificate: %v", err)
+	}
+	if cert.Subject.CommonName != "api.internal" {
+		t.Errorf("expected common name api.internal, got %s", cert.Subject.CommonName)
+	}
+	if !slices.Equal(cert.DNSNames, []string{"api.internal"}) || len(cert.IPAddresses) != 1 || cert.IPAddresses[0].String() != "10.0.0.1" {
+		t.Errorf("unexpected sans: %v %v", cert.DNSNames, cert.IPAddresses)
+	}
+	if remaining := time.Until(cert.NotAfter); remaining < 29*24*time.Hour || remaining > 30*24*time.Hour {
+		t.Errorf("expected the certificate to expire in 30 days, got %s", cert.NotAfter)
+	}
+	if cert.Issuer.CommonName != "Internal CA" {
+		t.Errorf("expected the certificate to be issued by the CA, got %s", cert.Issuer.CommonName)
+	}
+	if !generator.TLSCertMatchesKey(desired["tls.crt"], desired["tls.key"]) {
+		t.Error("certificate doesn't belong to the generated key")
+	}
+
+	// Under create the existing key and certificate are kept
+	current := map[string]string{"tls.key": desired["tls.key"], "tls.crt": desired["tls.crt"]}
+	blockDiff, errs = e.planBlock(context.Background(), BlockDiff{Name: "ingress"}, block, current, Options{})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	for _, change := range blockDiff.Changes {
+		if change.Change != ChangeNone {
+			t.Errorf("%s: expected the existing value to be kept, got %s", change.Key, change.Change)
+		}
+	}
+
+	// A certificate that doesn't belong to the key is issued again
+	otherKey, err := generator.TLSKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current["tls.key"] = otherKey
+	blockDiff, errs = e.planBlock(context.Background(), BlockDiff{Name: "ingress"}, block, current, Options{})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	for _, change := range blockDiff.Changes {
+		if change.Key == "tls.crt" && (change.Change != ChangeUpdate || !generator.TLSCertMatchesKey(change.NewValue, otherKey)) {
+			t.Errorf("expected a new certificate for the existing key, got %s", change.Change)
+		}
+	}
+}
+
+func TestPlan_ConcurrentIsDeterministic(t *testing.T) {
+	const blocks = 30
+
+	// One shared source document, so every block hits the document cache
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"db": {"host": "db.internal", "port": 5432}}`))
+	}))
+	defer source.Close()
+
+	// Every secret exists with a stale host and an unmanaged key
+	vaultServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"data":{"host":"old.internal","legacy":"x"},"metadata":{"version":1}}}`))
+	}))
+	defer vaultServer.Close()
+
+	client, err := vault.NewClientFromEnv(vaultServer.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	registry := fetcher.NewRegistry()
+	registry.Register(fetcher.NewHTTPFetcher())
+	e := NewEngine(client, registry, config.Defaults{
+		Generate: config.DefaultPasswordPolicy(),
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	cfg := &config.Config{Secrets: make(map[string]config.SecretBlock)}
+	for i := 0; i < blocks; i++ {
+		name := fmt.Sprintf("block-%02d", i)
+		cfg.Secrets[name] = config.SecretBlock{
+			Name:    name,
+			Mount:   "secret",
+			Path:    name,
+			Version: 2,
+			Content: map[string]config.Value{
+				"host":     {Type: config.ValueTypeJSON, URL: source.URL + "/out.json", Query: ".db.host"},
+				"port":     {Type: config.ValueTypeJSON, URL: source.URL + "/out.json", Query: ".db.port"},
+				"name":     {Type: config.ValueTypeStatic, Static: name},
+				"password": {Type: config.ValueTypeGenerate},
+			},
+		}
+	}
+
+	sequential, err := e.Plan(context.Background(), cfg, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	concurrent, err := e.Plan(context.Background(), cfg, Options{Concurrency: 8})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(concurrent.Errors) != 0 {
+		t.Fatalf("unexpected block errors: %v", concurrent.Errors)
+	}
+
+	// Generated passwords differ between runs; everything else must match
+	summarize := func(result *Result) []string {
+		var lines []string
+		for _, block := range result.Diff.Blocks {
+			for _, change := range block.Changes {
+				if change.Key == "password" {
+					continue
+				}
+				lines = append(lines, fmt.Sprintf("%s %s %s %q", block.Name, change.Key, change.Change, change.NewValue))
+			}
+		}
+		return lines
+	}
+	if !slices.Equal(summarize(sequential), summarize(concurrent)) {
+		t.Errorf("concurrent plan differs from sequential plan:\n%v\n%v", summarize(concurrent), summarize(sequential))
+	}
+
+	names := make([]string, len(concurrent.Diff.Blocks))
+	for i, block := range concurrent.Diff.Blocks {
+		names[i] = block.Name
+	}
+	if len(names) != blocks || !sort.StringsAreSorted(names) {
+		t.Errorf("expected %d blocks in name order, got %v", blocks, names)
+	}
+}
+
+func TestPlanBlock_IgnoreKeys(t *testing.T) {
+	e := &Engine{
+		resolver: NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults()),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	current := map[string]string{
+		"static":       "value",
+		"sessionToken": "abc",
+		"lastRotated":  "2026-01-01",
+		"legacy":       "old",
+	}
+
+	for _, prune := range []bool{true, false} {
+		block := config.SecretBlock{
+			Name:       "app",
+			Prune:      prune,
+			IgnoreKeys: []string{"sessionToken", "lastRotated", "absent"},
+			Content: map[string]config.Value{
+				"static": {Type: config.ValueTypeStatic, Static: "value"},
+			},
+		}
+
+		blockDiff, errs := e.planBlock(context.Background(), BlockDiff{Name: "app", Prune: prune}, block, current, Options{})
+		if len(errs) != 0 {
+			t.Fatalf("prune=%t: unexpected errors: %v", prune, errs)
+		}
+
+		legacy := ChangeUnmanaged
+		if prune {
+			legacy = ChangeDelete
+		}
+
+		changes := make(map[string]SecretChange)
+		for _, change := range blockDiff.Changes {
+			changes[change.Key] = change
+		}
+		if len(changes) != 4 {
+			t.Errorf("prune=%t: expected 4 changes, got %v", prune, blockDiff.Changes)
+		}
+		for _, key := range []string{"sessionToken", "lastRotated"} {
+			if c := changes[key]; c.Change != ChangeUnmanaged || !c.Ignored {
+				t.Errorf("prune=%t: expected %s to be ignored, got %s (ignored=%t)", prune, key, c.Change, c.Ignored)
+			}
+		}
+		if c := changes["legacy"]; c.Change != legacy || c.Ignored {
+			t.Errorf("prune=%t: expected legacy to be %s, got %s (ignored=%t)", prune, legacy, c.Change, c.Ignored)
+		}
+	}
+}
+
+func TestPlanBlock_SharedSourceFailure(t *testing.T) {
+	registry := fetcher.NewRegistry()
+	registry.Register(fetcher.NewLocalFetcher())
+
+	e := &Engine{
+		resolver: NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults()),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	dir := t.TempDir()
+	missing := "file://" + filepath.Join(dir, "missing.json")
+	other := "file://" + filepath.Join(dir, "other.json")
+
+	block := config.SecretBlock{
+		Name: "app",
+		Content: map[string]config.Value{
+			"db_host":  {Type: config.ValueTypeJSON, URL: missing, Query: ".db.host"},
+			"db_port":  {Type: config.ValueTypeJSON, URL: missing, Query: ".db.port"},
+			"db_cert":  {Type: config.ValueTypeRaw, URL: missing},
+			"api_host": {Type: config.ValueTypeYAML, URL: other, Query: ".api.host"},
+			"static":   {Type: config.ValueTypeStatic, Static: "value"},
+		},
+	}
+
+	web := config.SecretBlock{
+		Name: "web",
+		Content: map[string]config.Value{
+			"db_host": {Type: config.ValueTypeJSON, URL: missing, Query: ".db.host"},
+		},
+	}
+
+	_, appErrs := e.planBlock(context.Background(), BlockDiff{Name: "app"}, block, map[string]string{}, Options{})
+	_, webErrs := e.planBlock(context.Background(), BlockDiff{Name: "web"}, web, map[string]string{}, Options{})
+	errs := groupSourceErrors(slices.Concat(appErrs, webErrs))
+	if len(errs) != 2 {
+		t.Fatalf("expected one error per failed source, got %d: %v", len(errs), errs)
+	}
+
+	var shared, single BlockError
+	for _, err := range errs {
+		if len(err.Keys) > 0 {
+			shared = err
+		} else {
+			single = err
+		}
+	}
+
+	// Keys of every block using the source are grouped
+	expected := []BlockKey{{"app", "db_cert"}, {"app", "db_host"}, {"app", "db_port"}, {"web", "db_host"}}
+	if !slices.Equal(shared.Keys, expected) || shared.Block != "app" || shared.Key != "db_cert" {
+		t.Errorf("expected the keys of the missing source to be grouped, got %s/%s keys %v", shared.Block, shared.Key, shared.Keys)
+	}
+	if msg := shared.Error(); !strings.HasPrefix(msg, "app/{db_cert,db_host,db_port}, web/db_host: fetching "+missing+": ") {
+		t.Errorf("unexpected grouped error: %s", msg)
+	}
+	if blocks := shared.Blocks(); !slices.Equal(blocks, []string{"app", "web"}) {
+		t.Errorf("Blocks() = %v, want [app web]", blocks)
+	}
+	var srcErr *FetchError
+	if !errors.As(shared.Err, &srcErr) || srcErr.URL != missing {
+		t.Errorf("expected the grouped error to be the source error, got %v", shared.Err)
+	}
+
+	if single.Key != "api_host" || !strings.HasPrefix(single.Error(), "app/api_host: fetching "+other) {
+		t.Errorf("unexpected error for the other source: %v", single)
+	}
+}
+
+func TestReconcile_ErrorTypes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/secret/data/app":
+			_, _ = w.Write([]byte(`{"data":{"data":{"key":"old"},"metadata":{"version":1}}}`))
+		case r.URL.Path == "/v1/secret/data/app":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := vault.NewClientFromEnv(server.URL, "", "test-token")
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	registry := fetcher.NewRegistry()
+	registry.Register(fetcher.NewLocalFetcher())
+	e := NewEngine(client, registry, config.Defaults{
+		Strategy: config.DefaultStrategyDefaults(),
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	missing := "file://" + filepath.Join(t.TempDir(), "missing.json")
+	tests := []struct {
+		name    string
+		content map[string]config.Value
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name:    "rejected write",
+			content: map[string]config.Value{"key": {Type: config.ValueTypeStatic, Static: "new"}},
+			check: func(t *testing.T, err error) {
+				var vaultErr *VaultError
+				if !errors.As(err, &vaultErr) {
+					t.Errorf("expected a *VaultError, got %T: %v", err, err)
+				}
+			},
+		},
+		{
+			name:    "missing source",
+			content: map[string]config.Value{"key": {Type: config.ValueTypeJSON, URL: missing, Query: ".key"}},
+			check: func(t *testing.T, err error) {
+				var fetchErr *FetchError
+				if !errors.As(err, &fetchErr) || fetchErr.URL != missing {
+					t.Errorf("expected a *FetchError for %s, got %T: %v", missing, err, err)
+				}
+			},
+		},
+		{
+			name:    "failing command",
+			content: map[string]config.Value{"key": {Type: config.ValueTypeCommand, Command: "exit 1", Strategy: config.StrategyUpdate}},
+			check: func(t *testing.T, err error) {
+				var resolveErr *ResolveError
+				if !errors.As(err, &resolveErr) || resolveErr.Type != config.ValueTypeCommand {
+					t.Errorf("expected a *ResolveError for command(), got %T: %v", err, err)
+				}
+				var fetchErr *FetchError
+				if errors.As(err, &fetchErr) {
+					t.Errorf("expected no *FetchError, got %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Secrets: map[string]config.SecretBlock{
+					"app": {Name: "app", Mount: "secret", Path: "app", Version: 2, Content: tt.content},
+				},
+			}
+
+			result, err := e.Reconcile(context.Background(), cfg, Options{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(result.Errors) != 1 {
+				t.Fatalf("expected one block error, got %v", result.Errors)
+			}
+			tt.check(t, result.Errors[0].Err)
+		})
+	}
+}
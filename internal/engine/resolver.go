@@ -3,9 +3,21 @@ package engine
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"os"
 	"os/exec"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
 	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
@@ -13,17 +25,55 @@ import (
 	"github.com/pavlenkoa/vault-secrets-generator/internal/parser"
 )
 
-// VaultReader reads secrets from Vault for the vault() function.
+// DefaultRawMaxSize is the default maximum size of raw() content (1 MiB).
+// Larger files are rejected unless the value sets max_size.
+const DefaultRawMaxSize = 1 << 20
+
+// VaultReader reads secrets from Vault for the vault() function. A version
+// of 0 reads the latest version.
 type VaultReader interface {
-	ReadSecret(ctx context.Context, path, key string) (string, error)
+	ReadSecret(ctx context.Context, path, key string, version int) (string, error)
 }
 
+// ErrNoVaultReader is returned for vault() values by a resolver created
+// without a VaultReader.
+var ErrNoVaultReader = errors.New("vault() can't be resolved without a Vault connection")
+
+// Generation and hashing entry points. These are variables so tests can
+// observe whether a value was actually generated.
+var (
+	generatePassword   = generator.Generate
+	generatePassphrase = generator.GeneratePassphrase
+	generateUUID       = generator.UUID
+	hashBcrypt         = generator.HashBcrypt
+	hashArgon2         = generator.HashArgon2
+	hashPbkdf2         = generator.HashPbkdf2
+	generateSSHKey     = generator.SSHKey
+	generateTLSKey     = generator.TLSKey
+)
+
+// Document parsers. These are variables so tests can count parse calls.
+var (
+	parseJSON = parser.ParseJSON
+	parseYAML = parser.ParseYAML
+)
+
 // Resolver resolves secret values from various sources.
 type Resolver struct {
 	fetchers    *fetcher.Registry
 	vaultReader VaultReader
 	defaults    config.PasswordPolicy
+	policies    map[string]config.PasswordPolicy
 	strategies  config.StrategyDefaults
+
+	// commandTimeout is the timeout of command() values without one of
+	// their own, from Options.CommandTimeout; 0 for none
+	commandTimeout time.Duration
+
+	// docs caches parsed JSON/YAML documents keyed by format and URL,
+	// so multiple queries against one source parse it only once.
+	docsMu sync.Mutex
+	docs   map[string]interface{}
 }
 
 // NewResolver creates a new value resolver.
@@ -33,9 +83,16 @@ func NewResolver(fetchers *fetcher.Registry, vaultReader VaultReader, defaults c
 		vaultReader: vaultReader,
 		defaults:    defaults,
 		strategies:  strategies,
+		docs:        make(map[string]interface{}),
 	}
 }
 
+// SetPolicies sets the named password policies referenced by
+// generate({policy = "..."}).
+func (r *Resolver) SetPolicies(policies map[string]config.PasswordPolicy) {
+	r.policies = policies
+}
+
 // ResolveResult contains the resolved value and metadata.
 type ResolveResult struct {
 	Value     string
@@ -61,43 +118,95 @@ const (
 	SourceBcrypt    ValueSource = "bcrypt"
 	SourceArgon2    ValueSource = "argon2"
 	SourcePbkdf2    ValueSource = "pbkdf2"
+	SourceSSHKey    ValueSource = "ssh_keygen"
+	SourceTLSCert   ValueSource = "tls_cert"
 )
 
 // Resolve resolves a single value based on its type.
-// existingValue is the current value in Vault (if any).
+// existingValue is the current value in Vault and exists reports whether
+// the key is present, so that the create strategy keeps a present but
+// empty value instead of replacing it.
 // force forces regeneration of generated secrets.
-func (r *Resolver) Resolve(ctx context.Context, val config.Value, existingValue string, force bool) (*ResolveResult, error) {
-	// Determine effective strategy
-	strategy := val.Strategy
-	if strategy == "" {
-		strategy = r.getDefaultStrategy(val.Type)
-	}
+func (r *Resolver) Resolve(ctx context.Context, val config.Value, existingValue string, exists, force bool) (*ResolveResult, error) {
+	strategy := r.effectiveStrategy(val)
+
+	var result *ResolveResult
+	var err error
 
 	switch val.Type {
 	case config.ValueTypeStatic:
-		return r.resolveStatic(val, existingValue, strategy)
+		result, err = r.resolveStatic(val, existingValue, exists, strategy)
 
 	case config.ValueTypeGenerate:
-		return r.resolveGenerate(val, existingValue, force, strategy)
+		result, err = r.resolveGenerate(ctx, val, existingValue, exists, force, strategy)
 
 	case config.ValueTypeJSON:
-		return r.resolveJSON(ctx, val, existingValue, strategy)
+		result, err = r.resolveJSON(ctx, val, existingValue, exists, strategy)
 
 	case config.ValueTypeYAML:
-		return r.resolveYAML(ctx, val, existingValue, strategy)
+		result, err = r.resolveYAML(ctx, val, existingValue, exists, strategy)
 
 	case config.ValueTypeRaw:
-		return r.resolveRaw(ctx, val, existingValue, strategy)
+		result, err = r.resolveRaw(ctx, val, existingValue, exists, strategy)
 
 	case config.ValueTypeVault:
-		return r.resolveVault(ctx, val, existingValue, strategy)
+		result, err = r.resolveVault(ctx, val, existingValue, exists, strategy)
 
 	case config.ValueTypeCommand:
-		return r.resolveCommand(ctx, val, existingValue, strategy)
+		result, err = r.resolveCommand(ctx, val, existingValue, exists, strategy)
+
+	case config.ValueTypeUUID:
+		result, err = r.resolveUUID(existingValue, exists, force, strategy)
+
+	case config.ValueTypeSSHKey:
+		result, err = r.resolveSSHKey(val, existingValue, exists, force, strategy)
+
+	case config.ValueTypeTLSKey:
+		result, err = r.resolveTLSKey(existingValue, exists, force, strategy)
+
+	case config.ValueTypeHash:
+		result, err = r.resolveHashed(ctx, val, existingValue, exists, force, strategy)
 
 	default:
 		return nil, fmt.Errorf("unknown value type: %s", val.Type)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Post-process freshly resolved values; kept values were piped and
+	// transformed when written
+	if val.Pipe != "" && result.Source != SourceExisting {
+		piped, err := r.runPipe(ctx, val.Pipe, result.Value)
+		if err != nil {
+			return nil, err
+		}
+		result.Value = piped
+	}
+
+	if result.Source != SourceExisting {
+		for _, transform := range val.Transforms {
+			transformed, err := config.ApplyTransform(transform, result.Value)
+			if err != nil {
+				return nil, err
+			}
+			result.Value = transformed
+		}
+	}
+
+	return result, nil
+}
+
+// effectiveStrategy returns the value's strategy, falling back to the default
+// for its type. hash() values inherit the strategy of the value they wrap.
+func (r *Resolver) effectiveStrategy(val config.Value) config.Strategy {
+	if val.Strategy != "" {
+		return val.Strategy
+	}
+	if val.Type == config.ValueTypeHash && val.Inner != nil {
+		return r.effectiveStrategy(*val.Inner)
+	}
+	return r.getDefaultStrategy(val.Type)
 }
 
 // getDefaultStrategy returns the default strategy for a value type.
@@ -123,15 +232,20 @@ func (r *Resolver) getDefaultStrategy(valueType config.ValueType) config.Strateg
 		return r.strategies.Argon2
 	case config.ValueTypePbkdf2:
 		return r.strategies.Pbkdf2
+	case config.ValueTypeUUID:
+		return r.strategies.UUID
+	case config.ValueTypeSSHKey, config.ValueTypeTLSKey, config.ValueTypeTLSCert:
+		// A keypair is generated, so it follows the generate() default
+		return r.strategies.Generate
 	default:
 		return config.StrategyUpdate
 	}
 }
 
 // resolveStatic returns a static value.
-func (r *Resolver) resolveStatic(val config.Value, existingValue string, strategy config.Strategy) (*ResolveResult, error) {
+func (r *Resolver) resolveStatic(val config.Value, existingValue string, exists bool, strategy config.Strategy) (*ResolveResult, error) {
 	// Apply strategy
-	if existingValue != "" && strategy == config.StrategyCreate && existingValue == val.Static {
+	if exists && strategy == config.StrategyCreate && existingValue == val.Static {
 		return &ResolveResult{
 			Value:    existingValue,
 			Source:   SourceExisting,
@@ -146,10 +260,11 @@ func (r *Resolver) resolveStatic(val config.Value, existingValue string, strateg
 	}, nil
 }
 
-// resolveGenerate generates a password based on the policy.
-func (r *Resolver) resolveGenerate(val config.Value, existingValue string, force bool, strategy config.Strategy) (*ResolveResult, error) {
+// resolveGenerate generates a password based on the policy. With a
+// deterministic seed in ctx, the value is derived from the seed instead.
+func (r *Resolver) resolveGenerate(ctx context.Context, val config.Value, existingValue string, exists, force bool, strategy config.Strategy) (*ResolveResult, error) {
 	// If we have an existing value and not forcing and strategy is create, keep it
-	if existingValue != "" && !force && strategy == config.StrategyCreate {
+	if exists && !force && strategy == config.StrategyCreate {
 		return &ResolveResult{
 			Value:    existingValue,
 			Source:   SourceExisting,
@@ -157,14 +272,39 @@ func (r *Resolver) resolveGenerate(val config.Value, existingValue string, force
 		}, nil
 	}
 
-	// Determine the policy to use
-	policy := r.defaults
-	if val.Generate != nil {
-		// Merge custom policy with defaults
-		policy = mergePolicy(r.defaults, *val.Generate)
+	random := deterministicRandom(ctx)
+
+	if val.Passphrase != nil {
+		generate := generatePassphrase
+		if random != nil {
+			generate = func(policy config.PassphrasePolicy) (string, error) {
+				return generator.GeneratePassphraseFrom(policy, random)
+			}
+		}
+		passphrase, err := generate(*val.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("generating passphrase: %w", err)
+		}
+
+		return &ResolveResult{
+			Value:    passphrase,
+			Source:   SourceGenerated,
+			Strategy: strategy,
+		}, nil
+	}
+
+	policy, err := r.generatePolicy(val)
+	if err != nil {
+		return nil, err
 	}
 
-	password, err := generator.Generate(policy)
+	generate := generatePassword
+	if random != nil {
+		generate = func(policy config.PasswordPolicy) (string, error) {
+			return generator.GenerateFrom(policy, random)
+		}
+	}
+	password, err := generate(policy)
 	if err != nil {
 		return nil, fmt.Errorf("generating password: %w", err)
 	}
@@ -176,6 +316,206 @@ func (r *Resolver) resolveGenerate(val config.Value, existingValue string, force
 	}, nil
 }
 
+// resolveUUID generates a random v4 UUID.
+func (r *Resolver) resolveUUID(existingValue string, exists, force bool, strategy config.Strategy) (*ResolveResult, error) {
+	// If we have an existing value and not forcing and strategy is create, keep it
+	if exists && !force && strategy == config.StrategyCreate {
+		return &ResolveResult{
+			Value:    existingValue,
+			Source:   SourceExisting,
+			Strategy: strategy,
+		}, nil
+	}
+
+	id, err := generateUUID()
+	if err != nil {
+		return nil, fmt.Errorf("generating uuid: %w", err)
+	}
+
+	return &ResolveResult{
+		Value:    id,
+		Source:   SourceGenerated,
+		Strategy: strategy,
+	}, nil
+}
+
+// resolveSSHKey generates an SSH private key for ssh_keygen().
+func (r *Resolver) resolveSSHKey(val config.Value, existingValue string, exists, force bool, strategy config.Strategy) (*ResolveResult, error) {
+	// Keep the existing keypair under create, unless forced
+	if exists && !force && strategy == config.StrategyCreate {
+		return &ResolveResult{
+			Value:    existingValue,
+			Source:   SourceExisting,
+			Strategy: strategy,
+		}, nil
+	}
+
+	key, err := generateSSHKey(val.SSHKey.Type, val.SSHKey.Bits)
+	if err != nil {
+		return nil, fmt.Errorf("generating ssh key: %w", err)
+	}
+
+	return &ResolveResult{
+		Value:    key,
+		Source:   SourceSSHKey,
+		Strategy: strategy,
+	}, nil
+}
+
+// resolveSSHPublicKey derives the public key of an ssh_keygen() keypair from
+// the resolved private key, so it always matches whatever key is kept.
+func (r *Resolver) resolveSSHPublicKey(val config.Value, privateKey, existingValue string) (*ResolveResult, error) {
+	strategy := r.effectiveStrategy(val)
+
+	publicKey, err := generator.SSHPublicKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("deriving public key from %s: %w", val.SSHKey.FromKey, err)
+	}
+
+	source := SourceSSHKey
+	if publicKey == existingValue {
+		source = SourceExisting
+	}
+	return &ResolveResult{
+		Value:    publicKey,
+		Source:   source,
+		Strategy: strategy,
+		FromKey:  val.SSHKey.FromKey,
+	}, nil
+}
+
+// resolveTLSKey generates the private key of a tls_cert() certificate.
+func (r *Resolver) resolveTLSKey(existingValue string, exists, force bool, strategy config.Strategy) (*ResolveResult, error) {
+	// Keep the existing key under create, unless forced
+	if exists && !force && strategy == config.StrategyCreate {
+		return &ResolveResult{
+			Value:    existingValue,
+			Source:   SourceExisting,
+			Strategy: strategy,
+		}, nil
+	}
+
+	key, err := generateTLSKey()
+	if err != nil {
+		return nil, fmt.Errorf("generating tls key: %w", err)
+	}
+
+	return &ResolveResult{
+		Value:    key,
+		Source:   SourceTLSCert,
+		Strategy: strategy,
+	}, nil
+}
+
+// resolveTLSCert issues the certificate of a tls_cert() value for the
+// resolved private key. Under create the existing certificate is kept as
+// long as it still belongs to the key.
+func (r *Resolver) resolveTLSCert(ctx context.Context, val config.Value, keyPEM, existingValue string, exists, force bool) (*ResolveResult, error) {
+	strategy := r.effectiveStrategy(val)
+	cfg := val.TLSCert
+
+	if exists && !force && strategy == config.StrategyCreate && generator.TLSCertMatchesKey(existingValue, keyPEM) {
+		return &ResolveResult{
+			Value:    existingValue,
+			Source:   SourceExisting,
+			Strategy: strategy,
+			FromKey:  cfg.FromKey,
+		}, nil
+	}
+
+	var issuerCert, issuerKey string
+	if cfg.Issuer != "" {
+		if r.vaultReader == nil {
+			return nil, fmt.Errorf("reading issuer %s: %w", cfg.Issuer, ErrNoVaultReader)
+		}
+		var err error
+		issuerCert, err = r.vaultReader.ReadSecret(ctx, cfg.Issuer, cfg.IssuerName+config.TLSCertSuffix, 0)
+		if err != nil {
+			return nil, fmt.Errorf("reading issuer certificate from %s: %w", cfg.Issuer, err)
+		}
+		issuerKey, err = r.vaultReader.ReadSecret(ctx, cfg.Issuer, cfg.IssuerName+config.TLSKeySuffix, 0)
+		if err != nil {
+			return nil, fmt.Errorf("reading issuer key from %s: %w", cfg.Issuer, err)
+		}
+	}
+
+	cert, err := generator.TLSCert(keyPEM, *cfg, issuerCert, issuerKey)
+	if err != nil {
+		return nil, fmt.Errorf("issuing certificate for %s: %w", cfg.CommonName, err)
+	}
+
+	return &ResolveResult{
+		Value:    cert,
+		Source:   SourceTLSCert,
+		Strategy: strategy,
+		FromKey:  cfg.FromKey,
+	}, nil
+}
+
+// generatePolicy returns the effective password policy of a generate()
+// value: its options merged over the named policy it references, or over
+// the defaults.
+func (r *Resolver) generatePolicy(val config.Value) (config.PasswordPolicy, error) {
+	// Determine the base policy: a named policy if referenced, else defaults
+	base := r.defaults
+	if val.PolicyName != "" {
+		named, ok := r.policies[val.PolicyName]
+		if !ok {
+			return config.PasswordPolicy{}, fmt.Errorf("unknown password policy %q", val.PolicyName)
+		}
+		base = named
+	}
+
+	if val.Generate == nil {
+		return base, nil
+	}
+	// Merge custom policy with the base policy
+	return mergePolicy(base, *val.Generate), nil
+}
+
+// CheckPolicies generates a throwaway password with every password policy
+// of cfg: the default and named policies, and the effective policy of each
+// generate() value, including those wrapped by hash(). It catches policies
+// that can never generate, such as allow_repeat = false with more letters
+// than the alphabet holds, when the config is loaded instead of midway
+// through an apply.
+func CheckPolicies(cfg *config.Config) error {
+	r := NewResolver(nil, nil, cfg.Defaults.Generate, cfg.Defaults.Strategy)
+	r.SetPolicies(cfg.Defaults.Policies)
+
+	if _, err := generatePassword(cfg.Defaults.Generate); err != nil {
+		return fmt.Errorf("defaults.generate: %w", err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Defaults.Policies)) {
+		if _, err := generatePassword(cfg.Defaults.Policies[name]); err != nil {
+			return fmt.Errorf("defaults.policy %q: %w", name, err)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Secrets)) {
+		content := cfg.Secrets[name].Content
+		for _, key := range slices.Sorted(maps.Keys(content)) {
+			val := content[key]
+			if val.Type == config.ValueTypeHash && val.Inner != nil {
+				val = *val.Inner
+			}
+			if val.Type != config.ValueTypeGenerate || val.Passphrase != nil {
+				continue
+			}
+
+			policy, err := r.generatePolicy(val)
+			if err != nil {
+				return fmt.Errorf("secret %q key %q: %w", name, key, err)
+			}
+			if _, err := generatePassword(policy); err != nil {
+				return fmt.Errorf("secret %q key %q: %w", name, key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
 // mergePolicy merges a custom policy with defaults.
 // Custom values override defaults only if they are explicitly set.
 func mergePolicy(defaults, custom config.PasswordPolicy) config.PasswordPolicy {
@@ -184,12 +524,17 @@ func mergePolicy(defaults, custom config.PasswordPolicy) config.PasswordPolicy {
 	if custom.Length > 0 {
 		result.Length = custom.Length
 	}
+	if custom.MinEntropy > 0 {
+		// Without a length of its own, the length is derived from it
+		result.MinEntropy = custom.MinEntropy
+		result.Length = custom.Length
+	}
 	if custom.Digits > 0 {
 		result.Digits = custom.Digits
 	}
-	// Symbols can be 0 intentionally, so we check differently
-	// If the custom policy has any non-default fields set, use its Symbols value
-	if custom.Length > 0 || custom.Digits > 0 || custom.SymbolCharacters != "" || custom.NoUpper || custom.AllowRepeat != nil {
+	// Symbols can be 0 intentionally, so only a call that sets them
+	// overrides the inherited count
+	if custom.Symbols > 0 || custom.SymbolsSet {
 		result.Symbols = custom.Symbols
 	}
 	if custom.SymbolCharacters != "" {
@@ -197,18 +542,37 @@ func mergePolicy(defaults, custom config.PasswordPolicy) config.PasswordPolicy {
 	}
 	if custom.NoUpper {
 		result.NoUpper = custom.NoUpper
+		result.MinUpper = 0 // An inherited minimum can't be met without uppercase
+	}
+	if custom.MinLower > 0 {
+		result.MinLower = custom.MinLower
+	}
+	if custom.MinUpper > 0 {
+		result.MinUpper = custom.MinUpper
 	}
 	if custom.AllowRepeat != nil {
 		result.AllowRepeat = custom.AllowRepeat
 	}
+	if custom.ShellSafe {
+		result.ShellSafe = true
+	}
+	if custom.JSONSafe {
+		result.JSONSafe = true
+	}
+	if custom.ExcludeAmbiguous {
+		result.ExcludeAmbiguous = true
+	}
+	if custom.RequireEachClass {
+		result.RequireEachClass = true
+	}
 
 	return result
 }
 
 // resolveJSON fetches a JSON file and extracts a value.
-func (r *Resolver) resolveJSON(ctx context.Context, val config.Value, existingValue string, strategy config.Strategy) (*ResolveResult, error) {
+func (r *Resolver) resolveJSON(ctx context.Context, val config.Value, existingValue string, exists bool, strategy config.Strategy) (*ResolveResult, error) {
 	// Apply strategy - if create and key exists, skip
-	if existingValue != "" && strategy == config.StrategyCreate {
+	if exists && strategy == config.StrategyCreate {
 		return &ResolveResult{
 			Value:    existingValue,
 			Source:   SourceExisting,
@@ -216,14 +580,13 @@ func (r *Resolver) resolveJSON(ctx context.Context, val config.Value, existingVa
 		}, nil
 	}
 
-	// Fetch the source file
-	data, err := r.fetchers.Fetch(ctx, val.URL)
+	doc, err := r.document(ctx, val.URL, "json", parseJSON)
 	if err != nil {
-		return nil, fmt.Errorf("fetching %s: %w", val.URL, err)
+		return nil, err
 	}
 
 	// Extract value using JSON path
-	extracted, err := parser.ExtractJSON(data, val.Query)
+	extracted, err := extractAs(doc, val.Query, val.As)
 	if err != nil {
 		return nil, fmt.Errorf("extracting JSON path %s: %w", val.Query, err)
 	}
@@ -236,9 +599,9 @@ func (r *Resolver) resolveJSON(ctx context.Context, val config.Value, existingVa
 }
 
 // resolveYAML fetches a YAML file and extracts a value.
-func (r *Resolver) resolveYAML(ctx context.Context, val config.Value, existingValue string, strategy config.Strategy) (*ResolveResult, error) {
+func (r *Resolver) resolveYAML(ctx context.Context, val config.Value, existingValue string, exists bool, strategy config.Strategy) (*ResolveResult, error) {
 	// Apply strategy - if create and key exists, skip
-	if existingValue != "" && strategy == config.StrategyCreate {
+	if exists && strategy == config.StrategyCreate {
 		return &ResolveResult{
 			Value:    existingValue,
 			Source:   SourceExisting,
@@ -246,14 +609,13 @@ func (r *Resolver) resolveYAML(ctx context.Context, val config.Value, existingVa
 		}, nil
 	}
 
-	// Fetch the source file
-	data, err := r.fetchers.Fetch(ctx, val.URL)
+	doc, err := r.document(ctx, val.URL, "yaml", parseYAML)
 	if err != nil {
-		return nil, fmt.Errorf("fetching %s: %w", val.URL, err)
+		return nil, err
 	}
 
 	// Extract value using YAML path
-	extracted, err := parser.ExtractYAML(data, val.Query)
+	extracted, err := extractAs(doc, val.Query, val.As)
 	if err != nil {
 		return nil, fmt.Errorf("extracting YAML path %s: %w", val.Query, err)
 	}
@@ -265,10 +627,154 @@ func (r *Resolver) resolveYAML(ctx context.Context, val config.Value, existingVa
 	}, nil
 }
 
+// extractAs extracts the value at query from a parsed document. A value
+// with an as type must hold a value of that type in the document, so it can
+// be written to Vault as a typed JSON value.
+func extractAs(doc interface{}, query string, as config.WriteType) (string, error) {
+	if as == "" || as == config.WriteTypeString {
+		return parser.Extract(doc, query)
+	}
+
+	v, err := parser.ExtractValue(doc, query)
+	if err != nil {
+		return "", err
+	}
+
+	switch as {
+	case config.WriteTypeNumber:
+		switch n := v.(type) {
+		case int, int64, uint64:
+		case float64:
+			if math.IsInf(n, 0) || math.IsNaN(n) {
+				return "", fmt.Errorf("value %v is not a finite number", n)
+			}
+		default:
+			return "", fmt.Errorf("value is %s, not a number", describeType(v))
+		}
+	case config.WriteTypeBool:
+		if _, ok := v.(bool); !ok {
+			return "", fmt.Errorf("value is %s, not a bool", describeType(v))
+		}
+	}
+	return parser.ValueToString(v)
+}
+
+// describeType names the type of a decoded document value for errors.
+func describeType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "a string"
+	case int, int64, uint64, float64:
+		return "a number"
+	case bool:
+		return "a bool"
+	case nil:
+		return "null"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	default:
+		return fmt.Sprintf("a %T", v)
+	}
+}
+
+// typedValue converts a resolved value to the JSON type it's written to
+// Vault as. Fresh values are checked when resolved, but a value kept from
+// Vault may have been written as anything, so the conversion can fail.
+func typedValue(value string, as config.WriteType) (interface{}, error) {
+	switch as {
+	case config.WriteTypeNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil || !json.Valid([]byte(value)) {
+			return nil, fmt.Errorf("value %q is not a number", value)
+		}
+		return json.Number(value), nil
+	case config.WriteTypeBool:
+		if value != "true" && value != "false" {
+			return nil, fmt.Errorf("value %q is not a bool", value)
+		}
+		return value == "true", nil
+	default:
+		return value, nil
+	}
+}
+
+// document fetches and parses a source, returning a cached document when the
+// same URL was already parsed in the same format. Nothing is cached when the
+// fetch cache is disabled, so every query reads the source again.
+func (r *Resolver) document(ctx context.Context, url, format string, parse func([]byte) (interface{}, error)) (interface{}, error) {
+	key := format + ":" + url
+	cache := r.fetchers.CacheEnabled()
+
+	if cache {
+		r.docsMu.Lock()
+		doc, ok := r.docs[key]
+		r.docsMu.Unlock()
+		if ok {
+			r.fetchers.RecordCacheHit(url)
+			return doc, nil
+		}
+	}
+
+	// Fetch the source file
+	data, err := r.fetchers.Fetch(ctx, url)
+	if err != nil {
+		return nil, &FetchError{URL: url, Err: err}
+	}
+
+	doc, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache {
+		r.docsMu.Lock()
+		r.docs[key] = doc
+		r.docsMu.Unlock()
+	}
+
+	return doc, nil
+}
+
+// mapFrom fetches a map_from() document and returns its top-level keys
+// that match the value's filter, with their values as strings. Nested
+// objects and arrays are JSON-encoded. Documents are parsed as YAML when
+// the URL ends in .yaml or .yml and as JSON otherwise.
+func (r *Resolver) mapFrom(ctx context.Context, val config.Value) (map[string]string, error) {
+	format, parse := "json", parseJSON
+	if ext := strings.ToLower(path.Ext(val.URL)); ext == ".yaml" || ext == ".yml" {
+		format, parse = "yaml", parseYAML
+	}
+
+	doc, err := r.document(ctx, val.URL, format, parse)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is %s, not an object", val.URL, describeType(doc))
+	}
+
+	entries := make(map[string]string, len(obj))
+	for key, v := range obj {
+		if val.Filter != "" {
+			if matched, _ := path.Match(val.Filter, key); !matched {
+				continue
+			}
+		}
+		s, err := parser.ValueToString(v)
+		if err != nil {
+			return nil, fmt.Errorf("key %q of %s: %w", key, val.URL, err)
+		}
+		entries[key] = s
+	}
+	return entries, nil
+}
+
 // resolveRaw fetches a file and returns its raw content.
-func (r *Resolver) resolveRaw(ctx context.Context, val config.Value, existingValue string, strategy config.Strategy) (*ResolveResult, error) {
+func (r *Resolver) resolveRaw(ctx context.Context, val config.Value, existingValue string, exists bool, strategy config.Strategy) (*ResolveResult, error) {
 	// Apply strategy - if create and key exists, skip
-	if existingValue != "" && strategy == config.StrategyCreate {
+	if exists && strategy == config.StrategyCreate {
 		return &ResolveResult{
 			Value:    existingValue,
 			Source:   SourceExisting,
@@ -279,7 +785,22 @@ func (r *Resolver) resolveRaw(ctx context.Context, val config.Value, existingVal
 	// Fetch the source file
 	data, err := r.fetchers.Fetch(ctx, val.URL)
 	if err != nil {
-		return nil, fmt.Errorf("fetching %s: %w", val.URL, err)
+		return nil, &FetchError{URL: val.URL, Err: err}
+	}
+
+	maxSize := val.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultRawMaxSize
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%s is %d bytes, exceeding the raw() limit of %d bytes (raise it with max_size)", val.URL, len(data), maxSize)
+	}
+
+	if val.JSONFormat != "" {
+		var err error
+		if data, err = reformatJSON(data, val.JSONFormat); err != nil {
+			return nil, fmt.Errorf("%s: %w", val.URL, err)
+		}
 	}
 
 	return &ResolveResult{
@@ -289,10 +810,26 @@ func (r *Resolver) resolveRaw(ctx context.Context, val config.Value, existingVal
 	}, nil
 }
 
+// reformatJSON re-encodes a JSON document for raw() with minify or pretty.
+// Key order and number formatting are kept as they are.
+func reformatJSON(data []byte, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == config.JSONFormatPretty {
+		err = json.Indent(&buf, bytes.TrimSpace(data), "", "  ")
+	} else {
+		err = json.Compact(&buf, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s needs a JSON document: %w", format, err)
+	}
+	return buf.Bytes(), nil
+}
+
 // resolveVault reads a secret from another Vault path.
-func (r *Resolver) resolveVault(ctx context.Context, val config.Value, existingValue string, strategy config.Strategy) (*ResolveResult, error) {
+func (r *Resolver) resolveVault(ctx context.Context, val config.Value, existingValue string, exists bool, strategy config.Strategy) (*ResolveResult, error) {
 	// Apply strategy - if create and key exists, skip
-	if existingValue != "" && strategy == config.StrategyCreate {
+	if exists && strategy == config.StrategyCreate {
 		return &ResolveResult{
 			Value:    existingValue,
 			Source:   SourceExisting,
@@ -301,12 +838,15 @@ func (r *Resolver) resolveVault(ctx context.Context, val config.Value, existingV
 	}
 
 	if r.vaultReader == nil {
-		return nil, fmt.Errorf("vault reader not configured")
+		return nil, ErrNoVaultReader
 	}
 
 	// Read from Vault
-	value, err := r.vaultReader.ReadSecret(ctx, val.VaultPath, val.VaultKey)
+	value, err := r.vaultReader.ReadSecret(ctx, val.VaultPath, val.VaultKey, val.VaultVersion)
 	if err != nil {
+		if val.VaultVersion > 0 {
+			return nil, fmt.Errorf("reading from vault path %s key %s version %d: %w", val.VaultPath, val.VaultKey, val.VaultVersion, err)
+		}
 		return nil, fmt.Errorf("reading from vault path %s key %s: %w", val.VaultPath, val.VaultKey, err)
 	}
 
@@ -318,9 +858,9 @@ func (r *Resolver) resolveVault(ctx context.Context, val config.Value, existingV
 }
 
 // resolveCommand executes a command and returns its output.
-func (r *Resolver) resolveCommand(ctx context.Context, val config.Value, existingValue string, strategy config.Strategy) (*ResolveResult, error) {
+func (r *Resolver) resolveCommand(ctx context.Context, val config.Value, existingValue string, exists bool, strategy config.Strategy) (*ResolveResult, error) {
 	// Apply strategy - if create and key exists, skip
-	if existingValue != "" && strategy == config.StrategyCreate {
+	if exists && strategy == config.StrategyCreate {
 		return &ResolveResult{
 			Value:    existingValue,
 			Source:   SourceExisting,
@@ -328,20 +868,44 @@ func (r *Resolver) resolveCommand(ctx context.Context, val config.Value, existin
 		}, nil
 	}
 
-	// Execute the command using sh -c to support shell features
-	// #nosec G204 -- Command is intentionally user-configured
-	cmd := exec.CommandContext(ctx, "sh", "-c", val.Command)
+	var stdin string
+	if val.Stdin != nil {
+		result, err := r.Resolve(ctx, *val.Stdin, "", false, false)
+		if err != nil {
+			return nil, fmt.Errorf("resolving command stdin: %w", err)
+		}
+		stdin = result.Value
+	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	timeout := val.Timeout
+	if timeout == 0 {
+		timeout = r.commandTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("executing command: %w (stderr: %s)", err, stderr.String())
+	raw, err := runShellOutput(ctx, val.Command, stdin, val.Env)
+	if err != nil {
+		if timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("command %q timed out after %s", val.Command, timeout)
+		}
+		return nil, fmt.Errorf("executing command: %w", err)
 	}
 
-	// Trim trailing newlines from output
-	output := strings.TrimRight(stdout.String(), "\n\r")
+	var output string
+	if val.Binary == config.BinaryBase64 && !utf8.Valid(raw) {
+		// Binary output is encoded whole: trimming would corrupt it
+		output = base64.StdEncoding.EncodeToString(raw)
+	} else {
+		output = string(raw)
+		if val.NormalizeNewlines {
+			output = strings.ReplaceAll(output, "\r\n", "\n")
+		}
+		output = strings.TrimRight(output, "\n\r")
+	}
 
 	return &ResolveResult{
 		Value:    output,
@@ -350,9 +914,66 @@ func (r *Resolver) resolveCommand(ctx context.Context, val config.Value, existin
 	}, nil
 }
 
+// runPipe runs a pipe command on a resolved value, with the default command
+// timeout since a pipe has no timeout option of its own.
+func (r *Resolver) runPipe(ctx context.Context, pipe, value string) (string, error) {
+	if r.commandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.commandTimeout)
+		defer cancel()
+	}
+
+	piped, err := runShell(ctx, pipe, value, nil)
+	if err != nil {
+		if r.commandTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("pipe command %q timed out after %s", pipe, r.commandTimeout)
+		}
+		return "", fmt.Errorf("running pipe command: %w", err)
+	}
+	return piped, nil
+}
+
+// runShell executes command with sh -c to support shell features and returns
+// its output with trailing newlines trimmed. stdin is written to the command's
+// standard input, so values never appear in the process list. env is added to
+// the environment inherited from vsg.
+func runShell(ctx context.Context, command, stdin string, env map[string]string) (string, error) {
+	output, err := runShellOutput(ctx, command, stdin, env)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(output), "\n\r"), nil
+}
+
+// runShellOutput is runShell returning the command's output untouched.
+func runShellOutput(ctx context.Context, command, stdin string, env map[string]string) ([]byte, error) {
+	// #nosec G204 -- Command is intentionally user-configured
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = strings.NewReader(stdin)
+	if len(env) > 0 {
+		cmd.Env = os.Environ()
+		for _, name := range slices.Sorted(maps.Keys(env)) {
+			cmd.Env = append(cmd.Env, name+"="+env[name])
+		}
+	}
+	// Don't wait on children of a killed shell that still hold the output pipes
+	cmd.WaitDelay = time.Second
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w (stderr: %s)", err, stderr.String())
+	}
+
+	return stdout.Bytes(), nil
+}
+
 // ResolveHash resolves a hash value (bcrypt, argon2, pbkdf2).
 // sourceValue is the password to hash (from resolvedValues map).
-// existingValue is the current hash in Vault (if any).
+// existingValue is the current hash in Vault (if any). An empty hash never
+// verifies, so it is replaced whether or not the key is present.
 // force forces regeneration of the hash.
 func (r *Resolver) ResolveHash(val config.Value, sourceValue, existingValue string, force bool) (*ResolveResult, error) {
 	// Determine effective strategy
@@ -377,7 +998,7 @@ func (r *Resolver) ResolveHash(val config.Value, sourceValue, existingValue stri
 func (r *Resolver) resolveBcrypt(val config.Value, sourceValue, existingValue string, force bool, strategy config.Strategy) (*ResolveResult, error) {
 	// --force overrides everything: regenerate hash
 	if force {
-		hash, err := generator.HashBcrypt(sourceValue, *val.Bcrypt)
+		hash, err := hashBcrypt(sourceValue, *val.Bcrypt)
 		if err != nil {
 			return nil, fmt.Errorf("generating bcrypt hash: %w", err)
 		}
@@ -390,7 +1011,7 @@ func (r *Resolver) resolveBcrypt(val config.Value, sourceValue, existingValue st
 
 	// If hash doesn't exist, create it (both strategies)
 	if existingValue == "" {
-		hash, err := generator.HashBcrypt(sourceValue, *val.Bcrypt)
+		hash, err := hashBcrypt(sourceValue, *val.Bcrypt)
 		if err != nil {
 			return nil, fmt.Errorf("generating bcrypt hash: %w", err)
 		}
@@ -416,7 +1037,7 @@ func (r *Resolver) resolveBcrypt(val config.Value, sourceValue, existingValue st
 		}, nil
 	}
 
-	// strategy == StrategyUpdate
+	// strategy == StrategyUpdate or StrategyReplace
 	if verifies {
 		// Hash is valid, no update needed
 		return &ResolveResult{
@@ -427,7 +1048,7 @@ func (r *Resolver) resolveBcrypt(val config.Value, sourceValue, existingValue st
 	}
 
 	// Hash is stale, regenerate
-	hash, err := generator.HashBcrypt(sourceValue, *val.Bcrypt)
+	hash, err := hashBcrypt(sourceValue, *val.Bcrypt)
 	if err != nil {
 		return nil, fmt.Errorf("generating bcrypt hash: %w", err)
 	}
@@ -442,7 +1063,7 @@ func (r *Resolver) resolveBcrypt(val config.Value, sourceValue, existingValue st
 func (r *Resolver) resolveArgon2(val config.Value, sourceValue, existingValue string, force bool, strategy config.Strategy) (*ResolveResult, error) {
 	// --force overrides everything: regenerate hash
 	if force {
-		hash, err := generator.HashArgon2(sourceValue, *val.Argon2)
+		hash, err := hashArgon2(sourceValue, *val.Argon2)
 		if err != nil {
 			return nil, fmt.Errorf("generating argon2 hash: %w", err)
 		}
@@ -455,7 +1076,7 @@ func (r *Resolver) resolveArgon2(val config.Value, sourceValue, existingValue st
 
 	// If hash doesn't exist, create it (both strategies)
 	if existingValue == "" {
-		hash, err := generator.HashArgon2(sourceValue, *val.Argon2)
+		hash, err := hashArgon2(sourceValue, *val.Argon2)
 		if err != nil {
 			return nil, fmt.Errorf("generating argon2 hash: %w", err)
 		}
@@ -481,7 +1102,7 @@ func (r *Resolver) resolveArgon2(val config.Value, sourceValue, existingValue st
 		}, nil
 	}
 
-	// strategy == StrategyUpdate
+	// strategy == StrategyUpdate or StrategyReplace
 	if verifies {
 		// Hash is valid, no update needed
 		return &ResolveResult{
@@ -492,7 +1113,7 @@ func (r *Resolver) resolveArgon2(val config.Value, sourceValue, existingValue st
 	}
 
 	// Hash is stale, regenerate
-	hash, err := generator.HashArgon2(sourceValue, *val.Argon2)
+	hash, err := hashArgon2(sourceValue, *val.Argon2)
 	if err != nil {
 		return nil, fmt.Errorf("generating argon2 hash: %w", err)
 	}
@@ -507,7 +1128,7 @@ func (r *Resolver) resolveArgon2(val config.Value, sourceValue, existingValue st
 func (r *Resolver) resolvePbkdf2(val config.Value, sourceValue, existingValue string, force bool, strategy config.Strategy) (*ResolveResult, error) {
 	// --force overrides everything: regenerate hash
 	if force {
-		hash, err := generator.HashPbkdf2(sourceValue, *val.Pbkdf2)
+		hash, err := hashPbkdf2(sourceValue, *val.Pbkdf2)
 		if err != nil {
 			return nil, fmt.Errorf("generating pbkdf2 hash: %w", err)
 		}
@@ -520,7 +1141,7 @@ func (r *Resolver) resolvePbkdf2(val config.Value, sourceValue, existingValue st
 
 	// If hash doesn't exist, create it (both strategies)
 	if existingValue == "" {
-		hash, err := generator.HashPbkdf2(sourceValue, *val.Pbkdf2)
+		hash, err := hashPbkdf2(sourceValue, *val.Pbkdf2)
 		if err != nil {
 			return nil, fmt.Errorf("generating pbkdf2 hash: %w", err)
 		}
@@ -546,7 +1167,7 @@ func (r *Resolver) resolvePbkdf2(val config.Value, sourceValue, existingValue st
 		}, nil
 	}
 
-	// strategy == StrategyUpdate
+	// strategy == StrategyUpdate or StrategyReplace
 	if verifies {
 		// Hash is valid, no update needed
 		return &ResolveResult{
@@ -557,7 +1178,7 @@ func (r *Resolver) resolvePbkdf2(val config.Value, sourceValue, existingValue st
 	}
 
 	// Hash is stale, regenerate
-	hash, err := generator.HashPbkdf2(sourceValue, *val.Pbkdf2)
+	hash, err := hashPbkdf2(sourceValue, *val.Pbkdf2)
 	if err != nil {
 		return nil, fmt.Errorf("generating pbkdf2 hash: %w", err)
 	}
@@ -568,6 +1189,96 @@ func (r *Resolver) resolvePbkdf2(val config.Value, sourceValue, existingValue st
 	}, nil
 }
 
+// resolveHashed resolves the value wrapped by hash() and hashes it.
+// The plaintext is never compared to Vault directly: an existing hash is kept
+// with the create strategy, and with update only while it still verifies
+// against the freshly resolved plaintext.
+func (r *Resolver) resolveHashed(ctx context.Context, val config.Value, existingValue string, exists, force bool, strategy config.Strategy) (*ResolveResult, error) {
+	if val.Inner == nil {
+		return nil, fmt.Errorf("hash() has no value to hash")
+	}
+
+	if exists && !force && strategy == config.StrategyCreate {
+		return &ResolveResult{
+			Value:    existingValue,
+			Source:   SourceExisting,
+			Strategy: strategy,
+		}, nil
+	}
+
+	// Resolve the plaintext without an existing value: Vault holds the hash
+	inner, err := r.Resolve(ctx, *val.Inner, "", false, force)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists && !force && verifyHash(val.HashAlgorithm, existingValue, inner.Value) {
+		return &ResolveResult{
+			Value:    existingValue,
+			Source:   SourceExisting,
+			Strategy: strategy,
+		}, nil
+	}
+
+	var hash string
+	var source ValueSource
+	switch val.HashAlgorithm {
+	case config.ValueTypeBcrypt:
+		hash, err = hashBcrypt(inner.Value, *val.Bcrypt)
+		source = SourceBcrypt
+	case config.ValueTypeArgon2:
+		hash, err = hashArgon2(inner.Value, *val.Argon2)
+		source = SourceArgon2
+	case config.ValueTypePbkdf2:
+		hash, err = hashPbkdf2(inner.Value, *val.Pbkdf2)
+		source = SourcePbkdf2
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm: %s", val.HashAlgorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generating %s hash: %w", val.HashAlgorithm, err)
+	}
+
+	return &ResolveResult{
+		Value:    hash,
+		Source:   source,
+		Strategy: strategy,
+	}, nil
+}
+
+// verifyHash reports whether hash was produced from plaintext with algo.
+func verifyHash(algo config.ValueType, hash, plaintext string) bool {
+	switch algo {
+	case config.ValueTypeBcrypt:
+		return generator.VerifyBcrypt(hash, plaintext)
+	case config.ValueTypeArgon2:
+		return generator.VerifyArgon2(hash, plaintext)
+	case config.ValueTypePbkdf2:
+		return generator.VerifyPbkdf2(hash, plaintext)
+	default:
+		return false
+	}
+}
+
+// DependsOn returns the key a value is computed from: the from key of a hash
+// type, or the private key of an ssh_keygen() public key or a tls_cert()
+// certificate. It returns "" for values resolved on their own.
+func DependsOn(val config.Value) string {
+	return val.DependsOn()
+}
+
+// ResolveFrom resolves a value computed from the resolved value of the key
+// returned by DependsOn.
+func (r *Resolver) ResolveFrom(ctx context.Context, val config.Value, sourceValue, existingValue string, exists, force bool) (*ResolveResult, error) {
+	switch val.Type {
+	case config.ValueTypeSSHPublicKey:
+		return r.resolveSSHPublicKey(val, sourceValue, existingValue)
+	case config.ValueTypeTLSCert:
+		return r.resolveTLSCert(ctx, val, sourceValue, existingValue, exists, force)
+	}
+	return r.ResolveHash(val, sourceValue, existingValue, force)
+}
+
 // IsHashType returns true if the value type is a hash function.
 func IsHashType(t config.ValueType) bool {
 	return t == config.ValueTypeBcrypt || t == config.ValueTypeArgon2 || t == config.ValueTypePbkdf2
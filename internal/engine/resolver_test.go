@@ -2,10 +2,16 @@ package engine
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
 	"github.com/pavlenkoa/vault-secrets-generator/internal/fetcher"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/generator"
 )
 
 func TestResolver_ResolveStatic(t *testing.T) {
@@ -21,7 +27,7 @@ func TestResolver_ResolveStatic(t *testing.T) {
 		Static: "static-value",
 	}
 
-	result, err := resolver.Resolve(ctx, val, "", false)
+	result, err := resolver.Resolve(ctx, val, "", false, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -46,7 +52,7 @@ func TestResolver_ResolveGenerate(t *testing.T) {
 		Type: config.ValueTypeGenerate,
 	}
 
-	result, err := resolver.Resolve(ctx, val, "", false)
+	result, err := resolver.Resolve(ctx, val, "", false, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -75,7 +81,7 @@ func TestResolver_ResolveGenerateWithParams(t *testing.T) {
 		},
 	}
 
-	result, err := resolver.Resolve(ctx, val, "", false)
+	result, err := resolver.Resolve(ctx, val, "", false, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -98,7 +104,7 @@ func TestResolver_ResolveGenerateExistingNoForce(t *testing.T) {
 	}
 
 	// With existing value and no force, should keep existing (default strategy is "create")
-	result, err := resolver.Resolve(ctx, val, "existing-password", false)
+	result, err := resolver.Resolve(ctx, val, "existing-password", true, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -124,7 +130,7 @@ func TestResolver_ResolveGenerateExistingWithForce(t *testing.T) {
 	}
 
 	// With force, should generate new value
-	result, err := resolver.Resolve(ctx, val, "existing-password", true)
+	result, err := resolver.Resolve(ctx, val, "existing-password", true, true)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -137,6 +143,52 @@ func TestResolver_ResolveGenerateExistingWithForce(t *testing.T) {
 	}
 }
 
+func TestResolver_ResolveCreateAbsentVsEmpty(t *testing.T) {
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		val    config.Value
+		exists bool
+		source ValueSource
+	}{
+		{"generate absent", config.Value{Type: config.ValueTypeGenerate}, false, SourceGenerated},
+		{"generate present but empty", config.Value{Type: config.ValueTypeGenerate}, true, SourceExisting},
+		{"uuid absent", config.Value{Type: config.ValueTypeUUID}, false, SourceGenerated},
+		{"uuid present but empty", config.Value{Type: config.ValueTypeUUID}, true, SourceExisting},
+		{"command absent", config.Value{Type: config.ValueTypeCommand, Command: "echo hello", Strategy: config.StrategyCreate}, false, SourceCommand},
+		{"command present but empty", config.Value{Type: config.ValueTypeCommand, Command: "echo hello", Strategy: config.StrategyCreate}, true, SourceExisting},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := resolver.Resolve(ctx, tt.val, "", tt.exists, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Source != tt.source {
+				t.Errorf("Source = %s, want %s", result.Source, tt.source)
+			}
+			if tt.source == SourceExisting && result.Value != "" {
+				t.Errorf("Value = %q, want the empty existing value", result.Value)
+			}
+			if tt.source != SourceExisting && result.Value == "" {
+				t.Error("expected a new value for an absent key")
+			}
+		})
+	}
+
+	// force replaces a present empty value like any other
+	result, err := resolver.Resolve(ctx, config.Value{Type: config.ValueTypeGenerate}, "", true, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Source != SourceGenerated {
+		t.Errorf("Source = %s, want %s", result.Source, SourceGenerated)
+	}
+}
+
 func TestResolver_ResolveJSON(t *testing.T) {
 	registry := fetcher.NewRegistry()
 	defaults := config.DefaultPasswordPolicy()
@@ -168,7 +220,7 @@ func TestResolver_ResolveJSON(t *testing.T) {
 		Query: ".outputs.endpoint.value",
 	}
 
-	result, err := resolver.Resolve(ctx, val, "", false)
+	result, err := resolver.Resolve(ctx, val, "", false, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -181,6 +233,52 @@ func TestResolver_ResolveJSON(t *testing.T) {
 	}
 }
 
+func TestResolver_ResolveTyped(t *testing.T) {
+	registry := fetcher.NewRegistry()
+	registry.Register(&mockFetcherImpl{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			if strings.HasSuffix(uri, ".json") {
+				return []byte(`{"replicas": 3, "ratio": 0.5}`), nil
+			}
+			return []byte("port: 5432\ndebug: false\nhost: db.internal\nquoted: \"5432\"\nlimit: .inf\n"), nil
+		},
+	})
+	resolver := NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+
+	tests := []struct {
+		name    string
+		val     config.Value
+		want    string
+		wantErr string
+	}{
+		{"yaml number", config.Value{Type: config.ValueTypeYAML, URL: "s3://b/app.yaml", Query: ".port", As: config.WriteTypeNumber}, "5432", ""},
+		{"yaml bool", config.Value{Type: config.ValueTypeYAML, URL: "s3://b/app.yaml", Query: ".debug", As: config.WriteTypeBool}, "false", ""},
+		{"json number", config.Value{Type: config.ValueTypeJSON, URL: "s3://b/app.json", Query: ".ratio", As: config.WriteTypeNumber}, "0.5", ""},
+		{"string as number", config.Value{Type: config.ValueTypeYAML, URL: "s3://b/app.yaml", Query: ".quoted", As: config.WriteTypeNumber}, "", "value is a string, not a number"},
+		{"number as bool", config.Value{Type: config.ValueTypeYAML, URL: "s3://b/app.yaml", Query: ".port", As: config.WriteTypeBool}, "", "value is a number, not a bool"},
+		{"infinity", config.Value{Type: config.ValueTypeYAML, URL: "s3://b/app.yaml", Query: ".limit", As: config.WriteTypeNumber}, "", "not a finite number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := resolver.Resolve(context.Background(), tt.val, "", false, false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Value != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, result.Value)
+			}
+		})
+	}
+}
+
 func TestResolver_ResolveJSONCaching(t *testing.T) {
 	registry := fetcher.NewRegistry()
 	defaults := config.DefaultPasswordPolicy()
@@ -219,12 +317,12 @@ func TestResolver_ResolveJSONCaching(t *testing.T) {
 	}
 
 	// Resolve two values from the same source file
-	_, err := resolver.Resolve(ctx, val1, "", false)
+	_, err := resolver.Resolve(ctx, val1, "", false, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_, err = resolver.Resolve(ctx, val2, "", false)
+	_, err = resolver.Resolve(ctx, val2, "", false, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -248,7 +346,7 @@ func TestResolver_ResolveCommand(t *testing.T) {
 		Command: "echo hello-world",
 	}
 
-	result, err := resolver.Resolve(ctx, val, "", false)
+	result, err := resolver.Resolve(ctx, val, "", false, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -261,6 +359,237 @@ func TestResolver_ResolveCommand(t *testing.T) {
 	}
 }
 
+func TestResolver_ResolveCommandTimeout(t *testing.T) {
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+
+	tests := []struct {
+		name           string
+		defaultTimeout time.Duration
+		timeout        time.Duration
+	}{
+		{"value timeout", 0, 100 * time.Millisecond},
+		{"default timeout", 100 * time.Millisecond, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver.commandTimeout = tt.defaultTimeout
+			val := config.Value{
+				Type:    config.ValueTypeCommand,
+				Command: "sleep 5",
+				Timeout: tt.timeout,
+			}
+
+			start := time.Now()
+			_, err := resolver.Resolve(context.Background(), val, "", false, false)
+			if err == nil {
+				t.Fatal("expected a timeout error")
+			}
+			if !strings.Contains(err.Error(), `command "sleep 5" timed out after 100ms`) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("command ran for %s despite the timeout", elapsed)
+			}
+		})
+	}
+
+	// The value's own timeout wins over the default
+	resolver.commandTimeout = time.Millisecond
+	val := config.Value{Type: config.ValueTypeCommand, Command: "sleep 0.2; echo done", Timeout: 5 * time.Second}
+	result, err := resolver.Resolve(context.Background(), val, "", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Value != "done" {
+		t.Errorf("expected 'done', got %q", result.Value)
+	}
+}
+
+func TestResolver_ResolveCommandStdinEnv(t *testing.T) {
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	ctx := context.Background()
+
+	// A static stdin reaches the command unchanged
+	val := config.Value{
+		Type:    config.ValueTypeCommand,
+		Command: "cat",
+		Stdin:   &config.Value{Type: config.ValueTypeStatic, Static: "s3cret"},
+	}
+	result, err := resolver.Resolve(ctx, val, "", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Value != "s3cret" {
+		t.Errorf("expected 's3cret', got %q", result.Value)
+	}
+
+	// A generated stdin is resolved first
+	val.Command = "wc -c | tr -d ' '"
+	val.Stdin = &config.Value{Type: config.ValueTypeGenerate, Generate: &config.PasswordPolicy{Length: 24, Digits: 4}}
+	result, err = resolver.Resolve(ctx, val, "", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Value != "24" {
+		t.Errorf("expected 24 bytes on stdin, got %q", result.Value)
+	}
+
+	// env is added to the inherited environment
+	t.Setenv("VSG_INHERITED", "kept")
+	val = config.Value{
+		Type:    config.ValueTypeCommand,
+		Command: `echo "$VSG_INJECTED $VSG_INHERITED"`,
+		Env:     map[string]string{"VSG_INJECTED": "bar"},
+	}
+	result, err = resolver.Resolve(ctx, val, "", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Value != "bar kept" {
+		t.Errorf("expected 'bar kept', got %q", result.Value)
+	}
+
+	// A failing stdin fails the command without running it
+	val = config.Value{
+		Type:    config.ValueTypeCommand,
+		Command: "cat",
+		Stdin:   &config.Value{Type: config.ValueTypeCommand, Command: "exit 3"},
+	}
+	if _, err := resolver.Resolve(ctx, val, "", false, false); err == nil || !strings.Contains(err.Error(), "resolving command stdin") {
+		t.Errorf("expected a stdin error, got %v", err)
+	}
+}
+
+func TestResolver_ResolveCommandOutput(t *testing.T) {
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+
+	tests := []struct {
+		name     string
+		command  string
+		normal   bool
+		binary   string
+		expected string
+	}{
+		{"crlf kept", `printf 'a\r\nb\r\n'`, false, "", "a\r\nb"},
+		{"crlf normalized", `printf 'a\r\nb\r\n'`, true, "", "a\nb"},
+		{"lone cr kept", `printf 'a\rb'`, true, "", "a\rb"},
+		{"binary as is", `printf '\377\376\n'`, false, "", "\xff\xfe"},
+		{"binary encoded", `printf '\377\376\n'`, false, config.BinaryBase64, "//4K"},
+		{"utf8 not encoded", `printf 'h\303\251llo\n'`, false, config.BinaryBase64, "h\u00e9llo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			val := config.Value{
+				Type:              config.ValueTypeCommand,
+				Command:           tt.command,
+				NormalizeNewlines: tt.normal,
+				Binary:            tt.binary,
+			}
+			result, err := resolver.Resolve(context.Background(), val, "", false, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Value != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Value)
+			}
+		})
+	}
+}
+
+func TestResolver_ResolvePipe(t *testing.T) {
+	registry := fetcher.NewRegistry()
+	defaults := config.DefaultPasswordPolicy()
+	strategies := config.DefaultStrategyDefaults()
+	resolver := NewResolver(registry, nil, defaults, strategies)
+
+	ctx := context.Background()
+
+	val := config.Value{
+		Type:    config.ValueTypeCommand,
+		Command: "echo hello-world",
+		Pipe:    "tr a-z A-Z",
+	}
+
+	result, err := resolver.Resolve(ctx, val, "", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Value != "HELLO-WORLD" {
+		t.Errorf("expected 'HELLO-WORLD', got %q", result.Value)
+	}
+	if result.Source != SourceCommand {
+		t.Errorf("expected SourceCommand, got %s", result.Source)
+	}
+}
+
+func TestResolver_ResolvePipeSkippedWhenKeepingExisting(t *testing.T) {
+	registry := fetcher.NewRegistry()
+	defaults := config.DefaultPasswordPolicy()
+	strategies := config.DefaultStrategyDefaults()
+	resolver := NewResolver(registry, nil, defaults, strategies)
+
+	val := config.Value{
+		Type: config.ValueTypeGenerate,
+		Pipe: "tr a-z A-Z",
+	}
+
+	result, err := resolver.Resolve(context.Background(), val, "existing-password", true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Value != "existing-password" {
+		t.Errorf("expected existing value to be kept unpiped, got %q", result.Value)
+	}
+}
+
+func TestResolver_ResolvePipeError(t *testing.T) {
+	registry := fetcher.NewRegistry()
+	defaults := config.DefaultPasswordPolicy()
+	strategies := config.DefaultStrategyDefaults()
+	resolver := NewResolver(registry, nil, defaults, strategies)
+
+	val := config.Value{
+		Type:    config.ValueTypeCommand,
+		Command: "echo hello",
+		Pipe:    "echo boom >&2; exit 1",
+	}
+
+	_, err := resolver.Resolve(context.Background(), val, "", false, false)
+	if err == nil {
+		t.Fatal("expected error from failing pipe command")
+	}
+	if !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected stderr in error, got: %v", err)
+	}
+}
+
+func TestResolver_ResolvePipeTimeout(t *testing.T) {
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	resolver.commandTimeout = 100 * time.Millisecond
+
+	val := config.Value{
+		Type:   config.ValueTypeStatic,
+		Static: "hello",
+		Pipe:   "sleep 5",
+	}
+
+	start := time.Now()
+	_, err := resolver.Resolve(context.Background(), val, "", false, false)
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if !strings.Contains(err.Error(), `pipe command "sleep 5" timed out after 100ms`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("pipe ran for %s despite the timeout", elapsed)
+	}
+}
+
 func TestResolver_ResolveGenerateWithUpdateStrategy(t *testing.T) {
 	registry := fetcher.NewRegistry()
 	defaults := config.DefaultPasswordPolicy()
@@ -275,7 +604,7 @@ func TestResolver_ResolveGenerateWithUpdateStrategy(t *testing.T) {
 		Strategy: config.StrategyUpdate,
 	}
 
-	result, err := resolver.Resolve(ctx, val, "existing-password", false)
+	result, err := resolver.Resolve(ctx, val, "existing-password", true, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -289,6 +618,280 @@ func TestResolver_ResolveGenerateWithUpdateStrategy(t *testing.T) {
 	}
 }
 
+func TestResolver_ResolveGenerateNamedPolicy(t *testing.T) {
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	resolver.policies = map[string]config.PasswordPolicy{
+		"pin": {Length: 6, Digits: 6, Symbols: 0, NoUpper: true},
+	}
+
+	ctx := context.Background()
+
+	val := config.Value{
+		Type:       config.ValueTypeGenerate,
+		PolicyName: "pin",
+	}
+
+	result, err := resolver.Resolve(ctx, val, "", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Value) != 6 {
+		t.Errorf("expected length 6, got %d", len(result.Value))
+	}
+	for _, c := range result.Value {
+		if c < '0' || c > '9' {
+			t.Errorf("expected only digits, got %q", result.Value)
+			break
+		}
+	}
+
+	// Unknown policy names are an error
+	val.PolicyName = "missing"
+	if _, err := resolver.Resolve(ctx, val, "", false, false); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestResolver_GenerateInheritsSymbols(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     string
+		wantSymbols int
+	}{
+		{"shell_safe", `shell_safe = true`, 3},
+		{"json_safe", `json_safe = true`, 3},
+		{"exclude_ambiguous", `exclude_ambiguous = true`, 3},
+		{"min_entropy", `min_entropy = 128`, 3},
+		{"require_each_class", `require_each_class = true`, 3},
+		{"length", `length = 20`, 3},
+		{"symbols set", `symbols = 1`, 1},
+		{"symbols zero", `symbols = 0`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+defaults {
+  generate {
+    symbols    = 3
+    symbol_set = "-_@"
+  }
+}
+
+secret "app" {
+  path = "app"
+  content {
+    password = generate({` + tt.options + `})
+  }
+}
+`
+			cfg, err := config.ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err != nil {
+				t.Fatalf("parsing config: %v", err)
+			}
+			resolver := NewResolver(fetcher.NewRegistry(), nil, cfg.Defaults.Generate, cfg.Defaults.Strategy)
+			val := cfg.Secrets["app"].Content["password"]
+
+			policy, err := resolver.generatePolicy(val)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if policy.Symbols != tt.wantSymbols {
+				t.Errorf("symbols = %d, want %d", policy.Symbols, tt.wantSymbols)
+			}
+
+			result, err := resolver.Resolve(context.Background(), val, "", false, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := strings.Count(result.Value, "-") + strings.Count(result.Value, "_") + strings.Count(result.Value, "@"); got < tt.wantSymbols {
+				t.Errorf("expected at least %d symbols, got %q", tt.wantSymbols, result.Value)
+			}
+		})
+	}
+}
+
+func TestResolver_ParsesSourceOnce(t *testing.T) {
+	jsonParses, yamlParses := 0, 0
+	origJSON, origYAML := parseJSON, parseYAML
+	parseJSON = func(data []byte) (interface{}, error) {
+		jsonParses++
+		return origJSON(data)
+	}
+	parseYAML = func(data []byte) (interface{}, error) {
+		yamlParses++
+		return origYAML(data)
+	}
+	defer func() { parseJSON, parseYAML = origJSON, origYAML }()
+
+	registry := fetcher.NewRegistry()
+	registry.Register(&mockFetcherImpl{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			return []byte(`{"db": {"host": "db.example.com", "port": 5432}}`), nil
+		},
+	})
+	resolver := NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	ctx := context.Background()
+
+	const url = "s3://bucket/outputs.json"
+	queries := []config.Value{
+		{Type: config.ValueTypeJSON, URL: url, Query: ".db.host"},
+		{Type: config.ValueTypeJSON, URL: url, Query: ".db.port"},
+		{Type: config.ValueTypeYAML, URL: url, Query: ".db.host"},
+		{Type: config.ValueTypeYAML, URL: url, Query: ".db.port"},
+		{Type: config.ValueTypeRaw, URL: url},
+	}
+
+	for _, val := range queries {
+		if _, err := resolver.Resolve(ctx, val, "", false, false); err != nil {
+			t.Fatalf("unexpected error resolving %s %s: %v", val.Type, val.Query, err)
+		}
+	}
+
+	if jsonParses != 1 {
+		t.Errorf("expected 1 JSON parse, got %d", jsonParses)
+	}
+	if yamlParses != 1 {
+		t.Errorf("expected 1 YAML parse, got %d", yamlParses)
+	}
+}
+
+func TestResolver_ResolveUUID(t *testing.T) {
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	ctx := context.Background()
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	val := config.Value{Type: config.ValueTypeUUID}
+
+	result, err := resolver.Resolve(ctx, val, "", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !uuidPattern.MatchString(result.Value) {
+		t.Errorf("expected a v4 UUID, got %q", result.Value)
+	}
+	if result.Source != SourceGenerated {
+		t.Errorf("expected SourceGenerated, got %s", result.Source)
+	}
+
+	// Existing UUID is preserved under the default create strategy
+	existing := "0b6f6a53-7c2e-4b8e-9a51-2f4d2b1c9e10"
+	result, err = resolver.Resolve(ctx, val, existing, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Value != existing || result.Source != SourceExisting {
+		t.Errorf("expected existing UUID to be kept, got %q (%s)", result.Value, result.Source)
+	}
+
+	// --force regenerates
+	result, err = resolver.Resolve(ctx, val, existing, true, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Value == existing || !uuidPattern.MatchString(result.Value) {
+		t.Errorf("expected a new UUID with force, got %q", result.Value)
+	}
+}
+
+func TestResolver_ResolveGeneratePassphrase(t *testing.T) {
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+
+	val := config.Value{
+		Type:       config.ValueTypeGenerate,
+		Passphrase: &config.PassphrasePolicy{Words: 4, Separator: "."},
+	}
+
+	result, err := resolver.Resolve(context.Background(), val, "", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Source != SourceGenerated {
+		t.Errorf("expected SourceGenerated, got %s", result.Source)
+	}
+	if words := strings.Split(result.Value, "."); len(words) != 4 {
+		t.Errorf("expected 4 words, got %q", result.Value)
+	}
+}
+
+func TestResolver_GenerateSkippedWhenKeepingExisting(t *testing.T) {
+	calls := 0
+	orig := generatePassword
+	generatePassword = func(policy config.PasswordPolicy) (string, error) {
+		calls++
+		return orig(policy)
+	}
+	defer func() { generatePassword = orig }()
+
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+
+	val := config.Value{Type: config.ValueTypeGenerate}
+	result, err := resolver.Resolve(context.Background(), val, "existing-password", true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Source != SourceExisting {
+		t.Errorf("expected SourceExisting, got %s", result.Source)
+	}
+	if calls != 0 {
+		t.Errorf("expected no password generation, got %d calls", calls)
+	}
+}
+
+func TestResolver_HashSkippedWhenKeepingExisting(t *testing.T) {
+	existing, err := generator.HashBcrypt("source-password", config.BcryptConfig{Cost: 4})
+	if err != nil {
+		t.Fatalf("generating fixture hash: %v", err)
+	}
+
+	calls := 0
+	orig := hashBcrypt
+	hashBcrypt = func(password string, cfg config.BcryptConfig) (string, error) {
+		calls++
+		return orig(password, cfg)
+	}
+	defer func() { hashBcrypt = orig }()
+
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+
+	tests := []struct {
+		name     string
+		strategy config.Strategy
+		existing string
+	}{
+		{"create with valid hash", config.StrategyCreate, existing},
+		{"create with stale hash", config.StrategyCreate, "$2a$04$stalestalestalestalestalestalestalestalestalestalesta"},
+		{"update with valid hash", config.StrategyUpdate, existing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			val := config.Value{
+				Type:     config.ValueTypeBcrypt,
+				Strategy: tt.strategy,
+				Bcrypt:   &config.BcryptConfig{FromKey: "password", Cost: 4},
+			}
+
+			result, err := resolver.ResolveHash(val, "source-password", tt.existing, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if result.Value != tt.existing {
+				t.Errorf("expected existing hash to be kept")
+			}
+			if calls != 0 {
+				t.Errorf("expected no hash generation, got %d calls", calls)
+			}
+		})
+	}
+}
+
 // mockFetcherImpl implements fetcher.Fetcher for testing
 type mockFetcherImpl struct {
 	supports func(uri string) bool
@@ -302,3 +905,512 @@ func (m *mockFetcherImpl) Supports(uri string) bool {
 func (m *mockFetcherImpl) Fetch(ctx context.Context, uri string) ([]byte, error) {
 	return m.fetch(ctx, uri)
 }
+
+func TestResolver_ResolveHash(t *testing.T) {
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	ctx := context.Background()
+
+	val := config.Value{
+		Type:          config.ValueTypeHash,
+		HashAlgorithm: config.ValueTypeBcrypt,
+		Bcrypt:        &config.BcryptConfig{Cost: 4},
+		Inner: &config.Value{
+			Type:    config.ValueTypeCommand,
+			Command: "echo plaintext-password",
+		},
+	}
+
+	result, err := resolver.Resolve(ctx, val, "", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Source != SourceBcrypt {
+		t.Errorf("expected SourceBcrypt, got %s", result.Source)
+	}
+	if !generator.VerifyBcrypt(result.Value, "plaintext-password") {
+		t.Errorf("hash %q does not verify against the inner value", result.Value)
+	}
+
+	// update strategy (inherited from command) keeps a hash that still verifies
+	kept, err := resolver.Resolve(ctx, val, result.Value, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if kept.Source != SourceExisting || kept.Value != result.Value {
+		t.Errorf("expected verifying hash to be kept, got %s %q", kept.Source, kept.Value)
+	}
+
+	// ...and replaces one that no longer does
+	stale, err := generator.HashBcrypt("old-password", config.BcryptConfig{Cost: 4})
+	if err != nil {
+		t.Fatalf("generating fixture hash: %v", err)
+	}
+	updated, err := resolver.Resolve(ctx, val, stale, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Source != SourceBcrypt || !generator.VerifyBcrypt(updated.Value, "plaintext-password") {
+		t.Errorf("expected stale hash to be replaced, got %s %q", updated.Source, updated.Value)
+	}
+}
+
+func TestResolver_ResolveHashOfGenerateKeepsExisting(t *testing.T) {
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+
+	val := config.Value{
+		Type:          config.ValueTypeHash,
+		HashAlgorithm: config.ValueTypeArgon2,
+		Argon2:        &config.Argon2Config{},
+		Inner:         &config.Value{Type: config.ValueTypeGenerate},
+	}
+
+	// generate() defaults to create, so an existing hash is never regenerated
+	result, err := resolver.Resolve(context.Background(), val, "existing-hash", true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Source != SourceExisting || result.Value != "existing-hash" {
+		t.Errorf("expected existing hash to be kept, got %s %q", result.Source, result.Value)
+	}
+
+	forced, err := resolver.Resolve(context.Background(), val, "existing-hash", true, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if forced.Source != SourceArgon2 {
+		t.Errorf("expected --force to rehash, got %s", forced.Source)
+	}
+}
+
+func TestResolver_ResolveRawMaxSize(t *testing.T) {
+	registry := fetcher.NewRegistry()
+	registry.Register(&mockFetcherImpl{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			return []byte(strings.Repeat("x", DefaultRawMaxSize+1)), nil
+		},
+	})
+	resolver := NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	ctx := context.Background()
+
+	val := config.Value{
+		Type: config.ValueTypeRaw,
+		URL:  "s3://bucket/big.bin",
+	}
+
+	_, err := resolver.Resolve(ctx, val, "", false, false)
+	if err == nil {
+		t.Fatal("expected error for content over the default limit")
+	}
+	if !strings.Contains(err.Error(), "s3://bucket/big.bin") || !strings.Contains(err.Error(), "1048577 bytes") {
+		t.Errorf("expected URL and size in error, got: %v", err)
+	}
+
+	// A per-value limit overrides the default
+	val.MaxSize = 2 * DefaultRawMaxSize
+	result, err := resolver.Resolve(ctx, val, "", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error with raised limit: %v", err)
+	}
+	if len(result.Value) != DefaultRawMaxSize+1 {
+		t.Errorf("expected full content, got %d bytes", len(result.Value))
+	}
+}
+
+// versionedVaultReader serves one key whose value depends on the version
+// read, 0 being the latest.
+type versionedVaultReader map[int]string
+
+func (v versionedVaultReader) ReadSecret(ctx context.Context, path, key string, version int) (string, error) {
+	value, ok := v[version]
+	if !ok {
+		return "", fmt.Errorf("version %d of secret %s not found or deleted", version, path)
+	}
+	return value, nil
+}
+
+func TestResolver_ResolveVaultVersion(t *testing.T) {
+	reader := versionedVaultReader{0: "latest", 3: "third"}
+	resolver := NewResolver(nil, reader, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	ctx := context.Background()
+
+	tests := []struct {
+		version  int
+		expected string
+	}{
+		{0, "latest"},
+		{3, "third"},
+	}
+	for _, tt := range tests {
+		val := config.Value{Type: config.ValueTypeVault, VaultPath: "secret/shared", VaultKey: "api_key", VaultVersion: tt.version}
+		result, err := resolver.Resolve(ctx, val, "", false, false)
+		if err != nil {
+			t.Fatalf("version %d: unexpected error: %v", tt.version, err)
+		}
+		if result.Value != tt.expected {
+			t.Errorf("version %d: Value = %q, want %q", tt.version, result.Value, tt.expected)
+		}
+	}
+
+	val := config.Value{Type: config.ValueTypeVault, VaultPath: "secret/shared", VaultKey: "api_key", VaultVersion: 2}
+	if _, err := resolver.Resolve(ctx, val, "", false, false); err == nil || !strings.Contains(err.Error(), "key api_key version 2") {
+		t.Errorf("expected an error naming version 2, got: %v", err)
+	}
+}
+
+func TestResolver_ResolveRawJSONFormat(t *testing.T) {
+	doc := "{\n  \"b\": [1, 2],\n  \"a\": {\"x\": 1.50}\n}\n"
+	registry := fetcher.NewRegistry()
+	registry.Register(&mockFetcherImpl{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			if uri == "s3://bucket/notes.txt" {
+				return []byte("not json"), nil
+			}
+			return []byte(doc), nil
+		},
+	})
+	resolver := NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	ctx := context.Background()
+
+	// Key order and numbers are kept as they are in the document
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"", doc},
+		{config.JSONFormatMinify, `{"b":[1,2],"a":{"x":1.50}}`},
+		{config.JSONFormatPretty, "{\n  \"b\": [\n    1,\n    2\n  ],\n  \"a\": {\n    \"x\": 1.50\n  }\n}"},
+	}
+	for _, tt := range tests {
+		val := config.Value{Type: config.ValueTypeRaw, URL: "s3://bucket/app.json", JSONFormat: tt.format}
+		result, err := resolver.Resolve(ctx, val, "", false, false)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.format, err)
+		}
+		if result.Value != tt.expected {
+			t.Errorf("%q: Value = %q, want %q", tt.format, result.Value, tt.expected)
+		}
+	}
+
+	val := config.Value{Type: config.ValueTypeRaw, URL: "s3://bucket/notes.txt", JSONFormat: config.JSONFormatMinify}
+	if _, err := resolver.Resolve(ctx, val, "", false, false); err == nil || !strings.Contains(err.Error(), "minify needs a JSON document") {
+		t.Errorf("expected an error for content that isn't JSON, got: %v", err)
+	}
+}
+
+func TestResolver_GroupValuesResolveIndependently(t *testing.T) {
+	hcl := `
+secret "queues" {
+  path = "queues"
+
+  content {
+    group {
+      keys  = ["orders", "payments", "emails"]
+      value = generate({length = 24})
+    }
+  }
+}
+`
+	cfg, err := config.ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("parsing config: %v", err)
+	}
+
+	resolver := NewResolver(fetcher.NewRegistry(), nil, cfg.Defaults.Generate, cfg.Defaults.Strategy)
+
+	values := make(map[string]bool)
+	for key, val := range cfg.Secrets["queues"].Content {
+		result, err := resolver.Resolve(context.Background(), val, "", false, false)
+		if err != nil {
+			t.Fatalf("resolving %s: %v", key, err)
+		}
+		if len(result.Value) != 24 {
+			t.Errorf("%s: expected length 24, got %d", key, len(result.Value))
+		}
+		values[result.Value] = true
+	}
+
+	if len(values) != 3 {
+		t.Errorf("expected 3 distinct values, got %d", len(values))
+	}
+}
+
+func TestResolver_ResolveTransforms(t *testing.T) {
+	registry := fetcher.NewRegistry()
+	registry.Register(&mockFetcherImpl{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			switch uri {
+			case "s3://bucket/cert.b64":
+				return []byte("LS0tLS1CRUdJTi0tLS0t\n"), nil
+			case "s3://bucket/empty":
+				return []byte(""), nil
+			default:
+				return []byte("not base64!"), nil
+			}
+		},
+	})
+	resolver := NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		val      config.Value
+		existing string
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "decode raw",
+			val:      config.Value{Type: config.ValueTypeRaw, URL: "s3://bucket/cert.b64", Transforms: []config.Transform{config.TransformBase64Decode}},
+			expected: "-----BEGIN-----",
+		},
+		{
+			name:     "encode command output",
+			val:      config.Value{Type: config.ValueTypeCommand, Command: "echo hello", Transforms: []config.Transform{config.TransformBase64Encode}},
+			expected: "aGVsbG8=",
+		},
+		{
+			name:     "transforms applied in order",
+			val:      config.Value{Type: config.ValueTypeCommand, Command: "echo hello", Transforms: []config.Transform{config.TransformBase64Encode, config.TransformBase64Decode}},
+			expected: "hello",
+		},
+		{
+			name:     "empty input",
+			val:      config.Value{Type: config.ValueTypeRaw, URL: "s3://bucket/empty", Transforms: []config.Transform{config.TransformBase64Decode}},
+			expected: "",
+		},
+		{
+			name:     "kept value not transformed again",
+			val:      config.Value{Type: config.ValueTypeGenerate, Transforms: []config.Transform{config.TransformBase64Encode}},
+			existing: "c2VjcmV0",
+			expected: "c2VjcmV0",
+		},
+		{
+			name:    "invalid base64",
+			val:     config.Value{Type: config.ValueTypeRaw, URL: "s3://bucket/garbage", Transforms: []config.Transform{config.TransformBase64Decode}},
+			wantErr: "invalid base64",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := resolver.Resolve(ctx, tt.val, tt.existing, tt.existing != "", false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Value != tt.expected {
+				t.Errorf("Value = %q, want %q", result.Value, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolver_ResolveJSONMultiSingleFetch(t *testing.T) {
+	hcl := `
+secret "app" {
+  path = "app"
+
+  content {
+    outputs = json_multi("s3://bucket/terraform.tfstate", {
+      db_host = ".outputs.db_host.value"
+      db_port = ".outputs.db_port.value"
+      db_name = ".outputs.db_name.value"
+    })
+  }
+}
+`
+	cfg, err := config.ParseHCL([]byte(hcl), "test.hcl", nil)
+	if err != nil {
+		t.Fatalf("parsing config: %v", err)
+	}
+
+	origJSON := parseJSON
+	parses := 0
+	parseJSON = func(data []byte) (interface{}, error) {
+		parses++
+		return origJSON(data)
+	}
+	defer func() { parseJSON = origJSON }()
+
+	fetches := 0
+	registry := fetcher.NewRegistry()
+	registry.Register(&mockFetcherImpl{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			fetches++
+			return []byte(`{"outputs": {"db_host": {"value": "db.internal"}, "db_port": {"value": 5432}, "db_name": {"value": "app"}}}`), nil
+		},
+	})
+	resolver := NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+
+	expected := map[string]string{"db_host": "db.internal", "db_port": "5432", "db_name": "app"}
+	for key, want := range expected {
+		result, err := resolver.Resolve(context.Background(), cfg.Secrets["app"].Content[key], "", false, false)
+		if err != nil {
+			t.Fatalf("resolving %s: %v", key, err)
+		}
+		if result.Value != want {
+			t.Errorf("%s = %q, want %q", key, result.Value, want)
+		}
+	}
+
+	if fetches != 1 || parses != 1 {
+		t.Errorf("expected 1 fetch and 1 parse, got %d fetches and %d parses", fetches, parses)
+	}
+
+	// Requests served from the parsed documents still count as cache hits
+	stats := registry.Stats()
+	if len(stats) != 1 || stats[0].Fetches != 1 || stats[0].CacheHits != len(expected)-1 {
+		t.Errorf("unexpected source stats: %+v", stats)
+	}
+}
+
+func TestResolver_NoFetchCache(t *testing.T) {
+	val := config.Value{Type: config.ValueTypeJSON, URL: "s3://bucket/state.json", Query: ".version"}
+
+	fetches := 0
+	registry := fetcher.NewRegistry()
+	registry.Register(&mockFetcherImpl{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			fetches++
+			return []byte(fmt.Sprintf(`{"version": "v%d"}`, fetches)), nil
+		},
+	})
+	registry.DisableCache()
+	resolver := NewResolver(registry, nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+
+	// Every value reads the source again and sees its latest content
+	for _, want := range []string{"v1", "v2"} {
+		result, err := resolver.Resolve(context.Background(), val, "", false, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Value != want {
+			t.Errorf("Value = %q, want %q", result.Value, want)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("expected 2 fetches with the cache disabled, got %d", fetches)
+	}
+}
+
+func TestCheckPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "possible policies",
+			content: `password = generate({length = 20, symbols = 4, allow_repeat = false})` + "\n" + `hashed = hash(generate({policy = "pin"}), {algo = "bcrypt"})`,
+		},
+		{
+			name:    "too few unique letters",
+			content: `password = generate({length = 40, digits = 0, symbols = 0, no_upper = true, allow_repeat = false})`,
+			wantErr: `secret "app" key "password": cannot generate 35 unique letters`,
+		},
+		{
+			name:    "impossible value wrapped by hash",
+			content: `hashed = hash(generate({length = 40, symbols = 0, no_upper = true, allow_repeat = false}), {algo = "bcrypt"})`,
+			wantErr: `secret "app" key "hashed"`,
+		},
+		{
+			name:    "passphrases skipped",
+			content: `phrase = generate({mode = "passphrase"})`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcl := `
+defaults {
+  policy "pin" {
+    length   = 6
+    digits   = 6
+    symbols  = 0
+    no_upper = true
+  }
+}
+
+secret "app" {
+  path = "app"
+  content {
+    ` + tt.content + `
+  }
+}
+`
+			cfg, err := config.ParseHCL([]byte(hcl), "test.hcl", nil)
+			if err != nil {
+				t.Fatalf("parsing config: %v", err)
+			}
+
+			err = CheckPolicies(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// A named policy is checked even when no value uses it
+	cfg := &config.Config{Defaults: config.Defaults{
+		Generate: config.DefaultPasswordPolicy(),
+		Policies: map[string]config.PasswordPolicy{"hex": {Length: 100, Digits: 20, AllowRepeat: new(bool)}},
+	}}
+	if err := CheckPolicies(cfg); err == nil || !strings.Contains(err.Error(), `defaults.policy "hex"`) {
+		t.Errorf("expected the unused named policy to fail, got: %v", err)
+	}
+}
+
+func TestResolveBlocks(t *testing.T) {
+	cfg := &config.Config{
+		Secrets: map[string]config.SecretBlock{
+			"app": {Name: "app", Content: map[string]config.Value{
+				"password": {Type: config.ValueTypeStatic, Static: "hunter2"},
+				"hash":     {Type: config.ValueTypeBcrypt, Bcrypt: &config.BcryptConfig{FromKey: "password", Cost: 4}},
+			}},
+			"copied": {Name: "copied", Content: map[string]config.Value{
+				"token": {Type: config.ValueTypeVault, VaultPath: "secret/other", VaultKey: "token"},
+			}},
+			"skipped": {Name: "skipped", Content: map[string]config.Value{
+				"key": {Type: config.ValueTypeStatic, Static: "value"},
+			}},
+		},
+	}
+
+	resolver := NewResolver(fetcher.NewRegistry(), nil, config.DefaultPasswordPolicy(), config.DefaultStrategyDefaults())
+	values, errs := ResolveBlocks(context.Background(), resolver, cfg, Options{Exclude: []string{"skipped"}})
+
+	if len(errs) != 1 || errs[0].Block != "copied" || !errors.Is(errs[0].Err, ErrNoVaultReader) {
+		t.Fatalf("expected ErrNoVaultReader for the copied block, got %v", errs)
+	}
+	if _, ok := values["copied"]; ok {
+		t.Error("a block with errors should be left out")
+	}
+	if _, ok := values["skipped"]; ok {
+		t.Error("excluded block should not be resolved")
+	}
+
+	app := values["app"]
+	if app["password"] != "hunter2" {
+		t.Errorf("password = %q", app["password"])
+	}
+	if !strings.HasPrefix(app["hash"], "$2") {
+		t.Errorf("expected a bcrypt hash of the password, got %q", app["hash"])
+	}
+}
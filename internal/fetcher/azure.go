@@ -0,0 +1,232 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+)
+
+// Azure Blob Storage environment variables. AZURE_STORAGE_ACCOUNT names the
+// account for az:// URIs. A SAS token or account key, if set, is used instead
+// of a Microsoft Entra ID token.
+const (
+	AzureStorageAccountEnv = "AZURE_STORAGE_ACCOUNT"
+	AzureStorageKeyEnv     = "AZURE_STORAGE_KEY"
+	AzureStorageSASEnv     = "AZURE_STORAGE_SAS_TOKEN"
+)
+
+const azureBlobHostSuffix = ".blob.core.windows.net"
+
+// AzureBlobFetcher retrieves files from Azure Blob Storage.
+type AzureBlobFetcher struct {
+	sizeLimit
+	account    string
+	endpoint   string
+	sasToken   string
+	accountKey string
+	options    blob.ClientOptions
+
+	// credential is the DefaultAzureCredential, created on first use
+	credOnce   sync.Once
+	credential azcore.TokenCredential
+	credErr    error
+}
+
+// AzureBlobFetcherOption configures an AzureBlobFetcher.
+type AzureBlobFetcherOption func(*AzureBlobFetcher)
+
+// WithAzureAccount sets the storage account for az:// URIs, overriding
+// AZURE_STORAGE_ACCOUNT.
+func WithAzureAccount(account string) AzureBlobFetcherOption {
+	return func(f *AzureBlobFetcher) {
+		f.account = account
+	}
+}
+
+// WithAzureEndpoint sets the blob service endpoint used for az:// URIs
+// (e.g. an Azurite emulator), instead of https://<account>.blob.core.windows.net.
+func WithAzureEndpoint(endpoint string) AzureBlobFetcherOption {
+	return func(f *AzureBlobFetcher) {
+		f.endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+}
+
+// NewAzureBlobFetcher creates a new Azure Blob Storage fetcher.
+//
+// AZURE_STORAGE_SAS_TOKEN or AZURE_STORAGE_KEY authorize requests if set.
+// Otherwise the Azure SDK's DefaultAzureCredential is used: a service
+// principal or workload identity from the environment, managed identity,
+// or a logged in Azure CLI or Azure Developer CLI.
+func NewAzureBlobFetcher(opts ...AzureBlobFetcherOption) *AzureBlobFetcher {
+	f := &AzureBlobFetcher{
+		account:    os.Getenv(AzureStorageAccountEnv),
+		sasToken:   strings.TrimPrefix(os.Getenv(AzureStorageSASEnv), "?"),
+		accountKey: os.Getenv(AzureStorageKeyEnv),
+		options: blob.ClientOptions{ClientOptions: policy.ClientOptions{
+			Transport: &http.Client{Timeout: DefaultHTTPTimeout},
+		}},
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// Supports returns true for az:// URIs and https://<account>.blob.core.windows.net URLs.
+func (f *AzureBlobFetcher) Supports(uri string) bool {
+	if strings.HasPrefix(uri, "az://") {
+		return true
+	}
+	u, err := url.Parse(uri)
+	return err == nil && u.Scheme == "https" && strings.HasSuffix(u.Host, azureBlobHostSuffix)
+}
+
+// Fetch downloads the blob.
+func (f *AzureBlobFetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	account, container, blobName, err := f.parseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	blobPath := fmt.Sprintf("%s/%s/%s", account, container, blobName)
+
+	endpoint := f.endpoint
+	if endpoint == "" {
+		endpoint = "https://" + account + azureBlobHostSuffix
+	}
+	blobURL := endpoint + "/" + url.PathEscape(container) + "/" + escapeBlobName(blobName)
+
+	// A SAS token embedded in an https:// URL authorizes the request by itself
+	query := ""
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "https" {
+		query = u.RawQuery
+	}
+
+	client, err := f.newClient(account, blobURL, query)
+	if err != nil {
+		return nil, fmt.Errorf("creating azure blob client for %s: %w", blobPath, err)
+	}
+
+	resp, err := client.DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching azure blob %s: %w", blobPath, azureError(err))
+	}
+	//nolint:errcheck // Best effort close on defer
+	defer resp.Body.Close()
+
+	data, err := f.readAll(resp.Body, "azure blob "+blobPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading azure blob body: %w", err)
+	}
+
+	return data, nil
+}
+
+// newClient returns a blob client authorized by the SAS token in query, the
+// SAS token or account key from the environment, or DefaultAzureCredential,
+// in that order.
+func (f *AzureBlobFetcher) newClient(account, blobURL, query string) (*blob.Client, error) {
+	switch {
+	case strings.Contains(query, "sig="):
+		return blob.NewClientWithNoCredential(blobURL+"?"+query, &f.options)
+
+	case f.sasToken != "":
+		if query != "" {
+			query += "&"
+		}
+		return blob.NewClientWithNoCredential(blobURL+"?"+query+f.sasToken, &f.options)
+
+	case f.accountKey != "":
+		cred, err := blob.NewSharedKeyCredential(account, f.accountKey)
+		if err != nil {
+			return nil, fmt.Errorf("using %s: %w", AzureStorageKeyEnv, err)
+		}
+		return blob.NewClientWithSharedKeyCredential(blobURL, cred, &f.options)
+
+	default:
+		f.credOnce.Do(func() {
+			f.credential, f.credErr = azidentity.NewDefaultAzureCredential(nil)
+		})
+		if f.credErr != nil {
+			return nil, fmt.Errorf("loading Azure credentials: %w", f.credErr)
+		}
+		return blob.NewClient(blobURL, f.credential, &f.options)
+	}
+}
+
+// azureError shortens a failed request to its status and error code, and
+// keeps the request URL, which may carry a SAS token, out of the error.
+func azureError(err error) error {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		status := fmt.Sprintf("unexpected status %d %s", respErr.StatusCode, http.StatusText(respErr.StatusCode))
+		if respErr.ErrorCode != "" {
+			status += " (" + respErr.ErrorCode + ")"
+		}
+		return errors.New(status)
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// parseURI extracts account, container, and blob name from an az:// URI or a
+// blob URL. The account for az:// URIs comes from AZURE_STORAGE_ACCOUNT.
+// Formats: az://container/path/to/blob
+//
+//	https://account.blob.core.windows.net/container/path/to/blob
+func (f *AzureBlobFetcher) parseURI(uri string) (account, container, blob string, err error) {
+	var path string
+	switch {
+	case strings.HasPrefix(uri, "az://"):
+		if f.account == "" {
+			return "", "", "", fmt.Errorf("az:// URIs need %s to be set: %s", AzureStorageAccountEnv, uri)
+		}
+		account = f.account
+		path = strings.TrimPrefix(uri, "az://")
+
+	case strings.HasPrefix(uri, "https://"):
+		u, parseErr := url.Parse(uri)
+		if parseErr != nil || !strings.HasSuffix(u.Host, azureBlobHostSuffix) {
+			return "", "", "", fmt.Errorf("invalid Azure blob URL (expected https://<account>%s/container/blob)", azureBlobHostSuffix)
+		}
+		account = strings.TrimSuffix(u.Host, azureBlobHostSuffix)
+		path = strings.TrimPrefix(u.Path, "/")
+		if account == "" || strings.Contains(account, ".") {
+			return "", "", "", fmt.Errorf("invalid Azure blob URL (expected https://<account>%s/container/blob): %s", azureBlobHostSuffix, u.Redacted())
+		}
+
+	default:
+		return "", "", "", fmt.Errorf("invalid Azure blob URI: %s", uri)
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", fmt.Errorf("invalid Azure blob URI format (expected az://container/blob): %s", strings.SplitN(uri, "?", 2)[0])
+	}
+
+	return account, parts[0], parts[1], nil
+}
+
+// escapeBlobName escapes each segment of a blob name, keeping the "/"
+// separators that form virtual directories.
+func escapeBlobName(blob string) string {
+	segments := strings.Split(blob, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
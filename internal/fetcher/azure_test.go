@@ -0,0 +1,271 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+func TestAzureBlobFetcher_Supports(t *testing.T) {
+	f := &AzureBlobFetcher{}
+
+	tests := []struct {
+		uri      string
+		expected bool
+	}{
+		{"az://tfstate/prod/terraform.tfstate", true},
+		{"https://myaccount.blob.core.windows.net/tfstate/prod.tfstate", true},
+		{"https://example.com/state.tfstate", false},
+		{"http://myaccount.blob.core.windows.net/tfstate/prod.tfstate", false},
+		{"s3://bucket/path.tfstate", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			result := f.Supports(tt.uri)
+			if result != tt.expected {
+				t.Errorf("Supports(%q) = %v, want %v", tt.uri, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAzureBlobFetcher_ParseURI(t *testing.T) {
+	f := &AzureBlobFetcher{account: "envaccount"}
+
+	tests := []struct {
+		name          string
+		uri           string
+		wantAccount   string
+		wantContainer string
+		wantBlob      string
+		wantErr       bool
+	}{
+		{
+			name:          "az simple path",
+			uri:           "az://tfstate/terraform.tfstate",
+			wantAccount:   "envaccount",
+			wantContainer: "tfstate",
+			wantBlob:      "terraform.tfstate",
+		},
+		{
+			name:          "az nested path",
+			uri:           "az://tfstate/env/prod/rds/terraform.tfstate",
+			wantAccount:   "envaccount",
+			wantContainer: "tfstate",
+			wantBlob:      "env/prod/rds/terraform.tfstate",
+		},
+		{
+			name:          "blob URL",
+			uri:           "https://myaccount.blob.core.windows.net/configs/app/config.json",
+			wantAccount:   "myaccount",
+			wantContainer: "configs",
+			wantBlob:      "app/config.json",
+		},
+		{
+			name:          "blob URL with SAS",
+			uri:           "https://myaccount.blob.core.windows.net/configs/app.json?sv=2021-08-06&sig=abc",
+			wantAccount:   "myaccount",
+			wantContainer: "configs",
+			wantBlob:      "app.json",
+		},
+		{
+			name:    "az missing blob",
+			uri:     "az://tfstate/",
+			wantErr: true,
+		},
+		{
+			name:    "az container only",
+			uri:     "az://tfstate",
+			wantErr: true,
+		},
+		{
+			name:    "az empty container",
+			uri:     "az:///path/to/blob",
+			wantErr: true,
+		},
+		{
+			name:    "blob URL missing blob",
+			uri:     "https://myaccount.blob.core.windows.net/configs",
+			wantErr: true,
+		},
+		{
+			name:    "blob URL with nested host",
+			uri:     "https://a.b.blob.core.windows.net/configs/app.json",
+			wantErr: true,
+		},
+		{
+			name:    "not a blob host",
+			uri:     "https://example.com/configs/app.json",
+			wantErr: true,
+		},
+		{
+			name:    "wrong scheme",
+			uri:     "s3://bucket/key",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account, container, blob, err := f.parseURI(tt.uri)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if account != tt.wantAccount {
+				t.Errorf("account = %q, want %q", account, tt.wantAccount)
+			}
+			if container != tt.wantContainer {
+				t.Errorf("container = %q, want %q", container, tt.wantContainer)
+			}
+			if blob != tt.wantBlob {
+				t.Errorf("blob = %q, want %q", blob, tt.wantBlob)
+			}
+		})
+	}
+}
+
+func TestAzureBlobFetcher_ParseURI_NoAccount(t *testing.T) {
+	f := &AzureBlobFetcher{}
+
+	_, _, _, err := f.parseURI("az://tfstate/terraform.tfstate")
+	if err == nil {
+		t.Fatal("expected error without a storage account")
+	}
+	if !strings.Contains(err.Error(), AzureStorageAccountEnv) {
+		t.Errorf("expected error to mention %s, got: %v", AzureStorageAccountEnv, err)
+	}
+}
+
+func TestAzureBlobFetcher_FetchSAS(t *testing.T) {
+	var gotPath, gotQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotQuery = r.URL.Query().Get("sig")
+		_, _ = w.Write([]byte(`{"outputs": {}}`))
+	}))
+	defer server.Close()
+
+	f := NewAzureBlobFetcher(WithAzureAccount("myaccount"), WithAzureEndpoint(server.URL))
+	f.sasToken = "sv=2021-08-06&sig=abc"
+
+	data, err := f.Fetch(context.Background(), "az://tfstate/env/prod state.tfstate")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != `{"outputs": {}}` {
+		t.Errorf("unexpected body: %s", data)
+	}
+	if gotPath != "/tfstate/env/prod%20state.tfstate" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if gotQuery != "abc" {
+		t.Errorf("sig = %q", gotQuery)
+	}
+}
+
+func TestAzureBlobFetcher_FetchSharedKey(t *testing.T) {
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := NewAzureBlobFetcher(WithAzureAccount("myaccount"), WithAzureEndpoint(server.URL))
+	f.sasToken = ""
+	f.accountKey = base64.StdEncoding.EncodeToString([]byte("account-key"))
+
+	if _, err := f.Fetch(context.Background(), "az://tfstate/terraform.tfstate"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(gotAuth, "SharedKey myaccount:") {
+		t.Errorf("Authorization = %q, want a SharedKey signature", gotAuth)
+	}
+}
+
+// staticTokenCredential is a TokenCredential returning a fixed token.
+type staticTokenCredential string
+
+func (c staticTokenCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: string(c), ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestAzureBlobFetcher_FetchTokenCredential(t *testing.T) {
+	var gotAuth string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := NewAzureBlobFetcher(WithAzureAccount("myaccount"), WithAzureEndpoint(server.URL))
+	f.sasToken, f.accountKey = "", ""
+	f.options.Transport = server.Client()
+	// Stand in for DefaultAzureCredential
+	f.credOnce.Do(func() { f.credential = staticTokenCredential("entra-token") })
+
+	if _, err := f.Fetch(context.Background(), "az://tfstate/terraform.tfstate"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotAuth != "Bearer entra-token" {
+		t.Errorf("Authorization = %q, want %q", gotAuth, "Bearer entra-token")
+	}
+}
+
+func TestAzureBlobFetcher_FetchError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-error-code", "BlobNotFound")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	f := NewAzureBlobFetcher(WithAzureAccount("myaccount"), WithAzureEndpoint(server.URL))
+	f.sasToken = "sig=secret"
+
+	_, err := f.Fetch(context.Background(), "az://tfstate/prod/missing.tfstate")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"myaccount/tfstate/prod/missing.tfstate", "404", "BlobNotFound"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got: %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error leaks the SAS token: %v", err)
+	}
+}
+
+func TestAzureBlobFetcher_Fetch_MaxSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 4096)))
+	}))
+	defer server.Close()
+
+	f := NewAzureBlobFetcher(WithAzureAccount("myaccount"), WithAzureEndpoint(server.URL))
+	f.sasToken = "sig=abc"
+	f.setMaxSize(1024)
+
+	_, err := f.Fetch(context.Background(), "az://tfstate/huge.tfstate")
+	if err == nil {
+		t.Fatal("expected error for blob over the fetch size limit")
+	}
+	if !strings.Contains(err.Error(), "myaccount/tfstate/huge.tfstate exceeds the maximum fetch size of 1024 bytes") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
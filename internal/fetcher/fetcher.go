@@ -2,10 +2,16 @@ package fetcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
 	"sync"
 )
 
+// DefaultMaxFetchSize is the default maximum size of fetched content (64 MiB).
+const DefaultMaxFetchSize int64 = 64 << 20
+
 // Fetcher retrieves files from various backends.
 type Fetcher interface {
 	// Fetch retrieves the file and returns its contents.
@@ -15,47 +21,153 @@ type Fetcher interface {
 	Supports(uri string) bool
 }
 
+// Lister is implemented by fetchers that can list the sources matching a
+// URI pattern, so one config declaration can expand per source.
+type Lister interface {
+	// List returns the URIs of the sources matching pattern, sorted.
+	List(ctx context.Context, pattern string) ([]string, error)
+}
+
+// sizeLimiter is implemented by fetchers whose maximum fetch size can be
+// configured by the registry.
+type sizeLimiter interface {
+	setMaxSize(n int64)
+}
+
+// sizeLimit caps how much a fetcher reads from a source, so a URL pointing at
+// an enormous object fails fast instead of being buffered in memory.
+type sizeLimit struct {
+	maxSize int64
+}
+
+func (l *sizeLimit) setMaxSize(n int64) {
+	l.maxSize = n
+}
+
+// readAll reads r to the end, failing as soon as more than the limit has been
+// read. A zero limit means DefaultMaxFetchSize.
+func (l *sizeLimit) readAll(r io.Reader, uri string) ([]byte, error) {
+	limit := l.maxSize
+	if limit <= 0 {
+		limit = DefaultMaxFetchSize
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s exceeds the maximum fetch size of %d bytes", uri, limit)
+	}
+
+	return data, nil
+}
+
 // Registry manages multiple fetchers and routes requests to the appropriate one.
 type Registry struct {
 	fetchers []Fetcher
 	cache    map[string][]byte
+	stats    map[string]*SourceStats
+	maxSize  int64
+	noCache  bool
 	mu       sync.RWMutex
 }
 
+// SourceStats records how a source URL was accessed through a Registry.
+type SourceStats struct {
+	URL string
+
+	// Fetches counts the successful fetches from the source itself
+	Fetches int
+
+	// CacheHits counts the requests served from the cache
+	CacheHits int
+
+	// Failures counts the fetches that returned an error
+	Failures int
+
+	// Size is the size in bytes of the fetched content
+	Size int
+}
+
 // NewRegistry creates a new fetcher registry.
 func NewRegistry() *Registry {
 	return &Registry{
-		cache: make(map[string][]byte),
+		cache:   make(map[string][]byte),
+		stats:   make(map[string]*SourceStats),
+		maxSize: DefaultMaxFetchSize,
 	}
 }
 
-// Register adds a fetcher to the registry.
+// Register adds a fetcher to the registry, applying the registry's maximum
+// fetch size to it.
 func (r *Registry) Register(f Fetcher) {
+	if l, ok := f.(sizeLimiter); ok {
+		l.setMaxSize(r.maxSize)
+	}
 	r.fetchers = append(r.fetchers, f)
 }
 
+// SetMaxSize sets the maximum size of fetched content for all registered
+// and future fetchers.
+func (r *Registry) SetMaxSize(n int64) {
+	r.maxSize = n
+	for _, f := range r.fetchers {
+		if l, ok := f.(sizeLimiter); ok {
+			l.setMaxSize(n)
+		}
+	}
+}
+
+// DisableCache makes every Fetch read the source again, for sources that
+// may change while the registry is in use.
+func (r *Registry) DisableCache() {
+	r.mu.Lock()
+	r.noCache = true
+	r.cache = make(map[string][]byte)
+	r.mu.Unlock()
+}
+
+// CacheEnabled reports whether fetched content is cached, which it is
+// unless DisableCache was called.
+func (r *Registry) CacheEnabled() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.noCache
+}
+
 // Fetch retrieves content from the given URI using the appropriate fetcher.
-// Results are cached for the lifetime of the registry.
+// Results are cached for the lifetime of the registry, unless the cache is
+// disabled.
 func (r *Registry) Fetch(ctx context.Context, uri string) ([]byte, error) {
 	// Check cache
-	r.mu.RLock()
-	if data, ok := r.cache[uri]; ok {
-		r.mu.RUnlock()
+	r.mu.Lock()
+	if data, ok := r.cache[uri]; ok && !r.noCache {
+		r.sourceStats(uri).CacheHits++
+		r.mu.Unlock()
 		return data, nil
 	}
-	r.mu.RUnlock()
+	r.mu.Unlock()
 
 	// Find appropriate fetcher
 	for _, f := range r.fetchers {
 		if f.Supports(uri) {
 			data, err := f.Fetch(ctx, uri)
 			if err != nil {
+				r.mu.Lock()
+				r.sourceStats(uri).Failures++
+				r.mu.Unlock()
 				return nil, err
 			}
 
 			// Cache the result
 			r.mu.Lock()
-			r.cache[uri] = data
+			if !r.noCache {
+				r.cache[uri] = data
+			}
+			stats := r.sourceStats(uri)
+			stats.Fetches++
+			stats.Size = len(data)
 			r.mu.Unlock()
 
 			return data, nil
@@ -65,9 +177,56 @@ func (r *Registry) Fetch(ctx context.Context, uri string) ([]byte, error) {
 	return nil, fmt.Errorf("no fetcher supports URI: %s", uri)
 }
 
+// RecordCacheHit counts a request for uri served from a cache outside the
+// registry, such as a cache of parsed documents, so Stats still shows it.
+func (r *Registry) RecordCacheHit(uri string) {
+	r.mu.Lock()
+	r.sourceStats(uri).CacheHits++
+	r.mu.Unlock()
+}
+
+// sourceStats returns the stats of uri, adding them if needed. The caller
+// must hold r.mu.
+func (r *Registry) sourceStats(uri string) *SourceStats {
+	stats, ok := r.stats[uri]
+	if !ok {
+		stats = &SourceStats{URL: uri}
+		r.stats[uri] = stats
+	}
+	return stats
+}
+
+// Stats returns how each source URL requested from the registry was
+// accessed, sorted by URL. Unlike the cache, stats survive ClearCache.
+func (r *Registry) Stats() []SourceStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := make([]SourceStats, 0, len(r.stats))
+	for _, s := range r.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].URL < stats[j].URL })
+	return stats
+}
+
 // ClearCache clears the fetch cache.
 func (r *Registry) ClearCache() {
 	r.mu.Lock()
 	r.cache = make(map[string][]byte)
 	r.mu.Unlock()
 }
+
+// Close releases the clients held by the registered fetchers, such as the
+// GCS client. The registry must not be used afterwards.
+func (r *Registry) Close() error {
+	var errs []error
+	for _, f := range r.fetchers {
+		if c, ok := f.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
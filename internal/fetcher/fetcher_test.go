@@ -2,6 +2,8 @@ package fetcher
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"testing"
 )
 
@@ -59,6 +61,42 @@ func TestRegistry_Caching(t *testing.T) {
 	}
 }
 
+func TestRegistry_DisableCache(t *testing.T) {
+	registry := NewRegistry()
+
+	callCount := 0
+	registry.Register(&mockFetcher{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			callCount++
+			return []byte(`{"key":"value"}`), nil
+		},
+	})
+
+	ctx := context.Background()
+	if _, err := registry.Fetch(ctx, "test://state.json"); err != nil {
+		t.Fatalf("first fetch error: %v", err)
+	}
+
+	// Content cached before the cache is disabled isn't served either
+	registry.DisableCache()
+	if registry.CacheEnabled() {
+		t.Error("expected the cache to be disabled")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := registry.Fetch(ctx, "test://state.json"); err != nil {
+			t.Fatalf("fetch error: %v", err)
+		}
+	}
+
+	if callCount != 3 {
+		t.Errorf("expected 3 fetch calls with the cache disabled, got %d", callCount)
+	}
+	if got := registry.Stats()[0]; got.Fetches != 3 || got.CacheHits != 0 {
+		t.Errorf("Stats() = %+v, want 3 fetches and no cache hits", got)
+	}
+}
+
 func TestRegistry_NoFetcher(t *testing.T) {
 	registry := NewRegistry()
 
@@ -68,6 +106,68 @@ func TestRegistry_NoFetcher(t *testing.T) {
 	}
 }
 
+func TestRegistry_Stats(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&mockFetcher{
+		supports: func(uri string) bool { return true },
+		fetch: func(ctx context.Context, uri string) ([]byte, error) {
+			if uri == "test://missing.json" {
+				return nil, errors.New("not found")
+			}
+			return []byte(`{"key":"value"}`), nil
+		},
+	})
+
+	ctx := context.Background()
+	for _, uri := range []string{"test://state.json", "test://state.json", "test://state.json", "test://other.json", "test://missing.json", "test://missing.json"} {
+		_, _ = registry.Fetch(ctx, uri)
+	}
+
+	expected := []SourceStats{
+		{URL: "test://missing.json", Failures: 2},
+		{URL: "test://other.json", Fetches: 1, Size: 15},
+		{URL: "test://state.json", Fetches: 1, CacheHits: 2, Size: 15},
+	}
+	if got := registry.Stats(); !slices.Equal(got, expected) {
+		t.Errorf("Stats() = %+v, want %+v", got, expected)
+	}
+
+	// Stats outlive the cache
+	registry.ClearCache()
+	_, _ = registry.Fetch(ctx, "test://other.json")
+	if got := registry.Stats()[1]; got.Fetches != 2 || got.CacheHits != 0 {
+		t.Errorf("after ClearCache: %+v, want 2 fetches and no cache hits", got)
+	}
+}
+
+func TestRegistry_Close(t *testing.T) {
+	closed := 0
+	registry := NewRegistry()
+	registry.Register(&closingFetcher{closed: &closed})
+	registry.Register(&mockFetcher{})
+	registry.Register(&closingFetcher{closed: &closed, err: errors.New("close failed")})
+
+	err := registry.Close()
+	if closed != 2 {
+		t.Errorf("expected both closers to be closed, got %d", closed)
+	}
+	if err == nil || err.Error() != "close failed" {
+		t.Errorf("expected the close error, got %v", err)
+	}
+}
+
+// closingFetcher is a fetcher holding a client to close
+type closingFetcher struct {
+	mockFetcher
+	closed *int
+	err    error
+}
+
+func (c *closingFetcher) Close() error {
+	*c.closed++
+	return c.err
+}
+
 // mockFetcher is a test helper
 type mockFetcher struct {
 	supports func(uri string) bool
@@ -0,0 +1,83 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// GCSFetcher retrieves terraform state from Google Cloud Storage.
+type GCSFetcher struct {
+	sizeLimit
+	client *storage.Client
+}
+
+// NewGCSFetcher creates a new GCS fetcher using Application Default Credentials.
+// This supports GOOGLE_APPLICATION_CREDENTIALS, gcloud user credentials,
+// Workload Identity, and the GCE metadata server.
+func NewGCSFetcher(ctx context.Context) (*GCSFetcher, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCS client: %w", err)
+	}
+
+	return &GCSFetcher{
+		client: client,
+	}, nil
+}
+
+// Close closes the GCS client.
+func (f *GCSFetcher) Close() error {
+	return f.client.Close()
+}
+
+// Supports returns true for gcs:// and gs:// URIs.
+func (f *GCSFetcher) Supports(uri string) bool {
+	return strings.HasPrefix(uri, "gcs://") || strings.HasPrefix(uri, "gs://")
+}
+
+// Fetch retrieves the terraform state file from GCS.
+func (f *GCSFetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	bucket, object, err := f.parseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := f.client.Bucket(bucket).Object(object).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching gs://%s/%s: %w", bucket, object, err)
+	}
+	//nolint:errcheck // Best effort close on defer
+	defer reader.Close()
+
+	data, err := f.readAll(reader, uri)
+	if err != nil {
+		return nil, fmt.Errorf("reading gcs object body: %w", err)
+	}
+
+	return data, nil
+}
+
+// parseURI extracts bucket and object from a gcs:// or gs:// URI.
+// Format: gcs://bucket/path/to/object
+func (f *GCSFetcher) parseURI(uri string) (bucket, object string, err error) {
+	var path string
+	switch {
+	case strings.HasPrefix(uri, "gcs://"):
+		path = strings.TrimPrefix(uri, "gcs://")
+	case strings.HasPrefix(uri, "gs://"):
+		path = strings.TrimPrefix(uri, "gs://")
+	default:
+		return "", "", fmt.Errorf("invalid GCS URI: %s", uri)
+	}
+
+	// Split into bucket and object
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid GCS URI format (expected gcs://bucket/object): %s", uri)
+	}
+
+	return parts[0], parts[1], nil
+}
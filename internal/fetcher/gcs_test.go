@@ -0,0 +1,103 @@
+package fetcher
+
+import (
+	"testing"
+)
+
+func TestGCSFetcher_Supports(t *testing.T) {
+	f := &GCSFetcher{}
+
+	tests := []struct {
+		uri      string
+		expected bool
+	}{
+		{"gcs://bucket/path/to/state.tfstate", true},
+		{"gs://my-bucket/terraform.tfstate", true},
+		{"gs://bucket/deep/nested/path/default.tfstate", true},
+		{"s3://bucket/path.tfstate", false},
+		{"file:///path/to/state.tfstate", false},
+		{"http://example.com/state.tfstate", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			result := f.Supports(tt.uri)
+			if result != tt.expected {
+				t.Errorf("Supports(%q) = %v, want %v", tt.uri, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGCSFetcher_ParseURI(t *testing.T) {
+	f := &GCSFetcher{}
+
+	tests := []struct {
+		name       string
+		uri        string
+		wantBucket string
+		wantObject string
+		wantErr    bool
+	}{
+		{
+			name:       "gcs scheme",
+			uri:        "gcs://mybucket/terraform.tfstate",
+			wantBucket: "mybucket",
+			wantObject: "terraform.tfstate",
+		},
+		{
+			name:       "gs scheme",
+			uri:        "gs://mybucket/terraform.tfstate",
+			wantBucket: "mybucket",
+			wantObject: "terraform.tfstate",
+		},
+		{
+			name:       "nested path",
+			uri:        "gs://terraform-state/env/prod/default.tfstate",
+			wantBucket: "terraform-state",
+			wantObject: "env/prod/default.tfstate",
+		},
+		{
+			name:    "missing object",
+			uri:     "gcs://mybucket/",
+			wantErr: true,
+		},
+		{
+			name:    "bucket only",
+			uri:     "gs://mybucket",
+			wantErr: true,
+		},
+		{
+			name:    "empty bucket",
+			uri:     "gs:///path/to/file",
+			wantErr: true,
+		},
+		{
+			name:    "wrong scheme",
+			uri:     "s3://bucket/key",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, object, err := f.parseURI(tt.uri)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if bucket != tt.wantBucket {
+				t.Errorf("bucket = %q, want %q", bucket, tt.wantBucket)
+			}
+			if object != tt.wantObject {
+				t.Errorf("object = %q, want %q", object, tt.wantObject)
+			}
+		})
+	}
+}
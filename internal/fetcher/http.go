@@ -0,0 +1,91 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultHTTPTimeout is the default timeout for HTTP requests.
+const DefaultHTTPTimeout = 30 * time.Second
+
+// HTTPTokenEnv is the environment variable holding an optional bearer token
+// sent with every HTTP request.
+const HTTPTokenEnv = "VSG_HTTP_TOKEN"
+
+// HTTPFetcher retrieves files over HTTP(S).
+type HTTPFetcher struct {
+	sizeLimit
+	client *http.Client
+	token  string
+}
+
+// HTTPFetcherOption configures an HTTPFetcher.
+type HTTPFetcherOption func(*HTTPFetcher)
+
+// WithHTTPTimeout sets the request timeout.
+func WithHTTPTimeout(timeout time.Duration) HTTPFetcherOption {
+	return func(f *HTTPFetcher) {
+		f.client.Timeout = timeout
+	}
+}
+
+// WithHTTPToken sets the bearer token, overriding VSG_HTTP_TOKEN.
+func WithHTTPToken(token string) HTTPFetcherOption {
+	return func(f *HTTPFetcher) {
+		f.token = token
+	}
+}
+
+// NewHTTPFetcher creates a new HTTP(S) fetcher.
+// If VSG_HTTP_TOKEN is set, it is sent as an "Authorization: Bearer" header.
+func NewHTTPFetcher(opts ...HTTPFetcherOption) *HTTPFetcher {
+	f := &HTTPFetcher{
+		client: &http.Client{Timeout: DefaultHTTPTimeout},
+		token:  os.Getenv(HTTPTokenEnv),
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// Supports returns true for http:// and https:// URIs.
+func (f *HTTPFetcher) Supports(uri string) bool {
+	return strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://")
+}
+
+// Fetch retrieves the file with an HTTP GET request.
+func (f *HTTPFetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request for %s: %w", uri, err)
+	}
+
+	if f.token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.token)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", uri, err)
+	}
+	//nolint:errcheck // Best effort close on defer
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("fetching %s: unexpected status %d %s", uri, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	data, err := f.readAll(resp.Body, uri)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+
+	return data, nil
+}
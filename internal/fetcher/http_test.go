@@ -0,0 +1,125 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPFetcher_Supports(t *testing.T) {
+	f := NewHTTPFetcher()
+
+	tests := []struct {
+		uri      string
+		expected bool
+	}{
+		{"https://config.example.com/app.json", true},
+		{"http://localhost:8080/state.tfstate", true},
+		{"s3://bucket/path.tfstate", false},
+		{"file:///path/to/state.tfstate", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			result := f.Supports(tt.uri)
+			if result != tt.expected {
+				t.Errorf("Supports(%q) = %v, want %v", tt.uri, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHTTPFetcher_Fetch(t *testing.T) {
+	t.Setenv(HTTPTokenEnv, "test-token")
+
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"db": {"host": "db.example.com"}}`))
+	}))
+	defer server.Close()
+
+	f := NewHTTPFetcher()
+	data, err := f.Fetch(context.Background(), server.URL+"/app.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(string(data), "db.example.com") {
+		t.Errorf("unexpected body: %s", data)
+	}
+	if gotAuth != "Bearer test-token" {
+		t.Errorf("Authorization = %q, want %q", gotAuth, "Bearer test-token")
+	}
+}
+
+func TestHTTPFetcher_NoToken(t *testing.T) {
+	t.Setenv(HTTPTokenEnv, "")
+
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	if _, err := NewHTTPFetcher().Fetch(context.Background(), server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotAuth != "" {
+		t.Errorf("expected no Authorization header, got %q", gotAuth)
+	}
+}
+
+func TestHTTPFetcher_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPFetcher().Fetch(context.Background(), server.URL)
+	if err == nil {
+		t.Fatal("expected error for non-2xx response")
+	}
+	if !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected status code in error, got: %v", err)
+	}
+}
+
+func TestHTTPFetcher_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	f := NewHTTPFetcher(WithHTTPTimeout(20 * time.Millisecond))
+	if _, err := f.Fetch(context.Background(), server.URL); err == nil {
+		t.Error("expected timeout error")
+	}
+}
+
+func TestHTTPFetcher_RegistryCaching(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"a": 1, "b": 2}`))
+	}))
+	defer server.Close()
+
+	registry := NewRegistry()
+	registry.Register(NewHTTPFetcher())
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := registry.Fetch(ctx, server.URL+"/outputs.json"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("expected 1 request (cached), got %d", requests)
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
 // LocalFetcher retrieves terraform state from the local filesystem.
-type LocalFetcher struct{}
+type LocalFetcher struct {
+	sizeLimit
+}
 
 // NewLocalFetcher creates a new local file fetcher.
 func NewLocalFetcher() *LocalFetcher {
@@ -35,7 +39,14 @@ func (f *LocalFetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
 	}
 
 	// #nosec G304 -- File path is intentionally user-provided via URI
-	data, err := os.ReadFile(path)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %s: %w", path, err)
+	}
+	//nolint:errcheck // Best effort close on defer
+	defer file.Close()
+
+	data, err := f.readAll(file, uri)
 	if err != nil {
 		return nil, fmt.Errorf("reading file %s: %w", path, err)
 	}
@@ -43,6 +54,45 @@ func (f *LocalFetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
 	return data, nil
 }
 
+// List returns the file:// URIs of the regular files matching pattern, a
+// file:// URI holding a glob pattern (file:///srv/apps/*.json) or naming a
+// directory, meaning every file directly in it. Subdirectories are never
+// listed.
+func (f *LocalFetcher) List(ctx context.Context, pattern string) ([]string, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	path, err := f.parsePath(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "*")
+	}
+
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+
+	var uris []string
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %w", match, err)
+		}
+		if info.Mode().IsRegular() {
+			uris = append(uris, "file://"+match)
+		}
+	}
+	sort.Strings(uris)
+	return uris, nil
+}
+
 // parsePath extracts the file path from a file:// URI.
 func (f *LocalFetcher) parsePath(uri string) (string, error) {
 	if !strings.HasPrefix(uri, "file://") {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -94,3 +95,67 @@ func TestLocalFetcher_Fetch_Canceled(t *testing.T) {
 		t.Errorf("expected context.Canceled, got %v", err)
 	}
 }
+
+func TestLocalFetcher_Fetch_MaxSize(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(tmpFile, make([]byte, 2048), 0644); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+
+	registry := NewRegistry()
+	registry.SetMaxSize(1024)
+	registry.Register(NewLocalFetcher())
+
+	_, err := registry.Fetch(context.Background(), "file://"+tmpFile)
+	if err == nil {
+		t.Fatal("expected error for file over the fetch size limit")
+	}
+	if !strings.Contains(err.Error(), "exceeds the maximum fetch size of 1024 bytes") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Exactly at the limit is allowed
+	registry.SetMaxSize(2048)
+	registry.ClearCache()
+	data, err := registry.Fetch(context.Background(), "file://"+tmpFile)
+	if err != nil {
+		t.Fatalf("unexpected error at the limit: %v", err)
+	}
+	if len(data) != 2048 {
+		t.Errorf("expected 2048 bytes, got %d", len(data))
+	}
+}
+
+func TestLocalFetcher_List(t *testing.T) {
+	f := NewLocalFetcher()
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	for _, name := range []string{"b.json", "a.json", "c.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"file://" + dir + "/*.json", []string{"file://" + dir + "/a.json", "file://" + dir + "/b.json"}},
+		{"file://" + dir, []string{"file://" + dir + "/a.json", "file://" + dir + "/b.json", "file://" + dir + "/c.yaml"}},
+		{"file://" + dir + "/*.toml", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := f.List(ctx, tt.pattern)
+		if err != nil {
+			t.Fatalf("List(%q): unexpected error: %v", tt.pattern, err)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("List(%q) = %v, want %v", tt.pattern, got, tt.expected)
+		}
+	}
+}
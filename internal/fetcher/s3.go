@@ -3,7 +3,6 @@ package fetcher
 import (
 	"context"
 	"fmt"
-	"io"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -13,6 +12,7 @@ import (
 
 // S3Fetcher retrieves terraform state from AWS S3.
 type S3Fetcher struct {
+	sizeLimit
 	client *s3.Client
 }
 
@@ -62,7 +62,7 @@ func (f *S3Fetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
 	//nolint:errcheck // Best effort close on defer
 	defer result.Body.Close()
 
-	data, err := io.ReadAll(result.Body)
+	data, err := f.readAll(result.Body, uri)
 	if err != nil {
 		return nil, fmt.Errorf("reading s3 object body: %w", err)
 	}
@@ -2,8 +2,14 @@ package fetcher
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 func TestS3Fetcher_Supports(t *testing.T) {
@@ -104,6 +110,32 @@ func TestS3Fetcher_ParseURI(t *testing.T) {
 	}
 }
 
+func TestS3Fetcher_Fetch_MaxSize(t *testing.T) {
+	// Fake S3 endpoint serving an object larger than the limit
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 4096)))
+	}))
+	defer server.Close()
+
+	f := &S3Fetcher{
+		client: s3.New(s3.Options{
+			Region:       "us-east-1",
+			BaseEndpoint: aws.String(server.URL),
+			UsePathStyle: true,
+			Credentials:  aws.AnonymousCredentials{},
+		}),
+	}
+	f.setMaxSize(1024)
+
+	_, err := f.Fetch(context.Background(), "s3://bucket/huge.tfstate")
+	if err == nil {
+		t.Fatal("expected error for object over the fetch size limit")
+	}
+	if !strings.Contains(err.Error(), "s3://bucket/huge.tfstate exceeds the maximum fetch size of 1024 bytes") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 // Integration tests - require AWS credentials and a test bucket
 // Set AWS credentials and VSG_TEST_S3_BUCKET to run these
 
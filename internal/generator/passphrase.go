@@ -0,0 +1,66 @@
+package generator
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+)
+
+// wordlistData is the EFF large wordlist (7776 words), licensed CC BY 3.0 US.
+// https://www.eff.org/deeplinks/2016/07/new-wordlists-random-passphrases
+//
+//go:embed wordlist.txt
+var wordlistData string
+
+// wordlist returns the parsed embedded wordlist.
+var wordlist = sync.OnceValue(func() []string {
+	return strings.Fields(wordlistData)
+})
+
+// GeneratePassphrase creates a diceware-style passphrase based on the given policy.
+func GeneratePassphrase(policy config.PassphrasePolicy) (string, error) {
+	return GeneratePassphraseFrom(policy, rand.Reader)
+}
+
+// GeneratePassphraseFrom creates a passphrase based on the given policy,
+// drawing its randomness from random.
+func GeneratePassphraseFrom(policy config.PassphrasePolicy, random io.Reader) (string, error) {
+	if policy.Words < 1 {
+		return "", fmt.Errorf("words must be at least 1")
+	}
+	if policy.Words > config.MaxPassphraseWords {
+		return "", fmt.Errorf("words must be at most %d", config.MaxPassphraseWords)
+	}
+
+	words := wordlist()
+	parts := make([]string, 0, policy.Words+1)
+
+	for i := 0; i < policy.Words; i++ {
+		idx, err := randomInt(random, len(words))
+		if err != nil {
+			return "", fmt.Errorf("picking word: %w", err)
+		}
+
+		word := words[idx]
+		if policy.Capitalize {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		parts = append(parts, word)
+	}
+
+	if policy.Number {
+		n, err := randomInt(random, 100)
+		if err != nil {
+			return "", fmt.Errorf("picking number: %w", err)
+		}
+		parts = append(parts, strconv.Itoa(n))
+	}
+
+	return strings.Join(parts, policy.Separator), nil
+}
@@ -0,0 +1,111 @@
+package generator
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+)
+
+func TestWordlist(t *testing.T) {
+	if n := len(wordlist()); n != 7776 {
+		t.Errorf("expected 7776 words, got %d", n)
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy config.PassphrasePolicy
+	}{
+		{"default", config.DefaultPassphrasePolicy()},
+		{"five words dash", config.PassphrasePolicy{Words: 5, Separator: "-"}},
+		{"space separator", config.PassphrasePolicy{Words: 4, Separator: " "}},
+		{"dot separator", config.PassphrasePolicy{Words: 3, Separator: "."}},
+		{"single word", config.PassphrasePolicy{Words: 1, Separator: "-"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passphrase, err := GeneratePassphrase(tt.policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Count words via wordlist membership, since some words contain "-"
+			if got := countWords(passphrase, tt.policy.Separator); got != tt.policy.Words {
+				t.Errorf("expected %d words, got %d in %q", tt.policy.Words, got, passphrase)
+			}
+		})
+	}
+}
+
+func TestGeneratePassphrase_CapitalizeAndNumber(t *testing.T) {
+	policy := config.PassphrasePolicy{Words: 4, Separator: " ", Capitalize: true, Number: true}
+
+	passphrase, err := GeneratePassphrase(policy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parts := strings.Split(passphrase, " ")
+	if len(parts) != 5 {
+		t.Fatalf("expected 4 words and a number, got %q", passphrase)
+	}
+
+	for _, word := range parts[:4] {
+		if !unicode.IsUpper(rune(word[0])) {
+			t.Errorf("expected capitalized word, got %q", word)
+		}
+	}
+
+	if _, err := strconv.Atoi(parts[4]); err != nil {
+		t.Errorf("expected trailing number, got %q", parts[4])
+	}
+}
+
+func TestGeneratePassphrase_Differs(t *testing.T) {
+	policy := config.DefaultPassphrasePolicy()
+
+	a, err := GeneratePassphrase(policy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := GeneratePassphrase(policy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if a == b {
+		t.Errorf("expected two passphrases to differ, both were %q", a)
+	}
+}
+
+func TestGeneratePassphrase_Invalid(t *testing.T) {
+	for _, words := range []int{0, -1, config.MaxPassphraseWords + 1} {
+		if _, err := GeneratePassphrase(config.PassphrasePolicy{Words: words}); err == nil {
+			t.Errorf("expected error for %d words", words)
+		}
+	}
+}
+
+// countWords splits a passphrase back into wordlist words, handling
+// words that contain the separator (e.g. "t-shirt").
+func countWords(passphrase, sep string) int {
+	known := make(map[string]bool)
+	for _, w := range wordlist() {
+		known[w] = true
+	}
+
+	count := 0
+	parts := strings.Split(passphrase, sep)
+	for i := 0; i < len(parts); i++ {
+		if i+1 < len(parts) && known[parts[i]+sep+parts[i+1]] {
+			i++
+		}
+		count++
+	}
+	return count
+}
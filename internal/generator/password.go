@@ -3,6 +3,8 @@ package generator
 import (
 	"crypto/rand"
 	"fmt"
+	"io"
+	"math"
 	"math/big"
 	"regexp"
 	"strconv"
@@ -16,23 +18,43 @@ const (
 	uppercaseLetters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	digits           = "0123456789"
 	defaultSymbols   = "-_$@"
+
+	// shellUnsafeChars have a special meaning to the shell when unquoted or
+	// inside double quotes
+	shellUnsafeChars = " !\"#$&'()*;<>?[\\]`{|}~"
+
+	// jsonUnsafeChars need escaping inside a JSON string
+	jsonUnsafeChars = "\"\\"
+
+	// ambiguousChars are easily mistaken for one another when read or typed
+	ambiguousChars = "lI1O0"
 )
 
 // Generate creates a random password based on the given policy.
 func Generate(policy config.PasswordPolicy) (string, error) {
+	return GenerateFrom(policy, rand.Reader)
+}
+
+// GenerateFrom creates a password based on the given policy, drawing its
+// randomness from random. The same policy and random stream always give
+// the same password.
+func GenerateFrom(policy config.PasswordPolicy, random io.Reader) (string, error) {
+	policy = eachClassMinimums(policy)
+	policy, err := entropyPolicy(policy)
+	if err != nil {
+		return "", err
+	}
 	if err := validatePolicy(policy); err != nil {
 		return "", err
 	}
 
 	// Build character sets
-	symbols := policy.SymbolCharacters
-	if symbols == "" {
-		symbols = defaultSymbols
-	}
+	symbols := symbolSet(policy)
+	lower, upper, digitSet := characterSets(policy)
 
-	letters := lowercaseLetters
+	letters := lower
 	if !policy.NoUpper {
-		letters += uppercaseLetters
+		letters += upper
 	}
 
 	// Calculate how many letters we need
@@ -47,28 +69,47 @@ func Generate(policy config.PasswordPolicy) (string, error) {
 	allowRepeat := policy.AllowRepeat == nil || *policy.AllowRepeat
 
 	// Add required digits
-	chars, err := randomChars(digits, policy.Digits, allowRepeat)
+	chars, err := randomChars(random, digitSet, policy.Digits, allowRepeat)
 	if err != nil {
 		return "", fmt.Errorf("generating digits: %w", err)
 	}
 	password = append(password, chars...)
 
 	// Add required symbols
-	chars, err = randomChars(symbols, policy.Symbols, allowRepeat)
+	chars, err = randomChars(random, symbols, policy.Symbols, allowRepeat)
 	if err != nil {
 		return "", fmt.Errorf("generating symbols: %w", err)
 	}
 	password = append(password, chars...)
 
-	// Add letters
-	chars, err = randomChars(letters, letterCount, allowRepeat)
+	// Add required lowercase and uppercase letters
+	chars, err = randomChars(random, lower, policy.MinLower, allowRepeat)
+	if err != nil {
+		return "", fmt.Errorf("generating lowercase letters: %w", err)
+	}
+	password = append(password, chars...)
+	required := chars
+
+	chars, err = randomChars(random, upper, policy.MinUpper, allowRepeat)
+	if err != nil {
+		return "", fmt.Errorf("generating uppercase letters: %w", err)
+	}
+	password = append(password, chars...)
+	required = append(required, chars...)
+
+	// Fill the remainder with any letters, without those already used
+	// when characters can't repeat
+	if !allowRepeat {
+		letters = removeChars(letters, string(required))
+	}
+	chars, err = randomChars(random, letters, letterCount-policy.MinLower-policy.MinUpper, allowRepeat)
 	if err != nil {
 		return "", fmt.Errorf("generating letters: %w", err)
 	}
 	password = append(password, chars...)
 
 	// Shuffle the password
-	if err := shuffle(password); err != nil {
+	if err := shuffle(random, password); err != nil {
 		return "", fmt.Errorf("shuffling password: %w", err)
 	}
 
@@ -86,32 +127,53 @@ func validatePolicy(policy config.PasswordPolicy) error {
 	if policy.Symbols < 0 {
 		return fmt.Errorf("symbols cannot be negative")
 	}
+	if policy.MinLower < 0 {
+		return fmt.Errorf("min_lowercase cannot be negative")
+	}
+	if policy.MinUpper < 0 {
+		return fmt.Errorf("min_uppercase cannot be negative")
+	}
+	if policy.NoUpper && policy.MinUpper > 0 {
+		return fmt.Errorf("min_uppercase cannot be used with no_upper")
+	}
 
-	minRequired := policy.Digits + policy.Symbols
+	minRequired := policy.Digits + policy.Symbols + policy.MinLower + policy.MinUpper
 	if policy.Length < minRequired {
+		if policy.MinLower > 0 || policy.MinUpper > 0 {
+			return fmt.Errorf("length %d is too small for %d digits, %d symbols, %d lowercase and %d uppercase letters",
+				policy.Length, policy.Digits, policy.Symbols, policy.MinLower, policy.MinUpper)
+		}
 		return fmt.Errorf("length %d is too small for %d digits and %d symbols",
 			policy.Length, policy.Digits, policy.Symbols)
 	}
 
-	// Check if we have enough characters when AllowRepeat is false
 	allowRepeat := policy.AllowRepeat == nil || *policy.AllowRepeat
+	symbols := symbolSet(policy)
+	if policy.Symbols > 0 && symbols == "" {
+		return fmt.Errorf("no symbols left to generate %d symbols after removing shell or JSON unsafe characters", policy.Symbols)
+	}
+
+	// Check if we have enough characters when AllowRepeat is false
 	if !allowRepeat {
-		symbols := policy.SymbolCharacters
-		if symbols == "" {
-			symbols = defaultSymbols
-		}
-		letters := lowercaseLetters
+		lower, upper, digitSet := characterSets(policy)
+		letters := lower
 		if !policy.NoUpper {
-			letters += uppercaseLetters
+			letters += upper
 		}
 
 		letterCount := policy.Length - policy.Digits - policy.Symbols
-		if policy.Digits > len(digits) {
-			return fmt.Errorf("cannot generate %d unique digits (only %d available)", policy.Digits, len(digits))
+		if policy.Digits > len(digitSet) {
+			return fmt.Errorf("cannot generate %d unique digits (only %d available)", policy.Digits, len(digitSet))
 		}
 		if policy.Symbols > len(symbols) {
 			return fmt.Errorf("cannot generate %d unique symbols (only %d available)", policy.Symbols, len(symbols))
 		}
+		if policy.MinLower > len(lower) {
+			return fmt.Errorf("cannot generate %d unique lowercase letters (only %d available)", policy.MinLower, len(lower))
+		}
+		if policy.MinUpper > len(upper) {
+			return fmt.Errorf("cannot generate %d unique uppercase letters (only %d available)", policy.MinUpper, len(upper))
+		}
 		if letterCount > len(letters) {
 			return fmt.Errorf("cannot generate %d unique letters (only %d available)", letterCount, len(letters))
 		}
@@ -120,8 +182,152 @@ func validatePolicy(policy config.PasswordPolicy) error {
 	return nil
 }
 
+// maxEntropyLength bounds the length EntropyLength tries, so an
+// unreachable min_entropy fails instead of looping.
+const maxEntropyLength = 1024
+
+// Entropy returns the entropy in bits of the passwords generated with
+// policy: log2 of the number of passwords its character counts and sets
+// allow. The orderings the final shuffle adds are left out, so it errs on
+// the low side.
+func Entropy(policy config.PasswordPolicy) float64 {
+	policy = eachClassMinimums(policy)
+	allowRepeat := policy.AllowRepeat == nil || *policy.AllowRepeat
+	lower, upper, digitSet := characterSets(policy)
+
+	letters := len(lower)
+	if !policy.NoUpper {
+		letters += len(upper)
+	}
+	letterCount := policy.Length - policy.Digits - policy.Symbols - policy.MinLower - policy.MinUpper
+	if !allowRepeat {
+		letters -= policy.MinLower + policy.MinUpper
+	}
+
+	return choiceBits(len(digitSet), policy.Digits, allowRepeat) +
+		choiceBits(len(symbolSet(policy)), policy.Symbols, allowRepeat) +
+		choiceBits(len(lower), policy.MinLower, allowRepeat) +
+		choiceBits(len(upper), policy.MinUpper, allowRepeat) +
+		choiceBits(letters, letterCount, allowRepeat)
+}
+
+// choiceBits returns log2 of the number of ways to pick n characters in
+// order from a set of size, with or without repeats.
+func choiceBits(size, n int, allowRepeat bool) float64 {
+	if n <= 0 || size <= 0 {
+		return 0
+	}
+	if allowRepeat {
+		return float64(n) * math.Log2(float64(size))
+	}
+	var bits float64
+	for i := 0; i < n && i < size; i++ {
+		bits += math.Log2(float64(size - i))
+	}
+	return bits
+}
+
+// EntropyLength returns the shortest length at which policy generates
+// passwords of at least bits of entropy, ignoring its Length. It fails if
+// no valid length reaches it, such as when allow_repeat = false runs out
+// of characters first.
+func EntropyLength(policy config.PasswordPolicy, bits int) (int, error) {
+	policy = eachClassMinimums(policy)
+	minLength := max(policy.Digits+policy.Symbols+policy.MinLower+policy.MinUpper, 1)
+
+	for length := minLength; length <= maxEntropyLength; length++ {
+		policy.Length = length
+		if validatePolicy(policy) != nil {
+			break
+		}
+		if Entropy(policy) >= float64(bits) {
+			return length, nil
+		}
+	}
+	return 0, fmt.Errorf("min_entropy %d bits can't be reached with this policy", bits)
+}
+
+// entropyPolicy applies MinEntropy to policy: it derives the length when
+// none is set, and otherwise checks that the length reaches it.
+func entropyPolicy(policy config.PasswordPolicy) (config.PasswordPolicy, error) {
+	if policy.MinEntropy <= 0 {
+		return policy, nil
+	}
+	if policy.Length == 0 {
+		length, err := EntropyLength(policy, policy.MinEntropy)
+		if err != nil {
+			return policy, err
+		}
+		policy.Length = length
+		return policy, nil
+	}
+	if bits := Entropy(policy); bits < float64(policy.MinEntropy) {
+		return policy, fmt.Errorf("length %d gives %.0f bits of entropy, less than min_entropy %d", policy.Length, math.Floor(bits), policy.MinEntropy)
+	}
+	return policy, nil
+}
+
+// eachClassMinimums raises the minimums of a RequireEachClass policy to at
+// least one character of each class it can draw from, so the seeding in
+// GenerateFrom and the length check in validatePolicy both account for them.
+func eachClassMinimums(policy config.PasswordPolicy) config.PasswordPolicy {
+	if !policy.RequireEachClass {
+		return policy
+	}
+	policy.MinLower = max(policy.MinLower, 1)
+	if !policy.NoUpper {
+		policy.MinUpper = max(policy.MinUpper, 1)
+	}
+	policy.Digits = max(policy.Digits, 1)
+	if symbolSet(policy) != "" {
+		policy.Symbols = max(policy.Symbols, 1)
+	}
+	return policy
+}
+
+// characterSets returns the lowercase letters, uppercase letters and digits
+// a password may contain, without ambiguousChars when ExcludeAmbiguous is set.
+func characterSets(policy config.PasswordPolicy) (lower, upper, digitSet string) {
+	lower, upper, digitSet = lowercaseLetters, uppercaseLetters, digits
+	if policy.ExcludeAmbiguous {
+		lower = removeChars(lower, ambiguousChars)
+		upper = removeChars(upper, ambiguousChars)
+		digitSet = removeChars(digitSet, ambiguousChars)
+	}
+	return lower, upper, digitSet
+}
+
+// removeChars returns s without the characters in excluded.
+func removeChars(s, excluded string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(excluded, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// symbolSet returns the symbols a password may contain: the policy's symbol
+// set, or the default one, without the characters excluded by ShellSafe and
+// JSONSafe.
+func symbolSet(policy config.PasswordPolicy) string {
+	symbols := policy.SymbolCharacters
+	if symbols == "" {
+		symbols = defaultSymbols
+	}
+
+	var excluded string
+	if policy.ShellSafe {
+		excluded += shellUnsafeChars
+	}
+	if policy.JSONSafe {
+		excluded += jsonUnsafeChars
+	}
+	return removeChars(symbols, excluded)
+}
+
 // randomChars generates n random characters from the given charset.
-func randomChars(charset string, n int, allowRepeat bool) ([]byte, error) {
+func randomChars(random io.Reader, charset string, n int, allowRepeat bool) ([]byte, error) {
 	if n == 0 {
 		return nil, nil
 	}
@@ -137,7 +343,7 @@ func randomChars(charset string, n int, allowRepeat bool) ([]byte, error) {
 			return nil, fmt.Errorf("not enough unique characters")
 		}
 
-		idx, err := randomInt(len(available))
+		idx, err := randomInt(random, len(available))
 		if err != nil {
 			return nil, err
 		}
@@ -153,9 +359,9 @@ func randomChars(charset string, n int, allowRepeat bool) ([]byte, error) {
 	return result, nil
 }
 
-// randomInt returns a cryptographically random int in [0, max).
-func randomInt(max int) (int, error) {
-	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+// randomInt returns a uniformly random int in [0, max) read from random.
+func randomInt(random io.Reader, max int) (int, error) {
+	n, err := rand.Int(random, big.NewInt(int64(max)))
 	if err != nil {
 		return 0, err
 	}
@@ -163,9 +369,9 @@ func randomInt(max int) (int, error) {
 }
 
 // shuffle randomly reorders the bytes using Fisher-Yates algorithm.
-func shuffle(data []byte) error {
+func shuffle(random io.Reader, data []byte) error {
 	for i := len(data) - 1; i > 0; i-- {
-		j, err := randomInt(i + 1)
+		j, err := randomInt(random, i+1)
 		if err != nil {
 			return err
 		}
@@ -239,6 +445,36 @@ func ParseGenerateValue(value string, defaults config.PasswordPolicy) (config.Pa
 				return config.PasswordPolicy{}, fmt.Errorf("invalid noUpper value: %s", val)
 			}
 			policy.NoUpper = b
+		case "minLower":
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return config.PasswordPolicy{}, fmt.Errorf("invalid minLower value: %s", val)
+			}
+			policy.MinLower = n
+		case "minUpper":
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return config.PasswordPolicy{}, fmt.Errorf("invalid minUpper value: %s", val)
+			}
+			policy.MinUpper = n
+		case "excludeAmbiguous":
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return config.PasswordPolicy{}, fmt.Errorf("invalid excludeAmbiguous value: %s", val)
+			}
+			policy.ExcludeAmbiguous = b
+		case "requireEachClass":
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return config.PasswordPolicy{}, fmt.Errorf("invalid requireEachClass value: %s", val)
+			}
+			policy.RequireEachClass = b
+		case "minEntropy":
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return config.PasswordPolicy{}, fmt.Errorf("invalid minEntropy value: %s", val)
+			}
+			policy.MinEntropy = n
 		case "allowRepeat":
 			b, err := strconv.ParseBool(val)
 			if err != nil {
@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"math"
 	"strings"
 	"testing"
 	"unicode"
@@ -101,6 +102,155 @@ func TestGenerate_NoRepeat(t *testing.T) {
 	}
 }
 
+func TestGenerate_MinLetters(t *testing.T) {
+	allowRepeat := false
+	tests := []struct {
+		name   string
+		policy config.PasswordPolicy
+	}{
+		{"lowercase", config.PasswordPolicy{Length: 16, Digits: 4, Symbols: 2, MinLower: 10}},
+		{"uppercase", config.PasswordPolicy{Length: 16, Digits: 4, Symbols: 2, MinUpper: 10}},
+		{"both", config.PasswordPolicy{Length: 20, Digits: 2, Symbols: 2, MinLower: 8, MinUpper: 8}},
+		{"both without repeats", config.PasswordPolicy{Length: 40, Digits: 2, Symbols: 2, MinLower: 16, MinUpper: 16, AllowRepeat: &allowRepeat}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				password, err := Generate(tt.policy)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(password) != tt.policy.Length {
+					t.Fatalf("expected length %d, got %d", tt.policy.Length, len(password))
+				}
+				if n := countMatches(password, unicode.IsLower); n < tt.policy.MinLower {
+					t.Errorf("expected at least %d lowercase letters, got %d in %q", tt.policy.MinLower, n, password)
+				}
+				if n := countMatches(password, unicode.IsUpper); n < tt.policy.MinUpper {
+					t.Errorf("expected at least %d uppercase letters, got %d in %q", tt.policy.MinUpper, n, password)
+				}
+				if tt.policy.AllowRepeat != nil && !*tt.policy.AllowRepeat {
+					seen := make(map[rune]bool)
+					for _, r := range password {
+						if seen[r] {
+							t.Errorf("repeated character %c in %q", r, password)
+						}
+						seen[r] = true
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGenerate_MinLettersInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy config.PasswordPolicy
+	}{
+		{"too long", config.PasswordPolicy{Length: 10, Digits: 2, Symbols: 2, MinLower: 4, MinUpper: 4}},
+		{"negative", config.PasswordPolicy{Length: 10, MinLower: -1}},
+		{"no upper", config.PasswordPolicy{Length: 10, MinUpper: 2, NoUpper: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Generate(tt.policy); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestGenerate_ExcludeAmbiguous(t *testing.T) {
+	allowRepeat := false
+	for _, policy := range []config.PasswordPolicy{
+		{Length: 64, Digits: 10, Symbols: 4, ExcludeAmbiguous: true},
+		{Length: 40, Digits: 8, Symbols: 2, ExcludeAmbiguous: true, AllowRepeat: &allowRepeat},
+	} {
+		for i := 0; i < 50; i++ {
+			password, err := Generate(policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.ContainsAny(password, ambiguousChars) {
+				t.Fatalf("password %q contains one of the ambiguous characters %q", password, ambiguousChars)
+			}
+		}
+	}
+}
+
+func TestGenerate_ExcludeAmbiguousNoRepeat(t *testing.T) {
+	allowRepeat := false
+	tests := []struct {
+		name   string
+		policy config.PasswordPolicy
+	}{
+		// 0 and 1 are left out, so only 8 unique digits remain
+		{"digits", config.PasswordPolicy{Length: 20, Digits: 9, ExcludeAmbiguous: true, AllowRepeat: &allowRepeat}},
+		// l, I and O are left out, so only 49 unique letters remain
+		{"letters", config.PasswordPolicy{Length: 50, ExcludeAmbiguous: true, AllowRepeat: &allowRepeat}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Generate(tt.policy); err == nil || !strings.Contains(err.Error(), "unique") {
+				t.Errorf("expected a unique characters error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerate_RequireEachClass(t *testing.T) {
+	policy := config.PasswordPolicy{Length: 8, RequireEachClass: true}
+
+	for i := 0; i < 200; i++ {
+		password, err := Generate(policy)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(password) != 8 {
+			t.Fatalf("expected length 8, got %d", len(password))
+		}
+
+		classes := map[string]int{
+			"lowercase": countMatches(password, unicode.IsLower),
+			"uppercase": countMatches(password, unicode.IsUpper),
+			"digit":     countMatches(password, unicode.IsDigit),
+			"symbol": countMatches(password, func(r rune) bool {
+				return strings.ContainsRune(defaultSymbols, r)
+			}),
+		}
+		for class, n := range classes {
+			if n == 0 {
+				t.Fatalf("password %q has no %s character", password, class)
+			}
+		}
+	}
+}
+
+func TestGenerate_RequireEachClassSkipsDisabled(t *testing.T) {
+	// No uppercase and no symbols left after shell_safe: only lowercase
+	// and digits are required
+	policy := config.PasswordPolicy{Length: 2, NoUpper: true, SymbolCharacters: "$", ShellSafe: true, RequireEachClass: true}
+
+	for i := 0; i < 50; i++ {
+		password, err := Generate(policy)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if countMatches(password, unicode.IsLower) != 1 || countMatches(password, unicode.IsDigit) != 1 {
+			t.Fatalf("expected one lowercase letter and one digit, got %q", password)
+		}
+	}
+
+	// Each class needs a character, so 3 is too short
+	if _, err := Generate(config.PasswordPolicy{Length: 3, RequireEachClass: true}); err == nil {
+		t.Error("expected an error for a length too small for every class")
+	}
+}
+
 func TestGenerate_CustomSymbols(t *testing.T) {
 	policy := config.PasswordPolicy{
 		Length:           16,
@@ -130,6 +280,61 @@ func TestGenerate_CustomSymbols(t *testing.T) {
 	}
 }
 
+func TestGenerate_SafeSymbols(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   config.PasswordPolicy
+		excluded string
+	}{
+		{"shell safe", config.PasswordPolicy{ShellSafe: true}, "$`\"'\\!&;|<>(){}*?~# "},
+		{"json safe", config.PasswordPolicy{JSONSafe: true}, "\"\\"},
+		{"both", config.PasswordPolicy{ShellSafe: true, JSONSafe: true}, shellUnsafeChars + jsonUnsafeChars},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			policy.Length = 64
+			policy.Digits = 4
+			policy.Symbols = 40
+			policy.SymbolCharacters = "-_@%$`\"'\\!&;|<>(){}*?~# "
+
+			for i := 0; i < 20; i++ {
+				password, err := Generate(policy)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if i := strings.IndexAny(password, tt.excluded); i >= 0 {
+					t.Fatalf("password %q contains excluded character %q", password, password[i])
+				}
+				if !strings.ContainsAny(password, "-_@%") {
+					t.Fatalf("password %q contains no symbols", password)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerate_SafeSymbolsExhausted(t *testing.T) {
+	policy := config.PasswordPolicy{
+		Length:           16,
+		Symbols:          2,
+		SymbolCharacters: "$`\"",
+		ShellSafe:        true,
+	}
+
+	_, err := Generate(policy)
+	if err == nil || !strings.Contains(err.Error(), "no symbols left") {
+		t.Fatalf("expected an error for an empty symbol set, got %v", err)
+	}
+
+	// Without symbols the set doesn't matter
+	policy.Symbols = 0
+	if _, err := Generate(policy); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestGenerate_LengthTooSmall(t *testing.T) {
 	policy := config.PasswordPolicy{
 		Length:  5,
@@ -158,6 +363,79 @@ func TestGenerate_NoRepeatTooManyDigits(t *testing.T) {
 	}
 }
 
+func TestEntropy(t *testing.T) {
+	noRepeat := false
+	tests := []struct {
+		name     string
+		policy   config.PasswordPolicy
+		expected float64
+	}{
+		// 22 letters of 52, 5 digits of 10, 5 symbols of 4
+		{"default", config.DefaultPasswordPolicy(), 22*math.Log2(52) + 5*math.Log2(10) + 5*2},
+		{"lowercase only", config.PasswordPolicy{Length: 10, NoUpper: true}, 10 * math.Log2(26)},
+		{"no repeats", config.PasswordPolicy{Length: 3, NoUpper: true, AllowRepeat: &noRepeat}, math.Log2(26 * 25 * 24)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Entropy(tt.policy); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("Entropy() = %f, want %f", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGenerate_MinEntropy(t *testing.T) {
+	for _, bits := range []int{40, 128, 256} {
+		policy := config.DefaultPasswordPolicy()
+		policy.Length = 0
+		policy.MinEntropy = bits
+
+		password, err := Generate(policy)
+		if err != nil {
+			t.Fatalf("%d bits: unexpected error: %v", bits, err)
+		}
+
+		// The password is the shortest that reaches the target
+		policy.Length = len(password)
+		if got := Entropy(policy); got < float64(bits) {
+			t.Errorf("%d bits: length %d gives only %f bits", bits, len(password), got)
+		}
+		policy.Length--
+		if got := Entropy(policy); got >= float64(bits) {
+			t.Errorf("%d bits: length %d already gives %f bits", bits, policy.Length, got)
+		}
+	}
+
+	// 128 bits: 5 digits and 5 symbols give 26.6 bits, 18 letters the rest
+	length, err := EntropyLength(config.DefaultPasswordPolicy(), 128)
+	if err != nil || length != 28 {
+		t.Errorf("EntropyLength() = %d, %v, want 28", length, err)
+	}
+}
+
+func TestGenerate_MinEntropyWithLength(t *testing.T) {
+	policy := config.PasswordPolicy{Length: 12, NoUpper: true, MinEntropy: 64}
+	if _, err := Generate(policy); err == nil || !strings.Contains(err.Error(), "less than min_entropy 64") {
+		t.Errorf("expected a length too short for min_entropy to fail, got: %v", err)
+	}
+
+	policy.Length = 14
+	password, err := Generate(policy)
+	if err != nil || len(password) != 14 {
+		t.Errorf("expected a 14 character password, got %q, %v", password, err)
+	}
+}
+
+func TestGenerate_MinEntropyUnreachable(t *testing.T) {
+	// Without repeats, lowercase letters give log2(26!) = 88 bits at most
+	noRepeat := false
+	policy := config.PasswordPolicy{NoUpper: true, AllowRepeat: &noRepeat, MinEntropy: 100}
+	if _, err := Generate(policy); err == nil || !strings.Contains(err.Error(), "can't be reached") {
+		t.Errorf("expected an unreachable min_entropy to fail, got: %v", err)
+	}
+}
+
 func TestGenerate_Randomness(t *testing.T) {
 	policy := config.DefaultPasswordPolicy()
 
@@ -270,6 +548,19 @@ func TestParseGenerateValue(t *testing.T) {
 				}
 			}(),
 		},
+		{
+			name:  "with letter minimums",
+			value: "generate(minLower=4, minUpper=3)",
+			expected: config.PasswordPolicy{
+				Length:           defaults.Length,
+				Digits:           defaults.Digits,
+				Symbols:          defaults.Symbols,
+				SymbolCharacters: defaults.SymbolCharacters,
+				MinLower:         4,
+				MinUpper:         3,
+				AllowRepeat:      defaults.AllowRepeat,
+			},
+		},
 		{
 			name:    "invalid syntax",
 			value:   "generate[length=64]",
@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+)
+
+// SSHKey generates an SSH private key of the given type and returns it in
+// OpenSSH PEM format. bits is the RSA key size and is ignored for ed25519.
+func SSHKey(keyType string, bits int) (string, error) {
+	var key crypto.PrivateKey
+	switch keyType {
+	case config.SSHKeyTypeEd25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", fmt.Errorf("generating ed25519 key: %w", err)
+		}
+		key = priv
+	case config.SSHKeyTypeRSA:
+		if bits < config.MinRSABits {
+			return "", fmt.Errorf("rsa key size %d is below the minimum of %d bits", bits, config.MinRSABits)
+		}
+		priv, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return "", fmt.Errorf("generating rsa key: %w", err)
+		}
+		key = priv
+	default:
+		return "", fmt.Errorf("unknown ssh key type %q", keyType)
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		return "", fmt.Errorf("encoding private key: %w", err)
+	}
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// SSHPublicKey returns the public key of a PEM-encoded SSH private key in
+// authorized_keys format, without a trailing newline.
+func SSHPublicKey(privateKey string) (string, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return "", fmt.Errorf("parsing private key: %w", err)
+	}
+	return strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(signer.PublicKey())), "\n"), nil
+}
@@ -0,0 +1,148 @@
+package generator
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+)
+
+// TLSKey generates an ECDSA P-256 private key and returns it PEM-encoded
+// in PKCS #8 form.
+func TLSKey() (string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("generating ecdsa key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("encoding private key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// TLSCert issues a PEM-encoded certificate for the PEM-encoded private key.
+// It's self-signed unless issuerCert and issuerKey, the PEM-encoded CA
+// certificate and key, are given.
+func TLSCert(keyPEM string, cfg config.TLSCertConfig, issuerCert, issuerKey string) (string, error) {
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", fmt.Errorf("generating serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cfg.CommonName},
+		NotBefore:    now.Add(-time.Minute), // tolerate clock skew
+		NotAfter:     now.Add(cfg.TTL),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+
+		BasicConstraintsValid: true,
+	}
+	for _, san := range cfg.SANs {
+		if ip := net.ParseIP(san); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, san)
+		}
+	}
+	if cfg.IsCA {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+
+	parent, signer := template, key
+	if issuerCert != "" || issuerKey != "" {
+		parent, err = ParseCertificate(issuerCert)
+		if err != nil {
+			return "", fmt.Errorf("issuer: %w", err)
+		}
+		if !parent.IsCA {
+			return "", fmt.Errorf("issuer %q is not a CA certificate", parent.Subject.CommonName)
+		}
+		signer, err = parsePrivateKey(issuerKey)
+		if err != nil {
+			return "", fmt.Errorf("issuer: %w", err)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		return "", fmt.Errorf("creating certificate: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), nil
+}
+
+// TLSCertMatchesKey reports whether a PEM-encoded certificate was issued for
+// the PEM-encoded private key.
+func TLSCertMatchesKey(certPEM, keyPEM string) bool {
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		return false
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return false
+	}
+	public, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && public.Equal(cert.PublicKey)
+}
+
+// ParseCertificate parses the first PEM-encoded certificate in certPEM.
+func ParseCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// parsePrivateKey parses a PEM-encoded PKCS #8, PKCS #1 or SEC 1 private key.
+func parsePrivateKey(keyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
@@ -0,0 +1,87 @@
+package generator
+
+import (
+	"crypto/x509"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+)
+
+func TestTLSCert_SelfSigned(t *testing.T) {
+	key, err := TLSKey()
+	if err != nil {
+		t.Fatalf("TLSKey() error = %v", err)
+	}
+
+	cfg := config.TLSCertConfig{
+		CommonName: "svc.internal",
+		SANs:       []string{"svc.internal", "svc.default.svc", "10.0.0.1"},
+		TTL:        90 * 24 * time.Hour,
+	}
+	certPEM, err := TLSCert(key, cfg, "", "")
+	if err != nil {
+		t.Fatalf("TLSCert() error = %v", err)
+	}
+
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+	if cert.Subject.CommonName != "svc.internal" {
+		t.Errorf("CN = %q, want svc.internal", cert.Subject.CommonName)
+	}
+	if !slices.Equal(cert.DNSNames, []string{"svc.internal", "svc.default.svc"}) {
+		t.Errorf("DNSNames = %v", cert.DNSNames)
+	}
+	if len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("IPAddresses = %v", cert.IPAddresses)
+	}
+	if want := time.Now().Add(cfg.TTL); cert.NotAfter.Before(want.Add(-time.Minute)) || cert.NotAfter.After(want) {
+		t.Errorf("NotAfter = %v, want about %v", cert.NotAfter, want)
+	}
+	if cert.IsCA {
+		t.Error("expected a leaf certificate")
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		t.Errorf("expected a self-signed certificate: %v", err)
+	}
+	if !TLSCertMatchesKey(certPEM, key) {
+		t.Error("certificate doesn't match its key")
+	}
+
+	otherKey, _ := TLSKey()
+	if TLSCertMatchesKey(certPEM, otherKey) {
+		t.Error("certificate matches an unrelated key")
+	}
+}
+
+func TestTLSCert_Issuer(t *testing.T) {
+	caKey, _ := TLSKey()
+	caCert, err := TLSCert(caKey, config.TLSCertConfig{CommonName: "Internal CA", TTL: time.Hour, IsCA: true}, "", "")
+	if err != nil {
+		t.Fatalf("creating CA: %v", err)
+	}
+
+	key, _ := TLSKey()
+	certPEM, err := TLSCert(key, config.TLSCertConfig{CommonName: "svc.internal", SANs: []string{"svc.internal"}, TTL: time.Hour}, caCert, caKey)
+	if err != nil {
+		t.Fatalf("TLSCert() error = %v", err)
+	}
+
+	ca, _ := ParseCertificate(caCert)
+	cert, _ := ParseCertificate(certPEM)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "svc.internal"}); err != nil {
+		t.Errorf("certificate doesn't verify against the CA: %v", err)
+	}
+
+	// A leaf can't issue certificates
+	if _, err := TLSCert(key, config.TLSCertConfig{CommonName: "other", TTL: time.Hour}, certPEM, key); err == nil || !strings.Contains(err.Error(), "not a CA") {
+		t.Errorf("expected error for a non-CA issuer, got %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package generator
+
+import (
+	"regexp"
+	"testing"
+)
+
+var uuidV4Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestUUID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := UUID()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !uuidV4Pattern.MatchString(id) {
+			t.Errorf("UUID() = %q, not a valid v4 UUID", id)
+		}
+		if seen[id] {
+			t.Errorf("duplicate UUID generated: %s", id)
+		}
+		seen[id] = true
+	}
+}
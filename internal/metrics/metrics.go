@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+)
+
+// Run describes a single reconciliation run for metrics reporting.
+type Run struct {
+	// Command is the command that produced the run (apply, watch)
+	Command string
+
+	// Result is the reconciliation result
+	Result *engine.Result
+
+	// DryRun is true if no changes were written
+	DryRun bool
+
+	// Start and End bound the run
+	Start time.Time
+	End   time.Time
+}
+
+// Write serializes run metrics in the Prometheus text exposition format.
+// Only counts are reported, secret values and key names are never included.
+func Write(w io.Writer, run Run) error {
+	adds, updates, deletes, unmanaged, unchanged := run.Result.Diff.Summary()
+
+	success := 0
+	if len(run.Result.Errors) == 0 {
+		success = 1
+	}
+
+	var buf bytes.Buffer
+	labels := fmt.Sprintf(`command=%q`, run.Command)
+
+	gauge(&buf, "vsg_last_run_timestamp_seconds", "Unix time the last run finished.", labels, float64(run.End.Unix()))
+	gauge(&buf, "vsg_last_run_duration_seconds", "Duration of the last run in seconds.", labels, run.End.Sub(run.Start).Seconds())
+	gauge(&buf, "vsg_last_run_success", "Whether the last run completed without errors.", labels, float64(success))
+	gauge(&buf, "vsg_last_run_dry_run", "Whether the last run was a dry run.", labels, boolValue(run.DryRun))
+	gauge(&buf, "vsg_last_run_applied", "Whether the last run wrote changes to Vault.", labels, boolValue(run.Result.Applied))
+	gauge(&buf, "vsg_last_run_errors", "Number of errors in the last run.", labels, float64(len(run.Result.Errors)))
+	gauge(&buf, "vsg_last_run_blocks", "Number of secret blocks processed in the last run.", labels, float64(len(run.Result.Diff.Blocks)))
+
+	header(&buf, "vsg_last_run_keys", "Number of keys by change type in the last run.")
+	for _, c := range []struct {
+		change engine.ChangeType
+		count  int
+	}{
+		{engine.ChangeAdd, adds},
+		{engine.ChangeUpdate, updates},
+		{engine.ChangeDelete, deletes},
+		{engine.ChangeUnmanaged, unmanaged},
+		{engine.ChangeNone, unchanged},
+	} {
+		sample(&buf, "vsg_last_run_keys", fmt.Sprintf(`%s,change=%q`, labels, c.change), float64(c.count))
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteFile writes run metrics to path for the node_exporter textfile collector.
+// The file is written to a temporary file first and renamed into place, so the
+// collector never reads a partially written file.
+func WriteFile(path string, run Run) error {
+	var buf bytes.Buffer
+	if err := Write(&buf, run); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating metrics file: %w", err)
+	}
+	//nolint:errcheck // Best effort cleanup, fails harmlessly after rename
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		//nolint:errcheck // Already returning the write error
+		tmp.Close()
+		return fmt.Errorf("writing metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing metrics file: %w", err)
+	}
+
+	// #nosec G302 -- Metrics must be readable by node_exporter
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("setting metrics file permissions: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("renaming metrics file: %w", err)
+	}
+
+	return nil
+}
+
+func gauge(buf *bytes.Buffer, name, help, labels string, value float64) {
+	header(buf, name, help)
+	sample(buf, name, labels, value)
+}
+
+func header(buf *bytes.Buffer, name, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+}
+
+func sample(buf *bytes.Buffer, name, labels string, value float64) {
+	fmt.Fprintf(buf, "%s{%s} %s\n", name, labels, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+)
+
+func testRun() Run {
+	start := time.Unix(1700000000, 0)
+	return Run{
+		Command: "apply",
+		Result: &engine.Result{
+			Diff: &engine.Diff{
+				Blocks: []engine.BlockDiff{
+					{
+						Name: "app",
+						Changes: []engine.SecretChange{
+							{Key: "password", Change: engine.ChangeAdd, NewValue: "super-secret"},
+							{Key: "host", Change: engine.ChangeUpdate, OldValue: "old", NewValue: "new"},
+							{Key: "port", Change: engine.ChangeNone},
+						},
+					},
+				},
+			},
+			Errors:  []engine.BlockError{{Block: "db", Err: errors.New("fetch failed")}},
+			Applied: true,
+		},
+		Start: start,
+		End:   start.Add(1500 * time.Millisecond),
+	}
+}
+
+func TestWrite_WellFormed(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testRun()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	comment := regexp.MustCompile(`^# (HELP|TYPE) vsg_[a-z_]+ .+$`)
+	sample := regexp.MustCompile(`^vsg_[a-z_]+\{[a-z_]+="[^"]*"(,[a-z_]+="[^"]*")*\} -?[0-9.]+$`)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for _, line := range lines {
+		if !comment.MatchString(line) && !sample.MatchString(line) {
+			t.Errorf("malformed metric line: %q", line)
+		}
+	}
+}
+
+func TestWrite_Values(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testRun()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	expected := []string{
+		`vsg_last_run_timestamp_seconds{command="apply"} 1700000001`,
+		`vsg_last_run_duration_seconds{command="apply"} 1.5`,
+		`vsg_last_run_success{command="apply"} 0`,
+		`vsg_last_run_applied{command="apply"} 1`,
+		`vsg_last_run_errors{command="apply"} 1`,
+		`vsg_last_run_blocks{command="apply"} 1`,
+		`vsg_last_run_keys{command="apply",change="add"} 1`,
+		`vsg_last_run_keys{command="apply",change="update"} 1`,
+		`vsg_last_run_keys{command="apply",change="delete"} 0`,
+		`vsg_last_run_keys{command="apply",change="none"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing metric line %q in:\n%s", line, out)
+		}
+	}
+
+	// Values and key names must never appear
+	for _, secret := range []string{"super-secret", "password", "host"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("metrics output contains %q", secret)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vsg.prom")
+
+	if err := WriteFile(path, testRun()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading metrics file: %v", err)
+	}
+	if !strings.Contains(string(data), "vsg_last_run_timestamp_seconds") {
+		t.Errorf("unexpected metrics file content:\n%s", data)
+	}
+
+	// No temporary files left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the metrics file, found %d entries", len(entries))
+	}
+}
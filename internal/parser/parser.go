@@ -14,25 +14,58 @@ import (
 //   - ".outputs.db_host.value" -> data["outputs"]["db_host"]["value"]
 //   - ".items[0].name" -> data["items"][0]["name"]
 func ExtractJSON(data []byte, path string) (string, error) {
-	var obj interface{}
-	if err := json.Unmarshal(data, &obj); err != nil {
-		return "", fmt.Errorf("parsing JSON: %w", err)
+	obj, err := ParseJSON(data)
+	if err != nil {
+		return "", err
 	}
 
-	return extractValue(obj, path)
+	return Extract(obj, path)
 }
 
 // ExtractYAML extracts a value from YAML data using yq-style dot notation.
 // Uses the same syntax as ExtractJSON.
 func ExtractYAML(data []byte, path string) (string, error) {
+	obj, err := ParseYAML(data)
+	if err != nil {
+		return "", err
+	}
+
+	return Extract(obj, path)
+}
+
+// ParseJSON parses JSON data into a document that can be queried with Extract.
+func ParseJSON(data []byte) (interface{}, error) {
+	var obj interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %w", err)
+	}
+	return obj, nil
+}
+
+// ParseYAML parses YAML data into a document that can be queried with Extract.
+func ParseYAML(data []byte) (interface{}, error) {
 	var obj interface{}
 	if err := yaml.Unmarshal(data, &obj); err != nil {
-		return "", fmt.Errorf("parsing YAML: %w", err)
+		return nil, fmt.Errorf("parsing YAML: %w", err)
 	}
 
 	// Convert map[string]interface{} to work with our extraction
-	obj = normalizeYAML(obj)
+	return normalizeYAML(obj), nil
+}
+
+// Extract extracts a value from a parsed document using dot notation.
+// The document is not modified, so it can be queried repeatedly.
+func Extract(obj interface{}, path string) (string, error) {
+	v, err := extractValue(obj, path)
+	if err != nil {
+		return "", err
+	}
+	return ValueToString(v)
+}
 
+// ExtractValue extracts a value from a parsed document like Extract, but
+// returns it as decoded instead of converting it to a string.
+func ExtractValue(obj interface{}, path string) (interface{}, error) {
 	return extractValue(obj, path)
 }
 
@@ -56,12 +89,12 @@ func normalizeYAML(v interface{}) interface{} {
 }
 
 // extractValue traverses the object using the given path.
-func extractValue(obj interface{}, path string) (string, error) {
+func extractValue(obj interface{}, path string) (interface{}, error) {
 	// Remove leading dot if present
 	path = strings.TrimPrefix(path, ".")
 
 	if path == "" {
-		return valueToString(obj)
+		return obj, nil
 	}
 
 	parts := parsePath(path)
@@ -72,27 +105,27 @@ func extractValue(obj interface{}, path string) (string, error) {
 			// Array access
 			arr, ok := current.([]interface{})
 			if !ok {
-				return "", fmt.Errorf("expected array at %s, got %T", pathUpTo(parts, i), current)
+				return nil, fmt.Errorf("expected array at %s, got %T", pathUpTo(parts, i), current)
 			}
 			if part.index < 0 || part.index >= len(arr) {
-				return "", fmt.Errorf("array index %d out of bounds (length %d) at %s", part.index, len(arr), pathUpTo(parts, i))
+				return nil, fmt.Errorf("array index %d out of bounds (length %d) at %s", part.index, len(arr), pathUpTo(parts, i))
 			}
 			current = arr[part.index]
 		} else {
 			// Object key access
 			m, ok := current.(map[string]interface{})
 			if !ok {
-				return "", fmt.Errorf("expected object at %s, got %T", pathUpTo(parts, i), current)
+				return nil, fmt.Errorf("expected object at %s, got %T", pathUpTo(parts, i), current)
 			}
 			val, exists := m[part.key]
 			if !exists {
-				return "", fmt.Errorf("key %q not found at %s", part.key, pathUpTo(parts, i))
+				return nil, fmt.Errorf("key %q not found at %s", part.key, pathUpTo(parts, i))
 			}
 			current = val
 		}
 	}
 
-	return valueToString(current)
+	return current, nil
 }
 
 type pathPart struct {
@@ -167,8 +200,10 @@ func pathUpTo(parts []pathPart, i int) string {
 	return sb.String()
 }
 
-// valueToString converts a value to its string representation.
-func valueToString(v interface{}) (string, error) {
+// ValueToString converts a decoded value to the string written to Vault.
+// Integral numbers have no decimal point, and arrays and objects are
+// rendered as JSON.
+func ValueToString(v interface{}) (string, error) {
 	switch val := v.(type) {
 	case string:
 		return val, nil
@@ -240,3 +240,46 @@ func TestParsePath(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractValue_YAML(t *testing.T) {
+	doc, err := ParseYAML([]byte(`
+database:
+  port: 5432
+  ratio: 0.75
+  tls: true
+  host: db.internal
+  quoted_port: "5432"
+  password: ~
+`))
+	if err != nil {
+		t.Fatalf("parsing YAML: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{".database.port", 5432},
+		{".database.ratio", 0.75},
+		{".database.tls", true},
+		{".database.host", "db.internal"},
+		{".database.quoted_port", "5432"},
+		{".database.password", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ExtractValue(doc, tt.path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExtractValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ExtractValue(doc, ".database.missing"); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+}
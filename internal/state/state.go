@@ -0,0 +1,216 @@
+// Package state records which secret blocks an apply wrote successfully, so
+// a partly failed apply can be resumed without redoing the blocks that
+// already went through, and a later diff can tell whether Vault changed
+// since.
+package state
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+)
+
+// State is the content of a state file.
+type State struct {
+	// Salt keys the hashes of Block.Data. It's random and made for each
+	// state file, so a hash can't be matched against a table of common
+	// passwords or against the same secret recorded in another state.
+	Salt string `json:"salt,omitempty"`
+
+	Blocks map[string]Block `json:"blocks"`
+}
+
+// Block records the last successful apply of a secret block.
+type Block struct {
+	// Hash identifies the block's configuration at the time of the apply
+	Hash string `json:"hash"`
+
+	// Data identifies the secret's keys and values in Vault right after
+	// the apply, see State.DataHash
+	Data string `json:"data,omitempty"`
+
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// Load reads a state file. A missing file is an empty state.
+func Load(path string) (*State, error) {
+	// #nosec G304 -- State file path is provided by the user
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &State{Blocks: make(map[string]Block)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing state file %s: %w", path, err)
+	}
+	if s.Blocks == nil {
+		s.Blocks = make(map[string]Block)
+	}
+
+	// Older versions stored unsalted hashes; they're dropped rather than
+	// kept in the file, and the blocks count as recorded without data
+	if s.Salt == "" {
+		for name, b := range s.Blocks {
+			b.Data = ""
+			s.Blocks[name] = b
+		}
+	}
+	return &s, nil
+}
+
+// Save writes the state file atomically, so an interrupted run never
+// leaves a truncated file behind.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("formatting state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating state file: %w", err)
+	}
+	//nolint:errcheck // Best effort cleanup, fails harmlessly after rename
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		//nolint:errcheck // Already returning the write error
+		tmp.Close()
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("renaming state file: %w", err)
+	}
+	return nil
+}
+
+// Applied reports whether the block was applied successfully with the
+// configuration identified by hash.
+func (s *State) Applied(name, hash string) bool {
+	b, ok := s.Blocks[name]
+	return ok && b.Hash == hash
+}
+
+// Record updates the state from the result of an apply: blocks written
+// without errors are recorded with their hash, blocks with errors are
+// forgotten so a resumed run processes them again. Blocks the run didn't
+// process keep their previous record.
+func (s *State) Record(result *engine.Result, hashes map[string]string, at time.Time) {
+	if s.Salt == "" {
+		s.Salt = rand.Text()
+	}
+
+	failed := make(map[string]bool)
+	for _, e := range result.Errors {
+		for _, name := range e.Blocks() {
+			failed[name] = true
+			delete(s.Blocks, name)
+		}
+	}
+
+	for _, block := range result.Diff.Blocks {
+		if failed[block.Name] {
+			continue
+		}
+		s.Blocks[block.Name] = Block{Hash: hashes[block.Name], Data: s.AppliedData(block), AppliedAt: at}
+	}
+}
+
+// Drifted returns the blocks of diff, in sorted order, whose secret in
+// Vault no longer holds what the last apply left there: someone changed
+// it outside vsg. Blocks recorded without data, by an older version, are
+// never reported.
+func (s *State) Drifted(diff *engine.Diff) []string {
+	var drifted []string
+	for _, block := range diff.Blocks {
+		b, ok := s.Blocks[block.Name]
+		if !ok || b.Data == "" {
+			continue
+		}
+		if s.CurrentData(block) != b.Data {
+			drifted = append(drifted, block.Name)
+		}
+	}
+	sort.Strings(drifted)
+	return drifted
+}
+
+// AppliedData returns the DataHash of the secret as an apply of block
+// leaves it: the desired values, plus the unmanaged keys it keeps. Keys
+// matched by ignore_keys are left out, so changing them is never drift.
+func (s *State) AppliedData(block engine.BlockDiff) string {
+	data := make(map[string]string, len(block.Changes))
+	for _, c := range block.Changes {
+		if c.Ignored {
+			continue
+		}
+		switch c.Change {
+		case engine.ChangeAdd, engine.ChangeUpdate, engine.ChangeNone:
+			data[c.Key] = c.NewValue
+		case engine.ChangeUnmanaged:
+			data[c.Key] = c.OldValue
+		}
+	}
+	return s.DataHash(data)
+}
+
+// CurrentData returns the DataHash of the secret as block found it in
+// Vault, before any change, leaving out the keys matched by ignore_keys.
+func (s *State) CurrentData(block engine.BlockDiff) string {
+	data := make(map[string]string, len(block.Changes))
+	for _, c := range block.Changes {
+		if c.Change != engine.ChangeAdd && !c.Ignored {
+			data[c.Key] = c.OldValue
+		}
+	}
+	return s.DataHash(data)
+}
+
+// DataHash identifies the keys and values of a secret with an HMAC-SHA256
+// keyed by the state's salt. Like BlockHash, values are only hashed, never
+// stored.
+func (s *State) DataHash(data map[string]string) string {
+	h := hmac.New(sha256.New, []byte(s.Salt))
+	for _, key := range slices.Sorted(maps.Keys(data)) {
+		// Length-prefixed, so no two different secrets hash the same input
+		fmt.Fprintf(h, "%d:%s%d:%s", len(key), key, len(data[key]), data[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// BlockHash identifies the configuration a block is applied with: the
+// block itself and the defaults its values are resolved with. Any change to
+// either changes the hash. Values are only hashed, never stored.
+func BlockHash(block config.SecretBlock, defaults config.Defaults) (string, error) {
+	data, err := json.Marshal(struct {
+		Block    config.SecretBlock
+		Defaults config.Defaults
+	}{block, defaults})
+	if err != nil {
+		return "", fmt.Errorf("hashing block %s: %w", block.Name, err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,263 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+	"github.com/pavlenkoa/vault-secrets-generator/internal/engine"
+)
+
+func TestRecord_FailureThenResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	hashes := map[string]string{"app": "h-app", "db": "h-db", "cache": "h-cache"}
+
+	st, err := Load(path)
+	if err != nil {
+		t.Fatalf("loading missing state: %v", err)
+	}
+	if len(st.Blocks) != 0 {
+		t.Fatalf("expected an empty state, got %v", st.Blocks)
+	}
+
+	// First run: app is written, db fails on a key, cache fails before
+	// it has a diff
+	first := &engine.Result{
+		Diff: &engine.Diff{Blocks: []engine.BlockDiff{{Name: "app"}, {Name: "db"}}},
+		Errors: []engine.BlockError{
+			{Block: "db", Key: "password", Err: errors.New("fetch failed")},
+			{Block: "cache", Err: errors.New("permission denied")},
+		},
+	}
+	st.Record(first, hashes, time.Now())
+	if err := st.Save(path); err != nil {
+		t.Fatalf("saving state: %v", err)
+	}
+
+	st, err = Load(path)
+	if err != nil {
+		t.Fatalf("loading state: %v", err)
+	}
+	if !st.Applied("app", "h-app") {
+		t.Error("expected app to be recorded as applied")
+	}
+	for _, name := range []string{"db", "cache"} {
+		if st.Applied(name, hashes[name]) {
+			t.Errorf("expected failed block %s not to be recorded", name)
+		}
+	}
+	if st.Applied("app", "changed") {
+		t.Error("expected a changed configuration not to count as applied")
+	}
+
+	// Resumed run: only the failed blocks are processed, and succeed
+	resumed := &engine.Result{
+		Diff: &engine.Diff{Blocks: []engine.BlockDiff{{Name: "db"}, {Name: "cache"}}},
+	}
+	st.Record(resumed, hashes, time.Now())
+	for name, hash := range hashes {
+		if !st.Applied(name, hash) {
+			t.Errorf("expected %s to be applied after the resumed run", name)
+		}
+	}
+
+	// A block failing again is forgotten
+	st.Record(&engine.Result{
+		Diff:   &engine.Diff{},
+		Errors: []engine.BlockError{{Block: "app", Err: errors.New("write failed")}},
+	}, hashes, time.Now())
+	if st.Applied("app", "h-app") {
+		t.Error("expected a failed block to be forgotten")
+	}
+
+	// A source failure grouped across blocks fails each of them
+	st.Record(resumed, hashes, time.Now())
+	st.Record(&engine.Result{
+		Diff: &engine.Diff{},
+		Errors: []engine.BlockError{{
+			Block: "cache",
+			Key:   "host",
+			Err:   errors.New("fetch failed"),
+			Keys:  []engine.BlockKey{{Block: "cache", Key: "host"}, {Block: "db", Key: "host"}},
+		}},
+	}, hashes, time.Now())
+	for _, name := range []string{"cache", "db"} {
+		if st.Applied(name, hashes[name]) {
+			t.Errorf("expected %s to be forgotten after the grouped failure", name)
+		}
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected an error for an invalid state file")
+	}
+}
+
+func TestBlockHash(t *testing.T) {
+	block := config.SecretBlock{
+		Name:  "app",
+		Mount: "secret",
+		Path:  "app",
+		Content: map[string]config.Value{
+			"password": {Type: config.ValueTypeGenerate},
+			"host":     {Type: config.ValueTypeStatic, Static: "db.internal"},
+		},
+	}
+	defaults := config.Defaults{Generate: config.DefaultPasswordPolicy()}
+
+	hash, err := BlockHash(block, defaults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	again, _ := BlockHash(block, defaults)
+	if hash != again {
+		t.Error("expected the same block to hash the same")
+	}
+
+	changed := block
+	changed.Content = map[string]config.Value{
+		"password": {Type: config.ValueTypeGenerate},
+		"host":     {Type: config.ValueTypeStatic, Static: "db2.internal"},
+	}
+	if h, _ := BlockHash(changed, defaults); h == hash {
+		t.Error("expected a changed value to change the hash")
+	}
+
+	longer := defaults
+	longer.Generate.Length = 64
+	if h, _ := BlockHash(block, longer); h == hash {
+		t.Error("expected changed defaults to change the hash")
+	}
+}
+
+func TestDrifted(t *testing.T) {
+	// The apply adds password, keeps the unmanaged legacy key, and prunes old
+	applied := engine.BlockDiff{Name: "app", Changes: []engine.SecretChange{
+		{Key: "host", Change: engine.ChangeNone, OldValue: "db", NewValue: "db"},
+		{Key: "legacy", Change: engine.ChangeUnmanaged, OldValue: "x"},
+		{Key: "old", Change: engine.ChangeDelete, OldValue: "y"},
+		{Key: "password", Change: engine.ChangeAdd, NewValue: "hunter2"},
+	}}
+	st := &State{Blocks: make(map[string]Block)}
+	st.Record(&engine.Result{Diff: &engine.Diff{Blocks: []engine.BlockDiff{applied}}}, map[string]string{"app": "h"}, time.Now())
+	st.Blocks["legacy-record"] = Block{Hash: "h"}
+
+	inSync := engine.BlockDiff{Name: "app", Changes: []engine.SecretChange{
+		{Key: "host", Change: engine.ChangeUpdate, OldValue: "db", NewValue: "db2"},
+		{Key: "legacy", Change: engine.ChangeUnmanaged, OldValue: "x"},
+		{Key: "password", Change: engine.ChangeNone, OldValue: "hunter2", NewValue: "hunter2"},
+	}}
+	changed := engine.BlockDiff{Name: "app", Changes: []engine.SecretChange{
+		{Key: "host", Change: engine.ChangeNone, OldValue: "db", NewValue: "db"},
+		{Key: "legacy", Change: engine.ChangeUnmanaged, OldValue: "x"},
+		{Key: "password", Change: engine.ChangeUpdate, OldValue: "changed", NewValue: "hunter2"},
+	}}
+	unrecorded := engine.BlockDiff{Name: "legacy-record", Changes: []engine.SecretChange{
+		{Key: "key", Change: engine.ChangeUpdate, OldValue: "a", NewValue: "b"},
+	}}
+
+	if drifted := st.Drifted(&engine.Diff{Blocks: []engine.BlockDiff{inSync, unrecorded}}); drifted != nil {
+		t.Errorf("expected no drift, got %v", drifted)
+	}
+	if drifted := st.Drifted(&engine.Diff{Blocks: []engine.BlockDiff{changed}}); len(drifted) != 1 || drifted[0] != "app" {
+		t.Errorf("expected app to have drifted, got %v", drifted)
+	}
+}
+
+func TestDrifted_IgnoredKeys(t *testing.T) {
+	applied := engine.BlockDiff{Name: "app", Changes: []engine.SecretChange{
+		{Key: "host", Change: engine.ChangeNone, OldValue: "db", NewValue: "db"},
+		{Key: "session_token", Change: engine.ChangeUnmanaged, OldValue: "abc", Ignored: true},
+	}}
+	st := &State{Blocks: make(map[string]Block)}
+	st.Record(&engine.Result{Diff: &engine.Diff{Blocks: []engine.BlockDiff{applied}}}, map[string]string{"app": "h"}, time.Now())
+
+	// The ignored key is rotated outside vsg, then removed
+	rotated := engine.BlockDiff{Name: "app", Changes: []engine.SecretChange{
+		{Key: "host", Change: engine.ChangeNone, OldValue: "db", NewValue: "db"},
+		{Key: "session_token", Change: engine.ChangeUnmanaged, OldValue: "xyz", Ignored: true},
+	}}
+	removed := engine.BlockDiff{Name: "app", Changes: []engine.SecretChange{
+		{Key: "host", Change: engine.ChangeNone, OldValue: "db", NewValue: "db"},
+	}}
+	for _, block := range []engine.BlockDiff{rotated, removed} {
+		if drifted := st.Drifted(&engine.Diff{Blocks: []engine.BlockDiff{block}}); drifted != nil {
+			t.Errorf("expected changes to an ignored key not to be drift, got %v", drifted)
+		}
+	}
+}
+
+func TestDataHash_Salted(t *testing.T) {
+	data := map[string]string{"password": "hunter2"}
+	block := engine.BlockDiff{Name: "app", Changes: []engine.SecretChange{
+		{Key: "password", Change: engine.ChangeNone, OldValue: "hunter2", NewValue: "hunter2"},
+	}}
+	result := &engine.Result{Diff: &engine.Diff{Blocks: []engine.BlockDiff{block}}}
+
+	first := &State{Blocks: make(map[string]Block)}
+	second := &State{Blocks: make(map[string]Block)}
+	first.Record(result, map[string]string{"app": "h"}, time.Now())
+	second.Record(result, map[string]string{"app": "h"}, time.Now())
+
+	if first.Salt == "" || first.Salt == second.Salt {
+		t.Fatalf("expected a random salt per state, got %q and %q", first.Salt, second.Salt)
+	}
+	if first.Blocks["app"].Data == second.Blocks["app"].Data {
+		t.Error("expected the same secret to hash differently in each state")
+	}
+	if first.Blocks["app"].Data != first.DataHash(data) {
+		t.Error("expected the recorded data to be the state's hash of the secret")
+	}
+
+	// The salt survives a save, so a later diff sees no drift
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := first.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Salt != first.Salt {
+		t.Errorf("salt = %q, want %q", loaded.Salt, first.Salt)
+	}
+	if drifted := loaded.Drifted(result.Diff); drifted != nil {
+		t.Errorf("expected no drift after reloading, got %v", drifted)
+	}
+}
+
+func TestLoad_UnsaltedData(t *testing.T) {
+	// A state file written before hashes were salted
+	path := filepath.Join(t.TempDir(), "state.json")
+	old := `{"blocks":{"app":{"hash":"h-app","data":"3f2a","applied_at":"2026-01-01T00:00:00Z"}}}`
+	if err := os.WriteFile(path, []byte(old), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Applied("app", "h-app") {
+		t.Error("expected the block to stay recorded as applied")
+	}
+	if st.Blocks["app"].Data != "" {
+		t.Errorf("expected the unsalted data hash to be dropped, got %q", st.Blocks["app"].Data)
+	}
+
+	changed := engine.BlockDiff{Name: "app", Changes: []engine.SecretChange{
+		{Key: "key", Change: engine.ChangeUpdate, OldValue: "a", NewValue: "b"},
+	}}
+	if drifted := st.Drifted(&engine.Diff{Blocks: []engine.BlockDiff{changed}}); drifted != nil {
+		t.Errorf("expected no drift without a salted hash, got %v", drifted)
+	}
+}
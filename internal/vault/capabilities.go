@@ -0,0 +1,48 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+)
+
+// requiredCapabilities are the capabilities needed to reconcile a secret:
+// read to compare against the current state, create and update to write it.
+var requiredCapabilities = []string{"read", "create", "update"}
+
+// MissingCapabilities returns the capabilities required to reconcile the
+// secret at path that the client token lacks, using sys/capabilities-self.
+func (kv *KVClient) MissingCapabilities(ctx context.Context, path string) ([]string, error) {
+	fullPath := kv.buildWritePath(path)
+
+	var granted []string
+	err := kv.client.withRetry(ctx, func() error {
+		var err error
+		granted, err = kv.client.client.Sys().CapabilitiesSelfWithContext(ctx, fullPath)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("checking capabilities on %s: %w", fullPath, err)
+	}
+
+	return missingCapabilities(granted), nil
+}
+
+// missingCapabilities returns the required capabilities absent from granted.
+func missingCapabilities(granted []string) []string {
+	has := make(map[string]bool, len(granted))
+	for _, c := range granted {
+		if c == "root" {
+			return nil
+		}
+		has[c] = true
+	}
+
+	var missing []string
+	for _, c := range requiredCapabilities {
+		// deny overrides any other capability on the path
+		if !has[c] || has["deny"] {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
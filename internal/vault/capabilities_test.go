@@ -0,0 +1,89 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestMissingCapabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  []string
+		expected []string
+	}{
+		{"all granted", []string{"create", "read", "update", "delete"}, nil},
+		{"root", []string{"root"}, nil},
+		{"read only", []string{"read", "list"}, []string{"create", "update"}},
+		{"deny", []string{"deny"}, []string{"read", "create", "update"}},
+		{"none", nil, []string{"read", "create", "update"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := missingCapabilities(tt.granted)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("missingCapabilities(%v) = %v, want %v", tt.granted, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestKVClient_MissingCapabilities(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/capabilities-self" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var body struct {
+			Path string `json:"path"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		gotPath = body.Path
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"capabilities": []string{"read", "update"},
+				body.Path:      []string{"read", "update"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	apiCfg := api.DefaultConfig()
+	apiCfg.Address = server.URL
+	apiClient, err := api.NewClient(apiCfg)
+	if err != nil {
+		t.Fatalf("creating api client: %v", err)
+	}
+	apiClient.SetToken("test-token")
+
+	kv := &KVClient{
+		client:  &Client{client: apiClient},
+		mount:   "secret",
+		version: KVVersion2,
+	}
+
+	missing, err := kv.MissingCapabilities(context.Background(), "myapp/config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotPath != "secret/data/myapp/config" {
+		t.Errorf("checked path = %q, want %q", gotPath, "secret/data/myapp/config")
+	}
+	if !reflect.DeepEqual(missing, []string{"create"}) {
+		t.Errorf("missing = %v, want [create]", missing)
+	}
+}
@@ -2,9 +2,22 @@ package vault
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/hashicorp/vault/api"
 
 	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
@@ -14,79 +27,179 @@ import (
 type Client struct {
 	client    *api.Client
 	namespace string
+
+	// Retry settings for KV reads and writes
+	maxAttempts int
+	retryDelay  time.Duration
+
+	// kvVersion is used by KV clients created with KVVersionAuto
+	// (KVVersionAuto keeps auto-detection)
+	kvVersion KVVersion
+
+	// maxConns caps the connections open to Vault at once, 0 for no cap
+	maxConns int
+
+	// renewer keeps a renewable login token alive, nil if there is none
+	renewer *api.LifetimeWatcher
 }
 
 // NewClient creates a new Vault client from the given configuration.
-func NewClient(cfg config.VaultConfig) (*Client, error) {
-	// Create Vault API config
-	vaultCfg := api.DefaultConfig()
+func NewClient(cfg config.VaultConfig, opts ...ClientOption) (*Client, error) {
+	address, err := resolveAddress(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
 
-	// Set address from config or environment
-	if cfg.Address != "" {
-		vaultCfg.Address = cfg.Address
+	// The config's connection limit comes first, so an explicit option wins
+	opts = append([]ClientOption{WithMaxConns(cfg.MaxConns)}, opts...)
+	c, err := newClient(address, cfg.Namespace, opts)
+	if err != nil {
+		return nil, err
 	}
-	// api.DefaultConfig() already reads VAULT_ADDR
 
-	// Create the client
-	client, err := api.NewClient(vaultCfg)
+	// Authenticate
+	login, err := c.authenticate(cfg.Auth)
 	if err != nil {
-		return nil, fmt.Errorf("creating vault client: %w", err)
+		return nil, fmt.Errorf("authenticating to vault: %w", err)
 	}
 
-	// Set namespace if specified
-	if cfg.Namespace != "" {
-		client.SetNamespace(cfg.Namespace)
+	if err := c.watchLogin(login); err != nil {
+		return nil, err
 	}
+	return c, nil
+}
 
-	// Authenticate
-	if err := authenticate(client, cfg.Auth); err != nil {
-		return nil, fmt.Errorf("authenticating to vault: %w", err)
+// watchLogin starts renewing the token of a login in the background, so it
+// outlives runs longer than its TTL. Tokens that aren't renewable, and
+// tokens given directly rather than by a login, are left alone. The
+// renewer runs until Close.
+func (c *Client) watchLogin(login *api.Secret) error {
+	if login == nil || login.Auth == nil || !login.Auth.Renewable {
+		return nil
 	}
 
-	return &Client{
-		client:    client,
-		namespace: cfg.Namespace,
-	}, nil
+	watcher, err := c.client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: login})
+	if err != nil {
+		return fmt.Errorf("starting token renewal: %w", err)
+	}
+	c.renewer = watcher
+	go watcher.Start()
+	return nil
+}
+
+// Close stops renewing the client's token. It is safe to call more than
+// once, and on clients that don't renew their token.
+func (c *Client) Close() {
+	if c.renewer != nil {
+		c.renewer.Stop()
+	}
+}
+
+// resolveAddress returns the Vault address from config, falling back to
+// VAULT_ADDR. Unlike api.DefaultConfig(), it never falls back to the
+// localhost default, which only produces confusing connection errors.
+func resolveAddress(addr string) (string, error) {
+	if addr != "" {
+		return addr, nil
+	}
+	if env := os.Getenv("VAULT_ADDR"); env != "" {
+		return env, nil
+	}
+	return "", fmt.Errorf("no Vault address configured (set VAULT_ADDR or vault.address)")
 }
 
-// authenticate sets up authentication based on the config.
-func authenticate(client *api.Client, auth config.AuthConfig) error {
+// authenticate sets up authentication based on the config. It returns the
+// login response of the methods that log in, and nil for token auth.
+func (c *Client) authenticate(auth config.AuthConfig) (*api.Secret, error) {
 	switch auth.Method {
 	case "token", "":
-		return authenticateToken(client, auth)
+		return authenticateToken(c.client, auth)
 	case "kubernetes":
-		return authenticateKubernetes(client, auth)
+		return c.authenticateKubernetes(auth)
 	case "approle":
-		return authenticateAppRole(client, auth)
+		return c.authenticateAppRole(auth)
+	case "aws":
+		return c.authenticateAWS(auth)
+	case "jwt":
+		return c.authenticateJWT(auth)
+	case "userpass", "ldap":
+		return c.authenticateUserpass(auth)
 	default:
-		return fmt.Errorf("unsupported auth method: %s", auth.Method)
+		return nil, fmt.Errorf("unsupported auth method: %s", auth.Method)
 	}
 }
 
 // authenticateToken sets up token authentication.
-func authenticateToken(client *api.Client, auth config.AuthConfig) error {
+func authenticateToken(client *api.Client, auth config.AuthConfig) (*api.Secret, error) {
 	token := auth.Token
 	if token == "" {
-		token = os.Getenv("VAULT_TOKEN")
+		var err error
+		if token, err = envToken(); err != nil {
+			return nil, err
+		}
 	}
 	if token == "" {
-		return fmt.Errorf("no token provided: set VAULT_TOKEN or specify in config")
+		return nil, fmt.Errorf("no token provided: set VAULT_TOKEN, VAULT_TOKEN_FILE or ~/.vault-token, or specify in config")
 	}
 
 	client.SetToken(token)
-	return nil
+	return nil, nil
+}
+
+// login writes data to the login endpoint at path, retrying like any other
+// request.
+func (c *Client) login(path string, data map[string]interface{}) (*api.Secret, error) {
+	var secret *api.Secret
+	err := c.withRetry(context.Background(), func() error {
+		var err error
+		secret, err = c.client.Logical().Write(path, data)
+		return err
+	})
+	return secret, err
+}
+
+// envToken returns the token from VAULT_TOKEN, or else from the file named
+// by VAULT_TOKEN_FILE, or else from ~/.vault-token, where the vault CLI
+// keeps it after a login. Surrounding whitespace is trimmed. It returns ""
+// if none is set; a missing ~/.vault-token is not an error.
+func envToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	if name := os.Getenv("VAULT_TOKEN_FILE"); name != "" {
+		// #nosec G304 -- Token file path is intentionally user-provided
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("reading VAULT_TOKEN_FILE: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading ~/.vault-token: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
 }
 
 // authenticateKubernetes performs Kubernetes service account authentication.
-func authenticateKubernetes(client *api.Client, auth config.AuthConfig) error {
+func (c *Client) authenticateKubernetes(auth config.AuthConfig) (*api.Secret, error) {
 	if auth.Role == "" {
-		return fmt.Errorf("kubernetes auth requires role")
+		return nil, fmt.Errorf("kubernetes auth requires role")
 	}
 
 	// Read the service account token
 	jwt, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/token")
 	if err != nil {
-		return fmt.Errorf("reading service account token: %w", err)
+		return nil, fmt.Errorf("reading service account token: %w", err)
 	}
 
 	mountPath := auth.MountPath
@@ -96,30 +209,30 @@ func authenticateKubernetes(client *api.Client, auth config.AuthConfig) error {
 
 	// Login
 	path := fmt.Sprintf("auth/%s/login", mountPath)
-	secret, err := client.Logical().Write(path, map[string]interface{}{
+	secret, err := c.login(path, map[string]interface{}{
 		"role": auth.Role,
 		"jwt":  string(jwt),
 	})
 	if err != nil {
-		return fmt.Errorf("kubernetes auth login: %w", err)
+		return nil, fmt.Errorf("kubernetes auth login: %w", err)
 	}
 
 	if secret == nil || secret.Auth == nil {
-		return fmt.Errorf("kubernetes auth: no auth info returned")
+		return nil, fmt.Errorf("kubernetes auth: no auth info returned")
 	}
 
-	client.SetToken(secret.Auth.ClientToken)
-	return nil
+	c.client.SetToken(secret.Auth.ClientToken)
+	return secret, nil
 }
 
 // authenticateAppRole performs AppRole authentication.
-func authenticateAppRole(client *api.Client, auth config.AuthConfig) error {
+func (c *Client) authenticateAppRole(auth config.AuthConfig) (*api.Secret, error) {
 	roleID := auth.RoleID
 	if roleID == "" {
 		roleID = os.Getenv("VAULT_ROLE_ID")
 	}
 	if roleID == "" {
-		return fmt.Errorf("approle auth requires role_id")
+		return nil, fmt.Errorf("approle auth requires role_id")
 	}
 
 	secretID := auth.SecretID
@@ -127,7 +240,7 @@ func authenticateAppRole(client *api.Client, auth config.AuthConfig) error {
 		secretID = os.Getenv("VAULT_SECRET_ID")
 	}
 	if secretID == "" {
-		return fmt.Errorf("approle auth requires secret_id")
+		return nil, fmt.Errorf("approle auth requires secret_id")
 	}
 
 	mountPath := auth.MountPath
@@ -137,20 +250,217 @@ func authenticateAppRole(client *api.Client, auth config.AuthConfig) error {
 
 	// Login
 	path := fmt.Sprintf("auth/%s/login", mountPath)
-	secret, err := client.Logical().Write(path, map[string]interface{}{
+	secret, err := c.login(path, map[string]interface{}{
 		"role_id":   roleID,
 		"secret_id": secretID,
 	})
 	if err != nil {
-		return fmt.Errorf("approle auth login: %w", err)
+		return nil, fmt.Errorf("approle auth login: %w", err)
 	}
 
 	if secret == nil || secret.Auth == nil {
-		return fmt.Errorf("approle auth: no auth info returned")
+		return nil, fmt.Errorf("approle auth: no auth info returned")
 	}
 
-	client.SetToken(secret.Auth.ClientToken)
-	return nil
+	c.client.SetToken(secret.Auth.ClientToken)
+	return secret, nil
+}
+
+// authenticateJWT performs JWT/OIDC authentication with a JWT from jwt,
+// the jwt_path file, or the jwt_env environment variable, in that order.
+func (c *Client) authenticateJWT(auth config.AuthConfig) (*api.Secret, error) {
+	if auth.Role == "" {
+		return nil, fmt.Errorf("jwt auth requires role")
+	}
+
+	jwt, err := readJWT(auth)
+	if err != nil {
+		return nil, err
+	}
+
+	mountPath := auth.MountPath
+	if mountPath == "" {
+		mountPath = "jwt"
+	}
+
+	// Login
+	path := fmt.Sprintf("auth/%s/login", mountPath)
+	secret, err := c.login(path, map[string]interface{}{
+		"role": auth.Role,
+		"jwt":  jwt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("jwt auth login: %w", err)
+	}
+
+	if secret == nil || secret.Auth == nil {
+		return nil, fmt.Errorf("jwt auth: no auth info returned")
+	}
+
+	c.client.SetToken(secret.Auth.ClientToken)
+	return secret, nil
+}
+
+// readJWT returns the JWT for jwt auth from the first of jwt, jwt_path
+// and jwt_env that is set.
+func readJWT(auth config.AuthConfig) (string, error) {
+	switch {
+	case auth.JWT != "":
+		return auth.JWT, nil
+	case auth.JWTPath != "":
+		data, err := os.ReadFile(auth.JWTPath)
+		if err != nil {
+			return "", fmt.Errorf("reading JWT: %w", err)
+		}
+		jwt := strings.TrimSpace(string(data))
+		if jwt == "" {
+			return "", fmt.Errorf("JWT file %s is empty", auth.JWTPath)
+		}
+		return jwt, nil
+	case auth.JWTEnv != "":
+		jwt := strings.TrimSpace(os.Getenv(auth.JWTEnv))
+		if jwt == "" {
+			return "", fmt.Errorf("environment variable %s holding the JWT is not set", auth.JWTEnv)
+		}
+		return jwt, nil
+	default:
+		return "", fmt.Errorf("jwt auth requires a JWT: set jwt, jwt_path, or jwt_env")
+	}
+}
+
+// authenticateUserpass performs username and password authentication for
+// the userpass and ldap auth methods, which share a login endpoint.
+func (c *Client) authenticateUserpass(auth config.AuthConfig) (*api.Secret, error) {
+	username := auth.Username
+	if username == "" {
+		username = os.Getenv("VAULT_USERNAME")
+	}
+	if username == "" {
+		return nil, fmt.Errorf("%s auth requires username", auth.Method)
+	}
+
+	password := auth.Password
+	if password == "" {
+		password = os.Getenv("VAULT_PASSWORD")
+	}
+	if password == "" {
+		return nil, fmt.Errorf("%s auth requires password", auth.Method)
+	}
+
+	// Login
+	path := fmt.Sprintf("auth/%s/login/%s", userpassMountPath(auth), url.PathEscape(username))
+	secret, err := c.login(path, map[string]interface{}{
+		"password": password,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s auth login: %w", auth.Method, err)
+	}
+
+	if secret == nil || secret.Auth == nil {
+		return nil, fmt.Errorf("%s auth: no auth info returned", auth.Method)
+	}
+
+	c.client.SetToken(secret.Auth.ClientToken)
+	return secret, nil
+}
+
+// userpassMountPath returns the mount path for userpass and ldap auth,
+// which defaults to the method name.
+func userpassMountPath(auth config.AuthConfig) string {
+	if auth.MountPath != "" {
+		return auth.MountPath
+	}
+	return auth.Method
+}
+
+// defaultAWSRegion is the STS region used by aws auth when none is configured.
+const defaultAWSRegion = "us-east-1"
+
+// authenticateAWS performs AWS IAM authentication: it signs an STS
+// GetCallerIdentity request with the ambient AWS credentials (environment,
+// shared config, or the EC2 instance profile) and hands it to Vault, which
+// sends it to STS to learn who is calling.
+func (c *Client) authenticateAWS(auth config.AuthConfig) (*api.Secret, error) {
+	if auth.Role == "" {
+		return nil, fmt.Errorf("aws auth requires role")
+	}
+
+	ctx := context.Background()
+	region := auth.Region
+	if region == "" {
+		region = defaultAWSRegion
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+	creds, err := awsCfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving AWS credentials: %w", err)
+	}
+
+	data, err := awsLoginData(ctx, creds, region, auth.HeaderValue, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	data["role"] = auth.Role
+
+	mountPath := auth.MountPath
+	if mountPath == "" {
+		mountPath = "aws"
+	}
+
+	// Login
+	path := fmt.Sprintf("auth/%s/login", mountPath)
+	secret, err := c.login(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("aws auth login: %w", err)
+	}
+
+	if secret == nil || secret.Auth == nil {
+		return nil, fmt.Errorf("aws auth: no auth info returned")
+	}
+
+	c.client.SetToken(secret.Auth.ClientToken)
+	return secret, nil
+}
+
+// awsLoginData signs an STS GetCallerIdentity request with creds and
+// returns it as the iam_* fields of an aws auth login. headerValue, if set,
+// is signed into the request as X-Vault-AWS-IAM-Server-ID.
+func awsLoginData(ctx context.Context, creds aws.Credentials, region, headerValue string, now time.Time) (map[string]interface{}, error) {
+	endpoint := "https://sts.amazonaws.com/"
+	if region != defaultAWSRegion {
+		endpoint = fmt.Sprintf("https://sts.%s.amazonaws.com/", region)
+	}
+	body := "Action=GetCallerIdentity&Version=2011-06-15"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("building STS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if headerValue != "" {
+		req.Header.Set("X-Vault-AWS-IAM-Server-ID", headerValue)
+	}
+
+	payloadHash := sha256.Sum256([]byte(body))
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadHash[:]), "sts", region, now); err != nil {
+		return nil, fmt.Errorf("signing STS request: %w", err)
+	}
+
+	headers, err := json.Marshal(req.Header)
+	if err != nil {
+		return nil, fmt.Errorf("encoding STS request headers: %w", err)
+	}
+
+	return map[string]interface{}{
+		"iam_http_request_method": req.Method,
+		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(endpoint)),
+		"iam_request_body":        base64.StdEncoding.EncodeToString([]byte(body)),
+		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+	}, nil
 }
 
 // Logical returns the underlying logical client for direct API access.
@@ -171,7 +481,12 @@ func (c *Client) Address() string {
 // CheckHealth verifies the client can connect to Vault.
 func (c *Client) CheckHealth(ctx context.Context) error {
 	// Use sys/health which doesn't require auth
-	resp, err := c.client.Sys().Health()
+	var resp *api.HealthResponse
+	err := c.withRetry(ctx, func() error {
+		var err error
+		resp, err = c.client.Sys().HealthWithContext(ctx)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("health check failed: %w", err)
 	}
@@ -188,12 +503,58 @@ func (c *Client) CheckHealth(ctx context.Context) error {
 }
 
 // NewClientFromEnv creates a new Vault client using environment variables.
-// Uses VAULT_ADDR for address and VAULT_TOKEN for authentication.
-func NewClientFromEnv(addr, namespace string) (*Client, error) {
+// Uses VAULT_ADDR for address and VAULT_TOKEN for authentication, falling
+// back to VAULT_TOKEN_FILE and ~/.vault-token. A non-empty token takes
+// precedence over all of them.
+func NewClientFromEnv(addr, namespace, token string, opts ...ClientOption) (*Client, error) {
+	address, err := resolveAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newClient(address, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get token from environment unless provided
+	if token == "" {
+		if token, err = envToken(); err != nil {
+			return nil, err
+		}
+	}
+	if token == "" {
+		return nil, fmt.Errorf("VAULT_TOKEN environment variable is required (or a token in VAULT_TOKEN_FILE or ~/.vault-token)")
+	}
+	c.client.SetToken(token)
+
+	return c, nil
+}
+
+// newClient creates an API client for address, applying the default retry
+// and connection settings and opts. The connection settings go into the
+// HTTP transport before the API client is created, so nothing is changed
+// under a client in use.
+func newClient(address, namespace string, opts []ClientOption) (*Client, error) {
+	c := &Client{
+		namespace:   namespace,
+		maxAttempts: DefaultMaxAttempts,
+		retryDelay:  DefaultRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
 	// Create Vault API config
 	vaultCfg := api.DefaultConfig()
-	if addr != "" {
-		vaultCfg.Address = addr
+	vaultCfg.Address = address
+	vaultCfg.MaxRetries = 0 // Every request is retried by withRetry instead
+	if t, ok := vaultCfg.HttpClient.Transport.(*http.Transport); ok {
+		t.MaxIdleConnsPerHost = DefaultMaxIdleConns
+		if c.maxConns > 0 {
+			t.MaxConnsPerHost = c.maxConns
+			t.MaxIdleConnsPerHost = c.maxConns
+		}
 	}
 
 	// Create the client
@@ -207,15 +568,33 @@ func NewClientFromEnv(addr, namespace string) (*Client, error) {
 		client.SetNamespace(namespace)
 	}
 
-	// Get token from environment
-	token := os.Getenv("VAULT_TOKEN")
-	if token == "" {
-		return nil, fmt.Errorf("VAULT_TOKEN environment variable is required")
+	c.client = client
+	return c, nil
+}
+
+// DefaultMaxIdleConns is how many idle connections to Vault are kept for
+// reuse without a connection limit. The HTTP client's own default of one
+// per CPU makes parallel block processing reconnect for most requests.
+const DefaultMaxIdleConns = 32
+
+// WithMaxConns caps the connections open to Vault at once at n, and keeps
+// up to n idle for reuse. n of 0 or less keeps the defaults: no cap, and
+// DefaultMaxIdleConns idle connections.
+func WithMaxConns(n int) ClientOption {
+	return func(c *Client) {
+		if n > 0 {
+			c.maxConns = n
+		}
 	}
-	client.SetToken(token)
+}
 
-	return &Client{
-		client:    client,
-		namespace: namespace,
-	}, nil
+// transport returns the HTTP transport of the client, or nil if it uses a
+// custom round tripper.
+func (c *Client) transport() *http.Transport {
+	httpClient := c.client.CloneConfig().HttpClient
+	if httpClient == nil {
+		return nil
+	}
+	t, _ := httpClient.Transport.(*http.Transport)
+	return t
 }
@@ -1,8 +1,18 @@
 package vault
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
 
 	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
 )
@@ -38,6 +48,8 @@ func TestNewClient_MissingToken(t *testing.T) {
 			os.Setenv("VAULT_TOKEN", originalToken)
 		}
 	}()
+	t.Setenv("VAULT_TOKEN_FILE", "")
+	t.Setenv("HOME", t.TempDir())
 
 	cfg := config.VaultConfig{
 		Address: "http://localhost:8200",
@@ -123,3 +135,450 @@ func TestNewClient_WithNamespace(t *testing.T) {
 		t.Errorf("expected namespace admin, got %s", client.namespace)
 	}
 }
+
+func TestNewClient_MissingAddress(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	cfg := config.VaultConfig{
+		Auth: config.AuthConfig{
+			Method: "token",
+		},
+	}
+
+	_, err := NewClient(cfg)
+	if err == nil {
+		t.Fatal("expected error for missing address")
+	}
+	if !strings.Contains(err.Error(), "no Vault address configured") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = NewClientFromEnv("", "", "")
+	if err == nil {
+		t.Fatal("expected error for missing address from env client")
+	}
+}
+
+func TestNewClient_AddressFromEnv(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "http://vault.example.com:8200")
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	client, err := NewClient(config.VaultConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if client.Address() != "http://vault.example.com:8200" {
+		t.Errorf("expected address from VAULT_ADDR, got %s", client.Address())
+	}
+}
+
+func TestNewClient_TokenPrecedence(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "http://localhost:8200")
+	t.Setenv("VAULT_TOKEN", "env-token")
+
+	// Token from config (or --vault-token) wins over VAULT_TOKEN
+	client, err := NewClient(config.VaultConfig{
+		Auth: config.AuthConfig{Method: "token", Token: "flag-token"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.Token() != "flag-token" {
+		t.Errorf("expected flag-token, got %s", client.Token())
+	}
+
+	// VAULT_TOKEN is used when no token is given
+	client, err = NewClient(config.VaultConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.Token() != "env-token" {
+		t.Errorf("expected env-token, got %s", client.Token())
+	}
+
+	client, err = NewClientFromEnv("", "", "flag-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.Token() != "flag-token" {
+		t.Errorf("expected flag-token from env client, got %s", client.Token())
+	}
+}
+
+func TestNewClient_TokenFile(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "http://localhost:8200")
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_TOKEN_FILE", "")
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// No token anywhere
+	_, err := NewClient(config.VaultConfig{})
+	if err == nil || !strings.Contains(err.Error(), "~/.vault-token") {
+		t.Fatalf("expected an error naming the token file fallbacks, got: %v", err)
+	}
+	if _, err := NewClientFromEnv("", "", ""); err == nil || !strings.Contains(err.Error(), "~/.vault-token") {
+		t.Fatalf("expected an error naming the token file fallbacks, got: %v", err)
+	}
+
+	// ~/.vault-token, as the vault CLI writes it after a login
+	if err := os.WriteFile(filepath.Join(home, ".vault-token"), []byte("home-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(config.VaultConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.Token() != "home-token" {
+		t.Errorf("expected home-token, got %q", client.Token())
+	}
+
+	// VAULT_TOKEN_FILE wins over ~/.vault-token
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("  file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VAULT_TOKEN_FILE", tokenFile)
+	client, err = NewClientFromEnv("", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.Token() != "file-token" {
+		t.Errorf("expected file-token, got %q", client.Token())
+	}
+
+	// VAULT_TOKEN wins over both
+	t.Setenv("VAULT_TOKEN", "env-token")
+	client, err = NewClient(config.VaultConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.Token() != "env-token" {
+		t.Errorf("expected env-token, got %q", client.Token())
+	}
+
+	// A VAULT_TOKEN_FILE that can't be read is an error, not a fallback
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_TOKEN_FILE", filepath.Join(home, "missing"))
+	if _, err := NewClient(config.VaultConfig{}); err == nil || !strings.Contains(err.Error(), "VAULT_TOKEN_FILE") {
+		t.Errorf("expected an error reading VAULT_TOKEN_FILE, got: %v", err)
+	}
+}
+
+func TestNewClient_MaxConns(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "http://localhost:8200")
+
+	client, err := NewClientFromEnv("", "", "test-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := client.transport(); got.MaxConnsPerHost != 0 || got.MaxIdleConnsPerHost != DefaultMaxIdleConns {
+		t.Errorf("default transport: MaxConnsPerHost = %d, MaxIdleConnsPerHost = %d", got.MaxConnsPerHost, got.MaxIdleConnsPerHost)
+	}
+
+	client, err = NewClientFromEnv("", "", "test-token", WithMaxConns(8))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := client.transport(); got.MaxConnsPerHost != 8 || got.MaxIdleConnsPerHost != 8 {
+		t.Errorf("WithMaxConns(8): MaxConnsPerHost = %d, MaxIdleConnsPerHost = %d", got.MaxConnsPerHost, got.MaxIdleConnsPerHost)
+	}
+
+	// The config's max_conns applies to NewClient
+	client, err = NewClient(config.VaultConfig{
+		Auth:     config.AuthConfig{Method: "token", Token: "test-token"},
+		MaxConns: 16,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := client.transport(); got.MaxConnsPerHost != 16 || got.MaxIdleConnsPerHost != 16 {
+		t.Errorf("max_conns = 16: MaxConnsPerHost = %d, MaxIdleConnsPerHost = %d", got.MaxConnsPerHost, got.MaxIdleConnsPerHost)
+	}
+}
+
+func TestNewClient_AWSAuthRequiresRole(t *testing.T) {
+	cfg := config.VaultConfig{
+		Address: "http://localhost:8200",
+		Auth: config.AuthConfig{
+			Method: "aws",
+		},
+	}
+
+	_, err := NewClient(cfg)
+	if err == nil || !strings.Contains(err.Error(), "aws auth requires role") {
+		t.Errorf("expected missing role error, got %v", err)
+	}
+}
+
+func TestNewClient_AWSAuthNoCredentials(t *testing.T) {
+	// No credentials anywhere: environment, shared files, or instance metadata
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+
+	cfg := config.VaultConfig{
+		Address: "http://localhost:8200",
+		Auth: config.AuthConfig{
+			Method: "aws",
+			Role:   "vsg",
+		},
+	}
+
+	_, err := NewClient(cfg)
+	if err == nil || !strings.Contains(err.Error(), "retrieving AWS credentials") {
+		t.Errorf("expected a credentials error, got %v", err)
+	}
+}
+
+func TestAWSLoginData(t *testing.T) {
+	creds := aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		region      string
+		headerValue string
+		url         string
+	}{
+		{"us-east-1", "", "https://sts.amazonaws.com/"},
+		{"eu-west-1", "vault.example.com", "https://sts.eu-west-1.amazonaws.com/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.region, func(t *testing.T) {
+			data, err := awsLoginData(context.Background(), creds, tt.region, tt.headerValue, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			decode := func(field string) string {
+				raw, err := base64.StdEncoding.DecodeString(data[field].(string))
+				if err != nil {
+					t.Fatalf("%s is not base64: %v", field, err)
+				}
+				return string(raw)
+			}
+
+			if data["iam_http_request_method"] != "POST" {
+				t.Errorf("method = %v, want POST", data["iam_http_request_method"])
+			}
+			if got := decode("iam_request_url"); got != tt.url {
+				t.Errorf("url = %s, want %s", got, tt.url)
+			}
+			if got := decode("iam_request_body"); got != "Action=GetCallerIdentity&Version=2011-06-15" {
+				t.Errorf("unexpected body %s", got)
+			}
+
+			var headers http.Header
+			if err := json.Unmarshal([]byte(decode("iam_request_headers")), &headers); err != nil {
+				t.Fatalf("headers are not JSON: %v", err)
+			}
+			auth := headers.Get("Authorization")
+			if !strings.Contains(auth, "Credential=AKIDEXAMPLE/20240102/"+tt.region+"/sts/aws4_request") {
+				t.Errorf("unexpected Authorization header %q", auth)
+			}
+			if got := headers.Get("X-Vault-AWS-IAM-Server-ID"); got != tt.headerValue {
+				t.Errorf("server ID header = %q, want %q", got, tt.headerValue)
+			}
+			if tt.headerValue != "" && !strings.Contains(auth, "x-vault-aws-iam-server-id") {
+				t.Errorf("expected the server ID header to be signed, got %q", auth)
+			}
+		})
+	}
+}
+
+func TestNewClient_JWTAuthErrors(t *testing.T) {
+	emptyFile := filepath.Join(t.TempDir(), "empty.jwt")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VSG_TEST_EMPTY_JWT", "")
+
+	tests := []struct {
+		name    string
+		auth    config.AuthConfig
+		wantErr string
+	}{
+		{"missing role", config.AuthConfig{Method: "jwt", JWT: "eyJ"}, "jwt auth requires role"},
+		{"missing jwt", config.AuthConfig{Method: "jwt", Role: "ci"}, "jwt auth requires a JWT"},
+		{"missing file", config.AuthConfig{Method: "jwt", Role: "ci", JWTPath: filepath.Join(t.TempDir(), "none")}, "reading JWT"},
+		{"empty file", config.AuthConfig{Method: "jwt", Role: "ci", JWTPath: emptyFile}, "is empty"},
+		{"empty env", config.AuthConfig{Method: "jwt", Role: "ci", JWTEnv: "VSG_TEST_EMPTY_JWT"}, "VSG_TEST_EMPTY_JWT holding the JWT is not set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(config.VaultConfig{Address: "http://localhost:8200", Auth: tt.auth})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewClient_JWTAuthLogin(t *testing.T) {
+	var path string
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"hvs.from-jwt"}}`))
+	}))
+	defer server.Close()
+
+	jwtFile := filepath.Join(t.TempDir(), "token.jwt")
+	if err := os.WriteFile(jwtFile, []byte("eyJ.file.jwt\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(config.VaultConfig{
+		Address: server.URL,
+		Auth:    config.AuthConfig{Method: "jwt", Role: "ci", JWTPath: jwtFile, MountPath: "gitlab"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if path != "/v1/auth/gitlab/login" {
+		t.Errorf("login path = %s, want /v1/auth/gitlab/login", path)
+	}
+	if body["role"] != "ci" || body["jwt"] != "eyJ.file.jwt" {
+		t.Errorf("unexpected login body %v", body)
+	}
+	if client.Token() != "hvs.from-jwt" {
+		t.Errorf("token = %q, want hvs.from-jwt", client.Token())
+	}
+}
+
+func TestNewClient_UserpassAuthErrors(t *testing.T) {
+	t.Setenv("VAULT_USERNAME", "")
+	t.Setenv("VAULT_PASSWORD", "")
+
+	tests := []struct {
+		name    string
+		auth    config.AuthConfig
+		wantErr string
+	}{
+		{"userpass missing username", config.AuthConfig{Method: "userpass", Password: "pw"}, "userpass auth requires username"},
+		{"userpass missing password", config.AuthConfig{Method: "userpass", Username: "alice"}, "userpass auth requires password"},
+		{"ldap missing username", config.AuthConfig{Method: "ldap", Password: "pw"}, "ldap auth requires username"},
+		{"ldap missing password", config.AuthConfig{Method: "ldap", Username: "alice"}, "ldap auth requires password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(config.VaultConfig{Address: "http://localhost:8200", Auth: tt.auth})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewClient_UserpassAuthLogin(t *testing.T) {
+	var path, password string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		var body struct {
+			Password string `json:"password"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		password = body.Password
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"hvs.from-login"}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_USERNAME", "env-user")
+	t.Setenv("VAULT_PASSWORD", "env-password")
+
+	tests := []struct {
+		name     string
+		auth     config.AuthConfig
+		path     string
+		password string
+	}{
+		{"userpass default mount", config.AuthConfig{Method: "userpass", Username: "alice", Password: "pw"}, "/v1/auth/userpass/login/alice", "pw"},
+		{"ldap default mount", config.AuthConfig{Method: "ldap", Username: "alice", Password: "pw"}, "/v1/auth/ldap/login/alice", "pw"},
+		{"custom mount", config.AuthConfig{Method: "ldap", Username: "alice", Password: "pw", MountPath: "corp-ldap"}, "/v1/auth/corp-ldap/login/alice", "pw"},
+		{"env fallback", config.AuthConfig{Method: "userpass"}, "/v1/auth/userpass/login/env-user", "env-password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(config.VaultConfig{Address: server.URL, Auth: tt.auth})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if path != tt.path {
+				t.Errorf("login path = %s, want %s", path, tt.path)
+			}
+			if password != tt.password {
+				t.Errorf("password = %q, want %q", password, tt.password)
+			}
+			if client.Token() != "hvs.from-login" {
+				t.Errorf("token = %q, want hvs.from-login", client.Token())
+			}
+		})
+	}
+}
+
+func TestNewClient_TokenRenewal(t *testing.T) {
+	tests := []struct {
+		name      string
+		renewable bool
+	}{
+		{"non-renewable token", false},
+		{"renewable token", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"auth": map[string]interface{}{
+						"client_token":   "hvs.from-login",
+						"renewable":      tt.renewable,
+						"lease_duration": 3600,
+					},
+				})
+			}))
+			defer server.Close()
+
+			client, err := NewClient(config.VaultConfig{
+				Address: server.URL,
+				Auth:    config.AuthConfig{Method: "userpass", Username: "alice", Password: "pw"},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if started := client.renewer != nil; started != tt.renewable {
+				t.Errorf("renewer started = %t, want %t", started, tt.renewable)
+			}
+
+			// Close is safe to call repeatedly
+			client.Close()
+			client.Close()
+		})
+	}
+
+	// Tokens given directly have no login to renew
+	client, err := NewClientFromEnv("http://127.0.0.1:8200", "", "test-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.renewer != nil {
+		t.Error("expected no renewer for a token given directly")
+	}
+	client.Close()
+}
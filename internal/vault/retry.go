@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Default retry settings for Vault reads and writes.
+const (
+	DefaultMaxAttempts = 3
+	DefaultRetryDelay  = 200 * time.Millisecond
+)
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithRetry sets how many times a KV read or write is attempted and the base
+// delay between attempts. The delay doubles after each attempt, with jitter.
+// maxAttempts below 1 disables retries.
+func WithRetry(maxAttempts int, baseDelay time.Duration) ClientOption {
+	return func(c *Client) {
+		c.maxAttempts = maxAttempts
+		c.retryDelay = baseDelay
+	}
+}
+
+// withRetry runs op until it succeeds, fails with a non-retriable error, or
+// the attempts are exhausted. It stops early when ctx is canceled.
+func (c *Client) withRetry(ctx context.Context, op func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = op(); err == nil || attempt >= c.maxAttempts || !isRetriable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff(c.retryDelay, attempt)):
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt: base doubled for each
+// previous attempt, randomized to between 50% and 150% to spread out clients.
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	delay := base << (attempt - 1)
+	return delay/2 + rand.N(delay) // #nosec G404 -- Jitter does not need a CSPRNG
+}
+
+// isRetriable reports whether err is a transient failure worth retrying:
+// rate limiting, server errors, timeouts, and dropped connections.
+// Client errors such as 403 and 404 are never retried.
+func isRetriable(err error) bool {
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode == http.StatusTooManyRequests || respErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
@@ -0,0 +1,215 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
+)
+
+// newTestKVClient returns a KV v2 client talking to handler.
+func newTestKVClient(t *testing.T, handler http.Handler, opts ...ClientOption) *KVClient {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := NewClientFromEnv(server.URL, "", "test-token", opts...)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	kv, err := NewKVClient(client, "secret", KVVersion2)
+	if err != nil {
+		t.Fatalf("creating KV client: %v", err)
+	}
+	return kv
+}
+
+func TestKVClient_ReadRetriesTransientErrors(t *testing.T) {
+	var calls atomic.Int32
+	kv := newTestKVClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"errors":["vault is busy"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"password":"s3cret"}}}`))
+	}), WithRetry(3, time.Millisecond))
+
+	data, err := kv.Read(context.Background(), "myapp")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data["password"] != "s3cret" {
+		t.Errorf("unexpected data: %v", data)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestKVClient_WriteGivesUpAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	kv := newTestKVClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}), WithRetry(2, time.Millisecond))
+
+	err := kv.Write(context.Background(), "myapp", map[string]interface{}{"k": "v"})
+	if err == nil {
+		t.Fatal("expected error after exhausting attempts")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls.Load())
+	}
+}
+
+func TestKVClient_NoRetryOnForbidden(t *testing.T) {
+	var calls atomic.Int32
+	kv := newTestKVClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+	}), WithRetry(5, time.Millisecond))
+
+	if _, err := kv.Read(context.Background(), "myapp"); err == nil {
+		t.Fatal("expected permission error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected a single attempt for 403, got %d", calls.Load())
+	}
+}
+
+func TestKVClient_RetryStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls atomic.Int32
+	kv := newTestKVClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		cancel()
+		w.WriteHeader(http.StatusBadGateway)
+	}), WithRetry(5, time.Hour))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := kv.Read(ctx, "myapp")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry did not stop after context cancellation")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 attempt before cancellation, got %d", calls.Load())
+	}
+}
+
+func TestClient_RetriesEveryRequest(t *testing.T) {
+	// Each path fails once with a 503 before it succeeds
+	var mu sync.Mutex
+	failed := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		first := !failed[r.Method+r.URL.Path]
+		failed[r.Method+r.URL.Path] = true
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"login-token"}}`))
+		case "/v1/auth/token/lookup-self":
+			_, _ = w.Write([]byte(`{"data":{"display_name":"approle"}}`))
+		case "/v1/sys/health":
+			_, _ = w.Write([]byte(`{"initialized":true,"sealed":false}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(config.VaultConfig{
+		Address: server.URL,
+		Auth:    config.AuthConfig{Method: "approle", RoleID: "role", SecretID: "secret"},
+	}, WithRetry(2, time.Millisecond))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := client.CheckHealth(ctx); err != nil {
+		t.Errorf("health: %v", err)
+	}
+	if info, err := client.LookupSelf(ctx); err != nil || info.DisplayName != "approle" {
+		t.Errorf("lookup-self: %+v, %v", info, err)
+	}
+	kv, err := NewKVClient(client, "secret", KVVersion2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Delete(ctx, "myapp"); err != nil {
+		t.Errorf("delete: %v", err)
+	}
+	if err := kv.Destroy(ctx, "myapp"); err != nil {
+		t.Errorf("destroy: %v", err)
+	}
+}
+
+func TestIsRetriable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"500", &api.ResponseError{StatusCode: 500}, true},
+		{"503", &api.ResponseError{StatusCode: 503}, true},
+		{"429", &api.ResponseError{StatusCode: 429}, true},
+		{"403", &api.ResponseError{StatusCode: 403}, false},
+		{"404", &api.ResponseError{StatusCode: 404}, false},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"canceled", context.Canceled, false},
+		{"other", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetriable(tt.err); got != tt.expected {
+				t.Errorf("isRetriable(%v) = %v, want %v", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+	for attempt := 1; attempt <= 4; attempt++ {
+		delay := base << (attempt - 1)
+		for i := 0; i < 20; i++ {
+			got := backoff(base, attempt)
+			if got < delay/2 || got >= delay/2+delay {
+				t.Errorf("backoff(%v, %d) = %v, want in [%v, %v)", base, attempt, got, delay/2, delay/2+delay)
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// TokenInfo identifies who the client token belongs to.
+type TokenInfo struct {
+	DisplayName string   `json:"display_name"`
+	EntityID    string   `json:"entity_id,omitempty"`
+	Accessor    string   `json:"accessor,omitempty"`
+	Policies    []string `json:"policies,omitempty"`
+}
+
+// LookupSelf returns the identity of the client token, using
+// auth/token/lookup-self. The token ID itself is never included.
+func (c *Client) LookupSelf(ctx context.Context) (*TokenInfo, error) {
+	var secret *api.Secret
+	err := c.withRetry(ctx, func() error {
+		var err error
+		secret, err = c.client.Auth().Token().LookupSelfWithContext(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("looking up token: %w", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("looking up token: empty response")
+	}
+
+	info := &TokenInfo{}
+	info.DisplayName, _ = secret.Data["display_name"].(string)
+	info.EntityID, _ = secret.Data["entity_id"].(string)
+	info.Accessor, _ = secret.Data["accessor"].(string)
+	if policies, err := secret.TokenPolicies(); err == nil {
+		info.Policies = policies
+	}
+	return info, nil
+}
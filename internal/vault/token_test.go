@@ -0,0 +1,65 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestClient_LookupSelf(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/lookup-self" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"id":           "test-token",
+				"accessor":     "acc-123",
+				"display_name": "oidc-jane@example.com",
+				"entity_id":    "7d2e3179-f69b-450c-7179-ac8ee8bd8ca9",
+				"policies":     []string{"default", "vsg-writer"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	apiCfg := api.DefaultConfig()
+	apiCfg.Address = server.URL
+	apiClient, err := api.NewClient(apiCfg)
+	if err != nil {
+		t.Fatalf("creating api client: %v", err)
+	}
+	apiClient.SetToken("test-token")
+	client := &Client{client: apiClient}
+
+	info, err := client.LookupSelf(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &TokenInfo{
+		DisplayName: "oidc-jane@example.com",
+		EntityID:    "7d2e3179-f69b-450c-7179-ac8ee8bd8ca9",
+		Accessor:    "acc-123",
+		Policies:    []string{"default", "vsg-writer"},
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("LookupSelf() = %+v, want %+v", info, expected)
+	}
+
+	apiClient.SetToken("other-token")
+	if _, err := client.LookupSelf(context.Background()); err == nil {
+		t.Error("expected an error for a denied lookup")
+	}
+}
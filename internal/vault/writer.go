@@ -1,9 +1,17 @@
 package vault
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
 )
 
 // KVVersion represents the KV secrets engine version.
@@ -23,12 +31,26 @@ type KVClient struct {
 	version KVVersion
 }
 
+// WithKVVersion forces the KV version for every KV client that doesn't specify
+// one, skipping auto-detection. Detection reads sys/mounts, which tightly
+// scoped tokens usually can't do.
+func WithKVVersion(version KVVersion) ClientOption {
+	return func(c *Client) {
+		c.kvVersion = version
+	}
+}
+
 // NewKVClient creates a new KV client for the given mount path.
-// If version is KVVersionAuto (0), it will be auto-detected.
+// If version is KVVersionAuto (0), the client's WithKVVersion setting is used,
+// and if that is unset too the version is auto-detected.
 func NewKVClient(client *Client, mount string, version KVVersion) (*KVClient, error) {
 	// Clean up mount path
 	mount = strings.Trim(mount, "/")
 
+	if version == KVVersionAuto {
+		version = client.kvVersion
+	}
+
 	kv := &KVClient{
 		client:  client,
 		mount:   mount,
@@ -50,7 +72,12 @@ func NewKVClient(client *Client, mount string, version KVVersion) (*KVClient, er
 // detectVersion determines the KV engine version by checking mount info.
 func (kv *KVClient) detectVersion() (KVVersion, error) {
 	// Try to read mount configuration
-	mounts, err := kv.client.client.Sys().ListMounts()
+	var mounts map[string]*api.MountOutput
+	err := kv.client.withRetry(context.Background(), func() error {
+		var err error
+		mounts, err = kv.client.client.Sys().ListMounts()
+		return err
+	})
 	if err != nil {
 		// Fall back to trying v2 first, then v1
 		return kv.detectVersionByProbing()
@@ -86,7 +113,12 @@ func (kv *KVClient) detectVersion() (KVVersion, error) {
 func (kv *KVClient) detectVersionByProbing() (KVVersion, error) {
 	// Try reading from v2 metadata path
 	path := fmt.Sprintf("%s/config", kv.mount)
-	secret, err := kv.client.Logical().Read(path)
+	var secret *api.Secret
+	err := kv.client.withRetry(context.Background(), func() error {
+		var err error
+		secret, err = kv.client.Logical().Read(path)
+		return err
+	})
 	if err == nil && secret != nil {
 		// v2 has a config endpoint
 		return KVVersion2, nil
@@ -96,28 +128,174 @@ func (kv *KVClient) detectVersionByProbing() (KVVersion, error) {
 	return KVVersion1, nil
 }
 
+// DefaultMaxVersions is the number of versions KV v2 keeps per secret when
+// the mount's max_versions is unset.
+const DefaultMaxVersions = 10
+
+// MaxVersions returns the number of versions the mount keeps per secret
+// (KV v2 only), read from the same mount config endpoint the version probe
+// uses. It is DefaultMaxVersions when the mount doesn't set max_versions.
+func (kv *KVClient) MaxVersions(ctx context.Context) (int, error) {
+	if kv.version != KVVersion2 {
+		return 0, fmt.Errorf("max_versions requires KV version 2")
+	}
+
+	path := fmt.Sprintf("%s/config", kv.mount)
+
+	var secret *api.Secret
+	err := kv.client.withRetry(ctx, func() error {
+		var err error
+		secret, err = kv.client.Logical().ReadWithContext(ctx, path)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("reading mount config of %s: %w", kv.mount, err)
+	}
+	if secret == nil {
+		return DefaultMaxVersions, nil
+	}
+
+	maxVersions := 0
+	switch v := secret.Data["max_versions"].(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("parsing max_versions of %s: %w", kv.mount, err)
+		}
+		maxVersions = int(n)
+	case float64:
+		maxVersions = int(v)
+	}
+	if maxVersions <= 0 {
+		return DefaultMaxVersions, nil
+	}
+	return maxVersions, nil
+}
+
+// ErrCASMismatch is returned by WriteCAS when the secret was written by
+// someone else after it was read.
+var ErrCASMismatch = errors.New("secret changed since it was read")
+
 // Read retrieves a secret from the KV store.
 func (kv *KVClient) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	data, _, err := kv.ReadVersion(ctx, path)
+	return data, err
+}
+
+// ReadVersion retrieves a secret and its current version. The version is 0
+// for KV v1 and for secrets that have never been written; it is the value
+// WriteCAS expects to find.
+func (kv *KVClient) ReadVersion(ctx context.Context, path string) (map[string]interface{}, int, error) {
 	fullPath := kv.buildReadPath(path)
 
-	secret, err := kv.client.Logical().Read(fullPath)
+	var secret *api.Secret
+	err := kv.client.withRetry(ctx, func() error {
+		var err error
+		secret, err = kv.client.Logical().ReadWithContext(ctx, fullPath)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("reading secret at %s: %w", path, err)
+		return nil, 0, fmt.Errorf("reading secret at %s: %w", path, err)
 	}
 
 	if secret == nil {
-		return nil, nil // Secret doesn't exist
+		return nil, 0, nil // Secret doesn't exist
 	}
 
-	// For v2, extract data from the nested structure
+	// For v2, extract data from the nested structure. A soft-deleted latest
+	// version has metadata but no data, and still counts for CAS.
 	if kv.version == KVVersion2 {
+		version := secretVersion(secret)
 		if data, ok := secret.Data["data"].(map[string]interface{}); ok {
-			return data, nil
+			return data, version, nil
 		}
+		return nil, version, nil
+	}
+
+	return secret.Data, 0, nil
+}
+
+// ReadAtVersion retrieves the given version of a KV v2 secret instead of the
+// latest one. It returns nil if the version doesn't exist or was deleted or
+// destroyed. KV v1 secrets have no versions, so it's an error there.
+func (kv *KVClient) ReadAtVersion(ctx context.Context, path string, version int) (map[string]interface{}, error) {
+	if kv.version != KVVersion2 {
+		return nil, fmt.Errorf("reading version %d of %s: mount %s is KV v1, which has no versions", version, path, kv.mount)
+	}
+	if version <= 0 {
+		return nil, fmt.Errorf("reading version %d of %s: version must be positive", version, path)
+	}
+
+	fullPath := kv.buildReadPath(path)
+	query := map[string][]string{"version": {strconv.Itoa(version)}}
+
+	var secret *api.Secret
+	err := kv.client.withRetry(ctx, func() error {
+		var err error
+		secret, err = kv.client.Logical().ReadWithDataWithContext(ctx, fullPath, query)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading version %d of secret at %s: %w", version, path, err)
+	}
+	if secret == nil {
 		return nil, nil
 	}
 
-	return secret.Data, nil
+	data, _ := secret.Data["data"].(map[string]interface{})
+	return data, nil
+}
+
+// secretVersion extracts the version number from a KV v2 read response.
+func secretVersion(secret *api.Secret) int {
+	metadata, ok := secret.Data["metadata"].(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	switch v := metadata["version"].(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return 0
+		}
+		return int(n)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// List returns the keys directly under path, as Vault's LIST endpoint
+// reports them: secrets by name, and subpaths with a trailing slash. It
+// returns nil if nothing exists under path.
+func (kv *KVClient) List(ctx context.Context, path string) ([]string, error) {
+	fullPath := kv.buildListPath(path)
+
+	var secret *api.Secret
+	err := kv.client.withRetry(ctx, func() error {
+		var err error
+		secret, err = kv.client.Logical().ListWithContext(ctx, fullPath)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing secrets at %s: %w", path, err)
+	}
+	if secret == nil {
+		return nil, nil
+	}
+
+	raw, ok := secret.Data["keys"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(raw))
+	for _, k := range raw {
+		if s, ok := k.(string); ok {
+			keys = append(keys, s)
+		}
+	}
+	return keys, nil
 }
 
 // Write stores a secret in the KV store.
@@ -133,7 +311,10 @@ func (kv *KVClient) Write(ctx context.Context, path string, data map[string]inte
 		writeData = data
 	}
 
-	_, err := kv.client.Logical().Write(fullPath, writeData)
+	err := kv.client.withRetry(ctx, func() error {
+		_, err := kv.client.Logical().WriteWithContext(ctx, fullPath, writeData)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("writing secret at %s: %w", path, err)
 	}
@@ -141,11 +322,160 @@ func (kv *KVClient) Write(ctx context.Context, path string, data map[string]inte
 	return nil
 }
 
+// WriteCAS stores a secret only if its current version is still cas, as
+// returned by ReadVersion (0 requires that the secret doesn't exist yet).
+// It returns an error wrapping ErrCASMismatch if another writer got there
+// first. KV v1 has no versions, so this is a plain Write.
+func (kv *KVClient) WriteCAS(ctx context.Context, path string, data map[string]interface{}, cas int) error {
+	if kv.version != KVVersion2 {
+		return kv.Write(ctx, path, data)
+	}
+
+	writeData := map[string]interface{}{
+		"data":    data,
+		"options": map[string]interface{}{"cas": cas},
+	}
+
+	fullPath := kv.buildWritePath(path)
+	attempts := 0
+	err := kv.client.withRetry(ctx, func() error {
+		attempts++
+		_, err := kv.client.Logical().WriteWithContext(ctx, fullPath, writeData)
+		return err
+	})
+	if err != nil {
+		if isCASMismatch(err) {
+			// A retried write may have landed before its response was lost,
+			// so the retry finds its own write: not a conflict
+			if attempts > 1 && kv.wroteVersion(ctx, path, data, cas+1) {
+				return nil
+			}
+			return fmt.Errorf("writing secret at %s: %w (expected version %d)", path, ErrCASMismatch, cas)
+		}
+		return fmt.Errorf("writing secret at %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// wroteVersion reports whether the secret's current version is version and
+// holds exactly data.
+func (kv *KVClient) wroteVersion(ctx context.Context, path string, data map[string]interface{}, version int) bool {
+	current, currentVersion, err := kv.ReadVersion(ctx, path)
+	if err != nil || currentVersion != version {
+		return false
+	}
+	want, err := json.Marshal(data)
+	if err != nil {
+		return false
+	}
+	got, err := json.Marshal(current)
+	return err == nil && bytes.Equal(got, want)
+}
+
+// isCASMismatch reports whether Vault rejected a write because the
+// check-and-set version didn't match.
+func isCASMismatch(err error) bool {
+	var respErr *api.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, msg := range respErr.Errors {
+		if strings.Contains(msg, "check-and-set") {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadMetadata returns a secret's custom metadata (KV v2 only). It returns
+// nil if the secret doesn't exist or has no custom metadata.
+func (kv *KVClient) ReadMetadata(ctx context.Context, path string) (map[string]string, error) {
+	if kv.version != KVVersion2 {
+		return nil, fmt.Errorf("custom metadata requires KV version 2")
+	}
+
+	fullPath := kv.buildMetadataPath(path)
+
+	var secret *api.Secret
+	err := kv.client.withRetry(ctx, func() error {
+		var err error
+		secret, err = kv.client.Logical().ReadWithContext(ctx, fullPath)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading metadata at %s: %w", path, err)
+	}
+	if secret == nil {
+		return nil, nil
+	}
+
+	custom, ok := secret.Data["custom_metadata"].(map[string]interface{})
+	if !ok || len(custom) == 0 {
+		return nil, nil
+	}
+
+	metadata := make(map[string]string, len(custom))
+	for k, v := range custom {
+		metadata[k] = fmt.Sprintf("%v", v)
+	}
+	return metadata, nil
+}
+
+// WriteMetadata replaces a secret's custom metadata (KV v2 only).
+func (kv *KVClient) WriteMetadata(ctx context.Context, path string, metadata map[string]string) error {
+	if kv.version != KVVersion2 {
+		return fmt.Errorf("custom metadata requires KV version 2")
+	}
+
+	fullPath := kv.buildMetadataPath(path)
+	writeData := map[string]interface{}{
+		"custom_metadata": metadata,
+	}
+
+	err := kv.client.withRetry(ctx, func() error {
+		_, err := kv.client.Logical().WriteWithContext(ctx, fullPath, writeData)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("writing metadata at %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// SetDeleteVersionAfter sets a secret's delete_version_after, after which
+// Vault deletes each new version (KV v2 only). It applies to versions written
+// after it is set. Other metadata is left as is.
+func (kv *KVClient) SetDeleteVersionAfter(ctx context.Context, path string, after time.Duration) error {
+	if kv.version != KVVersion2 {
+		return fmt.Errorf("delete_version_after requires KV version 2")
+	}
+
+	fullPath := kv.buildMetadataPath(path)
+	writeData := map[string]interface{}{
+		"delete_version_after": after.String(),
+	}
+
+	err := kv.client.withRetry(ctx, func() error {
+		_, err := kv.client.Logical().WriteWithContext(ctx, fullPath, writeData)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("writing delete_version_after at %s: %w", path, err)
+	}
+
+	return nil
+}
+
 // Delete removes a secret from the KV store (soft delete for v2).
 func (kv *KVClient) Delete(ctx context.Context, path string) error {
 	fullPath := kv.buildDeletePath(path)
 
-	_, err := kv.client.Logical().Delete(fullPath)
+	err := kv.client.withRetry(ctx, func() error {
+		_, err := kv.client.Logical().DeleteWithContext(ctx, fullPath)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("deleting secret at %s: %w", path, err)
 	}
@@ -153,6 +483,27 @@ func (kv *KVClient) Delete(ctx context.Context, path string) error {
 	return nil
 }
 
+// DeleteVersions soft-deletes specific versions of a secret (KV v2 only).
+// Deleted versions can be restored with undelete.
+func (kv *KVClient) DeleteVersions(ctx context.Context, path string, versions []int) error {
+	if kv.version != KVVersion2 {
+		return fmt.Errorf("deleting versions requires KV version 2")
+	}
+
+	fullPath := fmt.Sprintf("%s/delete/%s", kv.mount, strings.TrimPrefix(path, "/"))
+	err := kv.client.withRetry(ctx, func() error {
+		_, err := kv.client.Logical().WriteWithContext(ctx, fullPath, map[string]interface{}{
+			"versions": versions,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("deleting versions of %s: %w", path, err)
+	}
+
+	return nil
+}
+
 // Destroy permanently removes a secret and all its versions (v2) or deletes (v1).
 // For KV v2, this deletes the metadata which removes all versions permanently.
 func (kv *KVClient) Destroy(ctx context.Context, path string) error {
@@ -167,7 +518,10 @@ func (kv *KVClient) Destroy(ctx context.Context, path string) error {
 		fullPath = fmt.Sprintf("%s/%s", kv.mount, path)
 	}
 
-	_, err := kv.client.Logical().Delete(fullPath)
+	err := kv.client.withRetry(ctx, func() error {
+		_, err := kv.client.Logical().DeleteWithContext(ctx, fullPath)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("destroying secret at %s: %w", path, err)
 	}
@@ -197,7 +551,10 @@ func (kv *KVClient) Patch(ctx context.Context, path string, data map[string]inte
 		"data": data,
 	}
 
-	_, err := kv.client.Logical().JSONMergePatch(ctx, fullPath, writeData)
+	err := kv.client.withRetry(ctx, func() error {
+		_, err := kv.client.Logical().JSONMergePatch(ctx, fullPath, writeData)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("patching secret at %s: %w", path, err)
 	}
@@ -220,6 +577,26 @@ func (kv *KVClient) buildWritePath(path string) string {
 	return kv.buildReadPath(path)
 }
 
+// buildMetadataPath constructs the KV v2 metadata path.
+func (kv *KVClient) buildMetadataPath(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	return fmt.Sprintf("%s/metadata/%s", kv.mount, path)
+}
+
+// buildListPath constructs the full path for listing. For KV v2, keys are
+// listed from the metadata endpoint. An empty path lists the mount's root.
+func (kv *KVClient) buildListPath(path string) string {
+	path = strings.Trim(path, "/")
+	base := kv.mount
+	if kv.version == KVVersion2 {
+		base += "/metadata"
+	}
+	if path == "" {
+		return base
+	}
+	return base + "/" + path
+}
+
 // buildDeletePath constructs the full path for deleting.
 func (kv *KVClient) buildDeletePath(path string) string {
 	path = strings.TrimPrefix(path, "/")
@@ -286,7 +663,12 @@ func (kv *KVClient) DestroyVersions(ctx context.Context, path string) error {
 		// For v2, use the destroy endpoint to destroy all versions
 		// First, get all versions from metadata
 		metadataPath := fmt.Sprintf("%s/metadata/%s", kv.mount, path)
-		metadata, err := kv.client.Logical().Read(metadataPath)
+		var metadata *api.Secret
+		err := kv.client.withRetry(ctx, func() error {
+			var err error
+			metadata, err = kv.client.Logical().ReadWithContext(ctx, metadataPath)
+			return err
+		})
 		if err != nil {
 			return fmt.Errorf("reading metadata: %w", err)
 		}
@@ -315,8 +697,11 @@ func (kv *KVClient) DestroyVersions(ctx context.Context, path string) error {
 
 		// Destroy all versions
 		destroyPath := fmt.Sprintf("%s/destroy/%s", kv.mount, path)
-		_, err = kv.client.Logical().Write(destroyPath, map[string]interface{}{
-			"versions": versions,
+		err = kv.client.withRetry(ctx, func() error {
+			_, err := kv.client.Logical().WriteWithContext(ctx, destroyPath, map[string]interface{}{
+				"versions": versions,
+			})
+			return err
 		})
 		if err != nil {
 			return fmt.Errorf("destroying versions: %w", err)
@@ -2,8 +2,15 @@ package vault
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/pavlenkoa/vault-secrets-generator/internal/config"
 )
@@ -25,6 +32,49 @@ func TestKVVersion_String(t *testing.T) {
 	}
 }
 
+func TestNewKVClient_ForcedVersionSkipsDetection(t *testing.T) {
+	var detected bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/sys/mounts") {
+			detected = true
+		}
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		forced   KVVersion
+		block    KVVersion
+		expected KVVersion
+	}{
+		{"forced version", KVVersion1, KVVersionAuto, KVVersion1},
+		{"block version overrides", KVVersion1, KVVersion2, KVVersion2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClientFromEnv(server.URL, "", "test-token", WithKVVersion(tt.forced))
+			if err != nil {
+				t.Fatalf("creating client: %v", err)
+			}
+
+			kv, err := NewKVClient(client, "secret", tt.block)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if kv.Version() != tt.expected {
+				t.Errorf("Version() = %d, want %d", kv.Version(), tt.expected)
+			}
+		})
+	}
+
+	if detected {
+		t.Error("expected sys/mounts not to be read when the version is forced")
+	}
+}
+
 func TestBuildReadPath_V1(t *testing.T) {
 	kv := &KVClient{
 		mount:   "secret",
@@ -71,6 +121,28 @@ func TestBuildReadPath_V2(t *testing.T) {
 	}
 }
 
+func TestBuildListPath(t *testing.T) {
+	tests := []struct {
+		version  KVVersion
+		path     string
+		expected string
+	}{
+		{KVVersion2, "myapp", "secret/metadata/myapp"},
+		{KVVersion2, "/myapp/", "secret/metadata/myapp"},
+		{KVVersion2, "", "secret/metadata"},
+		{KVVersion1, "myapp/config", "secret/myapp/config"},
+		{KVVersion1, "", "secret"},
+	}
+
+	for _, tt := range tests {
+		kv := &KVClient{mount: "secret", version: tt.version}
+		result := kv.buildListPath(tt.path)
+		if result != tt.expected {
+			t.Errorf("v%d buildListPath(%q) = %q, want %q", tt.version, tt.path, result, tt.expected)
+		}
+	}
+}
+
 func TestBuildDeletePath_V2(t *testing.T) {
 	kv := &KVClient{
 		mount:   "secret",
@@ -85,6 +157,133 @@ func TestBuildDeletePath_V2(t *testing.T) {
 	}
 }
 
+func TestKVClient_WriteCAS(t *testing.T) {
+	var gotCAS []interface{}
+	kv := newTestKVClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"data":{"data":{"key":"value"},"metadata":{"version":7}}}`))
+			return
+		}
+
+		var body struct {
+			Options map[string]interface{} `json:"options"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotCAS = append(gotCAS, body.Options["cas"])
+
+		if body.Options["cas"] != float64(7) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"version":8}}`))
+	}))
+
+	ctx := context.Background()
+	_, version, err := kv.ReadVersion(ctx, "myapp")
+	if err != nil {
+		t.Fatalf("unexpected read error: %v", err)
+	}
+	if version != 7 {
+		t.Fatalf("ReadVersion() version = %d, want 7", version)
+	}
+
+	if err := kv.WriteCAS(ctx, "myapp", map[string]interface{}{"key": "new"}, version); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	err = kv.WriteCAS(ctx, "myapp", map[string]interface{}{"key": "new"}, 6)
+	if !errors.Is(err, ErrCASMismatch) {
+		t.Errorf("expected ErrCASMismatch for stale version, got: %v", err)
+	}
+
+	if len(gotCAS) != 2 {
+		t.Errorf("expected 2 writes without retrying the conflict, got %d", len(gotCAS))
+	}
+}
+
+func TestKVClient_WriteCASRetryFindsOwnWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  string
+		wantErr bool
+	}{
+		{"own write", `{"key":"new"}`, false},
+		{"other write", `{"key":"other"}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var writes atomic.Int32
+			kv := newTestKVClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if r.Method == http.MethodGet {
+					_, _ = w.Write([]byte(`{"data":{"data":` + tt.stored + `,"metadata":{"version":8}}}`))
+					return
+				}
+				// The first write lands but its response is lost; the retry
+				// then conflicts with it
+				if writes.Add(1) == 1 {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+			}), WithRetry(2, time.Millisecond))
+
+			err := kv.WriteCAS(context.Background(), "myapp", map[string]interface{}{"key": "new"}, 7)
+			if tt.wantErr {
+				if !errors.Is(err, ErrCASMismatch) {
+					t.Errorf("expected ErrCASMismatch, got: %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestKVClient_ReadAtVersion(t *testing.T) {
+	var gotPath, gotQuery string
+	kv := newTestKVClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("version") == "2" {
+			// A deleted version has metadata but no data
+			_, _ = w.Write([]byte(`{"data":{"data":null,"metadata":{"version":2,"deletion_time":"2024-01-01T00:00:00Z"}}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"api_key":"old"},"metadata":{"version":3}}}`))
+	}))
+
+	ctx := context.Background()
+	data, err := kv.ReadAtVersion(ctx, "shared/api", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotPath != "/v1/secret/data/shared/api" || gotQuery != "version=3" {
+		t.Errorf("read %s?%s, want /v1/secret/data/shared/api?version=3", gotPath, gotQuery)
+	}
+	if data["api_key"] != "old" {
+		t.Errorf("unexpected data: %v", data)
+	}
+
+	data, err = kv.ReadAtVersion(ctx, "shared/api", 2)
+	if err != nil || data != nil {
+		t.Errorf("expected no data for a deleted version, got %v, %v", data, err)
+	}
+
+	if _, err := kv.ReadAtVersion(ctx, "shared/api", 0); err == nil {
+		t.Error("expected an error for version 0")
+	}
+
+	v1 := &KVClient{client: kv.client, mount: "kv", version: KVVersion1}
+	if _, err := v1.ReadAtVersion(ctx, "shared/api", 3); err == nil || !strings.Contains(err.Error(), "KV v1") {
+		t.Errorf("expected a KV v1 error, got %v", err)
+	}
+}
+
 // Integration tests - require a running Vault server
 // Set VAULT_ADDR and VAULT_TOKEN to run these
 
@@ -245,3 +444,37 @@ func TestIntegration_HealthCheck(t *testing.T) {
 		t.Errorf("health check failed: %v", err)
 	}
 }
+
+func TestIntegration_KVWriteCAS(t *testing.T) {
+	client := skipIfNoVault(t)
+	ctx := context.Background()
+
+	kv, err := NewKVClient(client, "kv", KVVersion2)
+	if err != nil {
+		t.Fatalf("failed to create KV client: %v", err)
+	}
+
+	testPath := "vsg-test/cas-test"
+	//nolint:errcheck // Best effort cleanup
+	defer kv.Destroy(ctx, testPath)
+
+	// Version 0 only succeeds while the secret doesn't exist
+	if err := kv.WriteCAS(ctx, testPath, map[string]interface{}{"key": "v1"}, 0); err != nil {
+		t.Fatalf("failed to create secret with cas=0: %v", err)
+	}
+
+	_, version, err := kv.ReadVersion(ctx, testPath)
+	if err != nil {
+		t.Fatalf("failed to read secret: %v", err)
+	}
+
+	// A second writer updates the secret after our read
+	if err := kv.Write(ctx, testPath, map[string]interface{}{"key": "other"}); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+
+	err = kv.WriteCAS(ctx, testPath, map[string]interface{}{"key": "v2"}, version)
+	if !errors.Is(err, ErrCASMismatch) {
+		t.Errorf("expected ErrCASMismatch, got: %v", err)
+	}
+}